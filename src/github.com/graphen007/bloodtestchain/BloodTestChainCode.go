@@ -19,32 +19,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/graphen007/bloodtestchain/btevents"
+	"github.com/graphen007/identitychain/identity"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"runtime"
-	"strconv"
-	"time"
+	"strings"
 )
 
 var logger = shim.NewLogger("BTChaincode")
 
 //==============================================================================================================================
-// Participant types - Each participant type is mapped to an integer which we will use to compare to the value stored in a
-//						 user's eCert
+// Participant types - Enrolled in the identity chaincode, see identity.go
 //==============================================================================================================================
-const ADMIN = "admin"       // 0
-const DOCTOR = "doctor"     // 1
-const CLIENT = "client"     // 2
-const HOSPITAL = "hospital" // 3
-const LAB = "lab"           // 4
-
-//==============================================================================================================================
-// Hardcoded access tokens
-//==============================================================================================================================
-const ADMIN_TOKEN = "pNAQvsgTSz"
-const DOCTOR_TOKEN = "9Hk5e3rdR9"
-const CLIENT_TOKEN = "ERE4zwMnao"
-const HOSPITAL_TOKEN = "XpK9cGH22x"
-const LAB_TOKEN = "TdFeAzGlrI"
+const ADMIN = identity.ADMIN       // 0
+const DOCTOR = identity.DOCTOR     // 1
+const CLIENT = identity.CLIENT     // 2
+const HOSPITAL = identity.HOSPITAL // 3
+const LAB = identity.LAB           // 4
+const COURIER = identity.COURIER   // 5
 
 // SimpleChaincode example simple Chaincode implementation
 type SimpleChaincode struct {
@@ -54,42 +46,44 @@ type SimpleChaincode struct {
 var bloodTestIndex = "_bloodTestIndex"
 var accountIndex = "_accountIndex"
 
+//==============================================================================================================================
+// bloodTest - Name, CPR and Result hold ciphertext, see patientcrypto. Keys maps certificate fingerprints to wrapped data keys.
+//			   Results holds the structured result, Result is the free text result of tests from before results.go.
+//			   SchemaVersion is set on every write, see schema.go
+//==============================================================================================================================
 type bloodTest struct {
-	TimeStampDoctor   string `json:"timeStampDoctor"`
-	TimeStampHospital string `json:"timeStampHospital"`
-	TimeStampLab      string `json:"timeStampLab"`
-	TimeStampAnalyse  string `json:"timeStampAnalyse"`
-	TimeStampResult   string `json:"timeStampResult"`
-	Name              string `json:"name"`
-	CPR               string `json:"CPR"`
-	Doctor            string `json:"doctor"`
-	Hospital          string `json:"hospital"`
-	Lab               string `json:"lab"`
-	Status            string `json:"status"`
-	Result            string `json:"result"`
-	BloodTestID       string `json:"bloodTestID"`
+	TimeStampDoctor   string            `json:"timeStampDoctor"`
+	TimeStampHospital string            `json:"timeStampHospital"`
+	TimeStampLab      string            `json:"timeStampLab"`
+	TimeStampAnalyse  string            `json:"timeStampAnalyse"`
+	TimeStampResult   string            `json:"timeStampResult"`
+	Name              string            `json:"name"`
+	CPR               string            `json:"CPR"`
+	CPRHash           string            `json:"CPRHash"`
+	Doctor            string            `json:"doctor"`
+	Hospital          string            `json:"hospital"`
+	Lab               string            `json:"lab"`
+	Status            string            `json:"status"`
+	Result            string            `json:"result"`
+	Results           []analyte         `json:"results,omitempty"`
+	Samples           []string          `json:"samples,omitempty"`
+	Panel             []string          `json:"panel,omitempty"`
+	BloodTestID       string            `json:"bloodTestID"`
+	OrderedBy         string            `json:"orderedBy"`
+	Keys              map[string]string `json:"keys"`
+	SchemaVersion     int               `json:"schemaVersion"`
 }
 
 //==============================================================================================================================
-// account - Struct for storing the JSON of a account
+// account - Struct for storing the JSON of a account. The password hash is stored separately, see credentials.go
 //==============================================================================================================================
 type account struct {
-	TypeOfUser string `json:"typeOfUser"`
-	Username   string `json:"username"`
-	Password   string `json:"password"`
+	TypeOfUser    string `json:"typeOfUser"`
+	Username      string `json:"username"`
+	Fingerprint   string `json:"fingerprint,omitempty"`
+	SchemaVersion int    `json:"schemaVersion"`
 }
 
-//==============================================================================================================================
-// Name for the key/value that will store a list of all known permissionholders
-//==============================================================================================================================
-const ADMIN_INDEX = "adminIndex"
-const DOCTOR_INDEX = "doctorIndex"
-const CLIENT_INDEX = "clientIndex"
-const HOSPITAL_INDEX = "hospitalIndex"
-const LAB_INDEX = "labIndex"
-const COLUMN_CERTS = "eCerts"
-const COLUMN_VALUE = "value"
-
 // ============================================================================================================================
 // Main
 // ============================================================================================================================
@@ -107,12 +101,14 @@ func main() {
 // ============================================================================================================================
 // Init
 // ============================================================================================================================
-func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	// *shim.ChaincodeStub 0.5
-	// shim.ChaincodeStubInterface 0.6
+func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) ([]byte, error) {
 
-	// Create tables
-	t.CreateTables(stub)
+	// Roles are looked up in the identity chaincode named by the first argument
+	_, args := stub.GetFunctionAndParameters()
+	err := t.configureIdentity(stub, args)
+	if err != nil {
+		return nil, err
+	}
 
 	return nil, nil
 }
@@ -120,61 +116,15 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string
 // ============================================================================================================================
 // Invoke - Our entry point to invoke a chaincode function
 // ============================================================================================================================
-func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	fmt.Println("invoke is running " + function)
-
-	// Handle different functions
-	if function == "init" {
-		return t.Init(stub, "init", args)
-	} else if function == "write" {
-		return t.write(stub, args)
-	} else if function == "init_bloodtest" {
-		return t.init_bloodtest(stub, args)
-	} else if function == "change_status" {
-		return t.change_status(stub, args)
-	} else if function == "change_doctor" {
-		return t.change_doctor(stub, args)
-	} else if function == "change_hospital" {
-		return t.change_hospital(stub, args)
-	} else if function == "change_result" {
-		return t.change_result(stub, args)
-	} else if function == "create_user" {
-		return t.create_user(stub, args)
-	} else if function == "change_lab" {
-		return t.change_lab(stub, args)
-	}
-	fmt.Println("invoke did not find func: " + function)
-
-	return nil, errors.New("Received unknown function invocation")
+func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	return bloodTestRoutes.dispatch(t, stub, modeWrite)
 }
 
 // ============================================================================================================================
 // Query - Our entry point for queries
 // ============================================================================================================================
-func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	fmt.Println("query is running " + function)
-
-	// Handle different functions
-	if function == "read" { //read a variable
-		return t.read(stub, args)
-	} else if function == "read_list" {
-		return t.read_list(stub, args)
-	} else if function == "client_read" {
-		return t.client_read(stub, args)
-	} else if function == "doctor_read" {
-		return t.doctor_read(stub, args)
-	} else if function == "hospital_read" {
-		return t.hospital_read(stub, args)
-	} else if function == "lab_read" {
-		return t.lab_read(stub, args)
-	} else if function == "get_user" {
-		return t.get_user(stub, args)
-	} else if function == "get_enrollment_cert" {
-		return t.get_enrollment_cert(stub, args)
-	}
-
-	fmt.Println("query did not find func: " + function)
-	return nil, errors.New("Received unknown function query")
+func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	return bloodTestRoutes.dispatch(t, stub, modeRead)
 }
 
 // ============================================================================================================================
@@ -185,12 +135,11 @@ func (t *SimpleChaincode) write(stub shim.ChaincodeStubInterface, args []string)
 	var err error
 	fmt.Println("running write()")
 
-	if len(args) != 2 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
-	}
-
 	name = args[0]
 	value = args[1]
+	if isProtectedKey(name) {
+		return nil, errors.New("{\"Error\":\"Access denied for " + name + "\"}")
+	}
 	err = stub.PutState(name, []byte(value)) //write the variable into the chaincode state
 	if err != nil {
 		return nil, err
@@ -205,200 +154,115 @@ func (t *SimpleChaincode) read(stub shim.ChaincodeStubInterface, args []string)
 	var name, jsonResp string
 	var err error
 
-	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting name of the var to query")
-	}
-
 	name = args[0]
+	if isProtectedKey(name) {
+		return nil, errors.New("{\"Error\":\"Access denied for " + name + "\"}")
+	}
 	valAsbytes, err := stub.GetState(name)
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + name + "\"}"
 		return nil, errors.New(jsonResp)
 	}
 
-	return valAsbytes, nil
-}
-
-// ============================================================================================================================
-// Client Read
-// ============================================================================================================================
-func (t *SimpleChaincode) client_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-
-	if len(args) != 1 {
-		return nil, errors.New("Gimme more arguments, 1 to be exact")
+	// Blood tests are only returned with consent
+	if valAsbytes == nil {
+		return nil, nil
 	}
-	bloodTestList, err := stub.GetState(bloodTestIndex)
+	readable, err := t.readableBloodTest(stub, name, valAsbytes)
 	if err != nil {
-		return nil, errors.New("Failed to get bloodList")
+		return nil, err
 	}
-
-	var bloodInd []string
-
-	err = json.Unmarshal(bloodTestList, &bloodInd)
-	if err != nil {
-		fmt.Println("you dun goofed", err)
+	if readable == nil {
+		return accessDenied(stub, name)
 	}
 
-	var bloodAsBytes []byte
-	var finalList []byte = []byte(`"returnedObjects":[`)
-	res := bloodTest{}
-	for i := range bloodInd {
-
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.CPR == args[0] {
-
-			finalList = append(finalList, bloodAsBytes...)
-			if i < (len(bloodInd) - 1) {
-				finalList = append(finalList, []byte(`,`)...)
-			}
-		}
-	}
-	finalList = append(finalList, []byte(`]`)...)
+	return readable, nil
+}
 
-	return finalList, nil
+// ============================================================================================================================
+// Client Read - Tests of a patient, looked up by the keyed hash of the CPR
+// ============================================================================================================================
+func (t *SimpleChaincode) client_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.readByIndex(stub, IDX_CPR, args)
 }
 
 // ============================================================================================================================
 // Doctor Read
 // ============================================================================================================================
 func (t *SimpleChaincode) doctor_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-
-	if len(args) != 1 {
-		return nil, errors.New("Gimme more arguments, 1 to be exact")
-	}
-	bloodTestList, err := stub.GetState(bloodTestIndex)
-	if err != nil {
-		return nil, errors.New("Failed to get bloodList")
-	}
-	var bloodInd []string
-
-	err = json.Unmarshal(bloodTestList, &bloodInd)
-	if err != nil {
-		fmt.Println("you dun goofed")
-	}
-
-	var bloodAsBytes []byte
-	var finalList []byte = []byte(`"returnedObjects":[`)
-	res := bloodTest{}
-	for i := range bloodInd {
-
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.Doctor == args[0] {
-
-			finalList = append(finalList, bloodAsBytes...)
-			if i < (len(bloodInd) - 1) {
-				finalList = append(finalList, []byte(`,`)...)
-			}
-		}
-	}
-	finalList = append(finalList, []byte(`]`)...)
-
-	return finalList, nil
+	return t.readByIndex(stub, IDX_DOCTOR, args)
 }
 
 // ============================================================================================================================
 // Hospital Read
 // ============================================================================================================================
 func (t *SimpleChaincode) hospital_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-
-	if len(args) != 1 {
-		return nil, errors.New("Gimme more arguments, 1 to be exact")
-	}
-	bloodTestList, err := stub.GetState(bloodTestIndex)
-	if err != nil {
-		return nil, errors.New("Failed to get bloodList")
-	}
-	var bloodInd []string
-
-	err = json.Unmarshal(bloodTestList, &bloodInd)
-	if err != nil {
-		fmt.Println("you dun goofed")
-	}
-
-	var bloodAsBytes []byte
-	var finalList []byte = []byte(`"returnedObjects":[`)
-	res := bloodTest{}
-	for i := range bloodInd {
-
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.Hospital == args[0] {
-
-			finalList = append(finalList, bloodAsBytes...)
-
-			if i < (len(bloodInd) - 1) {
-				finalList = append(finalList, []byte(`,`)...)
-			}
-		}
-	}
-	finalList = append(finalList, []byte(`]`)...)
-
-	return finalList, nil
+	return t.readByIndex(stub, IDX_HOSPITAL, args)
 }
 
 // ============================================================================================================================
-// lab Read !! HAS NOT BEEN ADDED YET AND IS NOT FULLY FUNCTIONAL!!!
+// Lab Read
 // ============================================================================================================================
 func (t *SimpleChaincode) lab_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.readByIndex(stub, IDX_LAB, args)
+}
 
-	if len(args) != 1 {
-		return nil, errors.New("Gimme more arguments, 1 to be exact")
-	}
-	bloodTestList, err := stub.GetState(bloodTestIndex)
-	if err != nil {
-		return nil, errors.New("Failed to get bloodList")
-	}
-	var bloodInd []string
-
-	err = json.Unmarshal(bloodTestList, &bloodInd)
-	if err != nil {
-		fmt.Println("you dun goofed")
-	}
-
-	var bloodAsBytes []byte
-	var finalList []byte = []byte(`"returnedObjects":[`)
-	res := bloodTest{}
-	for i := range bloodInd {
-
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.Lab == args[0] {
-
-			finalList = append(finalList, bloodAsBytes...)
-			if i < (len(bloodInd) - 1) {
-				finalList = append(finalList, []byte(`,`)...)
-			}
-		}
-	}
-	finalList = append(finalList, []byte(`]`)...)
-
-	return finalList, nil
+// ============================================================================================================================
+// Status Read
+// ============================================================================================================================
+func (t *SimpleChaincode) status_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.readByIndex(stub, IDX_STATUS, args)
 }
 
 // ============================================================================================================================
-// Read list
+// Read list - Reads the tests named by a JSON list of IDs. Keys that do not hold a test are left out, a test the caller
+// may not read is replaced by the same access denied response read gives
 // ============================================================================================================================
 func (t *SimpleChaincode) read_list(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	if len(args) != 1 {
-		return nil, errors.New("Gimme more arguments, 1 to be exact")
+	if isProtectedKey(args[0]) {
+		return nil, errors.New("{\"Error\":\"Access denied for " + args[0] + "\"}")
 	}
 	bloodTestList, err := stub.GetState(args[0])
 	if err != nil {
 		return nil, errors.New("Failed to get intList")
 	}
+	if bloodTestList == nil {
+		return nil, nil
+	}
 	var bloodInd []string
 
 	err = json.Unmarshal(bloodTestList, &bloodInd)
 	if err != nil {
-		fmt.Println("you dun goofed")
+		return nil, errors.New("Failed to unmarshal list " + args[0])
+	}
+	for i := range bloodInd {
+		if isProtectedKey(bloodInd[i]) {
+			return nil, errors.New("{\"Error\":\"Access denied for " + bloodInd[i] + "\"}")
+		}
 	}
+
 	var finalList []byte
 	var bloodAsBytes []byte
 	for i := range bloodInd {
 
 		bloodAsBytes, err = stub.GetState(bloodInd[i])
+		if err != nil || bloodAsBytes == nil {
+			continue
+		}
+		res := bloodTest{}
+		if json.Unmarshal(bloodAsBytes, &res) != nil || res.BloodTestID != bloodInd[i] {
+			continue
+		}
+		granted, err := t.checkAccess(stub, &res)
+		if err != nil {
+			return nil, err
+		}
+		if !granted {
+			bloodAsBytes, err = accessDenied(stub, bloodInd[i])
+			if err != nil {
+				return nil, err
+			}
+		}
 		finalList = append(finalList, bloodAsBytes...)
 
 	}
@@ -418,29 +282,33 @@ func (t *SimpleChaincode) change_status(stub shim.ChaincodeStubInterface, args [
 	   "bloodTestID", "Status"
 	   -------------------------------------------------------
 	*/
-	var err error
 
 	fmt.Println("- start set status")
 	fmt.Println(args[0] + " - " + args[1])
-	marbleAsBytes, err := stub.GetState(args[0])
+	old, err := t.getBloodTest(stub, args[0])
 	if err != nil {
-		return nil, errors.New("Failed to get thing")
+		return nil, err
 	}
-	res := bloodTest{}
-	json.Unmarshal(marbleAsBytes, &res)
-	fmt.Println(res)
+	res := *old
 
-	// Change the user
-	res.Status = args[1]
-	if args[1] == "Analysing" {
-		t := time.Now()
-		t.Format("20060102150405")
-		res.TimeStampAnalyse = t.String()
+	// The progress of a test with samples follows its samples
+	if len(res.Samples) > 0 && derivedStatuses[args[1]] {
+		return nil, errors.New("Status " + args[1] + " is derived from the samples of " + args[0])
+	}
 
+	// Only legal transitions by the matching role are accepted
+	err = t.applyTransition(stub, &res, args[1])
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
 	}
-	fmt.Println(res)
-	jsonAsBytes, _ := json.Marshal(res)
-	err = stub.PutState(args[0], jsonAsBytes)
+
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.emitEvent(stub, statusEvent(res.Status), old, &res)
 	if err != nil {
 		return nil, err
 	}
@@ -458,43 +326,32 @@ func (t *SimpleChaincode) change_doctor(stub shim.ChaincodeStubInterface, args [
 	   Our model looks like
 	   -------------------------------------------------------
 	      0              1
-	   "bloodTestID", "Status"
+	   "bloodTestID", "Doctor"
 	   -------------------------------------------------------
+	   Doctor is the fingerprint of a doctor on the staff of the hospital of the test
 	*/
 
 	fmt.Println("changing doctor")
-	bloodTestList, err := stub.GetState(bloodTestIndex)
+	old, err := t.getBloodTest(stub, args[0])
 	if err != nil {
-		return nil, errors.New("Failed to get intList")
+		return nil, err
 	}
-	fmt.Println("creating list")
-	var bloodInd []string
+	res := *old
 
-	fmt.Println("Unmarshaling doctor")
-	err = json.Unmarshal(bloodTestList, &bloodInd)
+	err = t.requireDoctorOf(stub, res.Hospital, args[1])
 	if err != nil {
-		fmt.Println("you dun goofed")
+		return nil, err
 	}
-	fmt.Println("assigning to res")
-	res := bloodTest{}
-	var bloodAsBytes []byte
-	fmt.Println("running through list")
-	for i := range bloodInd {
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.BloodTestID == args[0] {
-			res.Doctor = args[1]
-			t := time.Now()
-			t.Format("20060102150405")
-			res.TimeStampDoctor = t.String()
-			jsonAsBytes, _ := json.Marshal(res)
-			err = stub.PutState(args[0], jsonAsBytes)
-			if err != nil {
-				return nil, err
-			}
-		}
+
+	// TimeStampDoctor stays the time of the order, SLAs are measured from it
+	res.Doctor = args[1]
+
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+
+	return nil, t.emitEvent(stub, btevents.DoctorAssigned, old, &res)
 }
 
 // ============================================================================================================================
@@ -511,38 +368,33 @@ func (t *SimpleChaincode) change_lab(stub shim.ChaincodeStubInterface, args []st
 	*/
 
 	fmt.Println("changing lab")
-	bloodTestList, err := stub.GetState(bloodTestIndex)
+	old, err := t.getBloodTest(stub, args[0])
 	if err != nil {
-		return nil, errors.New("Failed to get intList")
+		return nil, err
 	}
-	fmt.Println("creating list")
-	var bloodInd []string
+	res := *old
 
-	fmt.Println("Unmarshaling lab")
-	err = json.Unmarshal(bloodTestList, &bloodInd)
+	// The hospital of the order picks a lab that can analyse the requested panel
+	err = t.requireCallerMember(stub, res.Hospital)
 	if err != nil {
-		fmt.Println("you dun goofed")
+		return nil, err
 	}
-	fmt.Println("assigning to res")
-	res := bloodTest{}
-	var bloodAsBytes []byte
-	fmt.Println("running through list")
-	for i := range bloodInd {
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.BloodTestID == args[0] {
-			res.Lab = args[1]
-			t := time.Now()
-			t.Format("20060102150405")
-			res.TimeStampLab = t.String()
-			jsonAsBytes, _ := json.Marshal(res)
-			err = stub.PutState(args[0], jsonAsBytes)
-			if err != nil {
-				return nil, err
-			}
-		}
+	lab, err := t.requireOrganisation(stub, args[1], LAB)
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	err = checkCatalogue(lab, res.Panel)
+	if err != nil {
+		return nil, err
+	}
+	res.Lab = args[1]
+
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.emitEvent(stub, btevents.LabAssigned, old, &res)
 }
 
 // ============================================================================================================================
@@ -557,37 +409,31 @@ func (t *SimpleChaincode) change_hospital(stub shim.ChaincodeStubInterface, args
 	   "bloodTestID", "Hospital"
 	   -------------------------------------------------------
 	*/
-	hospital := args[1]
-	fmt.Println("it might actually work now")
-	bloodTestList, err := stub.GetState(bloodTestIndex)
+
+	fmt.Println("changing hospital")
+	old, err := t.getBloodTest(stub, args[0])
 	if err != nil {
-		return nil, errors.New("Failed to get intList")
+		return nil, err
 	}
-	var bloodInd []string
+	res := *old
 
-	err = json.Unmarshal(bloodTestList, &bloodInd)
+	// The doctor moves the order to a hospital they work at
+	_, err = t.requireOrganisation(stub, args[1], HOSPITAL)
 	if err != nil {
-		fmt.Println("you dun goofed")
+		return nil, err
 	}
-	res := bloodTest{}
-	var bloodAsBytes []byte
-	for i := range bloodInd {
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.BloodTestID == args[0] {
-			fmt.Println("found it")
-			res.Hospital = hospital
-			t := time.Now()
-			t.Format("20060102150405")
-			res.TimeStampHospital = t.String()
-			jsonAsBytes, _ := json.Marshal(res)
-			err = stub.PutState(args[0], jsonAsBytes)
-			if err != nil {
-				return nil, err
-			}
-		}
+	err = t.requireCallerMember(stub, args[1])
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	res.Hospital = args[1]
+
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.emitEvent(stub, btevents.HospitalAssigned, old, &res)
 }
 
 // ============================================================================================================================
@@ -598,37 +444,57 @@ func (t *SimpleChaincode) change_result(stub shim.ChaincodeStubInterface, args [
 	   Our model looks like
 	   -------------------------------------------------------
 	      0              1
-	   "bloodTestID", "Status"
+	   "bloodTestID", "Results"
 	   -------------------------------------------------------
+	   Results is a JSON array of analytes, see results.go
 	*/
 
-	bloodTestList, err := stub.GetState(bloodTestIndex)
+	old, err := t.getBloodTest(stub, args[0])
 	if err != nil {
-		return nil, errors.New("Failed to get intList")
+		return nil, err
 	}
-	var bloodInd []string
+	res := *old
 
-	err = json.Unmarshal(bloodTestList, &bloodInd)
+	// Only the lab of the test records a result, while it has the test and before it is released
+	err = t.requireCallerMember(stub, res.Lab)
 	if err != nil {
-		fmt.Println("you dun goofed")
+		return nil, err
 	}
-	res := bloodTest{}
-	var bloodAsBytes []byte
-	for i := range bloodInd {
-		bloodAsBytes, err = stub.GetState(bloodInd[i])
-		json.Unmarshal(bloodAsBytes, &res)
-		if res.BloodTestID == args[0] {
-			res.Result = args[1]
-			t := time.Now()
-			t.Format("20060102150405")
-			res.TimeStampResult = t.String()
-			jsonAsBytes, _ := json.Marshal(res)
-			err = stub.PutState(args[0], jsonAsBytes)
-			if err != nil {
-				return nil, err
-			}
+	if res.Status != STATUS_ASSIGNED && res.Status != STATUS_ANALYSED {
+		return nil, errors.New("A result can only be recorded for a test that is " + STATUS_ASSIGNED + " or " + STATUS_ANALYSED)
+	}
+
+	res.Results, err = parseResults(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// The first result is billed to the hospital at the price list of the lab, corrections are not billed again
+	var unpriced []string
+	if !hasResult(old) {
+		unpriced, err = t.accrueCharges(stub, &res)
+		if err != nil {
+			return nil, err
 		}
 	}
+
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.emitEvent(stub, btevents.ResultRecorded, old, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	// Codes without a price are reported to the lab, which can price them and settle them out of band
+	if len(unpriced) > 0 {
+		fmt.Println("Unpriced codes of " + res.BloodTestID + ": " + strings.Join(unpriced, ", "))
+		return json.Marshal(struct {
+			Unpriced []string `json:"unpriced"`
+		}{unpriced})
+	}
 	return nil, nil
 }
 
@@ -640,15 +506,15 @@ func (t *SimpleChaincode) init_bloodtest(stub shim.ChaincodeStubInterface, args
 	   Our model looks like
 	   -------------------------------------------------------
 	   -------------------------------------------------------
-	         0         1      2        3        4	       5	    6	       7
-	   "timestamp", "name", "CPR", "doctor", "hospital" "status" "result" "bloodTestID
+	         0         1      2        3        4	       5	    6	       7	      8	         9       10
+	   "timestamp", "name", "CPR", "doctor", "hospital" "status" "result" "bloodTestID "CPRHash" "keys" ["panel"]
 	   -------------------------------------------------------
+	   name, CPR and result are encrypted by the client, keys is a JSON object of fingerprint -> wrapped data key,
+	   panel is an optional JSON array of the requested LOINC codes. timestamp must be empty, orders are dated by the
+	   transaction. doctor is the fingerprint of a doctor on the staff of hospital, empty for the caller
 	*/
 
 	fmt.Println("Creating the bloodTest")
-	if len(args) != 8 {
-		return nil, errors.New("Gimme more arguments, 8 to be exact, User and number pliz")
-	}
 
 	timeStamp := args[0]
 	name := args[1]
@@ -658,40 +524,107 @@ func (t *SimpleChaincode) init_bloodtest(stub shim.ChaincodeStubInterface, args
 	status := args[5]
 	result := args[6]
 	bloodTestID := args[7]
+	cprHash := args[8]
+
+	if isReservedName(bloodTestID) {
+		return nil, errors.New("Blood test ID " + bloodTestID + " is reserved")
+	}
+
+	// SLAs are measured from the order, so the caller can not date it
+	if timeStamp != "" {
+		return nil, errors.New("A new blood test is dated by the transaction, the timestamp must be empty")
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every test enters the lifecycle as ordered
+	if status != "" && status != STATUS_ORDERED {
+		return nil, errors.New("A new blood test must have status " + STATUS_ORDERED)
+	}
+	status = STATUS_ORDERED
 
 	bloodAsBytes, err := stub.GetState(bloodTestID)
 	if err != nil {
 		return nil, errors.New("blood")
 	}
-	res := bloodTest{}
-	json.Unmarshal(bloodAsBytes, &res)
-	if res.BloodTestID == bloodTestID {
-
+	if bloodAsBytes != nil {
 		return nil, errors.New("This blood test already exists")
 	}
 
-	json.Unmarshal(bloodAsBytes, &res)
-
-	str := []byte(`{"timeStampDoctor": "` + timeStamp + `","timeStampHospital": "` + `null` + `","timeStampLab": "` + `null` + `","timeStampAnalyse": "` + `null` + `","timeStampResult": "` + `null` + `","name": "` + name + `","CPR": "` + CPR + `","doctor": "` + doctor + `","hospital": "` + hospital + `","lab": "` + `unassigned` + `","status": "` + status + `","result": "` + result + `","bloodTestID": "` + bloodTestID + `"}`) //build the Json element
+	// Patient data is only accepted encrypted
+	err = validateEncryptedFields(name, CPR, cprHash, result)
+	if err != nil {
+		return nil, err
+	}
 
-	err = stub.PutState(bloodTestID, str)
+	orderedBy, err := callerFingerprint(stub)
 	if err != nil {
 		return nil, err
 	}
 
-	//get the blood index
-	bloodAsBytes, err = stub.GetState(bloodTestIndex)
+	keys, err := parseWrappedKeys(args[9])
 	if err != nil {
-		return nil, errors.New("you fucked up")
+		return nil, err
 	}
 
-	var bloodInd []string
-	json.Unmarshal(bloodAsBytes, &bloodInd)
+	panel := []string{}
+	if len(args) > 10 {
+		panel, err = parsePanel(args[10])
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	//append it to the list
-	bloodInd = append(bloodInd, bloodTestID)
-	jsonAsBytes, _ := json.Marshal(bloodInd)
-	err = stub.PutState(bloodTestIndex, jsonAsBytes)
+	// The ordering doctor must work at the hospital of the order
+	_, err = t.requireOrganisation(stub, hospital, HOSPITAL)
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireCallerMember(stub, hospital)
+	if err != nil {
+		return nil, err
+	}
+	if doctor == "" {
+		doctor = orderedBy
+	}
+	err = t.requireDoctorOf(stub, hospital, doctor)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := keys[orderedBy]; !ok {
+		return nil, errors.New("Keys must include a wrapped data key for the ordering doctor")
+	}
+
+	res := bloodTest{
+		TimeStampDoctor:   timeStamp,
+		TimeStampHospital: "null",
+		TimeStampLab:      "null",
+		TimeStampAnalyse:  "null",
+		TimeStampResult:   "null",
+		Name:              name,
+		CPR:               CPR,
+		CPRHash:           cprHash,
+		Doctor:            doctor,
+		Hospital:          hospital,
+		Lab:               "unassigned",
+		Status:            status,
+		Result:            result,
+		BloodTestID:       bloodTestID,
+		OrderedBy:         orderedBy,
+		Keys:              keys,
+		Panel:             panel,
+	}
+	err = t.saveBloodTest(stub, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.emitEvent(stub, btevents.Created, nil, &res)
+	if err != nil {
+		return nil, err
+	}
 
 	fmt.Println("Ended of creation")
 
@@ -700,149 +633,70 @@ func (t *SimpleChaincode) init_bloodtest(stub shim.ChaincodeStubInterface, args
 
 // ============================================================================================================================
 // Create User - user account stuff, login, create user, etc.
+// The caller must already be enrolled by an admin in the role of the account. The account is bound to the certificate of
+// the caller, there is no password
 // ============================================================================================================================
 func (t *SimpleChaincode) create_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	/*
 	   Our model looks like
 	   -------------------------------------------------------
-	      0  	     1		   2	       3	     4
-	   "ecert"	"typeOfUser"   "username"  "password"  "accesstoken"
+	        0		     1
+	   "typeOfUser"   "username"
 	   -------------------------------------------------------
 	*/
 
 	fmt.Println("Creating the account")
-	if len(args) != 5 {
-		return nil, errors.New("Gimme more arguments, 5 to be exact, User and number pliz")
-	}
 
 	// Create vars
-	ecert := args[0]
-	typeOfUser := args[1]
-	username := args[2]
-	password := args[3]
+	typeOfUser := args[0]
+	username := args[1]
 
-	accountAsBytes, err := stub.GetState(username)
-	if err != nil {
-		return nil, errors.New("Error getting state for username")
-	}
-	res := account{}
-	fmt.Println("checking if account exists")
-	json.Unmarshal(accountAsBytes, &res)
-	if res.Username == username {
-		fmt.Println("This account already exists")
-		return nil, errors.New("This account already exists")
+	if !identity.ValidRole(typeOfUser) {
+		fmt.Println("User not supported. User has not been created!")
+		return nil, errors.New("User not supported. User has not been created!")
 	}
 
-	// Check access token
-	fmt.Println("getting AccesToken")
-	accessCode, err := t.CheckToken(args[4])
-	if err != nil {
-		fmt.Println("Failed: during token approval")
-		return nil, errors.New("Failed: during token approval")
+	// A username is not a key, but names that are reserved for other records are refused all the same
+	if isReservedName(username) {
+		return nil, errors.New("Username " + username + " is reserved")
 	}
 
-	if len(ecert) == 0 {
-		fmt.Println("Caller has no eCert!")
-		return nil, errors.New("Caller has no eCert!")
+	accountAsBytes, err := stub.GetState(accountKey(username))
+	if err != nil {
+		return nil, errors.New("Error getting state for username")
 	}
-
-	// Set account permission
-	// ADMIN | DOCTOR | CLIENT | HOSPITAL | LAB
-	fmt.Println("Checking the permission")
-	switch typeOfUser {
-	case ADMIN:
-		fmt.Println("It's an Admin ACC")
-		// Check access code
-		if accessCode != 0 {
-			fmt.Println("Token does not give admin rights!")
-			return nil, errors.New("Token does not give admin rights!")
-		}
-
-		// Store eCert in table
-		ok, err := t.SaveECertificate(stub, []string{ADMIN_INDEX, username, ecert})
-
-		if err != nil {
-			return nil, errors.New("SaveECertificate Failed:")
-		}
-		if ok != 1 {
-			return nil, errors.New("SaveECertificate Failed")
-		}
-
-	case DOCTOR:
-		fmt.Println("It's an doctor ACC")
-		// Check access code
-		if accessCode != 1 {
-			return nil, errors.New("Token does not give doctor rights!")
-		}
-
-		// Store eCert in table
-		ok, err := t.SaveECertificate(stub, []string{DOCTOR_INDEX, username, ecert})
-
-		if err != nil {
-			return nil, errors.New("SaveECertificate Failed:")
-		}
-		if ok != 1 {
-			return nil, errors.New("SaveECertificate Failed")
-		}
-
-	case CLIENT:
-		fmt.Println("It's an CLIENT ACC")
-		// Check access code
-		if accessCode != 2 {
-			return nil, errors.New("Token does not give client rights!")
-		}
-
-		// Store eCert in table
-		ok, err := t.SaveECertificate(stub, []string{CLIENT_INDEX, username, ecert})
-
-		if err != nil {
-			return nil, errors.New("SaveECertificate Failed:")
-		}
-		if ok != 1 {
-			return nil, errors.New("SaveECertificate Failed")
-		}
-	case HOSPITAL:
-		fmt.Println("It's an Hospital ACC")
-		// Check access code
-		if accessCode != 3 {
-			return nil, errors.New("Token does not give hospital rights!")
-		}
-
-		// Store eCert in table
-		ok, err := t.SaveECertificate(stub, []string{HOSPITAL_INDEX, username, ecert})
-
-		if err != nil {
-			return nil, errors.New("SaveECertificate Failed:")
-		}
-		if ok != 1 {
-			return nil, errors.New("SaveECertificate Failed")
-		}
-	case LAB:
-		fmt.Println("It's an laboratory ACC")
-		// Check access code
-		if accessCode != 4 {
-			return nil, errors.New("Token does not give LAB rights!")
-		}
-
-		// Store eCert in table
-		ok, err := t.SaveECertificate(stub, []string{LAB_INDEX, username, ecert})
-
+	if accountAsBytes == nil {
+		// Accounts of older chaincodes stay under their username until migrate moves them
+		accountAsBytes, err = stub.GetState(username)
 		if err != nil {
-			return nil, errors.New("SaveECertificate Failed:")
+			return nil, errors.New("Error getting state for username")
 		}
-		if ok != 1 {
-			return nil, errors.New("SaveECertificate Failed")
+		legacy := account{}
+		if json.Unmarshal(accountAsBytes, &legacy) != nil || legacy.Username != username {
+			accountAsBytes = nil
 		}
+	}
+	fmt.Println("checking if account exists")
+	if accountAsBytes != nil {
+		fmt.Println("This account already exists")
+		return nil, errors.New("This account already exists")
+	}
 
-	default:
-		fmt.Println("User not supported. User has not been created!")
-		return nil, errors.New("User not supported. User has not been created!")
+	// Account permission comes from the callers enrollment, not from the caller
+	fmt.Println("Checking the permission")
+	if !t.CheckRole(stub, typeOfUser) {
+		fmt.Println("Caller is not enrolled as " + typeOfUser)
+		return nil, errors.New("Caller is not enrolled as " + typeOfUser)
 	}
 
-	json.Unmarshal(accountAsBytes, &res)
+	fingerprint, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
 
-	stringss := `{"typeOfUser": "` + typeOfUser + `", "username": "` + username + `", "password": "` + password + `"}` //build the Json element
-	err = stub.PutState(username, []byte(stringss))
+	res := account{TypeOfUser: typeOfUser, Username: username, Fingerprint: fingerprint, SchemaVersion: ACCOUNT_SCHEMA_VERSION}
+	jsonAsBytes, _ := json.Marshal(res)
+	err = stub.PutState(accountKey(username), jsonAsBytes)
 	if err != nil {
 		fmt.Println("Could not add account to list")
 		return nil, err
@@ -852,7 +706,7 @@ func (t *SimpleChaincode) create_user(stub shim.ChaincodeStubInterface, args []s
 	accountAsBytes, err = stub.GetState(accountIndex)
 	if err != nil {
 		fmt.Println("Could not get acc index")
-		return nil, errors.New("you fucked up")
+		return nil, errors.New("Could not get account index")
 	}
 
 	var accInd []string
@@ -860,348 +714,48 @@ func (t *SimpleChaincode) create_user(stub shim.ChaincodeStubInterface, args []s
 	fmt.Println("Appending to List")
 	//append it to the list
 	accInd = append(accInd, username)
-	jsonAsBytes, _ := json.Marshal(accInd)
+	jsonAsBytes, _ = json.Marshal(accInd)
 	err = stub.PutState(accountIndex, jsonAsBytes)
 
 	fmt.Println("Ended of creation")
 
-	return nil, nil
+	return nil, err
 }
 
 // ============================================================================================================================
-// Get User - Retreives a users data
+// Get User - Retreives a users data, only to the certificate the account is bound to
 // ============================================================================================================================
 func (t *SimpleChaincode) get_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 
 	/*
 	   Our model looks like
 	   -------------------------------------------------------
-	       0         1	       2	     3
-	     "ecert"  "username"  "password"   "typeOfUser"
+	       0	         1
+	   "username"  "typeOfUser"
 	   -------------------------------------------------------
 	*/
 
-	if len(args) != 4 {
-		return nil, errors.New("Gimme more arguments, 4 to be exact")
-	}
-	userList, err := stub.GetState(accountIndex)
-	if err != nil {
-		return nil, errors.New("Failed to get accountList")
-	}
-	var userIndex []string
-
-	err = json.Unmarshal(userList, &userIndex)
-	if err != nil {
-		fmt.Println("you dun goofed")
-	}
-
-	// Example of checking role
-	// Note how model looks like and keep it the same!
-	// Meaning "ecert" is always args[0]
-	if t.CheckRole(stub, args[1], t.GetTable(args[3]), args[0]) != true {
+	// The caller must be enrolled in the role it claims
+	if t.CheckRole(stub, args[1]) != true {
 		fmt.Println("Access Denied!")
 		return nil, errors.New("Access Denied!")
 	}
 
-	var accountAsBytes []byte
-	var finalListForUser []byte = []byte(`"returnedObjects":[`)
-	res := account{}
-	for i := range userIndex {
-
-		accountAsBytes, err = stub.GetState(userIndex[i])
-		json.Unmarshal(accountAsBytes, &res)
-		if res.Username == args[1] && res.Password == args[2] {
-
-			finalListForUser = append(finalListForUser, accountAsBytes...)
-			if i < (len(userIndex) - 1) {
-				finalListForUser = append(finalListForUser, []byte(`,`)...)
-			}
-		}
-	}
-	finalListForUser = append(finalListForUser, []byte(`]`)...)
-
-	return finalListForUser, nil
-}
-
-// ============================================================================================================================
-// Get ECERT HOLDER - Function to retreive a enrollment certificate stored in tablename and key
-// @Params: tablename, key
-// ============================================================================================================================
-func (t *SimpleChaincode) get_enrollment_cert(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-
-	/*
-	   Our model looks like
-	   -------------------------------------------------------
-	       0         1
-	   "tablename"  "key"
-	   -------------------------------------------------------
-	*/
-
-	if len(args) != 2 {
-		fmt.Println("At least 2 args must be provided")
-		return nil, errors.New("Get Admin Ecerts failed. Must include at least 2 args value")
-	}
-
-	// Initial repsonse
-	var finalList []byte = []byte(`"ecert":[`)
-
-	// Getting the rows for admin
-	var columns []shim.Column
-	var tmpHolder []byte
-
-	fmt.Println("Finding key/value pair key for key: ", args[1])
-	colNext := shim.Column{Value: &shim.Column_String_{String_: args[1]}}
-	columns = append(columns, colNext)
-
-	row, err := stub.GetRow(args[0], columns)
-
-	if err != nil {
-		fmt.Println("Failed getting row for ", args[0])
-		return nil, errors.New("Failed getting row")
-	}
-
-	if len(row.GetColumns()) != 0 {
-		fmt.Println("Appending eCert")
-		tmpHolder = append(tmpHolder, row.Columns[1].GetBytes()...)
-	}
-
-	finalList = append(finalList, tmpHolder...)
-	finalList = append(finalList, []byte(`]`)...)
-
-	fmt.Println("End of get_enrollment_cert!")
-
-	return finalList, nil
-
-}
-
-// ============================================================================================================================
-// CheckToken - The args[4] should contain the token of user type
-// ============================================================================================================================
-func (t *SimpleChaincode) CheckToken(token string) (int, error) {
-
-	fmt.Println("Checking token")
-	if len(token) == 0 {
-		fmt.Println("Invalid token. Empty.")
-		return -1, errors.New("Invalid token. Empty.")
-	}
-
-	switch token {
-	case ADMIN_TOKEN:
-		fmt.Println("Returned 0")
-		return 0, nil
-	case DOCTOR_TOKEN:
-		fmt.Println("Returned 1")
-		return 1, nil
-	case CLIENT_TOKEN:
-		fmt.Println("Returned 2")
-		return 2, nil
-	case HOSPITAL_TOKEN:
-		fmt.Println("Returned 3")
-		return 3, nil
-	case LAB_TOKEN:
-		fmt.Println("Returned 4")
-		return 4, nil
-	default:
-		fmt.Println("Invalid token. Not Correct.")
-		return -1, errors.New("Invalid token. Not Correct.")
-
-	}
-}
-
-// ============================================================================================================================
-// GetTable - The args[3] should contain the table of user type
-// ============================================================================================================================
-func (t *SimpleChaincode) GetTable(name string) string {
-
-	fmt.Println("Getting table")
-
-	switch name {
-	case ADMIN:
-		return ADMIN_INDEX
-	case LAB:
-		return LAB_INDEX
-	case CLIENT:
-		return CLIENT_INDEX
-	case HOSPITAL:
-		return HOSPITAL_INDEX
-	default:
-		return DOCTOR_INDEX
-	}
-}
-
-// ============================================================================================================================
-// SaveECertificate - Save Callers Enrollment Certificate
-// @Params: args[] -> 0 = tablename, 1 = username, 2 = ecert
-// ============================================================================================================================
-func (t *SimpleChaincode) SaveECertificate(stub shim.ChaincodeStubInterface, args []string) (int, error) {
-
-	fmt.Println("SaveECertificate")
-
-	if len(args) != 3 {
-		fmt.Println("Invaild number of arguments - 0 = tablename, 1 = username, 2 = ecert")
-		return -1, errors.New("Invaild number of arguments ")
-	}
-
-	// Saving Ecert
-	logger.Debug("Saving to table: ", args[0])
-
-	// *Debugging*
-	logger.Debug("Peer ecert: ", args[2])
-
-	// Inserting rows
-	fmt.Println("Inserting user: ", args[1])
-	ok, err := stub.InsertRow(args[0], shim.Row{
-		Columns: []*shim.Column{
-			{Value: &shim.Column_String_{String_: args[1]}},
-			{Value: &shim.Column_String_{String_: args[2]}}},
-	})
-
-	if err != nil {
-		fmt.Println("Error: can't insert row! ", err)
-		return -1, errors.New("Error: can't insert row!")
-	} else if !ok {
-		fmt.Println("Failed inserting row!")
-		return -1, nil
-	}
-
-	fmt.Println("Insert successful!")
-
-	//------------
-	// DEBUGGING
-	fmt.Println("Checking for inserted data!")
-	var columns []shim.Column
-	colNext := shim.Column{Value: &shim.Column_String_{String_: args[1]}}
-	columns = append(columns, colNext)
-
-	row, err := stub.GetRow(args[0], columns)
+	acc, err := t.getAccount(stub, args[0])
 	if err != nil {
-		fmt.Println("Failed inserted row for ", args[0])
-		return -1, errors.New("Failed getting rows")
-	}
-
-	if len(row.GetColumns()) != 0 {
-		fmt.Println("Check OK")
-	}
-	//-------------
-
-	// Ran successfully!
-	return 1, nil
-}
-
-// ============================================================================================================================
-// CreateTables - Called from init
-// ============================================================================================================================
-func (t *SimpleChaincode) CreateTables(stub shim.ChaincodeStubInterface) {
-
-	fmt.Print("Creating tables...")
-
-	var tableName string
-	for i := 0; i < 5; i++ {
-
-		switch i {
-		case 1:
-			tableName = DOCTOR_INDEX
-		case 2:
-			tableName = HOSPITAL_INDEX
-		case 3:
-			tableName = CLIENT_INDEX
-		case 4:
-			tableName = LAB_INDEX
-		default:
-			tableName = ADMIN_INDEX
-		}
-
-		fmt.Println("Creating table: ", tableName)
-
-		err := stub.CreateTable(tableName, []*shim.ColumnDefinition{
-			{Name: COLUMN_CERTS, Type: shim.ColumnDefinition_STRING, Key: true},
-			{Name: COLUMN_VALUE, Type: shim.ColumnDefinition_STRING, Key: false},
-		})
-
-		if err != nil {
-			fmt.Println("Table is already created!")
-		}
-	}
-
-	// Creating clients
-	fmt.Println("Creating clients")
-	for i := 0; i < 100; i++ {
-
-		lastFourSSN := strconv.Itoa(i + 1)
-		clientEcert := "ERE4zwMnao"
-
-		if i+1 < 10 {
-			fmt.Println("Creating client: 010101-000" + lastFourSSN)
-			_, err := t.create_user(stub, []string{clientEcert, CLIENT, "010101-000" + lastFourSSN, "000" + lastFourSSN, CLIENT_TOKEN})
-
-			if err != nil {
-				fmt.Println("Error creating client: 010101-000"+lastFourSSN, err)
-			}
-		} else if i+1 < 99 {
-			fmt.Println("Creating client: 010101-00" + lastFourSSN)
-
-			_, err := t.create_user(stub, []string{clientEcert, CLIENT, "010101-00" + lastFourSSN, "00" + lastFourSSN, CLIENT_TOKEN})
-
-			if err != nil {
-				fmt.Println("Error creating client: 010101-00"+lastFourSSN, err)
-			}
-
-		} else {
-			fmt.Println("Creating client: 010101-0" + lastFourSSN)
-
-			_, err := t.create_user(stub, []string{clientEcert, CLIENT, "010101-0" + lastFourSSN, "0" + lastFourSSN, CLIENT_TOKEN})
-
-			if err != nil {
-				fmt.Println("Error creating client: 010101-0"+lastFourSSN, err)
-			}
-		}
-
+		return nil, err
 	}
-
-}
-
-// ============================================================================================================================
-// CheckRole - Called from all invoke/query func's.
-// Access Control happens here
-// Params: username, role
-// Username should be pass from json input
-// Roles: ADMIN_INDEX, DOCTOR_INDEX, CLIENT_INDEX, HOSPITAL_INDEX, LAB_INDEX
-// ============================================================================================================================
-func (t *SimpleChaincode) CheckRole(stub shim.ChaincodeStubInterface, username string, role string, ecert string) bool {
-
-	fmt.Println("Checking Role")
-	fmt.Println("Finding pair in table ", role)
-	fmt.Println("Finding key/value pair for key: ", username)
-
-	// Get the row for username
-	var columns []shim.Column
-	colNext := shim.Column{Value: &shim.Column_String_{String_: username}}
-	columns = append(columns, colNext)
-
-	row, err := stub.GetRow(role, columns)
-
+	caller, err := callerFingerprint(stub)
 	if err != nil {
-		fmt.Println("Access denied! User not permitted to do this: ", role)
-		return false
+		return nil, err
 	}
 
-	if len(row.GetColumns()) != 0 {
-
-		fmt.Println("Getting saved callerCertificate")
-		ecertSaved := row.Columns[1].GetString_()
-
-		// Compare callers ecert & that which is stored
-		fmt.Println("Checking signature")
-
-		if ecertSaved != ecert {
-			fmt.Println("\nAccess denied! \n x509Cert not a match!")
-			return false
-		} else {
-			fmt.Println("\nx509Cert signature matches!")
-			return true
-		}
+	var finalListForUser []byte = []byte(`"returnedObjects":[`)
+	if acc != nil && acc.Fingerprint == caller && acc.TypeOfUser == args[1] {
+		accountAsBytes, _ := json.Marshal(acc)
+		finalListForUser = append(finalListForUser, accountAsBytes...)
 	}
+	finalListForUser = append(finalListForUser, []byte(`]`)...)
 
-	fmt.Println("Access denied! Last in function")
-	return false
+	return finalListForUser, nil
 }
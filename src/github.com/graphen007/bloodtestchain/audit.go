@@ -0,0 +1,429 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Audit trail - Every change of a test appends one entry under "audit" 0x00 bloodTestID 0x00 sequence.
+//				 Each entry hashes the previous one, "audit" 0x00 bloodTestID holds the head of the chain.
+//				 Consent checks are recorded apart under "access" 0x00 bloodTestID 0x00 txID, so reads write no shared
+//				 key and do not conflict with each other or with changes of the test
+//==============================================================================================================================
+const auditPrefix = "audit"
+const accessPrefix = "access"
+
+// auditGenesis is the previous hash of the first entry of every chain
+var auditGenesis = strings.Repeat("0", sha256.Size*2)
+
+type auditChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// auditAccess is set on entries that recorded a read in the chain, before reads were recorded apart
+type auditAccess struct {
+	Granted bool   `json:"granted"`
+	Reason  string `json:"reason"`
+}
+
+type auditEntry struct {
+	Sequence    int                    `json:"sequence"`
+	BloodTestID string                 `json:"bloodTestID"`
+	TxID        string                 `json:"txID"`
+	TimeStamp   string                 `json:"timeStamp"`
+	Actor       string                 `json:"actor"`
+	Role        string                 `json:"role"`
+	Function    string                 `json:"function"`
+	Changes     map[string]auditChange `json:"changes"`
+	Access      *auditAccess           `json:"access,omitempty"`
+	PrevHash    string                 `json:"prevHash"`
+	Hash        string                 `json:"hash,omitempty"`
+}
+
+type auditHead struct {
+	Count int    `json:"count"`
+	Hash  string `json:"hash"`
+}
+
+func auditHeadKey(bloodTestID string) string {
+	return auditPrefix + indexSep + bloodTestID
+}
+
+func auditEntryPrefix(bloodTestID string) string {
+	return auditHeadKey(bloodTestID) + indexSep
+}
+
+// auditEntryKey zero pads the sequence so entries sort chronologically
+func auditEntryKey(bloodTestID string, sequence int) string {
+	return auditEntryPrefix(bloodTestID) + fmt.Sprintf("%010d", sequence)
+}
+
+// accessRecord is the record of a consent check on a read of a test
+type accessRecord struct {
+	BloodTestID string `json:"bloodTestID"`
+	TxID        string `json:"txID"`
+	TimeStamp   string `json:"timeStamp"`
+	Actor       string `json:"actor"`
+	Role        string `json:"role"`
+	Function    string `json:"function"`
+	Granted     bool   `json:"granted"`
+	Reason      string `json:"reason"`
+}
+
+func accessRecordPrefix(bloodTestID string) string {
+	return accessPrefix + indexSep + bloodTestID + indexSep
+}
+
+func accessRecordKey(bloodTestID string, txID string) string {
+	return accessRecordPrefix(bloodTestID) + txID
+}
+
+// accessRecords sorts records chronologically, their keys sort by transaction ID
+type accessRecords []accessRecord
+
+func (r accessRecords) Len() int           { return len(r) }
+func (r accessRecords) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r accessRecords) Less(i, j int) bool { return r[i].TimeStamp < r[j].TimeStamp }
+
+// hash returns the hex SHA-256 of the entry without its own hash, chained to PrevHash
+func (e auditEntry) hash() string {
+	e.Hash = ""
+	jsonAsBytes, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.PrevHash), jsonAsBytes...))
+	return hex.EncodeToString(sum[:])
+}
+
+// ============================================================================================================================
+// diffBloodTest - Returns the old and new JSON value of every field that differs. old is nil for a new test
+// ============================================================================================================================
+func diffBloodTest(old *bloodTest, res *bloodTest) map[string]auditChange {
+	oldFields := make(map[string]json.RawMessage)
+	if old != nil {
+		oldAsBytes, _ := json.Marshal(old)
+		json.Unmarshal(oldAsBytes, &oldFields)
+	}
+	newFields := make(map[string]json.RawMessage)
+	newAsBytes, _ := json.Marshal(res)
+	json.Unmarshal(newAsBytes, &newFields)
+
+	changes := make(map[string]auditChange)
+	for field, value := range newFields {
+		if !bytes.Equal(oldFields[field], value) {
+			changes[field] = auditChange{Old: oldFields[field], New: value}
+		}
+	}
+	for field, value := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			changes[field] = auditChange{Old: value}
+		}
+	}
+	return changes
+}
+
+// ============================================================================================================================
+// appendAudit - Records who changed res through which function. Called by saveBloodTest
+// ============================================================================================================================
+func (t *SimpleChaincode) appendAudit(stub shim.ChaincodeStubInterface, old *bloodTest, res *bloodTest) error {
+	entry, err := t.newAuditEntry(stub, res.BloodTestID)
+	if err != nil {
+		return err
+	}
+	entry.Changes = diffBloodTest(old, res)
+	return t.putAuditEntry(stub, entry)
+}
+
+// ============================================================================================================================
+// recordAccess - Records a consent check on a read of a test, whether or not access was granted. A read dispatched by Query
+// can not write, its check is not recorded
+// ============================================================================================================================
+func (t *SimpleChaincode) recordAccess(stub shim.ChaincodeStubInterface, bloodTestID string, granted bool, reason string) error {
+	if _, queried := stub.(queryStub); queried {
+		return nil
+	}
+
+	actor, err := callerFingerprint(stub)
+	if err != nil {
+		return err
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return err
+	}
+	function, _ := stub.GetFunctionAndParameters()
+
+	record := accessRecord{
+		BloodTestID: bloodTestID,
+		TxID:        stub.GetTxID(),
+		TimeStamp:   timeStamp,
+		Actor:       actor,
+		Role:        bloodTestRoutes.callerRole(t, stub),
+		Function:    function,
+		Granted:     granted,
+		Reason:      reason,
+	}
+	jsonAsBytes, _ := json.Marshal(record)
+	return stub.PutState(accessRecordKey(bloodTestID, record.TxID), jsonAsBytes)
+}
+
+// ============================================================================================================================
+// getAccessRecords - Returns the records of the consent checks on reads of a test in the order they were made
+// ============================================================================================================================
+func (t *SimpleChaincode) getAccessRecords(stub shim.ChaincodeStubInterface, bloodTestID string) ([]accessRecord, error) {
+
+	prefix := accessRecordPrefix(bloodTestID)
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to get access records of " + bloodTestID)
+	}
+	defer iter.Close()
+
+	records := accessRecords{}
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get access records of " + bloodTestID)
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var record accessRecord
+		err = json.Unmarshal(value, &record)
+		if err != nil {
+			return nil, errors.New("Failed to unmarshal access record " + strings.TrimPrefix(key, prefix))
+		}
+		records = append(records, record)
+	}
+	sort.Stable(records)
+	return records, nil
+}
+
+// newAuditEntry fills in the actor and transaction of the next entry of the trail of bloodTestID
+func (t *SimpleChaincode) newAuditEntry(stub shim.ChaincodeStubInterface, bloodTestID string) (*auditEntry, error) {
+
+	head, err := t.getAuditHead(stub, bloodTestID)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	function, _ := stub.GetFunctionAndParameters()
+
+	return &auditEntry{
+		Sequence:    head.Count,
+		BloodTestID: bloodTestID,
+		TxID:        stub.GetTxID(),
+		TimeStamp:   timeStamp,
+		Actor:       actor,
+		Role:        bloodTestRoutes.callerRole(t, stub),
+		Function:    function,
+		PrevHash:    head.Hash,
+	}, nil
+}
+
+// putAuditEntry chains entry to the head and writes both
+func (t *SimpleChaincode) putAuditEntry(stub shim.ChaincodeStubInterface, entry *auditEntry) error {
+	entry.Hash = entry.hash()
+
+	jsonAsBytes, _ := json.Marshal(entry)
+	err := stub.PutState(auditEntryKey(entry.BloodTestID, entry.Sequence), jsonAsBytes)
+	if err != nil {
+		return err
+	}
+
+	jsonAsBytes, _ = json.Marshal(auditHead{Count: entry.Sequence + 1, Hash: entry.Hash})
+	return stub.PutState(auditHeadKey(entry.BloodTestID), jsonAsBytes)
+}
+
+func (t *SimpleChaincode) getAuditHead(stub shim.ChaincodeStubInterface, bloodTestID string) (*auditHead, error) {
+	headAsBytes, err := stub.GetState(auditHeadKey(bloodTestID))
+	if err != nil {
+		return nil, errors.New("Failed to get audit head of " + bloodTestID)
+	}
+	head := &auditHead{Hash: auditGenesis}
+	if headAsBytes == nil {
+		return head, nil
+	}
+	err = json.Unmarshal(headAsBytes, head)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal audit head of " + bloodTestID)
+	}
+	return head, nil
+}
+
+// ============================================================================================================================
+// getAuditEntries - Returns the audit trail of a test in the order it was written
+// ============================================================================================================================
+func (t *SimpleChaincode) getAuditEntries(stub shim.ChaincodeStubInterface, bloodTestID string) ([]auditEntry, error) {
+
+	err := validateKeyPart(bloodTestID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := auditEntryPrefix(bloodTestID)
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to get audit trail of " + bloodTestID)
+	}
+	defer iter.Close()
+
+	entries := []auditEntry{}
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get audit trail of " + bloodTestID)
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var entry auditEntry
+		err = json.Unmarshal(value, &entry)
+		if err != nil {
+			return nil, errors.New("Failed to unmarshal audit entry " + strings.TrimPrefix(key, prefix))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ============================================================================================================================
+// historyAccess - The trail holds every old value of a test, so it is only shown to callers that may read the test
+// ============================================================================================================================
+func (t *SimpleChaincode) historyAccess(stub shim.ChaincodeStubInterface, bloodTestID string) (bool, error) {
+	res, err := t.getBloodTest(stub, bloodTestID)
+	if err != nil {
+		return false, err
+	}
+	if res.BloodTestID != bloodTestID {
+		return false, errors.New("Blood test " + bloodTestID + " does not exist")
+	}
+	return t.checkAccess(stub, res)
+}
+
+// ============================================================================================================================
+// Get History - Chronological audit trail of a test and the records of the consent checks on its reads
+// ============================================================================================================================
+func (t *SimpleChaincode) get_history(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0
+	   "bloodTestID"
+	   -------------------------------------------------------
+	*/
+
+	granted, err := t.historyAccess(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !granted {
+		return accessDenied(stub, args[0])
+	}
+
+	entries, err := t.getAuditEntries(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	records, err := t.getAccessRecords(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		BloodTestID string         `json:"bloodTestID"`
+		History     []auditEntry   `json:"history"`
+		Access      []accessRecord `json:"access"`
+	}{args[0], entries, records})
+}
+
+// ============================================================================================================================
+// Verify History - Recomputes the hash chain of a test and reports the first entry that does not match
+// ============================================================================================================================
+func (t *SimpleChaincode) verify_history(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	granted, err := t.historyAccess(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !granted {
+		return accessDenied(stub, args[0])
+	}
+
+	entries, err := t.getAuditEntries(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	head, err := t.getAuditHead(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	type verification struct {
+		BloodTestID string `json:"bloodTestID"`
+		Entries     int    `json:"entries"`
+		Valid       bool   `json:"valid"`
+		BrokenAt    *int   `json:"brokenAt,omitempty"`
+		Reason      string `json:"reason,omitempty"`
+	}
+	result := verification{BloodTestID: args[0], Entries: len(entries), Valid: true}
+	broken := func(sequence int, reason string) ([]byte, error) {
+		result.Valid = false
+		result.BrokenAt = &sequence
+		result.Reason = reason
+		return json.Marshal(result)
+	}
+
+	prevHash := auditGenesis
+	for i, entry := range entries {
+		if entry.Sequence != i {
+			return broken(i, "Entry is missing")
+		}
+		if entry.BloodTestID != args[0] {
+			return broken(i, "Entry belongs to "+entry.BloodTestID)
+		}
+		if entry.PrevHash != prevHash {
+			return broken(i, "Previous hash does not match")
+		}
+		if entry.hash() != entry.Hash {
+			return broken(i, "Entry hash does not match its content")
+		}
+		prevHash = entry.Hash
+	}
+	if head.Count != len(entries) || head.Hash != prevHash {
+		return broken(len(entries), "Chain head does not match the last entry")
+	}
+
+	return json.Marshal(result)
+}
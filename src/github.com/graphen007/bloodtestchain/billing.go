@@ -0,0 +1,648 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Billing - Labs keep a price per LOINC code under "price" 0x00 lab 0x00 code. Recording a result accrues a charge per
+//			 billed code under "charge" 0x00 hospital 0x00 lab 0x00 period 0x00 bloodTestID 0x00 code, so the charges of a
+//			 hospital and lab in a month are one range. Amounts are integers in the minor unit of the currency
+//==============================================================================================================================
+const pricePrefix = "price"
+const chargePrefix = "charge"
+const disputePrefix = "dispute"
+const disputeIndexPrefix = "disputeIdx"
+
+const DISPUTE_OPEN = "open"                 // raised by the hospital
+const DISPUTE_UNDER_REVIEW = "under_review" // taken up by the lab
+const DISPUTE_ACCEPTED = "accepted"         // lab grants a credit
+const DISPUTE_REJECTED = "rejected"         // lab keeps the charges, the hospital may reopen
+const DISPUTE_WITHDRAWN = "withdrawn"       // withdrawn by the hospital
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+var settlementPeriod = regexp.MustCompile(`^[0-9]{4}-(0[1-9]|1[0-2])$`)
+
+type price struct {
+	Lab       string `json:"lab"`
+	Code      string `json:"code"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	UpdatedBy string `json:"updatedBy"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type charge struct {
+	BloodTestID string `json:"bloodTestID"`
+	Code        string `json:"code"`
+	Hospital    string `json:"hospital"`
+	Lab         string `json:"lab"`
+	Period      string `json:"period"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	AccruedAt   string `json:"accruedAt"`
+	TxID        string `json:"txID"`
+}
+
+type disputeEvent struct {
+	Status string `json:"status"`
+	By     string `json:"by"`
+	At     string `json:"at"`
+	Note   string `json:"note"`
+}
+
+type dispute struct {
+	ID          string           `json:"id"`
+	Hospital    string           `json:"hospital"`
+	Lab         string           `json:"lab"`
+	Period      string           `json:"period"`
+	BloodTestID string           `json:"bloodTestID,omitempty"` // empty when the whole period is disputed
+	Disputed    map[string]int64 `json:"disputed"`              // per currency
+	Credit      map[string]int64 `json:"credit,omitempty"`      // per currency, set when accepted
+	Status      string           `json:"status"`
+	History     []disputeEvent   `json:"history"`
+}
+
+//==============================================================================================================================
+// disputeTransition - A legal dispute status change and the side of the dispute allowed to perform it
+//==============================================================================================================================
+type disputeTransition struct {
+	from string
+	to   string
+	side string // HOSPITAL or LAB
+}
+
+var disputeWorkflow = []disputeTransition{
+	{from: DISPUTE_OPEN, to: DISPUTE_UNDER_REVIEW, side: LAB},
+	{from: DISPUTE_OPEN, to: DISPUTE_WITHDRAWN, side: HOSPITAL},
+	{from: DISPUTE_UNDER_REVIEW, to: DISPUTE_ACCEPTED, side: LAB},
+	{from: DISPUTE_UNDER_REVIEW, to: DISPUTE_REJECTED, side: LAB},
+	{from: DISPUTE_UNDER_REVIEW, to: DISPUTE_WITHDRAWN, side: HOSPITAL},
+	{from: DISPUTE_REJECTED, to: DISPUTE_OPEN, side: HOSPITAL},
+}
+
+func findDisputeTransition(from string, to string) *disputeTransition {
+	for i := range disputeWorkflow {
+		if disputeWorkflow[i].from == from && disputeWorkflow[i].to == to {
+			return &disputeWorkflow[i]
+		}
+	}
+	return nil
+}
+
+func priceKeyPrefix(lab string) string {
+	return pricePrefix + indexSep + lab + indexSep
+}
+
+func chargeKeyPrefix(hospital string, lab string, period string) string {
+	return chargePrefix + indexSep + hospital + indexSep + lab + indexSep + period + indexSep
+}
+
+func chargeKey(c *charge) string {
+	return chargeKeyPrefix(c.Hospital, c.Lab, c.Period) + c.BloodTestID + indexSep + c.Code
+}
+
+func disputeKey(id string) string {
+	return disputePrefix + indexSep + id
+}
+
+func disputeIndexKeyPrefix(hospital string, lab string, period string) string {
+	return disputeIndexPrefix + indexSep + hospital + indexSep + lab + indexSep + period + indexSep
+}
+
+// ============================================================================================================================
+// getPrice - Returns the price of code at lab, or nil if the lab has not priced it
+// ============================================================================================================================
+func (t *SimpleChaincode) getPrice(stub shim.ChaincodeStubInterface, lab string, code string) (*price, error) {
+	priceAsBytes, err := stub.GetState(priceKeyPrefix(lab) + code)
+	if err != nil {
+		return nil, errors.New("Failed to get price of " + code + " at " + lab)
+	}
+	if priceAsBytes == nil {
+		return nil, nil
+	}
+	p := &price{}
+	err = json.Unmarshal(priceAsBytes, p)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal price of " + code + " at " + lab)
+	}
+	return p, nil
+}
+
+// billedCodes are the codes a test is charged for, the requested panel or else the analysed codes
+func billedCodes(res *bloodTest) []string {
+	if len(res.Panel) > 0 {
+		return res.Panel
+	}
+	var codes []string
+	for _, a := range res.Results {
+		codes = append(codes, a.Code)
+	}
+	return codes
+}
+
+// ============================================================================================================================
+// accrueCharges - Writes a charge per billed code of a test when its lab records the result, in the month of the
+// transaction. Codes the lab has not priced are not charged and returned, so the result is recorded all the same
+// ============================================================================================================================
+func (t *SimpleChaincode) accrueCharges(stub shim.ChaincodeStubInterface, res *bloodTest) ([]string, error) {
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	unpriced := []string{}
+	for _, code := range billedCodes(res) {
+		p, err := t.getPrice(stub, res.Lab, code)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			unpriced = append(unpriced, code)
+			continue
+		}
+
+		c := &charge{
+			BloodTestID: res.BloodTestID,
+			Code:        code,
+			Hospital:    res.Hospital,
+			Lab:         res.Lab,
+			Period:      timeStamp[:7],
+			Amount:      p.Amount,
+			Currency:    p.Currency,
+			AccruedAt:   timeStamp,
+			TxID:        stub.GetTxID(),
+		}
+		jsonAsBytes, _ := json.Marshal(c)
+		err = stub.PutState(chargeKey(c), jsonAsBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return unpriced, nil
+}
+
+// ============================================================================================================================
+// getCharges - Charges of hospital at lab in period, in key order
+// ============================================================================================================================
+func (t *SimpleChaincode) getCharges(stub shim.ChaincodeStubInterface, hospital string, lab string, period string) ([]charge, error) {
+	prefix := chargeKeyPrefix(hospital, lab, period)
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to get charges")
+	}
+	defer iter.Close()
+
+	charges := []charge{}
+	for iter.HasNext() {
+		key, chargeAsBytes, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get charges")
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var c charge
+		err = json.Unmarshal(chargeAsBytes, &c)
+		if err != nil {
+			return nil, errors.New("Failed to unmarshal charge " + key)
+		}
+		charges = append(charges, c)
+	}
+	return charges, nil
+}
+
+// requireParty fails unless the caller is on the staff of the hospital or the lab, and returns which of the two
+func (t *SimpleChaincode) requireParty(stub shim.ChaincodeStubInterface, hospital string, lab string) (string, error) {
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return "", err
+	}
+	for _, party := range []struct{ kind, org string }{{HOSPITAL, hospital}, {LAB, lab}} {
+		ok, err := t.isMember(stub, party.org, caller)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return party.kind, nil
+		}
+	}
+	return "", errors.New("Caller is not on the staff of " + hospital + " or " + lab)
+}
+
+// validateSettlement checks the hospital, lab and period that identify a settlement
+func validateSettlement(hospital string, lab string, period string) error {
+	for _, part := range []string{hospital, lab} {
+		if err := validateKeyPart(part); err != nil {
+			return err
+		}
+	}
+	if !settlementPeriod.MatchString(period) {
+		return errors.New("Period must be a month as YYYY-MM")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Set Lab Prices - Lab staff set the price of codes in the catalogue of their lab. Codes left out keep their price
+// ============================================================================================================================
+func (t *SimpleChaincode) set_lab_prices(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0                  1
+	   "labID", "[{code, amount, currency}, ...]"
+	   -------------------------------------------------------
+	   amount is an integer in the minor unit of the currency, currency an ISO 4217 code
+	*/
+
+	lab, err := t.requireOrganisation(stub, args[0], LAB)
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireCallerMember(stub, lab.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var prices []price
+	err = json.Unmarshal([]byte(args[1]), &prices)
+	if err != nil || len(prices) == 0 {
+		return nil, errors.New("Prices must be a JSON array of {code, amount, currency}")
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range prices {
+		p := &prices[i]
+		err = checkCatalogue(lab, []string{p.Code})
+		if err != nil {
+			return nil, err
+		}
+		if p.Amount < 0 {
+			return nil, errors.New("Price of " + p.Code + " can not be negative")
+		}
+		if !currencyCode.MatchString(p.Currency) {
+			return nil, errors.New("Currency of " + p.Code + " must be an ISO 4217 code")
+		}
+		p.Lab = lab.ID
+		p.UpdatedBy = caller
+		p.UpdatedAt = timeStamp
+
+		jsonAsBytes, _ := json.Marshal(p)
+		err = stub.PutState(priceKeyPrefix(lab.ID)+p.Code, jsonAsBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("Updated prices of " + lab.ID)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Get Lab Prices - Price list of a lab
+// ============================================================================================================================
+func (t *SimpleChaincode) get_lab_prices(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	err := validateKeyPart(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := priceKeyPrefix(args[0])
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to get prices of " + args[0])
+	}
+	defer iter.Close()
+
+	prices := []json.RawMessage{}
+	for iter.HasNext() {
+		key, priceAsBytes, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get prices of " + args[0])
+		}
+		if strings.HasPrefix(key, prefix) {
+			prices = append(prices, json.RawMessage(priceAsBytes))
+		}
+	}
+	return json.Marshal(prices)
+}
+
+// ============================================================================================================================
+// Get Settlement - Charges, credits and disputes of a hospital at a lab in a month. Both parties can compare the digest
+// of the charges with their own books
+// ============================================================================================================================
+func (t *SimpleChaincode) get_settlement(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0           1        2
+	   "hospital", "lab", "YYYY-MM"
+	   -------------------------------------------------------
+	*/
+
+	hospital, lab, period := args[0], args[1], args[2]
+	err := validateSettlement(hospital, lab, period)
+	if err != nil {
+		return nil, err
+	}
+	_, err = t.requireParty(stub, hospital, lab)
+	if err != nil {
+		return nil, err
+	}
+
+	charges, err := t.getCharges(stub, hospital, lab, period)
+	if err != nil {
+		return nil, err
+	}
+	disputes, err := t.getDisputes(stub, hospital, lab, period)
+	if err != nil {
+		return nil, err
+	}
+
+	settlement := struct {
+		Hospital     string           `json:"hospital"`
+		Lab          string           `json:"lab"`
+		Period       string           `json:"period"`
+		Charges      []charge         `json:"charges"`
+		Total        map[string]int64 `json:"total"`
+		Credit       map[string]int64 `json:"credit"`
+		Net          map[string]int64 `json:"net"`
+		OpenDisputes int              `json:"openDisputes"`
+		Disputes     []*dispute       `json:"disputes"`
+		Digest       string           `json:"digest"`
+	}{
+		Hospital: hospital,
+		Lab:      lab,
+		Period:   period,
+		Charges:  charges,
+		Total:    map[string]int64{},
+		Credit:   map[string]int64{},
+		Net:      map[string]int64{},
+		Disputes: disputes,
+	}
+
+	for _, c := range charges {
+		settlement.Total[c.Currency] += c.Amount
+		settlement.Net[c.Currency] += c.Amount
+	}
+	for _, d := range disputes {
+		switch d.Status {
+		case DISPUTE_OPEN, DISPUTE_UNDER_REVIEW:
+			settlement.OpenDisputes++
+		case DISPUTE_ACCEPTED:
+			for currency, amount := range d.Credit {
+				settlement.Credit[currency] += amount
+				settlement.Net[currency] -= amount
+			}
+		}
+	}
+
+	chargesAsBytes, _ := json.Marshal(charges)
+	digest := sha256.Sum256(chargesAsBytes)
+	settlement.Digest = hex.EncodeToString(digest[:])
+
+	return json.Marshal(settlement)
+}
+
+// ============================================================================================================================
+// getDispute / putDispute / getDisputes - Disputes are stored by ID and indexed by hospital, lab and period
+// ============================================================================================================================
+func (t *SimpleChaincode) getDispute(stub shim.ChaincodeStubInterface, id string) (*dispute, error) {
+	disputeAsBytes, err := stub.GetState(disputeKey(id))
+	if err != nil {
+		return nil, errors.New("Failed to get dispute " + id)
+	}
+	if disputeAsBytes == nil {
+		return nil, errors.New("Dispute " + id + " does not exist")
+	}
+	d := &dispute{}
+	err = json.Unmarshal(disputeAsBytes, d)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal dispute " + id)
+	}
+	return d, nil
+}
+
+func (t *SimpleChaincode) putDispute(stub shim.ChaincodeStubInterface, d *dispute) error {
+	jsonAsBytes, _ := json.Marshal(d)
+	err := stub.PutState(disputeKey(d.ID), jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(disputeIndexKeyPrefix(d.Hospital, d.Lab, d.Period)+d.ID, []byte{0x00})
+}
+
+func (t *SimpleChaincode) getDisputes(stub shim.ChaincodeStubInterface, hospital string, lab string, period string) ([]*dispute, error) {
+	prefix := disputeIndexKeyPrefix(hospital, lab, period)
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to get disputes")
+	}
+	defer iter.Close()
+
+	disputes := []*dispute{}
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get disputes")
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		d, err := t.getDispute(stub, strings.TrimPrefix(key, prefix))
+		if err != nil {
+			return nil, err
+		}
+		disputes = append(disputes, d)
+	}
+	return disputes, nil
+}
+
+// ============================================================================================================================
+// Raise Dispute - Hospital staff dispute the charges of one test, or of the whole period when bloodTestID is empty
+// ============================================================================================================================
+func (t *SimpleChaincode) raise_dispute(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0           1        2           3             4
+	   "hospital", "lab", "YYYY-MM", "bloodTestID", "reason"
+	   -------------------------------------------------------
+	   The ID of the dispute is the transaction ID and is returned
+	*/
+
+	hospital, lab, period, bloodTestID := args[0], args[1], args[2], args[3]
+	err := validateSettlement(hospital, lab, period)
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireCallerMember(stub, hospital)
+	if err != nil {
+		return nil, err
+	}
+	if args[4] == "" {
+		return nil, errors.New("A dispute needs a reason")
+	}
+
+	charges, err := t.getCharges(stub, hospital, lab, period)
+	if err != nil {
+		return nil, err
+	}
+	disputed := map[string]int64{}
+	for _, c := range charges {
+		if bloodTestID == "" || c.BloodTestID == bloodTestID {
+			disputed[c.Currency] += c.Amount
+		}
+	}
+	if len(disputed) == 0 {
+		return nil, errors.New("There are no charges to dispute")
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dispute{
+		ID:          stub.GetTxID(),
+		Hospital:    hospital,
+		Lab:         lab,
+		Period:      period,
+		BloodTestID: bloodTestID,
+		Disputed:    disputed,
+		Status:      DISPUTE_OPEN,
+		History:     []disputeEvent{{Status: DISPUTE_OPEN, By: caller, At: timeStamp, Note: args[4]}},
+	}
+	err = t.putDispute(stub, d)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Raised dispute " + d.ID)
+	return []byte(d.ID), nil
+}
+
+// ============================================================================================================================
+// Change Dispute - Moves a dispute through its workflow. The lab accepting a dispute grants a credit, by default the
+// disputed amount
+// ============================================================================================================================
+func (t *SimpleChaincode) change_dispute(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0            1         2         3
+	   "disputeID", "status", "note", ["{currency: amount}"]
+	   -------------------------------------------------------
+	*/
+
+	d, err := t.getDispute(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	status := args[1]
+
+	tr := findDisputeTransition(d.Status, status)
+	if tr == nil {
+		return nil, errors.New("Illegal dispute status change from " + d.Status + " to " + status)
+	}
+	org := d.Hospital
+	if tr.side == LAB {
+		org = d.Lab
+	}
+	err = t.requireCallerMember(stub, org)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == DISPUTE_ACCEPTED {
+		d.Credit = d.Disputed
+		if len(args) > 3 && args[3] != "" {
+			var credit map[string]int64
+			err = json.Unmarshal([]byte(args[3]), &credit)
+			if err != nil {
+				return nil, errors.New("Credit must be a JSON object of currency to amount")
+			}
+			for currency, amount := range credit {
+				if amount < 0 || amount > d.Disputed[currency] {
+					return nil, fmt.Errorf("Credit in %s must be between 0 and the disputed %d", currency, d.Disputed[currency])
+				}
+			}
+			d.Credit = credit
+		}
+	}
+	if status == DISPUTE_OPEN {
+		d.Credit = nil
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	d.Status = status
+	d.History = append(d.History, disputeEvent{Status: status, By: caller, At: timeStamp, Note: args[2]})
+
+	err = t.putDispute(stub, d)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Dispute " + d.ID + " is " + status)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Get Dispute - A dispute with its history, for the staff of either party
+// ============================================================================================================================
+func (t *SimpleChaincode) get_dispute(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	d, err := t.getDispute(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	_, err = t.requireParty(stub, d.Hospital, d.Lab)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(d)
+}
@@ -0,0 +1,226 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testSettlement struct {
+	Charges      []charge         `json:"charges"`
+	Total        map[string]int64 `json:"total"`
+	Credit       map[string]int64 `json:"credit"`
+	Net          map[string]int64 `json:"net"`
+	OpenDisputes int              `json:"openDisputes"`
+	Digest       string           `json:"digest"`
+}
+
+// recordResult orders a test with panel, assigns it to the lab and records the scenario result
+func (s *scenario) recordResult(id string, panel string) []byte {
+	order := s.orderArgs()
+	order[7] = id
+	order[10] = panel
+	s.mustInvoke(DOCTOR, "init_bloodtest", order...)
+	s.mustInvoke(HOSPITAL, "change_status", id, STATUS_RECEIVED)
+	s.mustInvoke(HOSPITAL, "change_lab", id, scenarioLab)
+	s.mustInvoke(HOSPITAL, "change_status", id, STATUS_ASSIGNED)
+	return s.mustInvoke(LAB, "change_result", id, scenarioResult)
+}
+
+func (s *scenario) settlement(role string) testSettlement {
+	var settlement testSettlement
+	response, err := s.query(role, "get_settlement", scenarioHospital, scenarioLab, "2017-01")
+	if err != nil {
+		s.t.Fatalf("Failed to get the settlement: %s", err)
+	}
+	if err = json.Unmarshal(response, &settlement); err != nil {
+		s.t.Fatalf("Failed to unmarshal the settlement: %s", err)
+	}
+	return settlement
+}
+
+// ============================================================================================================================
+// TestSetLabPrices - Only the staff of a lab price the codes of its catalogue
+// ============================================================================================================================
+func TestSetLabPrices(t *testing.T) {
+	s := newScenario(t)
+
+	tests := []struct {
+		name    string
+		role    string
+		prices  string
+		wantErr string
+	}{
+		{"not in catalogue", LAB, `[{"code":"2951-2","amount":100,"currency":"DKK"}]`, "2951-2"},
+		{"negative", LAB, `[{"code":"718-7","amount":-1,"currency":"DKK"}]`, "can not be negative"},
+		{"bad currency", LAB, `[{"code":"718-7","amount":100,"currency":"kr"}]`, "ISO 4217"},
+		{"empty", LAB, `[]`, "JSON array"},
+		{"not on the staff", HOSPITAL, `[{"code":"718-7","amount":100,"currency":"DKK"}]`, "ACCESS_DENIED"},
+		{"new price", LAB, `[{"code":"718-7","amount":1600,"currency":"DKK"}]`, ""},
+	}
+	for _, test := range tests {
+		_, err := s.invoke(test.role, "set_lab_prices", scenarioLab, test.prices)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("%s: expected an error containing %q, got %v", test.name, test.wantErr, err)
+		}
+	}
+
+	response, err := s.query(HOSPITAL, "get_lab_prices", scenarioLab)
+	if err != nil {
+		t.Fatalf("Failed to get the prices: %s", err)
+	}
+	var prices []price
+	if err = json.Unmarshal(response, &prices); err != nil || len(prices) != 2 {
+		t.Fatalf("Expected 2 prices, got %s", response)
+	}
+	for _, p := range prices {
+		if p.Code == "718-7" && (p.Amount != 1600 || p.UpdatedBy != s.fingerprint(LAB)) {
+			t.Fatalf("Expected the new price of 718-7, got %+v", p)
+		}
+	}
+}
+
+// ============================================================================================================================
+// TestChargesOnResult - The first result accrues the charges, unpriced codes are reported without blocking the result or
+// its release, corrections are not billed again
+// ============================================================================================================================
+func TestChargesOnResult(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(ADMIN, "set_lab_catalogue", scenarioLab, `["718-7","2345-7","2951-2"]`)
+
+	response := s.recordResult(scenarioTest, `["718-7","2345-7","2951-2"]`)
+	var reported struct {
+		Unpriced []string `json:"unpriced"`
+	}
+	if err := json.Unmarshal(response, &reported); err != nil || len(reported.Unpriced) != 1 || reported.Unpriced[0] != "2951-2" {
+		t.Fatalf("Expected 2951-2 to be reported unpriced, got %s", response)
+	}
+	settlement := s.settlement(LAB)
+	if len(settlement.Charges) != 2 || settlement.Total["DKK"] != 2400 {
+		t.Fatalf("Expected 2 charges of 2400 DKK on the result, got %+v", settlement)
+	}
+	for _, c := range settlement.Charges {
+		if c.BloodTestID != scenarioTest || c.AccruedAt[:7] != c.Period {
+			t.Fatalf("Unexpected charge %+v", c)
+		}
+	}
+
+	s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_ANALYSED)
+	if response = s.mustInvoke(LAB, "change_result", scenarioTest, scenarioResult); response != nil {
+		t.Fatalf("Expected a correction not to be billed, got %s", response)
+	}
+	s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_RELEASED)
+	if after := s.settlement(HOSPITAL); len(after.Charges) != 2 || after.Total["DKK"] != 2400 {
+		t.Fatalf("Expected the correction and the release not to add charges, got %+v", after)
+	}
+}
+
+// ============================================================================================================================
+// TestDisputes - A hospital disputes charges, the lab reviews and credits part of them. Every step is taken by its side only
+// ============================================================================================================================
+func TestDisputes(t *testing.T) {
+	s := newScenario(t)
+	s.recordResult(scenarioTest, `["718-7","2345-7"]`)
+	s.recordResult("bt2", `["718-7"]`)
+
+	if _, err := s.invoke(LAB, "raise_dispute", scenarioHospital, scenarioLab, "2017-01", scenarioTest, "too expensive"); err == nil {
+		t.Fatal("Expected the lab to be refused to raise a dispute")
+	}
+	if _, err := s.invoke(HOSPITAL, "raise_dispute", scenarioHospital, scenarioLab, "2017-02", scenarioTest, "too expensive"); err == nil {
+		t.Fatal("Expected a dispute of a period without charges to be refused")
+	}
+	id := string(s.mustInvoke(HOSPITAL, "raise_dispute", scenarioHospital, scenarioLab, "2017-01", scenarioTest, "too expensive"))
+
+	steps := []struct {
+		name    string
+		role    string
+		args    []string
+		wantErr string
+	}{
+		{"accept before review", LAB, []string{id, DISPUTE_ACCEPTED, ""}, "Illegal dispute status change"},
+		{"review by the hospital", HOSPITAL, []string{id, DISPUTE_UNDER_REVIEW, ""}, "not on the staff of " + scenarioLab},
+		{"review", LAB, []string{id, DISPUTE_UNDER_REVIEW, "looking into it"}, ""},
+		{"credit above the disputed", LAB, []string{id, DISPUTE_ACCEPTED, "", `{"DKK":2401}`}, "between 0 and the disputed 2400"},
+		{"accept", LAB, []string{id, DISPUTE_ACCEPTED, "price list error", `{"DKK":900}`}, ""},
+		{"withdraw accepted", HOSPITAL, []string{id, DISPUTE_WITHDRAWN, ""}, "Illegal dispute status change"},
+	}
+	for _, step := range steps {
+		_, err := s.invoke(step.role, "change_dispute", step.args...)
+		if step.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: %s", step.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+			t.Fatalf("%s: expected an error containing %q, got %v", step.name, step.wantErr, err)
+		}
+	}
+
+	response, err := s.query(HOSPITAL, "get_dispute", id)
+	if err != nil {
+		t.Fatalf("Failed to get the dispute: %s", err)
+	}
+	var d dispute
+	if err = json.Unmarshal(response, &d); err != nil || d.Status != DISPUTE_ACCEPTED || d.Disputed["DKK"] != 2400 || len(d.History) != 3 {
+		t.Fatalf("Unexpected dispute %s", response)
+	}
+
+	settlement := s.settlement(HOSPITAL)
+	if settlement.Total["DKK"] != 3900 || settlement.Credit["DKK"] != 900 || settlement.Net["DKK"] != 3000 || settlement.OpenDisputes != 0 {
+		t.Fatalf("Expected 3900 DKK less a credit of 900, got %+v", settlement)
+	}
+
+	// A period dispute stays open until the lab takes it up
+	s.mustInvoke(HOSPITAL, "raise_dispute", scenarioHospital, scenarioLab, "2017-01", "", "duplicate invoice")
+	if settlement = s.settlement(LAB); settlement.OpenDisputes != 1 || settlement.Net["DKK"] != 3000 {
+		t.Fatalf("Expected one open dispute and an unchanged net, got %+v", settlement)
+	}
+}
+
+// ============================================================================================================================
+// TestSettlementDigest - Both parties get the same digest, the SHA-256 of the charges, and it changes with every charge
+// ============================================================================================================================
+func TestSettlementDigest(t *testing.T) {
+	s := newScenario(t)
+	s.recordResult(scenarioTest, `["718-7","2345-7"]`)
+
+	hospital := s.settlement(HOSPITAL)
+	lab := s.settlement(LAB)
+	chargesAsBytes, _ := json.Marshal(hospital.Charges)
+	digest := sha256.Sum256(chargesAsBytes)
+	if hospital.Digest != hex.EncodeToString(digest[:]) || lab.Digest != hospital.Digest {
+		t.Fatalf("Expected both parties to get the digest of the charges, got %s and %s", hospital.Digest, lab.Digest)
+	}
+	if _, err := s.query(DOCTOR, "get_settlement", scenarioHospital, scenarioLab, "2017-01"); err == nil {
+		t.Fatal("Expected the settlement to be refused to a doctor")
+	}
+
+	s.recordResult("bt2", `["718-7"]`)
+	if after := s.settlement(HOSPITAL); after.Digest == hospital.Digest || len(after.Charges) != 3 {
+		t.Fatalf("Expected a new digest over 3 charges, got %+v", after)
+	}
+}
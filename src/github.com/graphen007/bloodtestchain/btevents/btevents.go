@@ -0,0 +1,152 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package btevents defines the chaincode events emitted by bloodtestchain on
+// every blood test state change, and an events/consumer adapter that hospital
+// and lab services use to subscribe to them.
+//
+// Payloads never carry patient data: no name, CPR, CPR hash or result.
+package btevents
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/events/consumer"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// PayloadVersion is the version of the Payload format. It is bumped on every
+// incompatible change so subscribers can reject payloads they do not know.
+const PayloadVersion = 1
+
+// Event names passed to SetEvent
+const (
+	Created          = "bloodtest.created"
+	DoctorAssigned   = "bloodtest.doctor_assigned"
+	HospitalAssigned = "bloodtest.hospital_assigned"
+	LabAssigned      = "bloodtest.lab_assigned"
+	StatusChanged    = "bloodtest.status_changed"
+	ResultRecorded   = "bloodtest.result_recorded"
+	ResultReleased   = "bloodtest.result_released"
+	Imported         = "bloodtest.imported"
+)
+
+// Payload is the JSON payload of every bloodtestchain event. An Imported
+// event is emitted once for a batch and lists the imported tests in
+// BloodTestIDs instead of BloodTestID
+type Payload struct {
+	Version        int      `json:"version"`
+	Event          string   `json:"event"`
+	BloodTestID    string   `json:"bloodTestID"`
+	TxID           string   `json:"txID"`
+	TimeStamp      string   `json:"timeStamp"`
+	Status         string   `json:"status"`
+	PreviousStatus string   `json:"previousStatus,omitempty"`
+	Doctor         string   `json:"doctor,omitempty"`
+	Hospital       string   `json:"hospital,omitempty"`
+	Lab            string   `json:"lab,omitempty"`
+	BloodTestIDs   []string `json:"bloodTestIDs,omitempty"`
+}
+
+// Event is a decoded chaincode event
+type Event struct {
+	ChaincodeID string
+	Payload     Payload
+}
+
+// Decode parses a chaincode event emitted by bloodtestchain
+func Decode(ce *pb.ChaincodeEvent) (*Event, error) {
+	var p Payload
+	if err := json.Unmarshal(ce.Payload, &p); err != nil {
+		return nil, fmt.Errorf("Invalid payload for event %s: %s", ce.EventName, err)
+	}
+	if p.Version != PayloadVersion {
+		return nil, fmt.Errorf("Unsupported payload version %d for event %s", p.Version, ce.EventName)
+	}
+	if p.Event != ce.EventName {
+		return nil, fmt.Errorf("Payload of event %s is for %s", ce.EventName, p.Event)
+	}
+	return &Event{ChaincodeID: ce.ChaincodeID, Payload: p}, nil
+}
+
+// Adapter implements consumer.EventAdapter and delivers the decoded events of
+// one bloodtestchain instance on Events. Undecodable events are sent on Errors.
+type Adapter struct {
+	chaincodeID string
+	eventNames  []string
+
+	Events chan *Event
+	Errors chan error
+}
+
+var _ consumer.EventAdapter = (*Adapter)(nil)
+
+// NewAdapter returns an adapter for chaincodeID. When no event names are
+// given the adapter subscribes to every event of the chaincode.
+func NewAdapter(chaincodeID string, eventNames ...string) *Adapter {
+	return &Adapter{
+		chaincodeID: chaincodeID,
+		eventNames:  eventNames,
+		Events:      make(chan *Event),
+		Errors:      make(chan error, 1),
+	}
+}
+
+// GetInterestedEvents implements consumer.EventAdapter
+func (a *Adapter) GetInterestedEvents() ([]*pb.Interest, error) {
+	names := a.eventNames
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	interests := make([]*pb.Interest, 0, len(names))
+	for _, name := range names {
+		interests = append(interests, &pb.Interest{
+			EventType: pb.EventType_CHAINCODE,
+			RegInfo: &pb.Interest_ChaincodeRegInfo{
+				ChaincodeRegInfo: &pb.ChaincodeReg{
+					ChaincodeID: a.chaincodeID,
+					EventName:   name}}})
+	}
+	return interests, nil
+}
+
+// Recv implements consumer.EventAdapter
+func (a *Adapter) Recv(msg *pb.Event) (bool, error) {
+	ce, ok := msg.Event.(*pb.Event_ChaincodeEvent)
+	if !ok {
+		return false, fmt.Errorf("Received unexpected event type: %v", msg)
+	}
+	e, err := Decode(ce.ChaincodeEvent)
+	if err != nil {
+		select {
+		case a.Errors <- err:
+		default:
+		}
+		return true, nil
+	}
+	a.Events <- e
+	return true, nil
+}
+
+// Disconnected implements consumer.EventAdapter
+func (a *Adapter) Disconnected(err error) {
+	select {
+	case a.Errors <- fmt.Errorf("Disconnected from event hub: %v", err):
+	default:
+	}
+	close(a.Events)
+}
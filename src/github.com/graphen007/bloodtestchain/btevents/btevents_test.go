@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package btevents
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func chaincodeEvent(t *testing.T, name string, p Payload) *pb.Event {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Failed to marshal the payload: %s", err)
+	}
+	return &pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{
+		ChaincodeID: "bloodtestchain",
+		TxID:        p.TxID,
+		EventName:   name,
+		Payload:     payload}}}
+}
+
+func TestAdapterRecv(t *testing.T) {
+	a := NewAdapter("bloodtestchain", StatusChanged)
+	sent := Payload{
+		Version:        PayloadVersion,
+		Event:          StatusChanged,
+		BloodTestID:    "bt1",
+		TxID:           "tx1",
+		TimeStamp:      "2017-01-01T00:00:00Z",
+		Status:         "received",
+		PreviousStatus: "ordered",
+		Doctor:         "dr-hansen",
+		Hospital:       "rigshospitalet",
+	}
+
+	done := make(chan error)
+	go func() {
+		ok, err := a.Recv(chaincodeEvent(t, StatusChanged, sent))
+		if err == nil && !ok {
+			err = errors.New("Recv asked to stop")
+		}
+		done <- err
+	}()
+
+	e := <-a.Events
+	if err := <-done; err != nil {
+		t.Fatalf("Recv failed: %s", err)
+	}
+	if e.ChaincodeID != "bloodtestchain" || !reflect.DeepEqual(e.Payload, sent) {
+		t.Fatalf("Expected %+v, got %s %+v", sent, e.ChaincodeID, e.Payload)
+	}
+}
+
+func TestAdapterRecvInvalid(t *testing.T) {
+	a := NewAdapter("bloodtestchain")
+	valid := Payload{Version: PayloadVersion, Event: Created, BloodTestID: "bt1"}
+
+	tests := []struct {
+		name  string
+		event *pb.Event
+	}{
+		{"other version", chaincodeEvent(t, Created, Payload{Version: PayloadVersion + 1, Event: Created})},
+		{"other event name", chaincodeEvent(t, StatusChanged, valid)},
+		{"not json", &pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{EventName: Created, Payload: []byte("bt1")}}}},
+	}
+	for _, test := range tests {
+		ok, err := a.Recv(test.event)
+		if err != nil || !ok {
+			t.Fatalf("%s: expected the adapter to go on receiving, got %t %v", test.name, ok, err)
+		}
+		select {
+		case <-a.Errors:
+		default:
+			t.Fatalf("%s: expected an error on Errors", test.name)
+		}
+	}
+
+	if _, err := a.Recv(&pb.Event{Event: &pb.Event_Block{Block: &pb.Block{}}}); err == nil {
+		t.Fatal("Expected a block event to be refused")
+	}
+}
+
+func TestAdapterInterests(t *testing.T) {
+	interests, _ := NewAdapter("bloodtestchain").GetInterestedEvents()
+	if len(interests) != 1 || interests[0].GetChaincodeRegInfo().EventName != "" {
+		t.Fatalf("Expected one interest in every event, got %v", interests)
+	}
+
+	interests, _ = NewAdapter("bloodtestchain", Created, ResultReleased).GetInterestedEvents()
+	if len(interests) != 2 || interests[1].GetChaincodeRegInfo().ChaincodeID != "bloodtestchain" || interests[1].GetChaincodeRegInfo().EventName != ResultReleased {
+		t.Fatalf("Expected an interest per event name, got %v", interests)
+	}
+}
+
+func TestAdapterDisconnected(t *testing.T) {
+	a := NewAdapter("bloodtestchain")
+	a.Disconnected(errors.New("connection reset"))
+	if _, ok := <-a.Events; ok {
+		t.Fatal("Expected Events to be closed")
+	}
+	if err := <-a.Errors; err == nil {
+		t.Fatal("Expected the disconnection on Errors")
+	}
+}
@@ -0,0 +1,355 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Bulk import and export - Hospitals and labs joining the network bring their historic tests as a batch of records.
+//							export_bloodtests emits the same records, so data can round-trip
+//==============================================================================================================================
+const MAX_IMPORT_BATCH = 500
+
+const ERR_INVALID_BATCH = "INVALID_BATCH"
+
+//==============================================================================================================================
+// bloodTestRecord - Import and export format of a test. Patient fields are encrypted as in init_bloodtest
+//==============================================================================================================================
+type bloodTestRecord struct {
+	BloodTestID       string            `json:"bloodTestID"`
+	TimeStampDoctor   string            `json:"timeStampDoctor"`
+	TimeStampHospital string            `json:"timeStampHospital"`
+	TimeStampLab      string            `json:"timeStampLab"`
+	TimeStampAnalyse  string            `json:"timeStampAnalyse"`
+	TimeStampResult   string            `json:"timeStampResult"`
+	Name              string            `json:"name"`
+	CPR               string            `json:"CPR"`
+	CPRHash           string            `json:"CPRHash"`
+	Doctor            string            `json:"doctor"`
+	Hospital          string            `json:"hospital"`
+	Lab               string            `json:"lab"`
+	Status            string            `json:"status"`
+	Result            string            `json:"result,omitempty"`
+	Results           []analyte         `json:"results,omitempty"`
+	Panel             []string          `json:"panel,omitempty"`
+	Keys              map[string]string `json:"keys"`
+}
+
+func recordFromBloodTest(res *bloodTest) bloodTestRecord {
+	return bloodTestRecord{
+		BloodTestID:       res.BloodTestID,
+		TimeStampDoctor:   res.TimeStampDoctor,
+		TimeStampHospital: res.TimeStampHospital,
+		TimeStampLab:      res.TimeStampLab,
+		TimeStampAnalyse:  res.TimeStampAnalyse,
+		TimeStampResult:   res.TimeStampResult,
+		Name:              res.Name,
+		CPR:               res.CPR,
+		CPRHash:           res.CPRHash,
+		Doctor:            res.Doctor,
+		Hospital:          res.Hospital,
+		Lab:               res.Lab,
+		Status:            res.Status,
+		Result:            res.Result,
+		Results:           res.Results,
+		Panel:             res.Panel,
+		Keys:              res.Keys,
+	}
+}
+
+func (r *bloodTestRecord) bloodTest(orderedBy string) bloodTest {
+	return bloodTest{
+		TimeStampDoctor:   r.TimeStampDoctor,
+		TimeStampHospital: r.TimeStampHospital,
+		TimeStampLab:      r.TimeStampLab,
+		TimeStampAnalyse:  r.TimeStampAnalyse,
+		TimeStampResult:   r.TimeStampResult,
+		Name:              r.Name,
+		CPR:               r.CPR,
+		CPRHash:           r.CPRHash,
+		Doctor:            r.Doctor,
+		Hospital:          r.Hospital,
+		Lab:               r.Lab,
+		Status:            r.Status,
+		Result:            r.Result,
+		Results:           r.Results,
+		BloodTestID:       r.BloodTestID,
+		OrderedBy:         orderedBy,
+		Keys:              r.Keys,
+		Panel:             r.Panel,
+	}
+}
+
+//==============================================================================================================================
+// batchError - Returned when any record of an import is invalid. Nothing of the batch is written
+//==============================================================================================================================
+type recordError struct {
+	Index       int    `json:"index"`
+	BloodTestID string `json:"bloodTestID,omitempty"`
+	Message     string `json:"message"`
+}
+
+type batchError struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Errors  []recordError `json:"errors"`
+}
+
+func (e *batchError) Error() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e.Code + ": " + e.Message
+	}
+	return string(b)
+}
+
+// ============================================================================================================================
+// callerOrganisation - Returns the role and the registered organisation of a hospital or lab caller
+// ============================================================================================================================
+func (t *SimpleChaincode) callerOrganisation(stub shim.ChaincodeStubInterface) (string, string, error) {
+	role := bloodTestRoutes.callerRole(t, stub)
+	if role != HOSPITAL && role != LAB {
+		return "", "", errors.New("Caller is not a hospital or lab")
+	}
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return "", "", err
+	}
+	org, err := t.memberOrganisation(stub, caller, role)
+	if err != nil {
+		return "", "", err
+	}
+	if org == "" {
+		return "", "", errors.New("Caller is not on the staff of a registered " + role)
+	}
+	return role, org, nil
+}
+
+// ============================================================================================================================
+// checkRecordOrganisations - The hospital and an assigned lab of an imported record must be registered, like they must be
+// for tests ordered on the chain
+// ============================================================================================================================
+func (t *SimpleChaincode) checkRecordOrganisations(stub shim.ChaincodeStubInterface, r *bloodTestRecord) error {
+	_, err := t.requireOrganisation(stub, r.Hospital, HOSPITAL)
+	if err != nil {
+		return err
+	}
+	if r.Lab == "" || r.Lab == "unassigned" {
+		return nil
+	}
+	lab, err := t.requireOrganisation(stub, r.Lab, LAB)
+	if err != nil {
+		return err
+	}
+	return checkCatalogue(lab, r.Panel)
+}
+
+// ============================================================================================================================
+// validateRecord - Checks one imported record. caller must hold a wrapped key, org must own the record
+// ============================================================================================================================
+func validateRecord(r *bloodTestRecord, role string, org string, caller string) error {
+	if r.BloodTestID == "" {
+		return errors.New("bloodTestID is missing")
+	}
+	if isReservedName(r.BloodTestID) {
+		return errors.New("Blood test ID " + r.BloodTestID + " is reserved")
+	}
+	for _, part := range []string{r.BloodTestID, r.Doctor, r.Hospital, r.Lab} {
+		if err := validateKeyPart(part); err != nil {
+			return err
+		}
+	}
+	for _, code := range r.Panel {
+		if !validLOINC(code) {
+			return errors.New(code + " is not a LOINC code")
+		}
+	}
+	if role == HOSPITAL && r.Hospital != org {
+		return errors.New("Record belongs to hospital " + r.Hospital)
+	}
+	if role == LAB && r.Lab != org {
+		return errors.New("Record belongs to lab " + r.Lab)
+	}
+	if !validStatus(r.Status) {
+		return errors.New("Unknown status " + r.Status)
+	}
+	// Stamps are normalised like the stamps of new tests, so turnaround reports can compare them
+	for _, stamp := range []*string{&r.TimeStampDoctor, &r.TimeStampHospital, &r.TimeStampLab, &r.TimeStampAnalyse, &r.TimeStampResult} {
+		if *stamp == "" {
+			continue
+		}
+		normalised, err := utcTimeStamp(*stamp)
+		if err != nil {
+			return err
+		}
+		*stamp = normalised
+	}
+	err := validateEncryptedFields(r.Name, r.CPR, r.CPRHash, r.Result)
+	if err != nil {
+		return err
+	}
+	for i := range r.Results {
+		err = validateAnalyte(&r.Results[i])
+		if err != nil {
+			return err
+		}
+	}
+	if r.Status == STATUS_RELEASED && r.Result == "" && len(r.Results) == 0 {
+		return errors.New("A released test must have a result")
+	}
+	for fingerprint, wrapped := range r.Keys {
+		if validateWrappedKey(wrapped) != nil {
+			return errors.New("Invalid wrapped key for " + fingerprint)
+		}
+	}
+	if _, ok := r.Keys[caller]; !ok {
+		return errors.New("Keys must include a wrapped data key for the importer")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Import Bloodtests - Writes a batch of historic tests of the callers hospital or lab. The whole batch is validated first,
+// a single invalid record fails the transaction with the errors of every record
+// ============================================================================================================================
+func (t *SimpleChaincode) import_bloodtests(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0
+	   "[record, record, ...]"
+	   -------------------------------------------------------
+	   Every record has the format of bloodTestRecord
+	*/
+
+	var records []bloodTestRecord
+	err := json.Unmarshal([]byte(args[0]), &records)
+	if err != nil {
+		return nil, errors.New("Batch must be a JSON array of blood test records")
+	}
+	if len(records) == 0 || len(records) > MAX_IMPORT_BATCH {
+		return nil, fmt.Errorf("Batch must contain between 1 and %d records", MAX_IMPORT_BATCH)
+	}
+
+	role, org, err := t.callerOrganisation(stub)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []recordError
+	seen := make(map[string]bool)
+	for i := range records {
+		r := &records[i]
+		err = validateRecord(r, role, org, caller)
+		if err == nil && seen[r.BloodTestID] {
+			err = errors.New("Blood test is listed twice in the batch")
+		}
+		if err == nil {
+			err = t.checkRecordOrganisations(stub, r)
+		}
+		if err == nil {
+			existing, getErr := stub.GetState(r.BloodTestID)
+			if getErr != nil {
+				return nil, errors.New("Failed to get blood test " + r.BloodTestID)
+			}
+			if existing != nil {
+				err = errors.New("This blood test already exists")
+			}
+		}
+		if err != nil {
+			errs = append(errs, recordError{Index: i, BloodTestID: r.BloodTestID, Message: err.Error()})
+		}
+		seen[r.BloodTestID] = true
+	}
+	if len(errs) > 0 {
+		return nil, &batchError{Code: ERR_INVALID_BATCH, Message: fmt.Sprintf("%d of %d records are invalid", len(errs), len(records)), Errors: errs}
+	}
+
+	ids := make([]string, 0, len(records))
+	for i := range records {
+		res := records[i].bloodTest(caller)
+		err = t.saveBloodTest(stub, nil, &res)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, res.BloodTestID)
+	}
+
+	err = t.emitImportEvent(stub, role, org, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Imported blood tests: ", len(records))
+	return []byte(fmt.Sprintf(`{"imported":%d}`, len(records))), nil
+}
+
+// ============================================================================================================================
+// Export Bloodtests - Page of the tests of the callers hospital or lab in the import format. Tests without consent are
+// left out like in every other read, so a page can hold fewer tests than pageSize.
+// Our model looks like: ["pageSize"] ["bookmark"]
+// ============================================================================================================================
+func (t *SimpleChaincode) export_bloodtests(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	role, org, err := t.callerOrganisation(stub)
+	if err != nil {
+		return nil, err
+	}
+	attribute := IDX_HOSPITAL
+	if role == LAB {
+		attribute = IDX_LAB
+	}
+
+	pageSize, bookmark, err := parsePage(args)
+	if err != nil {
+		return nil, err
+	}
+	ids, next, err := t.scanIndex(stub, attribute, org, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	page := struct {
+		Records  []bloodTestRecord `json:"records"`
+		Bookmark string            `json:"bookmark"`
+	}{Records: []bloodTestRecord{}, Bookmark: next}
+
+	for _, id := range ids {
+		res, err := t.getBloodTest(stub, id)
+		if err != nil {
+			return nil, err
+		}
+		granted, err := t.checkAccess(stub, res)
+		if err != nil {
+			return nil, err
+		}
+		if granted {
+			page.Records = append(page.Records, recordFromBloodTest(res))
+		}
+	}
+
+	return json.Marshal(page)
+}
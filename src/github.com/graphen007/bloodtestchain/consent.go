@@ -0,0 +1,406 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/graphen007/bloodtestchain/patientcrypto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Consent - A patient grants doctors, hospitals and labs read access to one test or to all of their tests until an expiry.
+//			 Grants live under "consent" 0x00 CPRHash 0x00 grantee 0x00 scope, a patient is linked to their CPRHash by an
+//			 admin under "patient" 0x00 fingerprint
+//==============================================================================================================================
+const consentPrefix = "consent"
+const patientPrefix = "patient"
+
+// CONSENT_ALL_TESTS is the scope of a grant that covers every test of the patient
+const CONSENT_ALL_TESTS = "*"
+
+type consent struct {
+	CPRHash     string `json:"CPRHash"`
+	GrantedBy   string `json:"grantedBy"`
+	Grantee     string `json:"grantee"`
+	GranteeRole string `json:"granteeRole"`
+	Scope       string `json:"scope"`
+	Expires     string `json:"expires"`
+	GrantedAt   string `json:"grantedAt"`
+	RevokedAt   string `json:"revokedAt,omitempty"`
+}
+
+func consentPatientPrefix(cprHash string) string {
+	return consentPrefix + indexSep + cprHash + indexSep
+}
+
+func consentKey(cprHash string, grantee string, scope string) string {
+	return consentPatientPrefix(cprHash) + grantee + indexSep + scope
+}
+
+func patientKey(fingerprint string) string {
+	return patientPrefix + indexSep + fingerprint
+}
+
+// active returns true if the grant is not revoked and has not expired at now
+func (c *consent) active(now time.Time) bool {
+	if c.RevokedAt != "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, c.Expires)
+	return err == nil && now.Before(expires)
+}
+
+// txTime is the transaction timestamp as a time, used to evaluate expiries identically on every peer
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, timeStamp)
+}
+
+// ============================================================================================================================
+// getPatientCPRHash - Returns the CPRHash linked to fingerprint, empty if the certificate is not a linked patient
+// ============================================================================================================================
+func (t *SimpleChaincode) getPatientCPRHash(stub shim.ChaincodeStubInterface, fingerprint string) (string, error) {
+	cprHash, err := stub.GetState(patientKey(fingerprint))
+	if err != nil {
+		return "", errors.New("Failed to get patient " + fingerprint)
+	}
+	return string(cprHash), nil
+}
+
+func (t *SimpleChaincode) getConsent(stub shim.ChaincodeStubInterface, cprHash string, grantee string, scope string) (*consent, error) {
+	consentAsBytes, err := stub.GetState(consentKey(cprHash, grantee, scope))
+	if err != nil {
+		return nil, errors.New("Failed to get consent for " + grantee)
+	}
+	if consentAsBytes == nil {
+		return nil, nil
+	}
+	c := &consent{}
+	err = json.Unmarshal(consentAsBytes, c)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal consent for " + grantee)
+	}
+	return c, nil
+}
+
+// ============================================================================================================================
+// accessDecision - Tells whether the caller may read res and why. The patient and the ordering doctor always may,
+// everyone else needs an active grant for the test or for all tests of the patient
+// ============================================================================================================================
+func (t *SimpleChaincode) accessDecision(stub shim.ChaincodeStubInterface, res *bloodTest) (bool, string, error) {
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return false, "", err
+	}
+
+	if caller == res.OrderedBy {
+		return true, "ordering doctor", nil
+	}
+
+	cprHash, err := t.getPatientCPRHash(stub, caller)
+	if err != nil {
+		return false, "", err
+	}
+	if cprHash != "" && cprHash == res.CPRHash {
+		return true, "patient", nil
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return false, "", err
+	}
+	for _, scope := range []string{res.BloodTestID, CONSENT_ALL_TESTS} {
+		c, err := t.getConsent(stub, res.CPRHash, caller, scope)
+		if err != nil {
+			return false, "", err
+		}
+		if c != nil && c.active(now) {
+			return true, "consent " + scope + " until " + c.Expires, nil
+		}
+	}
+
+	return false, "no active consent", nil
+}
+
+// ============================================================================================================================
+// checkAccess - Runs accessDecision and records the outcome with the audit trail of the test
+// ============================================================================================================================
+func (t *SimpleChaincode) checkAccess(stub shim.ChaincodeStubInterface, res *bloodTest) (bool, error) {
+
+	granted, reason, err := t.accessDecision(stub, res)
+	if err != nil {
+		return false, err
+	}
+
+	err = t.recordAccess(stub, res.BloodTestID, granted, reason)
+	if err != nil {
+		return false, err
+	}
+
+	if !granted {
+		fmt.Println("Access denied to " + res.BloodTestID + ": " + reason)
+	}
+	return granted, nil
+}
+
+// ============================================================================================================================
+// readableBloodTest - Used by the read paths on any state value. Returns value unchanged if it is not a test, the test if
+// the caller may read it and nil otherwise
+// ============================================================================================================================
+func (t *SimpleChaincode) readableBloodTest(stub shim.ChaincodeStubInterface, key string, value []byte) ([]byte, error) {
+	res := bloodTest{}
+	if json.Unmarshal(value, &res) != nil || res.BloodTestID == "" || res.BloodTestID != key {
+		return value, nil
+	}
+
+	granted, err := t.checkAccess(stub, &res)
+	if err != nil {
+		return nil, err
+	}
+	if !granted {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// accessDenied is returned as the response of a denied read instead of an error, so the audited check is committed
+func accessDenied(stub shim.ChaincodeStubInterface, bloodTestID string) ([]byte, error) {
+	function, _ := stub.GetFunctionAndParameters()
+	return json.Marshal(&dispatchError{Code: ERR_ACCESS_DENIED, Function: function, Message: "No consent to read " + bloodTestID})
+}
+
+// ============================================================================================================================
+// Link Patient - An admin ties a client certificate to the CPRHash of the patient after checking their identity
+// ============================================================================================================================
+func (t *SimpleChaincode) link_patient(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0              1
+	   "fingerprint", "CPRHash"
+	   -------------------------------------------------------
+	*/
+
+	role, err := t.activeRole(stub, args[0], CLIENT)
+	if err != nil {
+		return nil, err
+	}
+	if role != CLIENT {
+		return nil, errors.New(args[0] + " is not an active client")
+	}
+	if !patientcrypto.IsCPRHash(args[1]) {
+		return nil, errors.New("CPRHash must be a hex encoded HMAC-SHA256")
+	}
+
+	linked, err := t.getPatientCPRHash(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if linked != "" && linked != args[1] {
+		return nil, errors.New(args[0] + " is already linked to another patient")
+	}
+
+	err = stub.PutState(patientKey(args[0]), []byte(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Linked patient " + args[0])
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Grant Consent - The patient gives a doctor, hospital or lab read access to one test or to "*" until expires (RFC3339)
+// ============================================================================================================================
+func (t *SimpleChaincode) grant_consent(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0              1          2
+	   "grantee",  "bloodTestID|*", "expires"
+	   -------------------------------------------------------
+	*/
+
+	grantee := args[0]
+	scope := args[1]
+	for _, part := range []string{grantee, scope} {
+		if err := validateKeyPart(part); err != nil {
+			return nil, err
+		}
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	cprHash, err := t.getPatientCPRHash(stub, caller)
+	if err != nil {
+		return nil, err
+	}
+	if cprHash == "" {
+		return nil, errors.New("Caller is not linked to a patient")
+	}
+
+	if scope != CONSENT_ALL_TESTS {
+		res, err := t.getBloodTest(stub, scope)
+		if err != nil {
+			return nil, err
+		}
+		if res.CPRHash != cprHash {
+			return nil, errors.New("Blood test " + scope + " does not belong to the caller")
+		}
+	}
+
+	granteeRole, err := t.activeRole(stub, grantee, DOCTOR, HOSPITAL, LAB)
+	if err != nil {
+		return nil, err
+	}
+	if granteeRole == "" {
+		return nil, errors.New("Grantee " + grantee + " is not an active doctor, hospital or lab")
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	expires, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return nil, errors.New("Expiry must be an RFC3339 timestamp")
+	}
+	if !now.Before(expires) {
+		return nil, errors.New("Expiry must be in the future")
+	}
+
+	c := consent{
+		CPRHash:     cprHash,
+		GrantedBy:   caller,
+		Grantee:     grantee,
+		GranteeRole: granteeRole,
+		Scope:       scope,
+		Expires:     expires.UTC().Format(time.RFC3339),
+		GrantedAt:   now.Format(time.RFC3339),
+	}
+	jsonAsBytes, _ := json.Marshal(c)
+	err = stub.PutState(consentKey(cprHash, grantee, scope), jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Granted consent " + scope + " to " + grantee)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Revoke Consent - The patient withdraws a grant. The record is kept with the time of revocation
+// ============================================================================================================================
+func (t *SimpleChaincode) revoke_consent(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0              1
+	   "grantee",  "bloodTestID|*"
+	   -------------------------------------------------------
+	*/
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	cprHash, err := t.getPatientCPRHash(stub, caller)
+	if err != nil {
+		return nil, err
+	}
+	if cprHash == "" {
+		return nil, errors.New("Caller is not linked to a patient")
+	}
+
+	c, err := t.getConsent(stub, cprHash, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || c.RevokedAt != "" {
+		return nil, errors.New("No consent " + args[1] + " for " + args[0] + " to revoke")
+	}
+
+	c.RevokedAt, err = txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	jsonAsBytes, _ := json.Marshal(c)
+	err = stub.PutState(consentKey(cprHash, args[0], args[1]), jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Revoked consent " + args[1] + " of " + args[0])
+	return nil, nil
+}
+
+// ============================================================================================================================
+// List Consents - Every grant the calling patient has made, including revoked and expired ones
+// ============================================================================================================================
+func (t *SimpleChaincode) list_consents(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	cprHash, err := t.getPatientCPRHash(stub, caller)
+	if err != nil {
+		return nil, err
+	}
+	if cprHash == "" {
+		return nil, errors.New("Caller is not linked to a patient")
+	}
+
+	prefix := consentPatientPrefix(cprHash)
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to get consents")
+	}
+	defer iter.Close()
+
+	consents := []consent{}
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get consents")
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var c consent
+		err = json.Unmarshal(value, &c)
+		if err != nil {
+			return nil, errors.New("Failed to unmarshal consent " + key)
+		}
+		consents = append(consents, c)
+	}
+
+	return json.Marshal(struct {
+		Consents []consent `json:"consents"`
+	}{consents})
+}
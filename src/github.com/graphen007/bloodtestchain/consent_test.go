@@ -0,0 +1,113 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readable tells whether role gets each of ids through read
+func (s *scenario) readable(role string, ids ...string) []bool {
+	readable := make([]bool, len(ids))
+	for i, id := range ids {
+		readable[i] = !denied(s.mustInvoke(role, "read", id))
+	}
+	return readable
+}
+
+// ============================================================================================================================
+// TestConsentLifecycle - A grant for one test or for all tests gives access until it expires or is revoked
+// ============================================================================================================================
+func TestConsentLifecycle(t *testing.T) {
+	s := newScenario(t)
+	s.at(0)
+	s.orderTests("bt1", "bt2")
+	s.mustInvoke(ADMIN, "link_patient", s.fingerprint(CLIENT), strings.Repeat("ab", 32))
+	hospital := s.fingerprint(HOSPITAL)
+
+	steps := []struct {
+		name     string
+		step     func()
+		at       time.Duration
+		readable []bool
+	}{
+		{name: "no grant", readable: []bool{false, false}},
+		{name: "grant for one test", step: func() {
+			s.mustInvoke(CLIENT, "grant_consent", hospital, "bt1", stamp(2*time.Hour))
+		}, at: time.Hour, readable: []bool{true, false}},
+		{name: "expired", at: 2 * time.Hour, readable: []bool{false, false}},
+		{name: "grant for all tests", step: func() {
+			s.mustInvoke(CLIENT, "grant_consent", hospital, CONSENT_ALL_TESTS, stamp(10*time.Hour))
+		}, at: 3 * time.Hour, readable: []bool{true, true}},
+		{name: "all tests revoked", step: func() {
+			s.mustInvoke(CLIENT, "revoke_consent", hospital, CONSENT_ALL_TESTS)
+		}, at: 4 * time.Hour, readable: []bool{false, false}},
+		{name: "grant for one test again", step: func() {
+			s.mustInvoke(CLIENT, "grant_consent", hospital, "bt1", stamp(10*time.Hour))
+		}, at: 5 * time.Hour, readable: []bool{true, false}},
+		{name: "one test revoked", step: func() {
+			s.mustInvoke(CLIENT, "revoke_consent", hospital, "bt1")
+		}, at: 6 * time.Hour, readable: []bool{false, false}},
+	}
+	for _, step := range steps {
+		s.at(step.at)
+		if step.step != nil {
+			step.step()
+		}
+		if readable := s.readable(HOSPITAL, "bt1", "bt2"); !reflect.DeepEqual(readable, step.readable) {
+			t.Fatalf("%s: expected readable %v, got %v", step.name, step.readable, readable)
+		}
+	}
+
+	if _, err := s.invoke(CLIENT, "revoke_consent", hospital, "bt1"); err == nil {
+		t.Fatal("Expected a revoked grant to be refused to revoke again")
+	}
+	if _, err := s.invoke(CLIENT, "grant_consent", hospital, "bt1", stamp(time.Hour)); err == nil {
+		t.Fatal("Expected an expiry in the past to be refused")
+	}
+	if _, err := s.invoke(HOSPITAL, "grant_consent", hospital, "bt1", stamp(10*time.Hour)); err == nil {
+		t.Fatal("Expected a grant by a caller that is not the patient to be refused")
+	}
+}
+
+// ============================================================================================================================
+// TestClientRead - The patient reads their tests by their CPR hash, nobody else gets them without consent
+// ============================================================================================================================
+func TestClientRead(t *testing.T) {
+	s := newScenario(t)
+	s.orderTests("bt1", "bt2")
+	cprHash := strings.Repeat("ab", 32)
+
+	s.enroll("other client", CLIENT)
+	s.mustInvoke(ADMIN, "link_patient", s.fingerprint("other client"), strings.Repeat("cd", 32))
+	if pages := s.readAll("other client", "client_read", cprHash, 10); !reflect.DeepEqual(pages, [][]string{{}}) {
+		t.Fatalf("Expected another patient to get no tests, got %v", pages)
+	}
+	if pages := s.readAll(CLIENT, "client_read", cprHash, 10); !reflect.DeepEqual(pages, [][]string{{}}) {
+		t.Fatalf("Expected an unlinked patient to get no tests, got %v", pages)
+	}
+
+	s.mustInvoke(ADMIN, "link_patient", s.fingerprint(CLIENT), cprHash)
+	if pages := s.readAll(CLIENT, "client_read", cprHash, 10); !reflect.DeepEqual(pages, [][]string{{"bt1", "bt2"}}) {
+		t.Fatalf("Expected the patient to get their tests, got %v", pages)
+	}
+	if _, err := s.invoke(HOSPITAL, "client_read", cprHash); err == nil {
+		t.Fatal("Expected client_read to be refused to the hospital")
+	}
+}
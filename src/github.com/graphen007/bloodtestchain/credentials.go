@@ -0,0 +1,307 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Credentials - Accounts are bound to the certificate that created them and are stored under accountKey, so a username can
+//				 never name a test or any other record. Only accounts migrated from records with a plaintext password have
+//				 a credential, the salted PBKDF2 hash of that password under its own key prefix
+//==============================================================================================================================
+const credentialPrefix = "_credential_"
+const accountPrefix = "account"
+const accountsMigratedKey = "_accountsMigrated"
+
+const HASH_ALGORITHM = "pbkdf2-sha256"
+const HASH_ITERATIONS = 10000
+const HASH_LENGTH = 32
+
+type credential struct {
+	Algorithm  string `json:"algorithm"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	Hash       string `json:"hash"`
+}
+
+//==============================================================================================================================
+// legacyAccount - Shape of account records written before passwords were hashed
+//==============================================================================================================================
+type legacyAccount struct {
+	TypeOfUser string `json:"typeOfUser"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+}
+
+func accountKey(username string) string {
+	return accountPrefix + indexSep + username
+}
+
+// pbkdf2SHA256 derives keyLen bytes from password and salt as defined in RFC 2898
+func pbkdf2SHA256(password []byte, salt []byte, iterations int, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:4])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+// ============================================================================================================================
+// newCredential - Hashes password with a salt derived from the transaction ID, so every endorser computes the same record
+// ============================================================================================================================
+func newCredential(stub shim.ChaincodeStubInterface, username string, password string) (*credential, error) {
+	if len(password) == 0 {
+		return nil, errors.New("Password can not be empty")
+	}
+
+	salt := sha256.Sum256([]byte(stub.GetTxID() + ":" + username))
+	return &credential{
+		Algorithm:  HASH_ALGORITHM,
+		Iterations: HASH_ITERATIONS,
+		Salt:       hex.EncodeToString(salt[:]),
+		Hash:       hex.EncodeToString(pbkdf2SHA256([]byte(password), salt[:], HASH_ITERATIONS, HASH_LENGTH)),
+	}, nil
+}
+
+// matches compares password against the stored hash in constant time
+func (c *credential) matches(password string) bool {
+	if c.Algorithm != HASH_ALGORITHM {
+		return false
+	}
+	salt, err := hex.DecodeString(c.Salt)
+	if err != nil {
+		return false
+	}
+	hash, err := hex.DecodeString(c.Hash)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(hash, pbkdf2SHA256([]byte(password), salt, c.Iterations, len(hash)))
+}
+
+// ============================================================================================================================
+// saveCredential / getCredential - Credentials live under credentialPrefix + username and are never returned by read
+// ============================================================================================================================
+func (t *SimpleChaincode) saveCredential(stub shim.ChaincodeStubInterface, username string, password string) error {
+	c, err := newCredential(stub, username, password)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(c)
+	return stub.PutState(credentialPrefix+username, jsonAsBytes)
+}
+
+func (t *SimpleChaincode) getCredential(stub shim.ChaincodeStubInterface, username string) (*credential, error) {
+	credAsBytes, err := stub.GetState(credentialPrefix + username)
+	if err != nil {
+		return nil, errors.New("Failed to get credential for " + username)
+	}
+	if credAsBytes == nil {
+		return nil, nil
+	}
+	c := &credential{}
+	err = json.Unmarshal(credAsBytes, c)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal credential for " + username)
+	}
+	return c, nil
+}
+
+// isProtectedKey returns true for keys that must not be accessed through read and write
+func isProtectedKey(key string) bool {
+	for _, prefix := range []string{credentialPrefix, identityChaincodeKey, accountPrefix + indexSep, auditPrefix + indexSep, accessPrefix + indexSep, consentPrefix + indexSep, patientPrefix + indexSep,
+		samplePrefix + indexSep, orgPrefix + indexSep, memberPrefix + indexSep, memberOfPrefix + indexSep,
+		pricePrefix + indexSep, chargePrefix + indexSep, disputePrefix + indexSep, disputeIndexPrefix + indexSep, slaPrefix + indexSep, migrateCheckpointKey, accountsMigratedKey, accountIndex} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReservedName returns true for names that can not be given to a test or an account. Records and markers of the chaincode
+// are stored under protected keys and names starting with _, * is the scope of a consent to all tests
+func isReservedName(name string) bool {
+	return name == "" || name == CONSENT_ALL_TESTS || strings.HasPrefix(name, "_") || isProtectedKey(name)
+}
+
+// ============================================================================================================================
+// getAccount - Returns the account of username, nil if there is none
+// ============================================================================================================================
+func (t *SimpleChaincode) getAccount(stub shim.ChaincodeStubInterface, username string) (*account, error) {
+
+	accountAsBytes, err := stub.GetState(accountKey(username))
+	if err != nil {
+		return nil, errors.New("Error getting state for username")
+	}
+	if accountAsBytes == nil {
+		return nil, nil
+	}
+	acc := &account{}
+	err = json.Unmarshal(accountAsBytes, acc)
+	if err != nil || acc.Username != username {
+		return nil, nil
+	}
+	err = upgradeAccount(acc)
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// ============================================================================================================================
+// checkCredentials - Returns the migrated account of username if password matches, nil otherwise
+// ============================================================================================================================
+func (t *SimpleChaincode) checkCredentials(stub shim.ChaincodeStubInterface, username string, password string) (*account, error) {
+
+	acc, err := t.getAccount(stub, username)
+	if err != nil || acc == nil {
+		return nil, err
+	}
+
+	c, err := t.getCredential(stub, username)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || !c.matches(password) {
+		return nil, nil
+	}
+	return acc, nil
+}
+
+// ============================================================================================================================
+// Verify Credentials - Tells whether username and password match, never returns the stored secret. Only accounts migrated
+// from records with a plaintext password have one, it is only checked by query so it is never stored in a block
+// ============================================================================================================================
+func (t *SimpleChaincode) verify_credentials(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	       0	     1
+	   "username"  "password"
+	   -------------------------------------------------------
+	*/
+
+	acc, err := t.checkCredentials(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	type verification struct {
+		Username   string `json:"username"`
+		TypeOfUser string `json:"typeOfUser,omitempty"`
+		Valid      bool   `json:"valid"`
+	}
+	if acc == nil {
+		return json.Marshal(verification{Username: args[0], Valid: false})
+	}
+	return json.Marshal(verification{Username: acc.Username, TypeOfUser: acc.TypeOfUser, Valid: true})
+}
+
+// ============================================================================================================================
+// Migrate Accounts - One-time rewrite of every account that still stores a plaintext password. The account is moved from
+// its username to accountKey
+// ============================================================================================================================
+func (t *SimpleChaincode) migrate_accounts(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	done, err := stub.GetState(accountsMigratedKey)
+	if err != nil {
+		return nil, errors.New("Failed to get migration marker")
+	}
+	if done != nil {
+		return nil, errors.New("Accounts have already been migrated")
+	}
+
+	accountList, err := stub.GetState(accountIndex)
+	if err != nil {
+		return nil, errors.New("Failed to get accountList")
+	}
+	var accInd []string
+	if accountList != nil {
+		err = json.Unmarshal(accountList, &accInd)
+		if err != nil {
+			return nil, errors.New("Failed to unmarshal accountList")
+		}
+	}
+
+	migrated := 0
+	for _, username := range accInd {
+		accountAsBytes, err := stub.GetState(username)
+		if err != nil {
+			return nil, errors.New("Failed to get account " + username)
+		}
+		legacy := legacyAccount{}
+		if err = json.Unmarshal(accountAsBytes, &legacy); err != nil || legacy.Password == "" {
+			continue
+		}
+
+		err = t.saveCredential(stub, username, legacy.Password)
+		if err != nil {
+			return nil, err
+		}
+		jsonAsBytes, _ := json.Marshal(account{TypeOfUser: legacy.TypeOfUser, Username: legacy.Username, SchemaVersion: ACCOUNT_SCHEMA_VERSION})
+		err = stub.PutState(accountKey(username), jsonAsBytes)
+		if err != nil {
+			return nil, err
+		}
+		err = stub.DelState(username)
+		if err != nil {
+			return nil, err
+		}
+		migrated++
+	}
+
+	err = stub.PutState(accountsMigratedKey, []byte(stub.GetTxID()))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Migrated accounts: ", migrated)
+	return []byte(fmt.Sprintf(`{"migrated":%d}`, migrated)), nil
+}
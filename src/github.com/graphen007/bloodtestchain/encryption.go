@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/graphen007/bloodtestchain/patientcrypto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Field encryption - The chaincode never sees patient data in the clear. Clients encrypt name, CPR and result with a per
+//					  test data key and wrap that key for every party allowed to read it
+//==============================================================================================================================
+
+// validateEncryptedFields checks that the patient fields are ciphertext and the CPR hash is well formed
+func validateEncryptedFields(name string, cpr string, cprHash string, result string) error {
+	if !patientcrypto.IsEnvelope(name) {
+		return errors.New("Name must be encrypted")
+	}
+	if !patientcrypto.IsEnvelope(cpr) {
+		return errors.New("CPR must be encrypted")
+	}
+	if !patientcrypto.IsCPRHash(cprHash) {
+		return errors.New("CPRHash must be a hex encoded HMAC-SHA256")
+	}
+	if result != "" && !patientcrypto.IsEnvelope(result) {
+		return errors.New("Result must be encrypted")
+	}
+	return nil
+}
+
+// parseWrappedKeys parses a JSON object of certificate fingerprint -> base64 wrapped data key
+func parseWrappedKeys(arg string) (map[string]string, error) {
+	keys := make(map[string]string)
+	err := json.Unmarshal([]byte(arg), &keys)
+	if err != nil {
+		return nil, errors.New("Keys must be a JSON object of fingerprint to wrapped key")
+	}
+	for fingerprint, wrapped := range keys {
+		if err := validateWrappedKey(wrapped); err != nil {
+			return nil, errors.New("Invalid wrapped key for " + fingerprint)
+		}
+	}
+	return keys, nil
+}
+
+func validateWrappedKey(wrapped string) error {
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(raw) == 0 {
+		return errors.New("Wrapped key must be base64 encoded")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Share Key - The ordering doctor gives the assigned lab or the patient access to the data key of a test
+// ============================================================================================================================
+func (t *SimpleChaincode) share_key(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0              1              2
+	   "bloodTestID", "fingerprint", "wrappedKey"
+	   -------------------------------------------------------
+	*/
+
+	old, err := t.getBloodTest(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	res := *old
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller != res.OrderedBy {
+		return nil, errors.New("Only the ordering doctor can share the data key")
+	}
+
+	err = validateWrappedKey(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	// The recipient must be an active lab, patient or doctor
+	role, err := t.activeRole(stub, args[1], LAB, CLIENT, DOCTOR)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, errors.New("Recipient " + args[1] + " is not an active lab, client or doctor")
+	}
+
+	// Copy the map so old keeps the previous keys
+	res.Keys = make(map[string]string)
+	for fingerprint, wrapped := range old.Keys {
+		res.Keys[fingerprint] = wrapped
+	}
+	res.Keys[args[1]] = args[2]
+
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Shared data key of " + args[0] + " with " + args[1])
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Get Data Key - Returns the data key of a test wrapped for the caller
+// ============================================================================================================================
+func (t *SimpleChaincode) get_data_key(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	res, err := t.getBloodTest(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := t.checkAccess(stub, res)
+	if err != nil {
+		return nil, err
+	}
+	if !granted {
+		return accessDenied(stub, args[0])
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, ok := res.Keys[caller]
+	if !ok {
+		return nil, errors.New("No data key has been shared with the caller")
+	}
+	return []byte(wrapped), nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/graphen007/bloodtestchain/btevents"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Events - Every state change of a test emits one chaincode event, so front-ends no longer poll the *_read queries.
+//			A transaction carries a single event, the last SetEvent wins
+//==============================================================================================================================
+
+// ============================================================================================================================
+// emitEvent - Publishes name for res. old is nil for a new test. The payload never contains patient data
+// ============================================================================================================================
+func (t *SimpleChaincode) emitEvent(stub shim.ChaincodeStubInterface, name string, old *bloodTest, res *bloodTest) error {
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return err
+	}
+
+	payload := btevents.Payload{
+		Version:     btevents.PayloadVersion,
+		Event:       name,
+		BloodTestID: res.BloodTestID,
+		TxID:        stub.GetTxID(),
+		TimeStamp:   timeStamp,
+		Status:      res.Status,
+		Doctor:      res.Doctor,
+		Hospital:    res.Hospital,
+		Lab:         res.Lab,
+	}
+	if old != nil && old.Status != res.Status {
+		payload.PreviousStatus = old.Status
+	}
+
+	jsonAsBytes, _ := json.Marshal(payload)
+	err = stub.SetEvent(name, jsonAsBytes)
+	if err != nil {
+		return errors.New("Failed to set event " + name)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// emitImportEvent - Publishes a single Imported event for a batch of new tests, since a transaction carries one event
+// ============================================================================================================================
+func (t *SimpleChaincode) emitImportEvent(stub shim.ChaincodeStubInterface, role string, org string, ids []string) error {
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return err
+	}
+
+	payload := btevents.Payload{
+		Version:      btevents.PayloadVersion,
+		Event:        btevents.Imported,
+		TxID:         stub.GetTxID(),
+		TimeStamp:    timeStamp,
+		BloodTestIDs: ids,
+	}
+	if role == HOSPITAL {
+		payload.Hospital = org
+	} else {
+		payload.Lab = org
+	}
+
+	jsonAsBytes, _ := json.Marshal(payload)
+	err = stub.SetEvent(btevents.Imported, jsonAsBytes)
+	if err != nil {
+		return errors.New("Failed to set event " + btevents.Imported)
+	}
+	return nil
+}
+
+// statusEvent returns the event of a status change, releasing a result has its own event
+func statusEvent(status string) string {
+	if status == STATUS_RELEASED {
+		return btevents.ResultReleased
+	}
+	return btevents.StatusChanged
+}
@@ -0,0 +1,444 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fhir maps bloodtestchain records to HL7 FHIR R4 resources and back.
+//
+// A blood test renders as a collection Bundle holding one ServiceRequest, one
+// DiagnosticReport and one Observation per analyte. Rendering only uses the
+// record itself: resource ids and bundle UUIDs are derived from the blood
+// test ID, entries follow the order of the record and every type is a struct,
+// so every endorsing peer produces byte-identical JSON.
+//
+// Patient fields stay encrypted. They are carried in extensions, and the
+// patient is referenced by the keyed CPR hash only.
+package fhir
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Systems and extension URLs used by bloodtestchain resources
+const (
+	SystemBloodTestID    = "urn:bloodtestchain:bloodtest-id"
+	SystemCPRHash        = "urn:bloodtestchain:cpr-hash"
+	SystemDoctor         = "urn:bloodtestchain:doctor"
+	SystemHospital       = "urn:bloodtestchain:hospital"
+	SystemLab            = "urn:bloodtestchain:lab"
+	SystemLOINC          = "http://loinc.org"
+	SystemInterpretation = "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation"
+
+	ExtensionEncryptedName  = "urn:bloodtestchain:extension:encrypted-name"
+	ExtensionEncryptedCPR   = "urn:bloodtestchain:extension:encrypted-cpr"
+	ExtensionWrappedKeys    = "urn:bloodtestchain:extension:wrapped-keys"
+	ExtensionEncryptedValue = "urn:bloodtestchain:extension:encrypted-value"
+	ExtensionUnit           = "urn:bloodtestchain:extension:unit"
+	ExtensionStatus         = "urn:bloodtestchain:extension:status"
+)
+
+// namespace is the UUID namespace of bundle entry URLs
+var namespace = [16]byte{0x6b, 0x1d, 0x8e, 0x0a, 0x2c, 0x41, 0x4f, 0x3e, 0x9a, 0x57, 0x0d, 0x35, 0xa2, 0x61, 0x7c, 0x14}
+
+//==============================================================================================================================
+// Input - The parts of a blood test the mapping needs, filled in by the chaincode
+//==============================================================================================================================
+
+// Analyte is one structured result
+type Analyte struct {
+	Code      string
+	Value     string // encrypted
+	Unit      string
+	Low       *float64
+	High      *float64
+	RangeText string
+	Flag      string
+}
+
+// Test is a blood test as stored by the chaincode
+type Test struct {
+	BloodTestID      string
+	Status           string
+	TimeStampDoctor  string
+	TimeStampAnalyse string
+	TimeStampResult  string
+	Name             string // encrypted
+	CPR              string // encrypted
+	CPRHash          string
+	Doctor           string
+	Hospital         string
+	Lab              string
+	Result           string // encrypted free text result of older tests
+	Panel            []string
+	Analytes         []Analyte
+}
+
+// Order is a test to create, read from a ServiceRequest
+type Order struct {
+	BloodTestID string
+	AuthoredOn  string
+	Name        string
+	CPR         string
+	CPRHash     string
+	Doctor      string
+	Hospital    string
+	Panel       []string
+	Keys        map[string]string
+}
+
+//==============================================================================================================================
+// Resources - The subset of FHIR R4 used by bloodtestchain
+//==============================================================================================================================
+
+type Coding struct {
+	System string `json:"system,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Reference struct {
+	Reference  string      `json:"reference,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+}
+
+type Extension struct {
+	URL         string `json:"url"`
+	ValueString string `json:"valueString,omitempty"`
+	ValueCode   string `json:"valueCode,omitempty"`
+}
+
+type Quantity struct {
+	Value *float64 `json:"value,omitempty"`
+	Unit  string   `json:"unit,omitempty"`
+}
+
+type ReferenceRange struct {
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+	Text string    `json:"text,omitempty"`
+}
+
+type ServiceRequest struct {
+	ResourceType string          `json:"resourceType"`
+	ID           string          `json:"id,omitempty"`
+	Extension    []Extension     `json:"extension,omitempty"`
+	Identifier   []Identifier    `json:"identifier,omitempty"`
+	Status       string          `json:"status"`
+	Intent       string          `json:"intent"`
+	Code         CodeableConcept `json:"code"`
+	Subject      Reference       `json:"subject"`
+	AuthoredOn   string          `json:"authoredOn,omitempty"`
+	Requester    *Reference      `json:"requester,omitempty"`
+	Performer    []Reference     `json:"performer,omitempty"`
+}
+
+type DiagnosticReport struct {
+	ResourceType      string          `json:"resourceType"`
+	ID                string          `json:"id"`
+	Extension         []Extension     `json:"extension,omitempty"`
+	Identifier        []Identifier    `json:"identifier"`
+	BasedOn           []Reference     `json:"basedOn"`
+	Status            string          `json:"status"`
+	Code              CodeableConcept `json:"code"`
+	Subject           Reference       `json:"subject"`
+	EffectiveDateTime string          `json:"effectiveDateTime,omitempty"`
+	Issued            string          `json:"issued,omitempty"`
+	Performer         []Reference     `json:"performer,omitempty"`
+	Result            []Reference     `json:"result,omitempty"`
+	Conclusion        string          `json:"conclusion,omitempty"`
+}
+
+type Observation struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id"`
+	Extension         []Extension       `json:"extension,omitempty"`
+	Status            string            `json:"status"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           Reference         `json:"subject"`
+	EffectiveDateTime string            `json:"effectiveDateTime,omitempty"`
+	ValueString       string            `json:"valueString"`
+	Interpretation    []CodeableConcept `json:"interpretation,omitempty"`
+	ReferenceRange    []ReferenceRange  `json:"referenceRange,omitempty"`
+}
+
+type BundleEntry struct {
+	FullURL  string      `json:"fullUrl"`
+	Resource interface{} `json:"resource"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+//==============================================================================================================================
+// Rendering
+//==============================================================================================================================
+
+// entryURL returns a name based (version 5 style) UUID URN for a resource id
+func entryURL(id string) string {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(id))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// dateTime returns ts if it is an RFC3339 timestamp, the chaincode stores "null" for unset timestamps
+func dateTime(ts string) string {
+	if _, err := time.Parse(time.RFC3339, ts); err != nil {
+		return ""
+	}
+	return ts
+}
+
+func identifierRef(system string, value string) *Reference {
+	if value == "" || value == "unassigned" {
+		return nil
+	}
+	return &Reference{Identifier: &Identifier{System: system, Value: value}}
+}
+
+func serviceRequestStatus(status string) string {
+	switch status {
+	case "released":
+		return "completed"
+	case "cancelled", "rejected":
+		return "revoked"
+	}
+	return "active"
+}
+
+func diagnosticReportStatus(status string) string {
+	switch status {
+	case "analysed":
+		return "preliminary"
+	case "released":
+		return "final"
+	case "cancelled", "rejected":
+		return "cancelled"
+	}
+	return "registered"
+}
+
+var bloodPanel = CodeableConcept{Text: "Blood test"}
+
+// panelCode lists the requested LOINC codes of a test
+func panelCode(panel []string) CodeableConcept {
+	c := CodeableConcept{Text: bloodPanel.Text}
+	for _, code := range panel {
+		c.Coding = append(c.Coding, Coding{System: SystemLOINC, Code: code})
+	}
+	return c
+}
+
+// Render returns the FHIR Bundle of a blood test as JSON
+func Render(t *Test) ([]byte, error) {
+	if t.BloodTestID == "" {
+		return nil, errors.New("Blood test has no ID")
+	}
+
+	subject := Reference{Identifier: &Identifier{System: SystemCPRHash, Value: t.CPRHash}}
+	statusExtension := Extension{URL: ExtensionStatus, ValueCode: t.Status}
+
+	sr := ServiceRequest{
+		ResourceType: "ServiceRequest",
+		ID:           "sr-" + t.BloodTestID,
+		Extension: []Extension{
+			statusExtension,
+			{URL: ExtensionEncryptedName, ValueString: t.Name},
+			{URL: ExtensionEncryptedCPR, ValueString: t.CPR},
+		},
+		Identifier: []Identifier{{System: SystemBloodTestID, Value: t.BloodTestID}},
+		Status:     serviceRequestStatus(t.Status),
+		Intent:     "order",
+		Code:       panelCode(t.Panel),
+		Subject:    subject,
+		AuthoredOn: dateTime(t.TimeStampDoctor),
+		Requester:  identifierRef(SystemDoctor, t.Doctor),
+	}
+	if r := identifierRef(SystemHospital, t.Hospital); r != nil {
+		sr.Performer = append(sr.Performer, *r)
+	}
+
+	dr := DiagnosticReport{
+		ResourceType:      "DiagnosticReport",
+		ID:                "dr-" + t.BloodTestID,
+		Extension:         []Extension{statusExtension},
+		Identifier:        []Identifier{{System: SystemBloodTestID, Value: t.BloodTestID}},
+		BasedOn:           []Reference{{Reference: entryURL(sr.ID)}},
+		Status:            diagnosticReportStatus(t.Status),
+		Code:              bloodPanel,
+		Subject:           subject,
+		EffectiveDateTime: dateTime(t.TimeStampAnalyse),
+		Issued:            dateTime(t.TimeStampResult),
+		Conclusion:        t.Result,
+	}
+	if r := identifierRef(SystemLab, t.Lab); r != nil {
+		dr.Performer = append(dr.Performer, *r)
+	}
+
+	observationStatus := "preliminary"
+	switch t.Status {
+	case "released":
+		observationStatus = "final"
+	case "cancelled", "rejected":
+		observationStatus = "cancelled"
+	}
+
+	var observations []BundleEntry
+	for _, a := range t.Analytes {
+		obs := Observation{
+			ResourceType: "Observation",
+			ID:           "obs-" + t.BloodTestID + "-" + a.Code,
+			Extension: []Extension{
+				{URL: ExtensionEncryptedValue, ValueCode: "true"},
+				{URL: ExtensionUnit, ValueString: a.Unit},
+			},
+			Status:            observationStatus,
+			Code:              CodeableConcept{Coding: []Coding{{System: SystemLOINC, Code: a.Code}}},
+			Subject:           subject,
+			EffectiveDateTime: dr.EffectiveDateTime,
+			ValueString:       a.Value,
+			Interpretation:    []CodeableConcept{{Coding: []Coding{{System: SystemInterpretation, Code: a.Flag}}}},
+		}
+		rr := ReferenceRange{Text: a.RangeText}
+		if a.Low != nil {
+			rr.Low = &Quantity{Value: a.Low, Unit: a.Unit}
+		}
+		if a.High != nil {
+			rr.High = &Quantity{Value: a.High, Unit: a.Unit}
+		}
+		obs.ReferenceRange = []ReferenceRange{rr}
+
+		url := entryURL(obs.ID)
+		dr.Result = append(dr.Result, Reference{Reference: url})
+		observations = append(observations, BundleEntry{FullURL: url, Resource: obs})
+	}
+
+	bundle := Bundle{
+		ResourceType: "Bundle",
+		ID:           "bloodtest-" + t.BloodTestID,
+		Type:         "collection",
+		Entry: append([]BundleEntry{
+			{FullURL: entryURL(sr.ID), Resource: sr},
+			{FullURL: entryURL(dr.ID), Resource: dr},
+		}, observations...),
+	}
+	return json.Marshal(bundle)
+}
+
+//==============================================================================================================================
+// Ingestion
+//==============================================================================================================================
+
+func findIdentifier(identifiers []Identifier, system string) string {
+	for _, id := range identifiers {
+		if id.System == system {
+			return id.Value
+		}
+	}
+	return ""
+}
+
+func findExtension(extensions []Extension, url string) string {
+	for _, e := range extensions {
+		if e.URL == url {
+			return e.ValueString
+		}
+	}
+	return ""
+}
+
+func referenceValue(r *Reference, system string) string {
+	if r == nil || r.Identifier == nil || r.Identifier.System != system {
+		return ""
+	}
+	return r.Identifier.Value
+}
+
+// ParseServiceRequest reads a new blood test order from a FHIR ServiceRequest
+func ParseServiceRequest(raw []byte) (*Order, error) {
+	var sr ServiceRequest
+	err := json.Unmarshal(raw, &sr)
+	if err != nil {
+		return nil, errors.New("Invalid ServiceRequest JSON")
+	}
+	if sr.ResourceType != "ServiceRequest" {
+		return nil, errors.New("Resource must be a ServiceRequest, got " + sr.ResourceType)
+	}
+	if sr.Status != "active" {
+		return nil, errors.New("ServiceRequest status must be active")
+	}
+	if sr.Intent != "order" {
+		return nil, errors.New("ServiceRequest intent must be order")
+	}
+
+	o := &Order{
+		BloodTestID: findIdentifier(sr.Identifier, SystemBloodTestID),
+		AuthoredOn:  sr.AuthoredOn,
+		Name:        findExtension(sr.Extension, ExtensionEncryptedName),
+		CPR:         findExtension(sr.Extension, ExtensionEncryptedCPR),
+		CPRHash:     referenceValue(&sr.Subject, SystemCPRHash),
+		Doctor:      referenceValue(sr.Requester, SystemDoctor),
+	}
+	for _, coding := range sr.Code.Coding {
+		if coding.System == SystemLOINC {
+			o.Panel = append(o.Panel, coding.Code)
+		}
+	}
+	if len(sr.Performer) > 0 {
+		o.Hospital = referenceValue(&sr.Performer[0], SystemHospital)
+	}
+
+	if o.BloodTestID == "" {
+		return nil, errors.New("ServiceRequest has no " + SystemBloodTestID + " identifier")
+	}
+	if o.CPRHash == "" {
+		return nil, errors.New("ServiceRequest subject has no " + SystemCPRHash + " identifier")
+	}
+	if o.Doctor == "" {
+		return nil, errors.New("ServiceRequest requester has no " + SystemDoctor + " identifier")
+	}
+	if o.AuthoredOn != "" && dateTime(o.AuthoredOn) == "" {
+		return nil, errors.New("ServiceRequest authoredOn must be a dateTime with time zone")
+	}
+
+	keys := findExtension(sr.Extension, ExtensionWrappedKeys)
+	if keys == "" {
+		return nil, errors.New("ServiceRequest has no " + ExtensionWrappedKeys + " extension")
+	}
+	err = json.Unmarshal([]byte(keys), &o.Keys)
+	if err != nil {
+		return nil, errors.New("Extension " + ExtensionWrappedKeys + " must hold a JSON object")
+	}
+	return o, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func newTest() *Test {
+	low, high := 12.0, 16.0
+	return &Test{
+		BloodTestID:      "bt1",
+		Status:           "released",
+		TimeStampDoctor:  "2017-01-01T00:00:00Z",
+		TimeStampAnalyse: "2017-01-02T00:00:00Z",
+		TimeStampResult:  "2017-01-03T00:00:00Z",
+		Name:             "v2.bmFtZQ==.dGFn",
+		CPR:              "v2.Y3By.dGFn",
+		CPRHash:          "abab",
+		Doctor:           "dr-hansen",
+		Hospital:         "rigshospitalet",
+		Lab:              "lab1",
+		Panel:            []string{"718-7", "2345-7", "2951-2", "2823-3"},
+		Analytes: []Analyte{
+			{Code: "718-7", Value: "v2.MTQ=.dGFn", Unit: "g/dL", Low: &low, High: &high, Flag: "N"},
+			{Code: "2345-7", Value: "v2.ODg=.dGFn", Unit: "mg/dL", RangeText: "70-99", Flag: "H"},
+			{Code: "2951-2", Value: "v2.MTQw.dGFn", Unit: "mmol/L", Low: &low, Flag: "N"},
+			{Code: "2823-3", Value: "v2.NA==.dGFn", Unit: "mmol/L", High: &high, Flag: "L"},
+		},
+	}
+}
+
+func TestRenderDeterministic(t *testing.T) {
+	first, err := Render(newTest())
+	if err != nil {
+		t.Fatalf("Render failed: %s", err)
+	}
+
+	// Every call, on a test built anew like every endorsing peer does, gives the same bytes
+	for i := 0; i < 50; i++ {
+		again, err := Render(newTest())
+		if err != nil {
+			t.Fatalf("Render failed: %s", err)
+		}
+		if !bytes.Equal(first, again) {
+			t.Fatalf("Render %d differs:\n%s\n%s", i, first, again)
+		}
+	}
+
+	// Entries follow the order of the record
+	var bundle struct {
+		Entry []struct {
+			Resource struct {
+				ID string `json:"id"`
+			} `json:"resource"`
+		} `json:"entry"`
+	}
+	if err = json.Unmarshal(first, &bundle); err != nil {
+		t.Fatalf("Failed to unmarshal the bundle: %s", err)
+	}
+	expected := []string{"sr-bt1", "dr-bt1", "obs-bt1-718-7", "obs-bt1-2345-7", "obs-bt1-2951-2", "obs-bt1-2823-3"}
+	if len(bundle.Entry) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(bundle.Entry))
+	}
+	for i, id := range expected {
+		if bundle.Entry[i].Resource.ID != id {
+			t.Fatalf("Expected entry %d to be %s, got %s", i, id, bundle.Entry[i].Resource.ID)
+		}
+	}
+}
+
+// TestResourcesHaveNoMaps keeps every rendered type made of structs and
+// slices, so the output never depends on the iteration order of a map
+func TestResourcesHaveNoMaps(t *testing.T) {
+	seen := make(map[reflect.Type]bool)
+	var check func(typ reflect.Type, path string)
+	check = func(typ reflect.Type, path string) {
+		if seen[typ] {
+			return
+		}
+		seen[typ] = true
+		switch typ.Kind() {
+		case reflect.Map:
+			t.Fatalf("%s is a map", path)
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			check(typ.Elem(), path)
+		case reflect.Struct:
+			for i := 0; i < typ.NumField(); i++ {
+				check(typ.Field(i).Type, path+"."+typ.Field(i).Name)
+			}
+		}
+	}
+	for _, resource := range []interface{}{Bundle{}, ServiceRequest{}, DiagnosticReport{}, Observation{}, Test{}} {
+		check(reflect.TypeOf(resource), reflect.TypeOf(resource).Name())
+	}
+}
+
+func TestRenderWithoutID(t *testing.T) {
+	if _, err := Render(&Test{}); err == nil {
+		t.Fatal("Expected a test without ID to be refused")
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/graphen007/bloodtestchain/fhir"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// FHIR - Tests are rendered as FHIR R4 bundles and can be created from a ServiceRequest, see the fhir package
+//==============================================================================================================================
+
+// fhirTest converts a stored test to the input of the fhir mapping
+func fhirTest(res *bloodTest) *fhir.Test {
+	t := &fhir.Test{
+		BloodTestID:      res.BloodTestID,
+		Status:           res.Status,
+		TimeStampDoctor:  res.TimeStampDoctor,
+		TimeStampAnalyse: res.TimeStampAnalyse,
+		TimeStampResult:  res.TimeStampResult,
+		Name:             res.Name,
+		CPR:              res.CPR,
+		CPRHash:          res.CPRHash,
+		Doctor:           res.Doctor,
+		Hospital:         res.Hospital,
+		Lab:              res.Lab,
+		Result:           res.Result,
+		Panel:            res.Panel,
+	}
+	for _, a := range res.Results {
+		t.Analytes = append(t.Analytes, fhir.Analyte{
+			Code:      a.Code,
+			Value:     a.Value,
+			Unit:      a.Unit,
+			Low:       a.ReferenceRange.Low,
+			High:      a.ReferenceRange.High,
+			RangeText: a.ReferenceRange.Text,
+			Flag:      a.Flag,
+		})
+	}
+	return t
+}
+
+// ============================================================================================================================
+// Get FHIR Bundle - ServiceRequest, DiagnosticReport and Observations of a test. Needs consent like every read
+// ============================================================================================================================
+func (t *SimpleChaincode) get_fhir_bundle(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0
+	   "bloodTestID"
+	   -------------------------------------------------------
+	*/
+
+	res, err := t.getBloodTest(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := t.checkAccess(stub, res)
+	if err != nil {
+		return nil, err
+	}
+	if !granted {
+		return accessDenied(stub, args[0])
+	}
+
+	return fhir.Render(fhirTest(res))
+}
+
+// ============================================================================================================================
+// Ingest Service Request - Creates a test from a FHIR ServiceRequest, with the same checks as init_bloodtest
+// ============================================================================================================================
+func (t *SimpleChaincode) ingest_service_request(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0
+	   "ServiceRequest JSON"
+	   -------------------------------------------------------
+	*/
+
+	order, err := fhir.ParseServiceRequest([]byte(args[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	keys, _ := json.Marshal(order.Keys)
+	panel, _ := json.Marshal(order.Panel)
+	return t.init_bloodtest(stub, []string{
+		order.AuthoredOn,
+		order.Name,
+		order.CPR,
+		order.Doctor,
+		order.Hospital,
+		STATUS_ORDERED,
+		"",
+		order.BloodTestID,
+		order.CPRHash,
+		string(keys),
+		string(panel),
+	})
+}
@@ -0,0 +1,200 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/graphen007/identitychain/identity"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Identity - Certificates are enrolled in roles by the identity chaincode, which other healthcare chaincodes share.
+//			  Its name is given to Init and stored under _identityChaincode. Admins invite, approve, suspend and revoke
+//			  users by invoking the identity chaincode directly
+//
+//			  Upgrading a bloodtestchain that kept its own role tables: deploy the identity chaincode, upgrade bloodtestchain
+//			  with its name as the Init argument, then as the admin who deployed the identity chaincode, for every role:
+//			  query export_enrollments here and pass its enrollments to import_enrollments of the identity chaincode,
+//			  following the bookmark until it is empty. Until then the users of the role are not recognised
+//==============================================================================================================================
+const identityChaincodeKey = "_identityChaincode"
+
+// callerFingerprint returns the fingerprint of the callers certificate
+func callerFingerprint(stub shim.ChaincodeStubInterface) (string, error) {
+	return identity.CallerFingerprint(stub)
+}
+
+// ============================================================================================================================
+// configureIdentity - Called from Init. Stores the name of the identity chaincode, which must be given on the first Init
+// ============================================================================================================================
+func (t *SimpleChaincode) configureIdentity(stub shim.ChaincodeStubInterface, args []string) error {
+
+	if len(args) > 0 && args[0] != "" {
+		fmt.Println("Using identity chaincode " + args[0])
+		return stub.PutState(identityChaincodeKey, []byte(args[0]))
+	}
+
+	_, err := t.identityChaincode(stub)
+	return err
+}
+
+// identityChaincode returns the name of the identity chaincode
+func (t *SimpleChaincode) identityChaincode(stub shim.ChaincodeStubInterface) (string, error) {
+	name, err := stub.GetState(identityChaincodeKey)
+	if err != nil {
+		return "", errors.New("Failed to get the identity chaincode")
+	}
+	if len(name) == 0 {
+		return "", errors.New("No identity chaincode is configured, pass its name to Init")
+	}
+	return string(name), nil
+}
+
+// ============================================================================================================================
+// activeRole - The first of roles fingerprint is actively enrolled in, empty if none
+// ============================================================================================================================
+func (t *SimpleChaincode) activeRole(stub shim.ChaincodeStubInterface, fingerprint string, roles ...string) (string, error) {
+	chaincode, err := t.identityChaincode(stub)
+	if err != nil {
+		return "", err
+	}
+	return identity.ActiveRole(stub, chaincode, fingerprint, roles...)
+}
+
+// ============================================================================================================================
+// callerActiveRole - The first of roles the caller is actively enrolled in, empty if none
+// ============================================================================================================================
+func (t *SimpleChaincode) callerActiveRole(stub shim.ChaincodeStubInterface, roles ...string) (string, error) {
+	fingerprint, err := callerFingerprint(stub)
+	if err != nil {
+		fmt.Println("Access denied! ", err)
+		return "", nil
+	}
+	return t.activeRole(stub, fingerprint, roles...)
+}
+
+// ============================================================================================================================
+// CheckRole - Returns true if the callers certificate has an active enrollment in role
+// Roles: ADMIN, DOCTOR, CLIENT, HOSPITAL, LAB, COURIER
+// ============================================================================================================================
+func (t *SimpleChaincode) CheckRole(stub shim.ChaincodeStubInterface, role string) bool {
+
+	fmt.Println("Checking Role ", role)
+
+	active, err := t.callerActiveRole(stub, role)
+	if err != nil {
+		fmt.Println("Access denied! ", err)
+		return false
+	}
+	if active != role {
+		fmt.Println("Access denied! Caller is not an active ", role)
+		return false
+	}
+	return true
+}
+
+// ============================================================================================================================
+// callerHasRole - Called by the router for every function that declares roles.
+// Returns true if the caller has an active enrollment in one of the given roles
+// ============================================================================================================================
+func (t *SimpleChaincode) callerHasRole(stub shim.ChaincodeStubInterface, roles []string) (bool, error) {
+
+	active, err := t.callerActiveRole(stub, roles...)
+	if err != nil {
+		return false, err
+	}
+	if active == "" {
+		fmt.Println("Access denied! Caller does not have any of the roles ", roles)
+		return false, nil
+	}
+	return true, nil
+}
+
+// ============================================================================================================================
+// Export Enrollments - Page of the enrollments of a role in the role tables bloodtestchain kept before it used the identity
+// chaincode. The enrollments are in the shape import_enrollments of the identity chaincode takes. Rows written before
+// enrollments had a status carry no certificate that can be checked, their keys are listed as skipped to be invited again
+// ============================================================================================================================
+func (t *SimpleChaincode) export_enrollments(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	     0          1            2
+	   "role" ["pageSize"] ["bookmark"]
+	   -------------------------------------------------------
+	   The bookmark is the key of the last row of the previous page
+	*/
+
+	role := args[0]
+	if !identity.ValidRole(role) {
+		return nil, errors.New("Unknown role " + role)
+	}
+	pageSize, bookmark, err := parsePage(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	page := struct {
+		Enrollments []identity.Enrollment `json:"enrollments"`
+		Skipped     []string              `json:"skipped"`
+		Bookmark    string                `json:"bookmark"`
+	}{Enrollments: []identity.Enrollment{}, Skipped: []string{}}
+
+	tableName := new(identity.Chaincode).GetTable(role)
+	_, err = stub.GetTable(tableName)
+	if err == shim.ErrTableNotFound {
+		// Deployed after the move, there is nothing to export
+		return json.Marshal(page)
+	}
+	if err != nil {
+		return nil, errors.New("Failed getting table " + tableName)
+	}
+	rows, err := stub.GetRows(tableName, []shim.Column{})
+	if err != nil {
+		return nil, errors.New("Failed getting rows of " + tableName)
+	}
+
+	// Rows come in key order. The channel is drained, the rows after the page only tell that there is another one
+	read, lastKey := 0, ""
+	for row := range rows {
+		if len(row.GetColumns()) < 2 {
+			continue
+		}
+		key := row.Columns[0].GetString_()
+		if key <= bookmark {
+			continue
+		}
+		if read == pageSize {
+			page.Bookmark = lastKey
+			continue
+		}
+		read++
+		lastKey = key
+
+		var e identity.Enrollment
+		if json.Unmarshal([]byte(row.Columns[1].GetString_()), &e) != nil || e.Fingerprint != key || e.Role != role {
+			page.Skipped = append(page.Skipped, key)
+			continue
+		}
+		page.Enrollments = append(page.Enrollments, e)
+	}
+
+	return json.Marshal(page)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/graphen007/identitychain/identity"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+type testEnrollmentPage struct {
+	Enrollments []identity.Enrollment `json:"enrollments"`
+	Skipped     []string              `json:"skipped"`
+	Bookmark    string                `json:"bookmark"`
+}
+
+// legacyEnrollment is a row of the role tables bloodtestchain kept before the identity chaincode
+func legacyEnrollment(cert []byte, role string, status string) shim.Row {
+	e := identity.Enrollment{
+		Fingerprint: identity.CertFingerprint(cert),
+		Certificate: base64.StdEncoding.EncodeToString(cert),
+		Role:        role,
+		Name:        string(cert),
+		Status:      status,
+	}
+	value, _ := json.Marshal(e)
+	return shim.Row{Columns: []*shim.Column{
+		{Value: &shim.Column_String_{String_: e.Fingerprint}},
+		{Value: &shim.Column_String_{String_: string(value)}}}}
+}
+
+// ============================================================================================================================
+// TestExportEnrollments - The doctors of the old role table are exported page by page and imported into the identity
+// chaincode, after which they are recognised by bloodtestchain
+// ============================================================================================================================
+func TestExportEnrollments(t *testing.T) {
+	s := newScenario(t)
+
+	if response, err := s.query(ADMIN, "export_enrollments", DOCTOR); err != nil || string(response) != `{"enrollments":[],"skipped":[],"bookmark":""}` {
+		t.Fatalf("Expected nothing to export without role tables, got %s %v", response, err)
+	}
+
+	legacy := [][]byte{[]byte("legacy doctor 1"), []byte("legacy doctor 2"), []byte("legacy doctor 3")}
+	s.stub.MockTransactionStart("legacy")
+	s.stub.CreateTable(identity.DOCTOR_INDEX, []*shim.ColumnDefinition{
+		{Name: identity.COLUMN_CERTS, Type: shim.ColumnDefinition_STRING, Key: true},
+		{Name: identity.COLUMN_VALUE, Type: shim.ColumnDefinition_STRING, Key: false},
+	})
+	rows := []shim.Row{
+		legacyEnrollment(legacy[0], DOCTOR, identity.ENROLLMENT_ACTIVE),
+		legacyEnrollment(legacy[1], DOCTOR, identity.ENROLLMENT_ACTIVE),
+		legacyEnrollment(legacy[2], DOCTOR, identity.ENROLLMENT_SUSPENDED),
+		legacyEnrollment(s.certs[DOCTOR], DOCTOR, identity.ENROLLMENT_ACTIVE),
+		{Columns: []*shim.Column{{Value: &shim.Column_String_{String_: "drjohn"}}, {Value: &shim.Column_String_{String_: "ecert"}}}},
+	}
+	for _, row := range rows {
+		if ok, err := s.stub.InsertRow(identity.DOCTOR_INDEX, row); !ok || err != nil {
+			t.Fatalf("Failed to insert the legacy row: %v", err)
+		}
+	}
+	s.stub.MockTransactionEnd("legacy")
+
+	if _, err := s.query(DOCTOR, "export_enrollments", DOCTOR); err == nil || !strings.Contains(err.Error(), ERR_ACCESS_DENIED) {
+		t.Fatalf("Expected the export to be refused to a doctor, got %v", err)
+	}
+	if _, err := s.invoke(COURIER, "query_bloodtests", `{}`); err == nil || !strings.Contains(err.Error(), ERR_ACCESS_DENIED) {
+		t.Fatalf("Expected the courier not to be a doctor, got %v", err)
+	}
+
+	var enrollments []identity.Enrollment
+	var skipped []string
+	bookmark, pages := "", 0
+	for {
+		response, err := s.query(ADMIN, "export_enrollments", DOCTOR, "2", bookmark)
+		if err != nil {
+			t.Fatalf("Failed to export: %s", err)
+		}
+		var page testEnrollmentPage
+		if err = json.Unmarshal(response, &page); err != nil || len(page.Enrollments)+len(page.Skipped) > 2 {
+			t.Fatalf("Unexpected page %s", response)
+		}
+		enrollments = append(enrollments, page.Enrollments...)
+		skipped = append(skipped, page.Skipped...)
+		pages++
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	if pages != 3 || len(enrollments) != 4 || len(skipped) != 1 || skipped[0] != "drjohn" {
+		t.Fatalf("Expected 4 enrollments and drjohn skipped over 3 pages, got %d pages %+v %v", pages, enrollments, skipped)
+	}
+
+	payload, _ := json.Marshal(enrollments)
+	s.identity.MockCaller(s.certs[ADMIN], nil)
+	response, err := s.identity.MockInvoke(s.tx(), args("import_enrollments", string(payload)))
+	if err != nil || string(response) != `{"imported":3}` {
+		t.Fatalf("Expected the 3 doctors not yet enrolled to be imported, got %s %v", response, err)
+	}
+
+	for i, active := range []bool{true, true, false} {
+		s.certs["legacy"] = legacy[i]
+		_, err := s.invoke("legacy", "query_bloodtests", `{}`)
+		denied := err != nil && strings.Contains(err.Error(), ERR_ACCESS_DENIED)
+		if denied == active {
+			t.Fatalf("Expected legacy doctor %d to be recognised %t, got %v", i+1, active, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Secondary indexes - One key per test and attribute: "idx" 0x00 attribute 0x00 value 0x00 bloodTestID
+//					   Lookups are prefix range scans, so no single key is written by every transaction
+//==============================================================================================================================
+const IDX_CPR = "CPR"
+const IDX_DOCTOR = "doctor"
+const IDX_HOSPITAL = "hospital"
+const IDX_LAB = "lab"
+const IDX_STATUS = "status"
+const IDX_ABNORMAL_CPR = "abnormalCPR"
+const IDX_ABNORMAL_DOCTOR = "abnormalDoctor"
+
+const indexPrefix = "idx"
+const indexSep = "\x00"
+
+// indexMaxRune sorts after every valid UTF-8 key and ends a prefix range
+var indexMaxRune = string(utf8.MaxRune)
+
+// indexValue is stored under every index key, the test itself is read from its own key
+var indexValue = []byte{0x00}
+
+const DEFAULT_PAGE_SIZE = 50
+const MAX_PAGE_SIZE = 200
+
+// sparseAttributes are only indexed for tests where they are set
+var sparseAttributes = map[string]bool{
+	IDX_ABNORMAL_CPR:    true,
+	IDX_ABNORMAL_DOCTOR: true,
+}
+
+// indexedAttributes returns the indexed attribute values of a test
+func indexedAttributes(res *bloodTest) map[string]string {
+	attributes := map[string]string{
+		IDX_CPR:             res.CPRHash,
+		IDX_DOCTOR:          res.Doctor,
+		IDX_HOSPITAL:        res.Hospital,
+		IDX_LAB:             res.Lab,
+		IDX_STATUS:          res.Status,
+		IDX_ABNORMAL_CPR:    "",
+		IDX_ABNORMAL_DOCTOR: "",
+	}
+	if isAbnormal(res) {
+		attributes[IDX_ABNORMAL_CPR] = res.CPRHash
+		attributes[IDX_ABNORMAL_DOCTOR] = res.Doctor
+	}
+	return attributes
+}
+
+func validateKeyPart(part string) error {
+	if strings.Contains(part, indexSep) || !utf8.ValidString(part) {
+		return errors.New("Value " + strconv.Quote(part) + " can not be used in a key")
+	}
+	return nil
+}
+
+func indexKeyPrefix(attribute string, value string) string {
+	return indexPrefix + indexSep + attribute + indexSep + value + indexSep
+}
+
+func indexKey(attribute string, value string, bloodTestID string) string {
+	return indexKeyPrefix(attribute, value) + bloodTestID
+}
+
+// ============================================================================================================================
+// getBloodTest - Reads a test by ID, returns an error if it does not exist
+// ============================================================================================================================
+func (t *SimpleChaincode) getBloodTest(stub shim.ChaincodeStubInterface, bloodTestID string) (*bloodTest, error) {
+	bloodAsBytes, err := stub.GetState(bloodTestID)
+	if err != nil {
+		return nil, errors.New("Failed to get blood test " + bloodTestID)
+	}
+	if bloodAsBytes == nil {
+		return nil, errors.New("Blood test " + bloodTestID + " does not exist")
+	}
+	res := &bloodTest{}
+	err = json.Unmarshal(bloodAsBytes, res)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal blood test " + bloodTestID)
+	}
+	err = upgradeBloodTest(res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ============================================================================================================================
+// saveBloodTest - Writes a test, moves the index entries of every attribute that changed and appends the change to the
+// audit trail. old is nil for a new test
+// ============================================================================================================================
+func (t *SimpleChaincode) saveBloodTest(stub shim.ChaincodeStubInterface, old *bloodTest, res *bloodTest) error {
+	err := t.writeBloodTest(stub, old, res)
+	if err != nil {
+		return err
+	}
+	return t.appendAudit(stub, old, res)
+}
+
+// writeBloodTest writes a test and its index entries without auditing, used when only the indexes change
+func (t *SimpleChaincode) writeBloodTest(stub shim.ChaincodeStubInterface, old *bloodTest, res *bloodTest) error {
+
+	err := validateKeyPart(res.BloodTestID)
+	if err != nil {
+		return err
+	}
+
+	newAttributes := indexedAttributes(res)
+	var oldAttributes map[string]string
+	if old != nil {
+		oldAttributes = indexedAttributes(old)
+	}
+
+	for attribute, value := range newAttributes {
+		err = validateKeyPart(value)
+		if err != nil {
+			return err
+		}
+		if old != nil && oldAttributes[attribute] == value {
+			continue
+		}
+		if old != nil && !(sparseAttributes[attribute] && oldAttributes[attribute] == "") {
+			err = stub.DelState(indexKey(attribute, oldAttributes[attribute], old.BloodTestID))
+			if err != nil {
+				return err
+			}
+		}
+		if sparseAttributes[attribute] && value == "" {
+			continue
+		}
+		err = stub.PutState(indexKey(attribute, value, res.BloodTestID), indexValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	res.SchemaVersion = BLOODTEST_SCHEMA_VERSION
+	jsonAsBytes, _ := json.Marshal(res)
+	return stub.PutState(res.BloodTestID, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// scanIndex - Returns up to pageSize test IDs with attribute == value, starting after bookmark.
+// The returned bookmark is empty when there are no more results
+// ============================================================================================================================
+func (t *SimpleChaincode) scanIndex(stub shim.ChaincodeStubInterface, attribute string, value string, pageSize int, bookmark string) ([]string, string, error) {
+
+	err := validateKeyPart(value)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix := indexKeyPrefix(attribute, value)
+	startKey := prefix
+	lastKey := ""
+	if bookmark != "" {
+		decoded, err := base64.URLEncoding.DecodeString(bookmark)
+		if err != nil || !strings.HasPrefix(string(decoded), prefix) {
+			return nil, "", errors.New("Invalid bookmark")
+		}
+		lastKey = string(decoded)
+		startKey = lastKey
+	}
+
+	iter, err := stub.RangeQueryState(startKey, prefix+indexMaxRune)
+	if err != nil {
+		return nil, "", errors.New("Failed to scan index " + attribute)
+	}
+	defer iter.Close()
+
+	var ids []string
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return nil, "", errors.New("Failed to scan index " + attribute)
+		}
+		if key == lastKey || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if len(ids) == pageSize {
+			return ids, base64.URLEncoding.EncodeToString([]byte(lastKey)), nil
+		}
+		ids = append(ids, strings.TrimPrefix(key, prefix))
+		lastKey = key
+	}
+
+	return ids, "", nil
+}
+
+// parsePage reads the optional page size and bookmark arguments of a lookup
+func parsePage(args []string) (int, string, error) {
+	pageSize := DEFAULT_PAGE_SIZE
+	bookmark := ""
+	if len(args) > 0 && args[0] != "" {
+		size, err := strconv.Atoi(args[0])
+		if err != nil || size < 1 || size > MAX_PAGE_SIZE {
+			return 0, "", fmt.Errorf("Page size must be between 1 and %d", MAX_PAGE_SIZE)
+		}
+		pageSize = size
+	}
+	if len(args) > 1 {
+		bookmark = args[1]
+	}
+	return pageSize, bookmark, nil
+}
+
+// ============================================================================================================================
+// readByIndex - Shared by the *_read queries.
+// Our model looks like: "value" ["pageSize"] ["bookmark"]
+// ============================================================================================================================
+func (t *SimpleChaincode) readByIndex(stub shim.ChaincodeStubInterface, attribute string, args []string) ([]byte, error) {
+
+	pageSize, bookmark, err := parsePage(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	ids, next, err := t.scanIndex(stub, attribute, args[0], pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	page := struct {
+		ReturnedObjects []json.RawMessage `json:"returnedObjects"`
+		Bookmark        string            `json:"bookmark"`
+	}{ReturnedObjects: []json.RawMessage{}, Bookmark: next}
+
+	for _, id := range ids {
+		bloodAsBytes, err := stub.GetState(id)
+		if err != nil {
+			return nil, errors.New("Failed to get blood test " + id)
+		}
+		if bloodAsBytes == nil {
+			continue
+		}
+		// Tests without consent are left out of the page
+		bloodAsBytes, err = t.readableBloodTest(stub, id, bloodAsBytes)
+		if err != nil {
+			return nil, err
+		}
+		if bloodAsBytes != nil {
+			page.ReturnedObjects = append(page.ReturnedObjects, json.RawMessage(bloodAsBytes))
+		}
+	}
+
+	return json.Marshal(page)
+}
+
+// ============================================================================================================================
+// Rebuild Indexes - Writes the index entries of tests created before the indexes existed, listed in _bloodTestIndex
+// ============================================================================================================================
+func (t *SimpleChaincode) rebuild_indexes(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	bloodTestList, err := stub.GetState(bloodTestIndex)
+	if err != nil {
+		return nil, errors.New("Failed to get bloodList")
+	}
+	var bloodInd []string
+	if bloodTestList != nil {
+		err = json.Unmarshal(bloodTestList, &bloodInd)
+		if err != nil {
+			return nil, errors.New("Failed to unmarshal bloodList")
+		}
+	}
+
+	for _, id := range bloodInd {
+		res, err := t.getBloodTest(stub, id)
+		if err != nil {
+			return nil, err
+		}
+		err = t.writeBloodTest(stub, nil, res)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The legacy list is no longer maintained
+	err = stub.DelState(bloodTestIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Reindexed blood tests: ", len(bloodInd))
+	return []byte(fmt.Sprintf(`{"reindexed":%d}`, len(bloodInd))), nil
+}
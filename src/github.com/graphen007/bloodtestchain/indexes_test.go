@@ -0,0 +1,181 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type indexPage struct {
+	ReturnedObjects []bloodTest `json:"returnedObjects"`
+	Bookmark        string      `json:"bookmark"`
+}
+
+// readAll follows the bookmarks of an index read with pageSize, returns the IDs of every page
+func (s *scenario) readAll(role string, function string, value string, pageSize int) [][]string {
+	var pages [][]string
+	bookmark := ""
+	for {
+		response := s.mustInvoke(role, function, value, strconv.Itoa(pageSize), bookmark)
+		var page indexPage
+		if err := json.Unmarshal(response, &page); err != nil {
+			s.t.Fatalf("Failed to unmarshal the page of %s: %s", function, response)
+		}
+		ids := []string{}
+		for _, res := range page.ReturnedObjects {
+			ids = append(ids, res.BloodTestID)
+		}
+		pages = append(pages, ids)
+		if page.Bookmark == "" {
+			return pages
+		}
+		if len(pages) > len(s.stub.State) {
+			s.t.Fatalf("%s does not stop paging", function)
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+// orderTests orders the tests ids of the scenario patient
+func (s *scenario) orderTests(ids ...string) {
+	for _, id := range ids {
+		order := s.orderArgs()
+		order[7] = id
+		s.mustInvoke(DOCTOR, "init_bloodtest", order...)
+	}
+}
+
+// consentToAll links the scenario patient and grants role consent to all of their tests
+func (s *scenario) consentToAll(roles ...string) {
+	s.mustInvoke(ADMIN, "link_patient", s.fingerprint(CLIENT), strings.Repeat("ab", 32))
+	for _, role := range roles {
+		s.mustInvoke(CLIENT, "grant_consent", s.fingerprint(role), CONSENT_ALL_TESTS, "2099-01-01T00:00:00Z")
+	}
+}
+
+// ============================================================================================================================
+// TestIndexPaging - Every index read pages through its tests in key order, the bookmark of one index is refused by another
+// ============================================================================================================================
+func TestIndexPaging(t *testing.T) {
+	s := newScenario(t)
+	s.orderTests("bt1", "bt2", "bt3", "bt4", "bt5")
+	s.consentToAll(HOSPITAL)
+
+	want := [][]string{{"bt1", "bt2"}, {"bt3", "bt4"}, {"bt5"}}
+	reads := []struct {
+		role     string
+		function string
+		value    string
+	}{
+		{DOCTOR, "doctor_read", s.fingerprint(DOCTOR)},
+		{DOCTOR, "client_read", strings.Repeat("ab", 32)},
+		{HOSPITAL, "hospital_read", scenarioHospital},
+		{HOSPITAL, "status_read", STATUS_ORDERED},
+	}
+	for _, read := range reads {
+		if pages := s.readAll(read.role, read.function, read.value, 2); !reflect.DeepEqual(pages, want) {
+			t.Fatalf("Expected %s to page through %v, got %v", read.function, want, pages)
+		}
+	}
+	if pages := s.readAll(HOSPITAL, "hospital_read", scenarioHospital, 5); !reflect.DeepEqual(pages, [][]string{{"bt1", "bt2", "bt3", "bt4", "bt5"}}) {
+		t.Fatalf("Expected one full page, got %v", pages)
+	}
+
+	var page indexPage
+	json.Unmarshal(s.mustInvoke(HOSPITAL, "hospital_read", scenarioHospital, "2"), &page)
+	if _, err := s.invoke(HOSPITAL, "status_read", STATUS_ORDERED, "2", page.Bookmark); err == nil || !strings.Contains(err.Error(), "Invalid bookmark") {
+		t.Fatalf("Expected the bookmark of another index to be refused, got %v", err)
+	}
+	if _, err := s.invoke(HOSPITAL, "hospital_read", scenarioHospital, fmt.Sprint(MAX_PAGE_SIZE+1)); err == nil {
+		t.Fatal("Expected a page size above the maximum to be refused")
+	}
+}
+
+// ============================================================================================================================
+// TestIndexMoves - A change of hospital, lab or status moves the index entry of the test
+// ============================================================================================================================
+func TestIndexMoves(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(ADMIN, "register_organisation", "herlev", HOSPITAL, "Herlev Hospital")
+	s.mustInvoke(ADMIN, "add_member", "herlev", s.fingerprint(DOCTOR))
+	s.orderTests("bt1", "bt2")
+	s.consentToAll(HOSPITAL, LAB)
+
+	s.mustInvoke(DOCTOR, "change_hospital", "bt2", "herlev")
+	if pages := s.readAll(HOSPITAL, "hospital_read", scenarioHospital, 10); !reflect.DeepEqual(pages, [][]string{{"bt1"}}) {
+		t.Fatalf("Expected the moved test to leave the hospital, got %v", pages)
+	}
+	if s.stub.State[indexKey(IDX_HOSPITAL, "herlev", "bt2")] == nil {
+		t.Fatal("Expected the moved test in the index of its new hospital")
+	}
+
+	s.mustInvoke(HOSPITAL, "change_status", "bt1", STATUS_RECEIVED)
+	s.mustInvoke(HOSPITAL, "change_lab", "bt1", scenarioLab)
+	if pages := s.readAll(LAB, "lab_read", scenarioLab, 10); !reflect.DeepEqual(pages, [][]string{{"bt1"}}) {
+		t.Fatalf("Expected the test at its lab, got %v", pages)
+	}
+	if s.stub.State[indexKey(IDX_LAB, "unassigned", "bt1")] != nil {
+		t.Fatal("Expected the test to leave the unassigned lab")
+	}
+	for status, want := range map[string][][]string{STATUS_ORDERED: {{"bt2"}}, STATUS_RECEIVED: {{"bt1"}}} {
+		if pages := s.readAll(HOSPITAL, "status_read", status, 10); !reflect.DeepEqual(pages, want) {
+			t.Fatalf("Expected %v %s, got %v", want, status, pages)
+		}
+	}
+}
+
+// ============================================================================================================================
+// TestRebuildIndexes - Tests listed in the legacy list are indexed by rebuild_indexes, which retires the list
+// ============================================================================================================================
+func TestRebuildIndexes(t *testing.T) {
+	s := newScenario(t)
+	ids := []string{"legacy0", "legacy1", "legacy2"}
+	for _, id := range ids {
+		s.putLegacy(id, fmt.Sprintf(`{"timeStampDoctor":"2017-01-01T00:00:00Z","timeStampHospital":"null","name":%q,"CPR":%q,`+
+			`"doctor":"dr-hansen","hospital":%q,"lab":"","status":"ordered","bloodTestID":%q}`,
+			envelope("John Doe"), envelope("0202801234"), scenarioHospital, id))
+	}
+	list, _ := json.Marshal(ids)
+	s.putLegacy(bloodTestIndex, string(list))
+	if s.stub.State[indexKey(IDX_HOSPITAL, scenarioHospital, "legacy0")] != nil {
+		t.Fatal("Expected the legacy tests to be unindexed")
+	}
+
+	if _, err := s.invoke(HOSPITAL, "rebuild_indexes"); err == nil {
+		t.Fatal("Expected rebuild_indexes to be refused to the hospital")
+	}
+	if response := s.mustInvoke(ADMIN, "rebuild_indexes"); string(response) != `{"reindexed":3}` {
+		t.Fatalf("Expected 3 tests reindexed, got %s", response)
+	}
+	for _, id := range ids {
+		for attribute, value := range map[string]string{IDX_DOCTOR: "dr-hansen", IDX_HOSPITAL: scenarioHospital, IDX_LAB: "unassigned", IDX_STATUS: STATUS_ORDERED} {
+			if s.stub.State[indexKey(attribute, value, id)] == nil {
+				t.Fatalf("Expected %s in the %s index", id, attribute)
+			}
+		}
+	}
+	if s.stub.State[bloodTestIndex] != nil {
+		t.Fatal("Expected the legacy list to be retired")
+	}
+	if response := s.mustInvoke(ADMIN, "rebuild_indexes"); string(response) != `{"reindexed":0}` {
+		t.Fatalf("Expected nothing left to reindex, got %s", response)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Blood test lifecycle - Every test starts as ordered and ends as released, cancelled or rejected
+//==============================================================================================================================
+const STATUS_ORDERED = "ordered"     // ordered by doctor
+const STATUS_RECEIVED = "received"   // received by hospital
+const STATUS_ASSIGNED = "assigned"   // assigned to lab
+const STATUS_ANALYSED = "analysed"   // analysed by lab
+const STATUS_RELEASED = "released"   // result released
+const STATUS_CANCELLED = "cancelled" // cancelled by the ordering doctor
+const STATUS_REJECTED = "rejected"   // rejected by hospital or lab
+
+// validStatus returns true if status is part of the lifecycle
+func validStatus(status string) bool {
+	switch status {
+	case STATUS_ORDERED, STATUS_RECEIVED, STATUS_ASSIGNED, STATUS_ANALYSED, STATUS_RELEASED, STATUS_CANCELLED, STATUS_REJECTED:
+		return true
+	}
+	return false
+}
+
+//==============================================================================================================================
+// transition - A legal status change, the roles allowed to perform it and the party of the test the caller must belong to
+//==============================================================================================================================
+const PARTY_ORDERED_BY = "orderedBy" // the doctor that ordered the test
+const PARTY_HOSPITAL = "hospital"    // a member of the hospital of the test
+const PARTY_LAB = "lab"              // a member of the lab of the test
+
+type transition struct {
+	from  string
+	to    string
+	roles []string
+	party string
+}
+
+var lifecycle = []transition{
+	{from: STATUS_ORDERED, to: STATUS_RECEIVED, roles: []string{HOSPITAL}, party: PARTY_HOSPITAL},
+	{from: STATUS_RECEIVED, to: STATUS_ASSIGNED, roles: []string{HOSPITAL}, party: PARTY_HOSPITAL},
+	{from: STATUS_ASSIGNED, to: STATUS_ANALYSED, roles: []string{LAB}, party: PARTY_LAB},
+	{from: STATUS_ANALYSED, to: STATUS_RELEASED, roles: []string{LAB}, party: PARTY_LAB},
+
+	{from: STATUS_ORDERED, to: STATUS_CANCELLED, roles: []string{DOCTOR}, party: PARTY_ORDERED_BY},
+	{from: STATUS_RECEIVED, to: STATUS_CANCELLED, roles: []string{DOCTOR}, party: PARTY_ORDERED_BY},
+	{from: STATUS_ASSIGNED, to: STATUS_CANCELLED, roles: []string{DOCTOR}, party: PARTY_ORDERED_BY},
+
+	{from: STATUS_ORDERED, to: STATUS_REJECTED, roles: []string{HOSPITAL}, party: PARTY_HOSPITAL},
+	{from: STATUS_RECEIVED, to: STATUS_REJECTED, roles: []string{HOSPITAL}, party: PARTY_HOSPITAL},
+	{from: STATUS_ASSIGNED, to: STATUS_REJECTED, roles: []string{LAB}, party: PARTY_LAB},
+}
+
+// findTransition returns the transition from -> to, or nil if the lifecycle does not allow it
+func findTransition(from string, to string) *transition {
+	for i := range lifecycle {
+		if lifecycle[i].from == from && lifecycle[i].to == to {
+			return &lifecycle[i]
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// applyTransition - Moves the test to the new status and stamps the matching timestamp field
+// ============================================================================================================================
+func (t *SimpleChaincode) applyTransition(stub shim.ChaincodeStubInterface, res *bloodTest, status string) error {
+
+	tr := findTransition(res.Status, status)
+	if tr == nil {
+		return errors.New("Illegal status change from " + res.Status + " to " + status)
+	}
+
+	ok, err := t.callerHasRole(stub, tr.roles)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Caller is not allowed to change status from " + res.Status + " to " + status)
+	}
+
+	// The role alone is not enough, the caller must be a party of this test
+	err = t.requireCallerParty(stub, res, tr.party)
+	if err != nil {
+		return err
+	}
+
+	return setStatus(stub, res, status)
+}
+
+// ============================================================================================================================
+// requireCallerParty - Fails unless the caller is the given party of the test
+// ============================================================================================================================
+func (t *SimpleChaincode) requireCallerParty(stub shim.ChaincodeStubInterface, res *bloodTest, party string) error {
+
+	switch party {
+	case PARTY_ORDERED_BY:
+		caller, err := callerFingerprint(stub)
+		if err != nil {
+			return err
+		}
+		if caller != res.OrderedBy {
+			return errors.New("Only the ordering doctor can do this for " + res.BloodTestID)
+		}
+		return nil
+	case PARTY_HOSPITAL:
+		return t.requireCallerMember(stub, res.Hospital)
+	case PARTY_LAB:
+		return t.requireCallerMember(stub, res.Lab)
+	}
+	return errors.New("Unknown party " + party)
+}
+
+// ============================================================================================================================
+// setStatus - Checks the preconditions of status and stamps its timestamp field, without checking the caller
+// ============================================================================================================================
+func setStatus(stub shim.ChaincodeStubInterface, res *bloodTest, status string) error {
+
+	switch status {
+	case STATUS_ASSIGNED:
+		if res.Lab == "" || res.Lab == "unassigned" {
+			return errors.New("A lab must be set before the test can be assigned")
+		}
+	case STATUS_RELEASED:
+		if !hasResult(res) {
+			return errors.New("A result must be set before it can be released")
+		}
+	}
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case STATUS_RECEIVED:
+		res.TimeStampHospital = timeStamp
+	case STATUS_ASSIGNED:
+		res.TimeStampLab = timeStamp
+	case STATUS_ANALYSED:
+		res.TimeStampAnalyse = timeStamp
+	case STATUS_RELEASED:
+		res.TimeStampResult = timeStamp
+	}
+
+	res.Status = status
+	return nil
+}
+
+// ============================================================================================================================
+// txTimeStamp - Transaction timestamp as RFC3339, identical on every endorsing peer
+// ============================================================================================================================
+func txTimeStamp(stub shim.ChaincodeStubInterface) (string, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return "", errors.New("Failed getting transaction timestamp")
+	}
+	if ts == nil {
+		return "", errors.New("Transaction has no timestamp")
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339), nil
+}
+
+// ============================================================================================================================
+// utcTimeStamp - Normalises an RFC3339 timestamp to UTC in the format of txTimeStamp, so stamps compare as strings
+// ============================================================================================================================
+func utcTimeStamp(ts string) (string, error) {
+	parsed, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return "", errors.New("Timestamp " + ts + " must be RFC3339 with a time zone")
+	}
+	return parsed.UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,432 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Organisation registry - Hospitals and labs under "org" 0x00 id, their staff under "member" 0x00 org 0x00 fingerprint and
+//						   "memberOf" 0x00 fingerprint 0x00 org. The Hospital and Lab fields of a test hold organisation ids
+//==============================================================================================================================
+const orgPrefix = "org"
+const memberPrefix = "member"
+const memberOfPrefix = "memberOf"
+
+type organisation struct {
+	ID        string   `json:"id"`
+	Kind      string   `json:"kind"` // HOSPITAL or LAB
+	Name      string   `json:"name"`
+	Catalogue []string `json:"catalogue,omitempty"` // LOINC codes a lab can analyse
+	UpdatedBy string   `json:"updatedBy"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+type membership struct {
+	Organisation string `json:"organisation"`
+	Fingerprint  string `json:"fingerprint"`
+	Role         string `json:"role"`
+	AddedBy      string `json:"addedBy"`
+	AddedAt      string `json:"addedAt"`
+}
+
+// staffRoles are the enrollment roles that can be members of each kind of organisation
+var staffRoles = map[string][]string{
+	HOSPITAL: {DOCTOR, HOSPITAL},
+	LAB:      {LAB},
+}
+
+func orgKey(id string) string {
+	return orgPrefix + indexSep + id
+}
+
+func memberKeyPrefix(org string) string {
+	return memberPrefix + indexSep + org + indexSep
+}
+
+func memberKey(org string, fingerprint string) string {
+	return memberKeyPrefix(org) + fingerprint
+}
+
+func memberOfKeyPrefix(fingerprint string) string {
+	return memberOfPrefix + indexSep + fingerprint + indexSep
+}
+
+func memberOfKey(fingerprint string, org string) string {
+	return memberOfKeyPrefix(fingerprint) + org
+}
+
+// ============================================================================================================================
+// getOrganisation - Returns the organisation id, or nil if it is not registered
+// ============================================================================================================================
+func (t *SimpleChaincode) getOrganisation(stub shim.ChaincodeStubInterface, id string) (*organisation, error) {
+	orgAsBytes, err := stub.GetState(orgKey(id))
+	if err != nil {
+		return nil, errors.New("Failed to get organisation " + id)
+	}
+	if orgAsBytes == nil {
+		return nil, nil
+	}
+	o := &organisation{}
+	err = json.Unmarshal(orgAsBytes, o)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal organisation " + id)
+	}
+	return o, nil
+}
+
+// requireOrganisation returns the organisation id if it is registered as kind
+func (t *SimpleChaincode) requireOrganisation(stub shim.ChaincodeStubInterface, id string, kind string) (*organisation, error) {
+	o, err := t.getOrganisation(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil || o.Kind != kind {
+		return nil, errors.New(id + " is not a registered " + kind)
+	}
+	return o, nil
+}
+
+func (t *SimpleChaincode) isMember(stub shim.ChaincodeStubInterface, org string, fingerprint string) (bool, error) {
+	memberAsBytes, err := stub.GetState(memberKey(org, fingerprint))
+	if err != nil {
+		return false, errors.New("Failed to get membership of " + fingerprint)
+	}
+	return memberAsBytes != nil, nil
+}
+
+// requireCallerMember fails unless the caller is on the staff of org
+func (t *SimpleChaincode) requireCallerMember(stub shim.ChaincodeStubInterface, org string) error {
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return err
+	}
+	ok, err := t.isMember(stub, org, caller)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Caller is not on the staff of " + org)
+	}
+	return nil
+}
+
+// requireDoctorOf fails unless doctor is an active doctor on the staff of hospital
+func (t *SimpleChaincode) requireDoctorOf(stub shim.ChaincodeStubInterface, hospital string, doctor string) error {
+	ok, err := t.isMember(stub, hospital, doctor)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Doctor " + doctor + " is not on the staff of " + hospital)
+	}
+	role, err := t.activeRole(stub, doctor, DOCTOR)
+	if err != nil {
+		return err
+	}
+	if role != DOCTOR {
+		return errors.New(doctor + " is not an active " + DOCTOR)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// memberOrganisation - Returns the first organisation of kind fingerprint is a member of, empty if there is none
+// ============================================================================================================================
+func (t *SimpleChaincode) memberOrganisation(stub shim.ChaincodeStubInterface, fingerprint string, kind string) (string, error) {
+	prefix := memberOfKeyPrefix(fingerprint)
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return "", errors.New("Failed to get organisations of " + fingerprint)
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return "", errors.New("Failed to get organisations of " + fingerprint)
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		o, err := t.getOrganisation(stub, strings.TrimPrefix(key, prefix))
+		if err != nil {
+			return "", err
+		}
+		if o != nil && o.Kind == kind {
+			return o.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// ============================================================================================================================
+// checkCatalogue - Fails unless the lab can analyse every code of the panel
+// ============================================================================================================================
+func checkCatalogue(lab *organisation, panel []string) error {
+	supported := make(map[string]bool)
+	for _, code := range lab.Catalogue {
+		supported[code] = true
+	}
+	var missing []string
+	for _, code := range panel {
+		if !supported[code] {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("Lab " + lab.ID + " does not analyse " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// parsePanel parses a JSON array of requested LOINC codes
+func parsePanel(arg string) ([]string, error) {
+	var panel []string
+	if arg == "" {
+		return panel, nil
+	}
+	err := json.Unmarshal([]byte(arg), &panel)
+	if err != nil {
+		return nil, errors.New("Panel must be a JSON array of LOINC codes")
+	}
+	seen := make(map[string]bool)
+	for _, code := range panel {
+		if !validLOINC(code) {
+			return nil, errors.New(code + " is not a LOINC code")
+		}
+		if seen[code] {
+			return nil, errors.New(code + " is requested twice")
+		}
+		seen[code] = true
+	}
+	return panel, nil
+}
+
+// ============================================================================================================================
+// Register Organisation - An admin registers a hospital or lab, or renames one
+// ============================================================================================================================
+func (t *SimpleChaincode) register_organisation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0      1                  2
+	   "id", "hospital|lab", "name"
+	   -------------------------------------------------------
+	*/
+
+	id := args[0]
+	kind := args[1]
+	if id == "" || id == "unassigned" {
+		return nil, errors.New("Invalid organisation id " + id)
+	}
+	if err := validateKeyPart(id); err != nil {
+		return nil, err
+	}
+	if _, ok := staffRoles[kind]; !ok {
+		return nil, errors.New("Organisation kind must be " + HOSPITAL + " or " + LAB)
+	}
+
+	o, err := t.getOrganisation(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		o = &organisation{ID: id, Kind: kind}
+	} else if o.Kind != kind {
+		return nil, errors.New(id + " is already registered as a " + o.Kind)
+	}
+	o.Name = args[2]
+
+	err = t.putOrganisation(stub, o)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Registered " + kind + " " + id)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set Lab Catalogue - Replaces the LOINC codes a lab can analyse
+// ============================================================================================================================
+func (t *SimpleChaincode) set_lab_catalogue(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0          1
+	   "labID", "[code, code, ...]"
+	   -------------------------------------------------------
+	*/
+
+	o, err := t.requireOrganisation(stub, args[0], LAB)
+	if err != nil {
+		return nil, err
+	}
+	o.Catalogue, err = parsePanel(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.putOrganisation(stub, o)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Updated catalogue of " + o.ID)
+	return nil, nil
+}
+
+func (t *SimpleChaincode) putOrganisation(stub shim.ChaincodeStubInterface, o *organisation) error {
+	var err error
+	o.UpdatedBy, err = callerFingerprint(stub)
+	if err != nil {
+		return err
+	}
+	o.UpdatedAt, err = txTimeStamp(stub)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(o)
+	return stub.PutState(orgKey(o.ID), jsonAsBytes)
+}
+
+// ============================================================================================================================
+// Add Member - Puts an enrolled doctor or hospital employee on the staff of a hospital, or a lab employee on a lab
+// ============================================================================================================================
+func (t *SimpleChaincode) add_member(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0                1
+	   "organisation", "fingerprint"
+	   -------------------------------------------------------
+	*/
+
+	o, err := t.getOrganisation(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, errors.New(args[0] + " is not a registered organisation")
+	}
+
+	role, err := t.activeRole(stub, args[1], staffRoles[o.Kind]...)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, fmt.Errorf("%s is not an active %v and can not join a %s", args[1], staffRoles[o.Kind], o.Kind)
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	m := membership{Organisation: o.ID, Fingerprint: args[1], Role: role, AddedBy: caller, AddedAt: timeStamp}
+	jsonAsBytes, _ := json.Marshal(m)
+	err = stub.PutState(memberKey(o.ID, args[1]), jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(memberOfKey(args[1], o.ID), indexValue)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Added " + args[1] + " to " + o.ID)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Remove Member - Takes a certificate off the staff of an organisation
+// ============================================================================================================================
+func (t *SimpleChaincode) remove_member(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	ok, err := t.isMember(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New(args[1] + " is not on the staff of " + args[0])
+	}
+
+	err = stub.DelState(memberKey(args[0], args[1]))
+	if err != nil {
+		return nil, err
+	}
+	err = stub.DelState(memberOfKey(args[1], args[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Removed " + args[1] + " from " + args[0])
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Get Organisation - An organisation with its staff
+// ============================================================================================================================
+func (t *SimpleChaincode) get_organisation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	o, err := t.getOrganisation(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, errors.New(args[0] + " is not a registered organisation")
+	}
+
+	prefix := memberKeyPrefix(o.ID)
+	iter, err := stub.RangeQueryState(prefix, prefix+indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to get staff of " + o.ID)
+	}
+	defer iter.Close()
+
+	members := []membership{}
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to get staff of " + o.ID)
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var m membership
+		err = json.Unmarshal(value, &m)
+		if err != nil {
+			return nil, errors.New("Failed to unmarshal membership " + key)
+		}
+		members = append(members, m)
+	}
+
+	return json.Marshal(struct {
+		*organisation
+		Members []membership `json:"members"`
+	}{o, members})
+}
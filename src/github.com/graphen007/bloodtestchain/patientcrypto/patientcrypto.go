@@ -0,0 +1,237 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package patientcrypto is used by bloodtestchain clients to encrypt the
+// sensitive fields of a blood test before they are sent to the chaincode.
+//
+// Every blood test has its own random AES-256 data key. The name, CPR and
+// result are encrypted under that key with the BCCSP AES support and the data
+// key is wrapped with ECIES for the certificate of every party allowed to read
+// them (ordering doctor, assigned lab, patient). The chaincode only ever sees
+// ciphertext, wrapped keys and a keyed hash of the CPR used for lookups.
+//
+// Encryption happens on the client because the AES support uses a random IV,
+// which would make endorsing peers disagree on the written state.
+//
+// The tag of a field also authenticates the blood test ID and the field name
+// it was written for, so a field can not be moved to another field or test
+// that shares the data key.
+package patientcrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/crypto/bccsp"
+	"github.com/hyperledger/fabric/core/crypto/primitives/ecies"
+)
+
+// EnvelopePrefix marks a field encrypted by EncryptField
+const EnvelopePrefix = "v2."
+
+// Field names of the encrypted fields of a blood test, see AnalyteField for
+// the values of structured results
+const (
+	FieldName   = "name"
+	FieldCPR    = "CPR"
+	FieldResult = "result"
+)
+
+// DataKeySize is the size in bytes of a data key
+const DataKeySize = 32
+
+// CPRHashSize is the size in hex characters of a CPR lookup hash
+const CPRHashSize = 64
+
+// GenerateDataKey returns a new random AES-256 data key for one blood test
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("Failed generating data key [%s]", err)
+	}
+	return key, nil
+}
+
+// macKey derives the key used to authenticate envelopes from the data key
+func macKey(dataKey []byte) []byte {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("bloodtestchain envelope mac"))
+	return mac.Sum(nil)
+}
+
+// AnalyteField returns the field name of the value of the analyte code
+func AnalyteField(code string) string {
+	return FieldResult + "/" + code
+}
+
+// fieldTag authenticates the ciphertext of field of the blood test
+// bloodTestID. Every part is length prefixed, so no two contexts give the
+// same MAC input
+func fieldTag(dataKey []byte, bloodTestID string, field string, ct []byte) []byte {
+	mac := hmac.New(sha256.New, macKey(dataKey))
+	for _, part := range [][]byte{[]byte(bloodTestID), []byte(field), ct} {
+		length := make([]byte, 8)
+		binary.BigEndian.PutUint64(length, uint64(len(part)))
+		mac.Write(length)
+		mac.Write(part)
+	}
+	return mac.Sum(nil)
+}
+
+// EncryptField encrypts plaintext under dataKey with AES-CBC-PKCS7 and
+// authenticates the ciphertext, the blood test ID and the field name with
+// HMAC-SHA256. The result has the form v2.<base64 ciphertext>.<base64 tag>
+func EncryptField(csp bccsp.BCCSP, dataKey []byte, bloodTestID string, field string, plaintext string) (string, error) {
+	k, err := csp.KeyImport(dataKey, &bccsp.AES256ImportKeyOpts{Temporary: true})
+	if err != nil {
+		return "", fmt.Errorf("Failed importing data key [%s]", err)
+	}
+
+	ct, err := csp.Encrypt(k, []byte(plaintext), &bccsp.AESCBCPKCS7ModeOpts{})
+	if err != nil {
+		return "", fmt.Errorf("Failed encrypting field [%s]", err)
+	}
+
+	tag := fieldTag(dataKey, bloodTestID, field, ct)
+	return EnvelopePrefix + base64.StdEncoding.EncodeToString(ct) + "." + base64.StdEncoding.EncodeToString(tag), nil
+}
+
+// DecryptField reverses EncryptField. It fails unless bloodTestID and field
+// are the ones the envelope was encrypted for
+func DecryptField(csp bccsp.BCCSP, dataKey []byte, bloodTestID string, field string, envelope string) (string, error) {
+	ct, tag, err := splitEnvelope(envelope)
+	if err != nil {
+		return "", err
+	}
+
+	if !hmac.Equal(tag, fieldTag(dataKey, bloodTestID, field, ct)) {
+		return "", errors.New("Envelope authentication failed")
+	}
+
+	k, err := csp.KeyImport(dataKey, &bccsp.AES256ImportKeyOpts{Temporary: true})
+	if err != nil {
+		return "", fmt.Errorf("Failed importing data key [%s]", err)
+	}
+
+	pt, err := csp.Decrypt(k, ct, &bccsp.AESCBCPKCS7ModeOpts{})
+	if err != nil {
+		return "", fmt.Errorf("Failed decrypting field [%s]", err)
+	}
+	return string(pt), nil
+}
+
+// IsEnvelope returns true if s is well formed output of EncryptField
+func IsEnvelope(s string) bool {
+	_, _, err := splitEnvelope(s)
+	return err == nil
+}
+
+func splitEnvelope(envelope string) ([]byte, []byte, error) {
+	if !strings.HasPrefix(envelope, EnvelopePrefix) {
+		return nil, nil, errors.New("Not an encrypted field")
+	}
+	parts := strings.Split(strings.TrimPrefix(envelope, EnvelopePrefix), ".")
+	if len(parts) != 2 {
+		return nil, nil, errors.New("Malformed encrypted field")
+	}
+	ct, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil || len(ct) == 0 {
+		return nil, nil, errors.New("Malformed ciphertext")
+	}
+	tag, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(tag) != sha256.Size {
+		return nil, nil, errors.New("Malformed tag")
+	}
+	return ct, tag, nil
+}
+
+// CPRHash returns the keyed hash used to look up tests by CPR. lookupKey is
+// shared out of band between the parties of the network.
+func CPRHash(lookupKey []byte, cpr string) string {
+	mac := hmac.New(sha256.New, lookupKey)
+	mac.Write([]byte(strings.TrimSpace(cpr)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsCPRHash returns true if s looks like output of CPRHash
+func IsCPRHash(s string) bool {
+	if len(s) != CPRHashSize {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// WrapKey encrypts dataKey with ECIES for the ECDSA public key of the DER
+// certificate cert. The primitives security level must be initialised.
+func WrapKey(cert []byte, dataKey []byte) (string, error) {
+	x509Cert, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return "", fmt.Errorf("Failed parsing certificate [%s]", err)
+	}
+	pub, ok := x509Cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return "", errors.New("Certificate does not hold an ECDSA public key")
+	}
+
+	spi := ecies.NewSPI()
+	pk, err := spi.NewPublicKey(nil, pub)
+	if err != nil {
+		return "", err
+	}
+	cipher, err := spi.NewAsymmetricCipherFromPublicKey(pk)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := cipher.Process(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("Failed wrapping data key [%s]", err)
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey with the private key of
+// the certificate it was wrapped for
+func UnwrapKey(priv *ecdsa.PrivateKey, wrapped string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, errors.New("Malformed wrapped key")
+	}
+
+	spi := ecies.NewSPI()
+	sk, err := spi.NewPrivateKey(nil, priv)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := spi.NewAsymmetricCipherFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := cipher.Process(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Failed unwrapping data key [%s]", err)
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patientcrypto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/crypto/bccsp"
+	"github.com/hyperledger/fabric/core/crypto/bccsp/sw"
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+)
+
+var csp bccsp.BCCSP
+
+func TestMain(m *testing.M) {
+	primitives.InitSecurityLevel("SHA2", 256)
+	var err error
+	csp, err = sw.New()
+	if err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newDataKey(t *testing.T) []byte {
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		t.Fatalf("Failed generating data key: %s", err)
+	}
+	return dataKey
+}
+
+func TestFieldRoundTrip(t *testing.T) {
+	dataKey := newDataKey(t)
+	for _, plaintext := range []string{"Jane Doe", "0101701234", "", strings.Repeat("x", 100)} {
+		envelope, err := EncryptField(csp, dataKey, "bt1", FieldName, plaintext)
+		if err != nil {
+			t.Fatalf("Failed encrypting %q: %s", plaintext, err)
+		}
+		if !IsEnvelope(envelope) {
+			t.Fatalf("Expected %s to be an envelope", envelope)
+		}
+		if strings.Contains(envelope, plaintext) && plaintext != "" {
+			t.Fatalf("The envelope %s holds the plaintext", envelope)
+		}
+		decrypted, err := DecryptField(csp, dataKey, "bt1", FieldName, envelope)
+		if err != nil {
+			t.Fatalf("Failed decrypting %q: %s", plaintext, err)
+		}
+		if decrypted != plaintext {
+			t.Fatalf("Expected %q, got %q", plaintext, decrypted)
+		}
+	}
+}
+
+func TestFieldTampered(t *testing.T) {
+	dataKey := newDataKey(t)
+	envelope, err := EncryptField(csp, dataKey, "bt1", FieldCPR, "0101701234")
+	if err != nil {
+		t.Fatalf("Failed encrypting: %s", err)
+	}
+	parts := strings.Split(strings.TrimPrefix(envelope, EnvelopePrefix), ".")
+	ct, _ := base64.StdEncoding.DecodeString(parts[0])
+	ct[0] ^= 0x01
+	flipped := EnvelopePrefix + base64.StdEncoding.EncodeToString(ct) + "." + parts[1]
+
+	tests := []struct {
+		name        string
+		dataKey     []byte
+		bloodTestID string
+		field       string
+		envelope    string
+	}{
+		{"flipped ciphertext", dataKey, "bt1", FieldCPR, flipped},
+		{"other field", dataKey, "bt1", FieldName, envelope},
+		{"other test", dataKey, "bt2", FieldCPR, envelope},
+		{"shifted context", dataKey, "bt1C", "PR", envelope},
+		{"other data key", newDataKey(t), "bt1", FieldCPR, envelope},
+		{"truncated", dataKey, "bt1", FieldCPR, envelope[:len(envelope)-4]},
+		{"no prefix", dataKey, "bt1", FieldCPR, strings.TrimPrefix(envelope, EnvelopePrefix)},
+	}
+	for _, test := range tests {
+		if _, err := DecryptField(csp, test.dataKey, test.bloodTestID, test.field, test.envelope); err == nil {
+			t.Fatalf("%s: expected the envelope to be refused", test.name)
+		}
+	}
+}
+
+func TestWrapKeyRoundTrip(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed generating key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "doctor"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("Failed creating certificate: %s", err)
+	}
+
+	dataKey := newDataKey(t)
+	wrapped, err := WrapKey(cert, dataKey)
+	if err != nil {
+		t.Fatalf("Failed wrapping: %s", err)
+	}
+	unwrapped, err := UnwrapKey(priv, wrapped)
+	if err != nil {
+		t.Fatalf("Failed unwrapping: %s", err)
+	}
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Fatal("The unwrapped data key differs")
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err = UnwrapKey(other, wrapped); err == nil {
+		t.Fatal("Expected unwrapping with another key to fail")
+	}
+}
+
+func TestCPRHash(t *testing.T) {
+	lookupKey := []byte("lookup key")
+	hash := CPRHash(lookupKey, " 0101701234 ")
+	if !IsCPRHash(hash) || hash != CPRHash(lookupKey, "0101701234") {
+		t.Fatalf("Unexpected CPR hash %s", hash)
+	}
+	if hash == CPRHash([]byte("other key"), "0101701234") {
+		t.Fatal("Expected the hash to depend on the lookup key")
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Rich queries - Dashboards select tests by status, assignment and order date. The criteria are turned into a CouchDB
+//				  selector, so query_bloodtests needs CouchDB as the state database. On LevelDB the error of the peer
+//				  is returned as is
+//==============================================================================================================================
+type bloodTestCriteria struct {
+	Status      string `json:"status,omitempty"`
+	Doctor      string `json:"doctor,omitempty"`
+	Hospital    string `json:"hospital,omitempty"`
+	Lab         string `json:"lab,omitempty"`
+	OrderedFrom string `json:"orderedFrom,omitempty"` // RFC3339, inclusive
+	OrderedTo   string `json:"orderedTo,omitempty"`   // RFC3339, exclusive
+}
+
+// ============================================================================================================================
+// selector - Builds the Mango selector of the criteria. Only blood tests carry wrapped keys, which keeps samples and
+// audit entries with the same bloodTestID field out of the results
+// ============================================================================================================================
+func (c *bloodTestCriteria) selector(after string) (map[string]interface{}, error) {
+	selector := map[string]interface{}{
+		"bloodTestID": map[string]interface{}{"$gt": after},
+		"keys":        map[string]interface{}{"$exists": true},
+	}
+
+	if c.Status != "" {
+		if !validStatus(c.Status) {
+			return nil, errors.New("Unknown status " + c.Status)
+		}
+		selector["status"] = c.Status
+	}
+	for field, value := range map[string]string{"doctor": c.Doctor, "hospital": c.Hospital, "lab": c.Lab} {
+		if value != "" {
+			selector[field] = value
+		}
+	}
+
+	ordered := map[string]interface{}{}
+	if c.OrderedFrom != "" {
+		from, err := utcTimeStamp(c.OrderedFrom)
+		if err != nil {
+			return nil, err
+		}
+		ordered["$gte"] = from
+	}
+	if c.OrderedTo != "" {
+		to, err := utcTimeStamp(c.OrderedTo)
+		if err != nil {
+			return nil, err
+		}
+		ordered["$lt"] = to
+	}
+	if len(ordered) > 0 {
+		selector["timeStampDoctor"] = ordered
+	}
+
+	return selector, nil
+}
+
+// ============================================================================================================================
+// Query Bloodtests - Page of the tests matching the criteria, ordered by ID. Tests without consent are left out
+// ============================================================================================================================
+func (t *SimpleChaincode) query_bloodtests(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0            1             2
+	   "criteria" ["pageSize"] ["bookmark"]
+	   -------------------------------------------------------
+	   criteria is a JSON object with any of status, doctor, hospital, lab, orderedFrom and orderedTo
+	*/
+
+	var criteria bloodTestCriteria
+	err := json.Unmarshal([]byte(args[0]), &criteria)
+	if err != nil {
+		return nil, errors.New("Criteria must be a JSON object")
+	}
+
+	pageSize, bookmark, err := parsePage(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	after := ""
+	if bookmark != "" {
+		decoded, err := base64.URLEncoding.DecodeString(bookmark)
+		if err != nil {
+			return nil, errors.New("Invalid bookmark")
+		}
+		after = string(decoded)
+	}
+
+	selector, err := criteria.selector(after)
+	if err != nil {
+		return nil, err
+	}
+	// Sorting on _id needs no extra CouchDB index and orders by key, which is the test ID.
+	// One more than a page tells if there is a next page
+	query, _ := json.Marshal(map[string]interface{}{
+		"selector": selector,
+		"sort":     []interface{}{map[string]string{"_id": "asc"}},
+		"limit":    pageSize + 1,
+	})
+
+	iter, err := stub.ExecuteQuery(string(query))
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	page := struct {
+		ReturnedObjects []json.RawMessage `json:"returnedObjects"`
+		Bookmark        string            `json:"bookmark"`
+	}{ReturnedObjects: []json.RawMessage{}}
+
+	scanned := 0
+	last := ""
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read query results")
+		}
+		if scanned == pageSize {
+			page.Bookmark = base64.URLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		scanned++
+		last = key
+
+		// The document is read again through GetState, so the test is in the read set and decoded like every read
+		res, err := t.getBloodTest(stub, key)
+		if err != nil {
+			return nil, err
+		}
+		if res.BloodTestID != key {
+			continue
+		}
+		granted, err := t.checkAccess(stub, res)
+		if err != nil {
+			return nil, err
+		}
+		if granted {
+			bloodAsBytes, _ := json.Marshal(res)
+			page.ReturnedObjects = append(page.ReturnedObjects, json.RawMessage(bloodAsBytes))
+		}
+	}
+
+	return json.Marshal(page)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// ============================================================================================================================
+// TestCriteriaSelector - The Mango selector of the criteria of query_bloodtests. Order dates are compared in UTC and the
+// bookmark is the last test ID of the previous page
+// ============================================================================================================================
+func TestCriteriaSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria bloodTestCriteria
+		after    string
+		want     string
+	}{
+		{"no criteria", bloodTestCriteria{}, "",
+			`{"bloodTestID":{"$gt":""},"keys":{"$exists":true}}`},
+		{"assignment", bloodTestCriteria{Status: STATUS_ASSIGNED, Doctor: "dr", Hospital: scenarioHospital, Lab: scenarioLab}, "",
+			`{"bloodTestID":{"$gt":""},"doctor":"dr","hospital":"rigshospitalet","keys":{"$exists":true},"lab":"lab1","status":"assigned"}`},
+		{"date range", bloodTestCriteria{OrderedFrom: "2017-01-01T01:00:00+01:00", OrderedTo: "2017-02-01T00:00:00Z"}, "",
+			`{"bloodTestID":{"$gt":""},"keys":{"$exists":true},"timeStampDoctor":{"$gte":"2017-01-01T00:00:00Z","$lt":"2017-02-01T00:00:00Z"}}`},
+		{"open range", bloodTestCriteria{OrderedTo: "2017-02-01T00:00:00Z"}, "",
+			`{"bloodTestID":{"$gt":""},"keys":{"$exists":true},"timeStampDoctor":{"$lt":"2017-02-01T00:00:00Z"}}`},
+		{"next page", bloodTestCriteria{Status: STATUS_ORDERED}, "bt5",
+			`{"bloodTestID":{"$gt":"bt5"},"keys":{"$exists":true},"status":"ordered"}`},
+	}
+	for _, test := range tests {
+		selector, err := test.criteria.selector(test.after)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got, _ := json.Marshal(selector); string(got) != test.want {
+			t.Fatalf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+
+	for _, criteria := range []bloodTestCriteria{{Status: "lost"}, {OrderedFrom: "yesterday"}, {OrderedTo: "2017-02-01"}} {
+		if _, err := criteria.selector(""); err == nil {
+			t.Fatalf("Expected the criteria %+v to be refused", criteria)
+		}
+	}
+}
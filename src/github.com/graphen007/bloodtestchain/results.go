@@ -0,0 +1,176 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/graphen007/bloodtestchain/patientcrypto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Structured results - A result is a list of analytes. The measured value is encrypted like the other patient fields,
+//						code, unit, reference range and abnormal flag are in the clear so abnormal tests can be indexed
+//==============================================================================================================================
+
+// Abnormal flags, following the HL7 observation interpretation codes
+const FLAG_NORMAL = "N"
+const FLAG_LOW = "L"
+const FLAG_HIGH = "H"
+const FLAG_CRITICAL_LOW = "LL"
+const FLAG_CRITICAL_HIGH = "HH"
+const FLAG_ABNORMAL = "A"
+
+var validFlags = map[string]bool{
+	FLAG_NORMAL:        true,
+	FLAG_LOW:           true,
+	FLAG_HIGH:          true,
+	FLAG_CRITICAL_LOW:  true,
+	FLAG_CRITICAL_HIGH: true,
+	FLAG_ABNORMAL:      true,
+}
+
+// loincCode matches a LOINC code: up to 7 digits, a dash and the check digit
+var loincCode = regexp.MustCompile(`^([0-9]{1,7})-([0-9])$`)
+
+const MAX_ANALYTES = 100
+
+type referenceRange struct {
+	Low  *float64 `json:"low,omitempty"`
+	High *float64 `json:"high,omitempty"`
+	Text string   `json:"text,omitempty"`
+}
+
+type analyte struct {
+	Code           string         `json:"code"`
+	Value          string         `json:"value"`
+	Unit           string         `json:"unit"`
+	ReferenceRange referenceRange `json:"referenceRange"`
+	Flag           string         `json:"flag"`
+}
+
+// loincCheckDigit computes the mod 10 check digit of the numeric part of a LOINC code
+func loincCheckDigit(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+// validLOINC returns true if code is a LOINC code with a correct check digit
+func validLOINC(code string) bool {
+	m := loincCode.FindStringSubmatch(code)
+	return m != nil && int(m[2][0]-'0') == loincCheckDigit(m[1])
+}
+
+// ============================================================================================================================
+// validateAnalyte - Checks one analyte of a submitted result
+// ============================================================================================================================
+func validateAnalyte(a *analyte) error {
+	if !validLOINC(a.Code) {
+		return errors.New("Analyte code " + a.Code + " is not a LOINC code")
+	}
+	if !patientcrypto.IsEnvelope(a.Value) {
+		return errors.New("Value of " + a.Code + " must be encrypted")
+	}
+	if a.Unit == "" {
+		return errors.New("Unit of " + a.Code + " is missing")
+	}
+	r := a.ReferenceRange
+	if r.Low == nil && r.High == nil && r.Text == "" {
+		return errors.New("Reference range of " + a.Code + " is missing")
+	}
+	if r.Low != nil && r.High != nil && *r.Low > *r.High {
+		return errors.New("Reference range of " + a.Code + " has low above high")
+	}
+	if !validFlags[a.Flag] {
+		return errors.New("Abnormal flag of " + a.Code + " must be one of N, L, H, LL, HH or A")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// parseResults - Parses and validates a JSON array of analytes
+// ============================================================================================================================
+func parseResults(arg string) ([]analyte, error) {
+	var results []analyte
+	err := json.Unmarshal([]byte(arg), &results)
+	if err != nil {
+		return nil, errors.New("Result must be a JSON array of analytes")
+	}
+	if len(results) == 0 {
+		return nil, errors.New("Result must contain at least one analyte")
+	}
+	if len(results) > MAX_ANALYTES {
+		return nil, fmt.Errorf("Result can not contain more than %d analytes", MAX_ANALYTES)
+	}
+
+	seen := make(map[string]bool)
+	for i := range results {
+		err = validateAnalyte(&results[i])
+		if err != nil {
+			return nil, err
+		}
+		if seen[results[i].Code] {
+			return nil, errors.New("Analyte " + results[i].Code + " is listed twice")
+		}
+		seen[results[i].Code] = true
+	}
+	return results, nil
+}
+
+// isAbnormal returns true if any analyte of the test is flagged
+func isAbnormal(res *bloodTest) bool {
+	for _, a := range res.Results {
+		if a.Flag != FLAG_NORMAL {
+			return true
+		}
+	}
+	return false
+}
+
+// hasResult returns true if the test has a structured or a legacy free text result
+func hasResult(res *bloodTest) bool {
+	return len(res.Results) > 0 || res.Result != ""
+}
+
+// ============================================================================================================================
+// Abnormal Patient Read - Tests of a patient with at least one flagged analyte, looked up by the keyed hash of the CPR
+// ============================================================================================================================
+func (t *SimpleChaincode) abnormal_patient_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.readByIndex(stub, IDX_ABNORMAL_CPR, args)
+}
+
+// ============================================================================================================================
+// Abnormal Doctor Read - Tests of a doctor with at least one flagged analyte
+// ============================================================================================================================
+func (t *SimpleChaincode) abnormal_doctor_read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.readByIndex(stub, IDX_ABNORMAL_DOCTOR, args)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ============================================================================================================================
+// TestAbnormalIndex - change_result adds a test with a flagged analyte to the abnormal indexes and takes it out again when
+// the result is corrected
+// ============================================================================================================================
+func TestAbnormalIndex(t *testing.T) {
+	s := newScenario(t)
+	cprHash := strings.Repeat("ab", 32)
+	s.mustInvoke(ADMIN, "link_patient", s.fingerprint(CLIENT), cprHash)
+	s.recordResult("bt1", `["718-7","2345-7"]`)
+	s.recordResult("bt2", `["718-7","2345-7"]`)
+
+	abnormal := func(id string) bool {
+		doctor := s.stub.State[indexKey(IDX_ABNORMAL_DOCTOR, s.fingerprint(DOCTOR), id)] != nil
+		patient := s.stub.State[indexKey(IDX_ABNORMAL_CPR, cprHash, id)] != nil
+		if doctor != patient {
+			t.Fatalf("Expected %s in both abnormal indexes or in neither", id)
+		}
+		return doctor
+	}
+	if abnormal("bt1") || abnormal("bt2") {
+		t.Fatal("Expected normal results to stay out of the abnormal indexes")
+	}
+
+	high := strings.Replace(scenarioResult, `"flag":"N"`, `"flag":"H"`, 1)
+	s.mustInvoke(LAB, "change_result", "bt1", high)
+	if !abnormal("bt1") || abnormal("bt2") {
+		t.Fatal("Expected only the flagged test in the abnormal indexes")
+	}
+	want := [][]string{{"bt1"}}
+	if pages := s.readAll(DOCTOR, "abnormal_doctor_read", s.fingerprint(DOCTOR), 10); !reflect.DeepEqual(pages, want) {
+		t.Fatalf("Expected the doctor to get %v, got %v", want, pages)
+	}
+	if pages := s.readAll(CLIENT, "abnormal_patient_read", cprHash, 10); !reflect.DeepEqual(pages, want) {
+		t.Fatalf("Expected the patient to get %v, got %v", want, pages)
+	}
+
+	s.mustInvoke(LAB, "change_status", "bt1", STATUS_ANALYSED)
+	s.mustInvoke(LAB, "change_result", "bt1", scenarioResult)
+	if abnormal("bt1") {
+		t.Fatal("Expected the corrected result to leave the abnormal indexes")
+	}
+	if pages := s.readAll(DOCTOR, "abnormal_doctor_read", s.fingerprint(DOCTOR), 10); !reflect.DeepEqual(pages, [][]string{{}}) {
+		t.Fatalf("Expected no abnormal tests, got %v", pages)
+	}
+}
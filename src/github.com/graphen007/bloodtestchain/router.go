@@ -0,0 +1,255 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Access modes - Invoke may only dispatch write functions, Query may only dispatch read functions. Both dispatch audited
+//				  reads, whose consent checks are only recorded when invoked
+//==============================================================================================================================
+type accessMode int
+
+const (
+	modeRead accessMode = iota
+	modeWrite
+	modeAudited
+)
+
+func (m accessMode) String() string {
+	switch m {
+	case modeWrite:
+		return "invoke"
+	case modeAudited:
+		return "invoke or query"
+	}
+	return "query"
+}
+
+// queryStub is the stub of an audited read dispatched by Query, which can not write the records of its consent checks
+type queryStub struct {
+	shim.ChaincodeStubInterface
+}
+
+// anyArity disables the argument count check for a route
+const anyArity = -1
+
+//==============================================================================================================================
+// Error codes returned by the dispatcher
+//==============================================================================================================================
+const (
+	ERR_UNKNOWN_FUNCTION = "UNKNOWN_FUNCTION"
+	ERR_WRONG_MODE       = "WRONG_MODE"
+	ERR_ARG_COUNT        = "INCORRECT_ARG_COUNT"
+	ERR_ACCESS_DENIED    = "ACCESS_DENIED"
+)
+
+//==============================================================================================================================
+// dispatchError - Structured error returned to the caller as JSON
+//==============================================================================================================================
+type dispatchError struct {
+	Code     string `json:"code"`
+	Function string `json:"function"`
+	Message  string `json:"message"`
+	Expected int    `json:"expected,omitempty"`
+	Received int    `json:"received,omitempty"`
+}
+
+func (e *dispatchError) Error() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e.Code + ": " + e.Message
+	}
+	return string(b)
+}
+
+//==============================================================================================================================
+// route - Declares a chaincode function, the number of args it takes, who may call it and whether it writes state
+//==============================================================================================================================
+type handlerFunc func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error)
+
+type route struct {
+	name     string
+	mode     accessMode
+	arity    int
+	optional int      // number of trailing optional args after arity
+	roles    []string // empty means any caller
+	handler  handlerFunc
+}
+
+type router struct {
+	routes map[string]route
+}
+
+func newRouter(routes ...route) *router {
+	r := &router{routes: make(map[string]route)}
+	for _, rt := range routes {
+		if _, exists := r.routes[rt.name]; exists {
+			panic("duplicate chaincode function " + rt.name)
+		}
+		r.routes[rt.name] = rt
+	}
+	return r
+}
+
+// ============================================================================================================================
+// dispatch - Looks up the function, validates mode, arity and role, then runs the handler
+// ============================================================================================================================
+func (r *router) dispatch(t *SimpleChaincode, stub shim.ChaincodeStubInterface, mode accessMode) ([]byte, error) {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println(mode.String() + " is running " + function)
+
+	rt, ok := r.routes[function]
+	if !ok {
+		fmt.Println(mode.String() + " did not find func: " + function)
+		return nil, &dispatchError{Code: ERR_UNKNOWN_FUNCTION, Function: function, Message: "Received unknown function " + mode.String()}
+	}
+
+	if rt.mode != mode && rt.mode != modeAudited {
+		return nil, &dispatchError{Code: ERR_WRONG_MODE, Function: function, Message: "Function must be called as " + rt.mode.String()}
+	}
+	if rt.mode == modeAudited && mode == modeRead {
+		stub = queryStub{stub}
+	}
+
+	if rt.arity != anyArity && (len(args) < rt.arity || len(args) > rt.arity+rt.optional) {
+		message := fmt.Sprintf("Incorrect number of arguments. Expecting %d", rt.arity)
+		if rt.optional > 0 {
+			message = fmt.Sprintf("Incorrect number of arguments. Expecting %d to %d", rt.arity, rt.arity+rt.optional)
+		}
+		return nil, &dispatchError{
+			Code:     ERR_ARG_COUNT,
+			Function: function,
+			Message:  message,
+			Expected: rt.arity,
+			Received: len(args),
+		}
+	}
+
+	if len(rt.roles) > 0 {
+		ok, err := t.callerHasRole(stub, rt.roles)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &dispatchError{Code: ERR_ACCESS_DENIED, Function: function, Message: fmt.Sprintf("Caller must have one of the roles %v", rt.roles)}
+		}
+	}
+
+	return rt.handler(t, stub, args)
+}
+
+// allRoles are looked up in this order for functions open to anyone
+var allRoles = []string{ADMIN, DOCTOR, HOSPITAL, LAB, COURIER, CLIENT}
+
+// ============================================================================================================================
+// callerRole - Returns the first role of the running function the caller is enrolled in. For functions open to anyone it
+// is the first of allRoles, empty if the caller has no active enrollment
+// ============================================================================================================================
+func (r *router) callerRole(t *SimpleChaincode, stub shim.ChaincodeStubInterface) string {
+	function, _ := stub.GetFunctionAndParameters()
+	roles := r.routes[function].roles
+	if len(roles) == 0 {
+		roles = allRoles
+	}
+	role, err := t.callerActiveRole(stub, roles...)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return role
+}
+
+//==============================================================================================================================
+// Function registry - Every function callable through Invoke or Query is declared here.
+//					   Built in init because handlers look up the roles of the running function
+//==============================================================================================================================
+var bloodTestRoutes *router
+
+func init() {
+	bloodTestRoutes = newRouter(
+		// Invoke functions
+		route{name: "init", mode: modeWrite, arity: anyArity, roles: []string{ADMIN}, handler: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+			return t.Init(stub)
+		}},
+		route{name: "write", mode: modeWrite, arity: 2, roles: []string{ADMIN}, handler: (*SimpleChaincode).write},
+		route{name: "init_bloodtest", mode: modeWrite, arity: 10, optional: 1, roles: []string{DOCTOR}, handler: (*SimpleChaincode).init_bloodtest},
+		route{name: "share_key", mode: modeWrite, arity: 3, roles: []string{DOCTOR}, handler: (*SimpleChaincode).share_key},
+		route{name: "change_status", mode: modeWrite, arity: 2, roles: []string{DOCTOR, HOSPITAL, LAB}, handler: (*SimpleChaincode).change_status},
+		route{name: "change_doctor", mode: modeWrite, arity: 2, roles: []string{DOCTOR, HOSPITAL}, handler: (*SimpleChaincode).change_doctor},
+		route{name: "change_hospital", mode: modeWrite, arity: 2, roles: []string{DOCTOR}, handler: (*SimpleChaincode).change_hospital},
+		route{name: "change_lab", mode: modeWrite, arity: 2, roles: []string{HOSPITAL}, handler: (*SimpleChaincode).change_lab},
+		route{name: "change_result", mode: modeWrite, arity: 2, roles: []string{LAB}, handler: (*SimpleChaincode).change_result},
+		route{name: "register_sample", mode: modeWrite, arity: 3, roles: []string{DOCTOR, HOSPITAL}, handler: (*SimpleChaincode).register_sample},
+		route{name: "handoff_sample", mode: modeWrite, arity: 4, roles: []string{DOCTOR, HOSPITAL, COURIER, LAB}, handler: (*SimpleChaincode).handoff_sample},
+		route{name: "acknowledge_sample", mode: modeWrite, arity: 3, roles: []string{HOSPITAL, COURIER, LAB}, handler: (*SimpleChaincode).acknowledge_sample},
+		route{name: "refuse_sample", mode: modeWrite, arity: 2, roles: []string{HOSPITAL, COURIER, LAB}, handler: (*SimpleChaincode).refuse_sample},
+		route{name: "change_sample_status", mode: modeWrite, arity: 2, roles: []string{LAB}, handler: (*SimpleChaincode).change_sample_status},
+		route{name: "register_organisation", mode: modeWrite, arity: 3, roles: []string{ADMIN}, handler: (*SimpleChaincode).register_organisation},
+		route{name: "set_lab_catalogue", mode: modeWrite, arity: 2, roles: []string{ADMIN}, handler: (*SimpleChaincode).set_lab_catalogue},
+		route{name: "add_member", mode: modeWrite, arity: 2, roles: []string{ADMIN}, handler: (*SimpleChaincode).add_member},
+		route{name: "remove_member", mode: modeWrite, arity: 2, roles: []string{ADMIN}, handler: (*SimpleChaincode).remove_member},
+		route{name: "set_lab_prices", mode: modeWrite, arity: 2, roles: []string{LAB}, handler: (*SimpleChaincode).set_lab_prices},
+		route{name: "raise_dispute", mode: modeWrite, arity: 5, roles: []string{HOSPITAL}, handler: (*SimpleChaincode).raise_dispute},
+		route{name: "change_dispute", mode: modeWrite, arity: 3, optional: 1, roles: []string{HOSPITAL, LAB}, handler: (*SimpleChaincode).change_dispute},
+		route{name: "set_sla", mode: modeWrite, arity: 3, roles: []string{ADMIN}, handler: (*SimpleChaincode).set_sla},
+		route{name: "migrate", mode: modeWrite, arity: 0, optional: 1, roles: []string{ADMIN}, handler: (*SimpleChaincode).migrate},
+		route{name: "rebuild_indexes", mode: modeWrite, arity: 0, roles: []string{ADMIN}, handler: (*SimpleChaincode).rebuild_indexes},
+		route{name: "create_user", mode: modeWrite, arity: 2, handler: (*SimpleChaincode).create_user},
+		route{name: "migrate_accounts", mode: modeWrite, arity: 0, roles: []string{ADMIN}, handler: (*SimpleChaincode).migrate_accounts},
+		route{name: "link_patient", mode: modeWrite, arity: 2, roles: []string{ADMIN}, handler: (*SimpleChaincode).link_patient},
+		route{name: "grant_consent", mode: modeWrite, arity: 3, roles: []string{CLIENT}, handler: (*SimpleChaincode).grant_consent},
+		route{name: "ingest_service_request", mode: modeWrite, arity: 1, roles: []string{DOCTOR}, handler: (*SimpleChaincode).ingest_service_request},
+		route{name: "import_bloodtests", mode: modeWrite, arity: 1, roles: []string{HOSPITAL, LAB}, handler: (*SimpleChaincode).import_bloodtests},
+		route{name: "revoke_consent", mode: modeWrite, arity: 2, roles: []string{CLIENT}, handler: (*SimpleChaincode).revoke_consent},
+
+		// Reads of blood tests, invoked or queried. Only invoked reads commit the records of their consent checks
+		route{name: "read", mode: modeAudited, arity: 1, handler: (*SimpleChaincode).read},
+		route{name: "read_list", mode: modeAudited, arity: 1, handler: (*SimpleChaincode).read_list},
+		route{name: "client_read", mode: modeAudited, arity: 1, optional: 2, roles: []string{CLIENT, DOCTOR}, handler: (*SimpleChaincode).client_read},
+		route{name: "doctor_read", mode: modeAudited, arity: 1, optional: 2, roles: []string{DOCTOR}, handler: (*SimpleChaincode).doctor_read},
+		route{name: "hospital_read", mode: modeAudited, arity: 1, optional: 2, roles: []string{HOSPITAL}, handler: (*SimpleChaincode).hospital_read},
+		route{name: "lab_read", mode: modeAudited, arity: 1, optional: 2, roles: []string{LAB}, handler: (*SimpleChaincode).lab_read},
+		route{name: "status_read", mode: modeAudited, arity: 1, optional: 2, roles: []string{ADMIN, HOSPITAL, LAB}, handler: (*SimpleChaincode).status_read},
+		route{name: "abnormal_patient_read", mode: modeAudited, arity: 1, optional: 2, roles: []string{CLIENT, DOCTOR}, handler: (*SimpleChaincode).abnormal_patient_read},
+		route{name: "abnormal_doctor_read", mode: modeAudited, arity: 1, optional: 2, roles: []string{DOCTOR}, handler: (*SimpleChaincode).abnormal_doctor_read},
+		route{name: "query_bloodtests", mode: modeAudited, arity: 1, optional: 2, roles: []string{DOCTOR, HOSPITAL, LAB}, handler: (*SimpleChaincode).query_bloodtests},
+		route{name: "export_bloodtests", mode: modeAudited, arity: 0, optional: 2, roles: []string{HOSPITAL, LAB}, handler: (*SimpleChaincode).export_bloodtests},
+		route{name: "get_fhir_bundle", mode: modeAudited, arity: 1, handler: (*SimpleChaincode).get_fhir_bundle},
+		route{name: "get_data_key", mode: modeAudited, arity: 1, handler: (*SimpleChaincode).get_data_key},
+		route{name: "get_history", mode: modeAudited, arity: 1, roles: []string{ADMIN, DOCTOR, HOSPITAL, LAB}, handler: (*SimpleChaincode).get_history},
+		route{name: "verify_history", mode: modeAudited, arity: 1, roles: []string{ADMIN, DOCTOR, HOSPITAL, LAB}, handler: (*SimpleChaincode).verify_history},
+
+		// Query functions
+		route{name: "get_user", mode: modeRead, arity: 2, handler: (*SimpleChaincode).get_user},
+		route{name: "verify_credentials", mode: modeRead, arity: 2, handler: (*SimpleChaincode).verify_credentials},
+		route{name: "get_samples", mode: modeRead, arity: 1, roles: []string{ADMIN, DOCTOR, HOSPITAL, COURIER, LAB}, handler: (*SimpleChaincode).get_samples},
+		route{name: "get_organisation", mode: modeRead, arity: 1, handler: (*SimpleChaincode).get_organisation},
+		route{name: "get_lab_prices", mode: modeRead, arity: 1, handler: (*SimpleChaincode).get_lab_prices},
+		route{name: "get_settlement", mode: modeRead, arity: 3, roles: []string{HOSPITAL, LAB}, handler: (*SimpleChaincode).get_settlement},
+		route{name: "get_dispute", mode: modeRead, arity: 1, roles: []string{HOSPITAL, LAB}, handler: (*SimpleChaincode).get_dispute},
+		route{name: "get_sla", mode: modeRead, arity: 2, handler: (*SimpleChaincode).get_sla},
+		route{name: "get_overdue", mode: modeRead, arity: 2, optional: 2, roles: []string{ADMIN, HOSPITAL, LAB}, handler: (*SimpleChaincode).get_overdue},
+		route{name: "get_turnaround", mode: modeRead, arity: 4, roles: []string{ADMIN, HOSPITAL, LAB}, handler: (*SimpleChaincode).get_turnaround},
+		route{name: "export_enrollments", mode: modeRead, arity: 1, optional: 2, roles: []string{ADMIN}, handler: (*SimpleChaincode).export_enrollments},
+		route{name: "list_consents", mode: modeRead, arity: 0, roles: []string{CLIENT}, handler: (*SimpleChaincode).list_consents},
+	)
+}
@@ -0,0 +1,613 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Samples - An order produces several tubes, each with a barcode, stored under "sample" 0x00 barcode. Every handoff between
+//			 custodians is acknowledged by the receiver. The received, assigned and analysed statuses of the order are
+//			 derived from its samples
+//==============================================================================================================================
+const samplePrefix = "sample"
+
+const SAMPLE_COLLECTED = "collected"     // taken by the doctor
+const SAMPLE_IN_TRANSIT = "in_transit"   // handed off and not yet acknowledged, or with a courier
+const SAMPLE_AT_HOSPITAL = "at_hospital" // acknowledged by a hospital
+const SAMPLE_AT_LAB = "at_lab"           // acknowledged by a lab
+const SAMPLE_ANALYSED = "analysed"       // analysed by the lab holding it
+const SAMPLE_REJECTED = "rejected"       // unusable, rejected by the lab holding it
+
+const HANDOFF_PENDING = "pending"
+const HANDOFF_ACKNOWLEDGED = "acknowledged"
+const HANDOFF_REFUSED = "refused"
+
+const MAX_SAMPLES = 20
+
+var barcodePattern = regexp.MustCompile(`^[A-Za-z0-9-]{4,64}$`)
+
+// derivedStatuses can not be set with change_status on a test with samples
+var derivedStatuses = map[string]bool{
+	STATUS_RECEIVED: true,
+	STATUS_ASSIGNED: true,
+	STATUS_ANALYSED: true,
+}
+
+// statusRank orders the statuses derived from samples, a derived status never moves a test back
+var statusRank = map[string]int{
+	STATUS_ORDERED:  0,
+	STATUS_RECEIVED: 1,
+	STATUS_ASSIGNED: 2,
+	STATUS_ANALYSED: 3,
+}
+
+type handoff struct {
+	Sequence            int      `json:"sequence"`
+	From                string   `json:"from"`
+	FromRole            string   `json:"fromRole"`
+	To                  string   `json:"to"`
+	ToRole              string   `json:"toRole"`
+	ToOrganisation      string   `json:"toOrganisation,omitempty"`
+	HandedOverAt        string   `json:"handedOverAt"`
+	Condition           string   `json:"condition"`
+	Temperature         *float64 `json:"temperature,omitempty"`
+	Status              string   `json:"status"`
+	AcknowledgedAt      string   `json:"acknowledgedAt,omitempty"`
+	ReceivedCondition   string   `json:"receivedCondition,omitempty"`
+	ReceivedTemperature *float64 `json:"receivedTemperature,omitempty"`
+	Reason              string   `json:"reason,omitempty"`
+	PreviousStatus      string   `json:"previousStatus"`
+}
+
+type sample struct {
+	Barcode       string    `json:"barcode"`
+	BloodTestID   string    `json:"bloodTestID"`
+	TubeType      string    `json:"tubeType"`
+	Status        string    `json:"status"`
+	Custodian     string    `json:"custodian"`
+	CustodianRole string    `json:"custodianRole"`
+	CollectedAt   string    `json:"collectedAt"`
+	Custody       []handoff `json:"custody"`
+}
+
+func sampleKey(barcode string) string {
+	return samplePrefix + indexSep + barcode
+}
+
+// pending returns the unacknowledged handoff of the sample, or nil
+func (s *sample) pending() *handoff {
+	if len(s.Custody) == 0 {
+		return nil
+	}
+	last := &s.Custody[len(s.Custody)-1]
+	if last.Status != HANDOFF_PENDING {
+		return nil
+	}
+	return last
+}
+
+// locationStatus is the status of a sample held by role
+func locationStatus(role string) string {
+	switch role {
+	case HOSPITAL:
+		return SAMPLE_AT_HOSPITAL
+	case LAB:
+		return SAMPLE_AT_LAB
+	case DOCTOR:
+		return SAMPLE_COLLECTED
+	}
+	return SAMPLE_IN_TRANSIT
+}
+
+// parseTemperature reads a temperature in degrees Celsius, empty when it was not measured
+func parseTemperature(arg string) (*float64, error) {
+	if arg == "" {
+		return nil, nil
+	}
+	temperature, err := strconv.ParseFloat(arg, 64)
+	if err != nil || temperature < -100 || temperature > 100 {
+		return nil, errors.New("Temperature must be in degrees Celsius between -100 and 100")
+	}
+	return &temperature, nil
+}
+
+func (t *SimpleChaincode) getSample(stub shim.ChaincodeStubInterface, barcode string) (*sample, error) {
+	sampleAsBytes, err := stub.GetState(sampleKey(barcode))
+	if err != nil {
+		return nil, errors.New("Failed to get sample " + barcode)
+	}
+	if sampleAsBytes == nil {
+		return nil, errors.New("Sample " + barcode + " does not exist")
+	}
+	s := &sample{}
+	err = json.Unmarshal(sampleAsBytes, s)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal sample " + barcode)
+	}
+	return s, nil
+}
+
+func (t *SimpleChaincode) putSample(stub shim.ChaincodeStubInterface, s *sample) error {
+	jsonAsBytes, _ := json.Marshal(s)
+	return stub.PutState(sampleKey(s.Barcode), jsonAsBytes)
+}
+
+// ============================================================================================================================
+// deriveStatus - Status of a test from its samples. A test is received once any sample reached a hospital or lab,
+// assigned once any reached a lab, analysed once all usable samples are, and rejected when every sample is
+// ============================================================================================================================
+func deriveStatus(samples []*sample) string {
+	usable := 0
+	analysed := 0
+	status := STATUS_ORDERED
+	for _, s := range samples {
+		reached := ""
+		switch s.Status {
+		case SAMPLE_REJECTED:
+			continue
+		case SAMPLE_ANALYSED:
+			analysed++
+			reached = STATUS_ASSIGNED
+		case SAMPLE_AT_LAB:
+			reached = STATUS_ASSIGNED
+		default:
+			// A sample that has been at a hospital or lab has made the test received, wherever it is now
+			for _, h := range s.Custody {
+				if h.Status == HANDOFF_ACKNOWLEDGED && (h.ToRole == HOSPITAL || h.ToRole == LAB) {
+					reached = STATUS_RECEIVED
+				}
+			}
+			if s.CustodianRole == HOSPITAL {
+				reached = STATUS_RECEIVED
+			}
+		}
+		usable++
+		if reached != "" && statusRank[reached] > statusRank[status] {
+			status = reached
+		}
+	}
+
+	if len(samples) > 0 && usable == 0 {
+		return STATUS_REJECTED
+	}
+	if usable > 0 && analysed == usable {
+		return STATUS_ANALYSED
+	}
+	return status
+}
+
+// ============================================================================================================================
+// updateOrderStatus - Moves the test of a sample forward to the status derived from all of its samples.
+// labName is the lab organisation a sample has just reached, recorded on the test if it has no lab yet
+// ============================================================================================================================
+func (t *SimpleChaincode) updateOrderStatus(stub shim.ChaincodeStubInterface, bloodTestID string, labName string) error {
+
+	old, err := t.getBloodTest(stub, bloodTestID)
+	if err != nil {
+		return err
+	}
+	res := *old
+
+	if labName != "" && (res.Lab == "" || res.Lab == "unassigned") {
+		res.Lab = labName
+	}
+
+	var samples []*sample
+	for _, barcode := range res.Samples {
+		s, err := t.getSample(stub, barcode)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, s)
+	}
+
+	derived := deriveStatus(samples)
+	current, inProgress := statusRank[res.Status]
+	if inProgress && derived == STATUS_REJECTED {
+		err = setStatus(stub, &res, derived)
+		if err != nil {
+			return err
+		}
+	} else if inProgress {
+		// When a sample moves on faster than the order, the order passes through every status in between so each is stamped
+		for _, status := range []string{STATUS_RECEIVED, STATUS_ASSIGNED, STATUS_ANALYSED} {
+			if statusRank[status] <= current || statusRank[status] > statusRank[derived] {
+				continue
+			}
+			err = setStatus(stub, &res, status)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if res.Status == old.Status && res.Lab == old.Lab {
+		return nil
+	}
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return err
+	}
+	if res.Status != old.Status {
+		return t.emitEvent(stub, statusEvent(res.Status), old, &res)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Register Sample - Adds a tube to an order. The caller becomes its first custodian
+// ============================================================================================================================
+func (t *SimpleChaincode) register_sample(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0              1          2
+	   "bloodTestID", "barcode", "tubeType"
+	   -------------------------------------------------------
+	*/
+
+	if !barcodePattern.MatchString(args[1]) {
+		return nil, errors.New("Barcode must be 4 to 64 letters, digits or dashes")
+	}
+	if args[2] == "" {
+		return nil, errors.New("Tube type is missing")
+	}
+
+	old, err := t.getBloodTest(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tubes are added by the ordering doctor or by the staff of the hospital of the order
+	if caller != old.OrderedBy {
+		err = t.requireCallerMember(stub, old.Hospital)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, inProgress := statusRank[old.Status]; !inProgress {
+		return nil, errors.New("Blood test " + args[0] + " is " + old.Status)
+	}
+	if len(old.Samples) >= MAX_SAMPLES {
+		return nil, fmt.Errorf("A blood test can not have more than %d samples", MAX_SAMPLES)
+	}
+
+	existing, err := stub.GetState(sampleKey(args[1]))
+	if err != nil {
+		return nil, errors.New("Failed to get sample " + args[1])
+	}
+	if existing != nil {
+		return nil, errors.New("Sample " + args[1] + " already exists")
+	}
+
+	role := bloodTestRoutes.callerRole(t, stub)
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sample{
+		Barcode:       args[1],
+		BloodTestID:   args[0],
+		TubeType:      args[2],
+		Status:        locationStatus(role),
+		Custodian:     caller,
+		CustodianRole: role,
+		CollectedAt:   timeStamp,
+		Custody:       []handoff{},
+	}
+	err = t.putSample(stub, s)
+	if err != nil {
+		return nil, err
+	}
+
+	res := *old
+	res.Samples = append(append([]string{}, old.Samples...), s.Barcode)
+	err = t.saveBloodTest(stub, old, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Registered sample " + s.Barcode + " for " + args[0])
+	return nil, t.updateOrderStatus(stub, args[0], "")
+}
+
+// ============================================================================================================================
+// Handoff Sample - The custodian hands a sample to a hospital, courier or lab. The receiver has to acknowledge it
+// ============================================================================================================================
+func (t *SimpleChaincode) handoff_sample(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0           1            2              3
+	   "barcode", "to", "condition", "temperature"
+	   -------------------------------------------------------
+	   to is the certificate fingerprint of the receiver, temperature is in degrees Celsius and may be empty
+	*/
+
+	s, err := t.getSample(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller != s.Custodian {
+		return nil, errors.New("Only the custodian can hand off sample " + s.Barcode)
+	}
+	if s.pending() != nil {
+		return nil, errors.New("Sample " + s.Barcode + " has a handoff waiting for acknowledgement")
+	}
+	if s.Status == SAMPLE_ANALYSED || s.Status == SAMPLE_REJECTED {
+		return nil, errors.New("Sample " + s.Barcode + " is " + s.Status)
+	}
+	if args[1] == caller {
+		return nil, errors.New("A sample can not be handed off to its custodian")
+	}
+	if args[2] == "" {
+		return nil, errors.New("Condition is missing")
+	}
+	temperature, err := parseTemperature(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	receiverRole, err := t.activeRole(stub, args[1], HOSPITAL, COURIER, LAB)
+	if err != nil {
+		return nil, err
+	}
+	if receiverRole == "" {
+		return nil, errors.New("Receiver " + args[1] + " is not an active hospital, courier or lab")
+	}
+
+	// A lab only receives samples of panels it can analyse
+	toOrganisation := ""
+	if receiverRole == HOSPITAL || receiverRole == LAB {
+		toOrganisation, err = t.memberOrganisation(stub, args[1], receiverRole)
+		if err != nil {
+			return nil, err
+		}
+		if toOrganisation == "" {
+			return nil, errors.New("Receiver " + args[1] + " is not on the staff of a registered " + receiverRole)
+		}
+	}
+	if receiverRole == LAB {
+		res, err := t.getBloodTest(stub, s.BloodTestID)
+		if err != nil {
+			return nil, err
+		}
+		lab, err := t.requireOrganisation(stub, toOrganisation, LAB)
+		if err != nil {
+			return nil, err
+		}
+		err = checkCatalogue(lab, res.Panel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Custody = append(s.Custody, handoff{
+		Sequence:       len(s.Custody),
+		From:           caller,
+		FromRole:       s.CustodianRole,
+		To:             args[1],
+		ToRole:         receiverRole,
+		ToOrganisation: toOrganisation,
+		HandedOverAt:   timeStamp,
+		Condition:      args[2],
+		Temperature:    temperature,
+		Status:         HANDOFF_PENDING,
+		PreviousStatus: s.Status,
+	})
+	s.Status = SAMPLE_IN_TRANSIT
+
+	err = t.putSample(stub, s)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Handed off sample " + s.Barcode + " to " + args[1])
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Acknowledge Sample - The receiver of a pending handoff confirms it got the sample and records its condition
+// ============================================================================================================================
+func (t *SimpleChaincode) acknowledge_sample(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0           1              2
+	   "barcode", "condition", "temperature"
+	   -------------------------------------------------------
+	*/
+
+	s, h, err := t.pendingHandoffForCaller(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if args[1] == "" {
+		return nil, errors.New("Condition is missing")
+	}
+	temperature, err := parseTemperature(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	h.AcknowledgedAt, err = txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	h.Status = HANDOFF_ACKNOWLEDGED
+	h.ReceivedCondition = args[1]
+	h.ReceivedTemperature = temperature
+
+	s.Custodian = h.To
+	s.CustodianRole = h.ToRole
+	s.Status = locationStatus(h.ToRole)
+
+	err = t.putSample(stub, s)
+	if err != nil {
+		return nil, err
+	}
+
+	labName := ""
+	if h.ToRole == LAB {
+		labName = h.ToOrganisation
+	}
+
+	fmt.Println("Acknowledged sample " + s.Barcode)
+	return nil, t.updateOrderStatus(stub, s.BloodTestID, labName)
+}
+
+// ============================================================================================================================
+// Refuse Sample - The receiver of a pending handoff declines it, the sender stays custodian
+// ============================================================================================================================
+func (t *SimpleChaincode) refuse_sample(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0           1
+	   "barcode", "reason"
+	   -------------------------------------------------------
+	*/
+
+	s, h, err := t.pendingHandoffForCaller(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if args[1] == "" {
+		return nil, errors.New("Reason is missing")
+	}
+
+	h.AcknowledgedAt, err = txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	h.Status = HANDOFF_REFUSED
+	h.Reason = args[1]
+	s.Status = h.PreviousStatus
+
+	err = t.putSample(stub, s)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Refused sample " + s.Barcode)
+	return nil, nil
+}
+
+// pendingHandoffForCaller returns a sample and its pending handoff if the caller is the receiver
+func (t *SimpleChaincode) pendingHandoffForCaller(stub shim.ChaincodeStubInterface, barcode string) (*sample, *handoff, error) {
+	s, err := t.getSample(stub, barcode)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := s.pending()
+	if h == nil {
+		return nil, nil, errors.New("Sample " + barcode + " has no pending handoff")
+	}
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if caller != h.To {
+		return nil, nil, errors.New("Sample " + barcode + " was not handed off to the caller")
+	}
+	return s, h, nil
+}
+
+// ============================================================================================================================
+// Change Sample Status - The lab holding a sample marks it analysed or rejected
+// ============================================================================================================================
+func (t *SimpleChaincode) change_sample_status(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0           1
+	   "barcode", "analysed|rejected"
+	   -------------------------------------------------------
+	*/
+
+	if args[1] != SAMPLE_ANALYSED && args[1] != SAMPLE_REJECTED {
+		return nil, errors.New("Sample status must be " + SAMPLE_ANALYSED + " or " + SAMPLE_REJECTED)
+	}
+
+	s, err := t.getSample(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller != s.Custodian || s.Status != SAMPLE_AT_LAB {
+		return nil, errors.New("Only the lab holding sample " + s.Barcode + " can change its status")
+	}
+
+	s.Status = args[1]
+	err = t.putSample(stub, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.updateOrderStatus(stub, s.BloodTestID, "")
+}
+
+// ============================================================================================================================
+// Get Samples - The samples of a test with their custody chain. Samples hold no patient data
+// ============================================================================================================================
+func (t *SimpleChaincode) get_samples(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	res, err := t.getBloodTest(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []*sample{}
+	for _, barcode := range res.Samples {
+		s, err := t.getSample(stub, barcode)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+
+	return json.Marshal(struct {
+		BloodTestID string    `json:"bloodTestID"`
+		Status      string    `json:"status"`
+		Samples     []*sample `json:"samples"`
+	}{res.BloodTestID, res.Status, samples})
+}
@@ -0,0 +1,789 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphen007/bloodtestchain/btevents"
+	"github.com/graphen007/bloodtestchain/patientcrypto"
+	"github.com/graphen007/identitychain/identity"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Scenarios - The blood test chaincode and the identity chaincode run on MockStubs. Every participant has a certificate
+//			   enrolled in its role, transactions are signed by the certificate of the role that runs them
+//==============================================================================================================================
+const (
+	scenarioHospital = "rigshospitalet"
+	scenarioLab      = "lab1"
+	scenarioTest     = "bt1"
+)
+
+var scenarioRoles = []string{ADMIN, DOCTOR, CLIENT, HOSPITAL, LAB, COURIER}
+
+type scenario struct {
+	t        *testing.T
+	identity *shim.MockStub
+	stub     *shim.MockStub
+	certs    map[string][]byte
+	txs      int
+}
+
+// newScenario deploys both chaincodes, enrolls one participant per role and registers the hospital and the lab
+func newScenario(t *testing.T) *scenario {
+	s := &scenario{
+		t:        t,
+		identity: shim.NewMockStub("identity", new(identity.Chaincode)),
+		stub:     shim.NewMockStub("bloodtestchain", new(SimpleChaincode)),
+		certs:    make(map[string][]byte),
+	}
+	for _, role := range scenarioRoles {
+		s.certs[role] = []byte("certificate of the " + role)
+	}
+
+	s.identity.MockCaller(s.certs[ADMIN], nil)
+	if _, err := s.identity.MockInit("deploy", args("init")); err != nil {
+		t.Fatalf("Failed to deploy the identity chaincode: %s", err)
+	}
+	for _, role := range scenarioRoles[1:] {
+		cert := base64.StdEncoding.EncodeToString(s.certs[role])
+		if _, err := s.identity.MockInvoke(s.tx(), args("invite_user", role, "The "+role, cert)); err != nil {
+			t.Fatalf("Failed to invite the %s: %s", role, err)
+		}
+		if _, err := s.identity.MockInvoke(s.tx(), args("approve_user", role, s.fingerprint(role))); err != nil {
+			t.Fatalf("Failed to approve the %s: %s", role, err)
+		}
+	}
+
+	s.stub.MockPeerChaincode("identity", s.identity)
+	s.stub.MockCaller(s.certs[ADMIN], nil)
+	if _, err := s.stub.MockInit("deploy", args("init", "identity")); err != nil {
+		t.Fatalf("Failed to deploy the blood test chaincode: %s", err)
+	}
+
+	s.mustInvoke(ADMIN, "register_organisation", scenarioHospital, HOSPITAL, "Rigshospitalet")
+	s.mustInvoke(ADMIN, "register_organisation", scenarioLab, LAB, "Lab One")
+	s.mustInvoke(ADMIN, "set_lab_catalogue", scenarioLab, `["718-7","2345-7"]`)
+	s.mustInvoke(ADMIN, "add_member", scenarioHospital, s.fingerprint(DOCTOR))
+	s.mustInvoke(ADMIN, "add_member", scenarioHospital, s.fingerprint(HOSPITAL))
+	s.mustInvoke(ADMIN, "add_member", scenarioLab, s.fingerprint(LAB))
+	s.mustInvoke(LAB, "set_lab_prices", scenarioLab, `[{"code":"718-7","amount":1500,"currency":"DKK"},{"code":"2345-7","amount":900,"currency":"DKK"}]`)
+
+	return s
+}
+
+func args(strs ...string) [][]byte {
+	a := make([][]byte, len(strs))
+	for i, s := range strs {
+		a[i] = []byte(s)
+	}
+	return a
+}
+
+func (s *scenario) tx() string {
+	s.txs++
+	return fmt.Sprintf("tx%d", s.txs)
+}
+
+func (s *scenario) fingerprint(role string) string {
+	return identity.CertFingerprint(s.certs[role])
+}
+
+// invoke runs function signed by the certificate of role
+func (s *scenario) invoke(role string, function string, params ...string) ([]byte, error) {
+	s.stub.MockCaller(s.certs[role], nil)
+	return s.stub.MockInvoke(s.tx(), args(append([]string{function}, params...)...))
+}
+
+func (s *scenario) query(role string, function string, params ...string) ([]byte, error) {
+	s.stub.MockCaller(s.certs[role], nil)
+	return s.stub.MockQuery(args(append([]string{function}, params...)...))
+}
+
+func (s *scenario) mustInvoke(role string, function string, params ...string) []byte {
+	result, err := s.invoke(role, function, params...)
+	if err != nil {
+		s.t.Fatalf("%s failed for the %s: %s", function, role, err)
+	}
+	return result
+}
+
+func (s *scenario) bloodTest(id string) *bloodTest {
+	res, err := new(SimpleChaincode).getBloodTest(s.stub, id)
+	if err != nil {
+		s.t.Fatalf("Failed to get blood test %s: %s", id, err)
+	}
+	return res
+}
+
+// envelope returns a well formed encrypted field, the chaincode never decrypts it
+func envelope(plaintext string) string {
+	tag := bytes.Repeat([]byte{0x01}, 32)
+	return patientcrypto.EnvelopePrefix + base64.StdEncoding.EncodeToString([]byte(plaintext)) + "." + base64.StdEncoding.EncodeToString(tag)
+}
+
+func (s *scenario) orderArgs() []string {
+	keys, _ := json.Marshal(map[string]string{s.fingerprint(DOCTOR): base64.StdEncoding.EncodeToString([]byte("wrapped key"))})
+	return []string{"", envelope("Jane Doe"), envelope("0101701234"), s.fingerprint(DOCTOR), scenarioHospital, "", "", scenarioTest,
+		strings.Repeat("ab", 32), string(keys), `["718-7","2345-7"]`}
+}
+
+var scenarioResult = fmt.Sprintf(`[{"code":"718-7","value":%q,"unit":"g/dL","referenceRange":{"low":12,"high":16},"flag":"N"},`+
+	`{"code":"2345-7","value":%q,"unit":"mg/dL","referenceRange":{"low":70,"high":99},"flag":"N"}]`, envelope("14.1"), envelope("88"))
+
+// ============================================================================================================================
+// TestOrderToRelease - Runs a test from the order of the doctor to the release of the result. Every step is first tried by
+// each of the other roles, which must be refused without changing the test or emitting an event
+// ============================================================================================================================
+func TestOrderToRelease(t *testing.T) {
+	s := newScenario(t)
+
+	steps := []struct {
+		name     string
+		role     string
+		function string
+		args     []string
+		event    string
+		status   string
+	}{
+		{"order", DOCTOR, "init_bloodtest", s.orderArgs(), btevents.Created, STATUS_ORDERED},
+		{"receive", HOSPITAL, "change_status", []string{scenarioTest, STATUS_RECEIVED}, btevents.StatusChanged, STATUS_RECEIVED},
+		{"pick lab", HOSPITAL, "change_lab", []string{scenarioTest, scenarioLab}, btevents.LabAssigned, STATUS_RECEIVED},
+		{"assign", HOSPITAL, "change_status", []string{scenarioTest, STATUS_ASSIGNED}, btevents.StatusChanged, STATUS_ASSIGNED},
+		{"analyse", LAB, "change_status", []string{scenarioTest, STATUS_ANALYSED}, btevents.StatusChanged, STATUS_ANALYSED},
+		{"record result", LAB, "change_result", []string{scenarioTest, scenarioResult}, btevents.ResultRecorded, STATUS_ANALYSED},
+		{"release", LAB, "change_status", []string{scenarioTest, STATUS_RELEASED}, btevents.ResultReleased, STATUS_RELEASED},
+	}
+
+	for _, step := range steps {
+		for _, role := range scenarioRoles {
+			if role == step.role {
+				continue
+			}
+			events := len(s.stub.Events)
+			before := s.stub.State[scenarioTest]
+			if _, err := s.invoke(role, step.function, step.args...); err == nil {
+				t.Fatalf("%s: the %s was allowed to %s", step.name, role, step.function)
+			}
+			if len(s.stub.Events) != events {
+				t.Fatalf("%s: the refused %s emitted %s", step.name, role, s.stub.Events[events].EventName)
+			}
+			if !bytes.Equal(s.stub.State[scenarioTest], before) {
+				t.Fatalf("%s: the refused %s changed the test", step.name, role)
+			}
+		}
+
+		if _, err := s.invoke(step.role, step.function, step.args...); err != nil {
+			t.Fatalf("%s: %s failed for the %s: %s", step.name, step.function, step.role, err)
+		}
+		stamp := time.Unix(s.stub.TxTimestamp.Seconds, 0).UTC().Format(time.RFC3339)
+
+		last := s.stub.Events[len(s.stub.Events)-1]
+		event, err := btevents.Decode(last)
+		if err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		}
+		p := event.Payload
+		if last.EventName != step.event || p.BloodTestID != scenarioTest || p.Status != step.status || p.TimeStamp != stamp || p.TxID != fmt.Sprintf("tx%d", s.txs) {
+			t.Fatalf("%s: unexpected event %s %+v", step.name, last.EventName, p)
+		}
+		if res := s.bloodTest(scenarioTest); res.Status != step.status {
+			t.Fatalf("%s: expected status %s, got %s", step.name, step.status, res.Status)
+		}
+	}
+
+	res := s.bloodTest(scenarioTest)
+	if res.OrderedBy != s.fingerprint(DOCTOR) || res.Lab != scenarioLab {
+		t.Fatalf("Unexpected parties of the released test: %+v", res)
+	}
+	stamps := []string{res.TimeStampDoctor, res.TimeStampHospital, res.TimeStampLab, res.TimeStampAnalyse, res.TimeStampResult}
+	for i := 1; i < len(stamps); i++ {
+		if stamps[i] <= stamps[i-1] {
+			t.Fatalf("Stamps are not in the order of the steps: %v", stamps)
+		}
+	}
+	released := s.stub.Events[len(s.stub.Events)-1]
+	if p, _ := btevents.Decode(released); res.TimeStampResult != p.Payload.TimeStamp {
+		t.Fatalf("Expected the result to be stamped %s, got %s", p.Payload.TimeStamp, res.TimeStampResult)
+	}
+
+	// The result is billed to the hospital at the prices of the lab
+	period := shim.MockClockStart.Format("2006-01")
+	settlementAsBytes, err := s.query(HOSPITAL, "get_settlement", scenarioHospital, scenarioLab, period)
+	if err != nil {
+		t.Fatalf("Failed to get the settlement: %s", err)
+	}
+	var settlement struct {
+		Charges []charge         `json:"charges"`
+		Total   map[string]int64 `json:"total"`
+	}
+	if err = json.Unmarshal(settlementAsBytes, &settlement); err != nil {
+		t.Fatalf("Failed to unmarshal the settlement: %s", err)
+	}
+	if len(settlement.Charges) != 2 || settlement.Total["DKK"] != 2400 {
+		t.Fatalf("Expected 2 charges of 2400 DKK in total, got %s", settlementAsBytes)
+	}
+}
+
+// ============================================================================================================================
+// TestStepsOutOfOrder - Status changes the lifecycle does not allow are refused, also for the role of the step
+// ============================================================================================================================
+func TestStepsOutOfOrder(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+
+	steps := []struct {
+		name    string
+		role    string
+		args    []string
+		wantErr string
+	}{
+		{"assign before receive", HOSPITAL, []string{scenarioTest, STATUS_ASSIGNED}, "Illegal status change"},
+		{"receive", HOSPITAL, []string{scenarioTest, STATUS_RECEIVED}, ""},
+		{"assign without lab", HOSPITAL, []string{scenarioTest, STATUS_ASSIGNED}, "A lab must be set"},
+		{"analyse before assign", LAB, []string{scenarioTest, STATUS_ANALYSED}, "Illegal status change"},
+		{"cancel", DOCTOR, []string{scenarioTest, STATUS_CANCELLED}, ""},
+		{"receive cancelled", HOSPITAL, []string{scenarioTest, STATUS_RECEIVED}, "Illegal status change"},
+	}
+
+	for _, step := range steps {
+		_, err := s.invoke(step.role, "change_status", step.args...)
+		if step.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: %s", step.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+			t.Fatalf("%s: expected an error containing %q, got %v", step.name, step.wantErr, err)
+		}
+	}
+
+	if res := s.bloodTest(scenarioTest); res.Status != STATUS_CANCELLED {
+		t.Fatalf("Expected the test to be cancelled, got %s", res.Status)
+	}
+}
+
+// enroll enrolls another participant in role under name, so tests can have two of a kind
+func (s *scenario) enroll(name string, role string) {
+	s.certs[name] = []byte("certificate of " + name)
+	cert := base64.StdEncoding.EncodeToString(s.certs[name])
+	if _, err := s.identity.MockInvoke(s.tx(), args("invite_user", role, name, cert)); err != nil {
+		s.t.Fatalf("Failed to invite %s: %s", name, err)
+	}
+	if _, err := s.identity.MockInvoke(s.tx(), args("approve_user", role, s.fingerprint(name))); err != nil {
+		s.t.Fatalf("Failed to approve %s: %s", name, err)
+	}
+}
+
+// ============================================================================================================================
+// TestStepsByOtherParties - A participant in the right role is refused for a test that is not theirs: only the ordering
+// doctor cancels, only the staff of the hospital and the lab of the test move it along
+// ============================================================================================================================
+func TestStepsByOtherParties(t *testing.T) {
+	s := newScenario(t)
+	s.enroll("other doctor", DOCTOR)
+	s.enroll("other hospital", HOSPITAL)
+	s.enroll("other lab", LAB)
+	s.mustInvoke(ADMIN, "register_organisation", "herlev", HOSPITAL, "Herlev Hospital")
+	s.mustInvoke(ADMIN, "register_organisation", "lab2", LAB, "Lab Two")
+	s.mustInvoke(ADMIN, "add_member", scenarioHospital, s.fingerprint("other doctor"))
+	s.mustInvoke(ADMIN, "add_member", "herlev", s.fingerprint("other hospital"))
+	s.mustInvoke(ADMIN, "add_member", "lab2", s.fingerprint("other lab"))
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+
+	steps := []struct {
+		name    string
+		role    string
+		status  string
+		wantErr string
+	}{
+		{"receive by another hospital", "other hospital", STATUS_RECEIVED, "not on the staff of " + scenarioHospital},
+		{"reject by another hospital", "other hospital", STATUS_REJECTED, "not on the staff of " + scenarioHospital},
+		{"cancel by a colleague", "other doctor", STATUS_CANCELLED, "Only the ordering doctor"},
+		{"receive", HOSPITAL, STATUS_RECEIVED, ""},
+		{"pick lab", HOSPITAL, "", ""},
+		{"assign", HOSPITAL, STATUS_ASSIGNED, ""},
+		{"analyse by another lab", "other lab", STATUS_ANALYSED, "not on the staff of " + scenarioLab},
+		{"reject by another lab", "other lab", STATUS_REJECTED, "not on the staff of " + scenarioLab},
+		{"analyse", LAB, STATUS_ANALYSED, ""},
+	}
+
+	for _, step := range steps {
+		var err error
+		if step.status == "" {
+			_, err = s.invoke(step.role, "change_lab", scenarioTest, scenarioLab)
+		} else {
+			_, err = s.invoke(step.role, "change_status", scenarioTest, step.status)
+		}
+		if step.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: %s", step.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+			t.Fatalf("%s: expected an error containing %q, got %v", step.name, step.wantErr, err)
+		}
+	}
+
+	if res := s.bloodTest(scenarioTest); res.Status != STATUS_ANALYSED {
+		t.Fatalf("Expected the test to be analysed, got %s", res.Status)
+	}
+}
+
+// ============================================================================================================================
+// TestDoctorOfHospital - The doctor of a test is an active doctor on the staff of its hospital, when ordered and reassigned
+// ============================================================================================================================
+func TestDoctorOfHospital(t *testing.T) {
+	s := newScenario(t)
+	s.enroll("dr jensen", DOCTOR)
+
+	for _, doctor := range []string{s.fingerprint("dr jensen"), s.fingerprint(HOSPITAL), "dr-hansen"} {
+		order := s.orderArgs()
+		order[3] = doctor
+		if _, err := s.invoke(DOCTOR, "init_bloodtest", order...); err == nil {
+			t.Fatalf("Expected an order for %s to be refused", doctor)
+		}
+	}
+	order := s.orderArgs()
+	order[3] = ""
+	s.mustInvoke(DOCTOR, "init_bloodtest", order...)
+	if res := s.bloodTest(scenarioTest); res.Doctor != s.fingerprint(DOCTOR) {
+		t.Fatalf("Expected the ordering doctor to be the doctor of the test, got %s", res.Doctor)
+	}
+
+	if _, err := s.invoke(HOSPITAL, "change_doctor", scenarioTest, s.fingerprint("dr jensen")); err == nil {
+		t.Fatal("Expected the test to be refused to a doctor from another hospital")
+	}
+	s.mustInvoke(ADMIN, "add_member", scenarioHospital, s.fingerprint("dr jensen"))
+	s.mustInvoke(HOSPITAL, "change_doctor", scenarioTest, s.fingerprint("dr jensen"))
+	if res := s.bloodTest(scenarioTest); res.Doctor != s.fingerprint("dr jensen") {
+		t.Fatalf("Expected the test to be reassigned, got %s", res.Doctor)
+	}
+}
+
+// ============================================================================================================================
+// TestCancelByOrderingDoctor - The doctor that ordered the test can cancel it
+// ============================================================================================================================
+func TestCancelByOrderingDoctor(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+	s.mustInvoke(DOCTOR, "change_status", scenarioTest, STATUS_CANCELLED)
+	if res := s.bloodTest(scenarioTest); res.Status != STATUS_CANCELLED {
+		t.Fatalf("Expected the test to be cancelled, got %s", res.Status)
+	}
+}
+
+// ============================================================================================================================
+// TestCreateUserKeys - Accounts are stored apart from every other record, a username can not overwrite a test or the
+// configuration of the chaincode. An account is bound to the certificate that created it and has no password
+// ============================================================================================================================
+func TestCreateUserKeys(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+	test := s.stub.State[scenarioTest]
+
+	if _, err := s.invoke(CLIENT, "create_user", CLIENT, scenarioTest, "secret"); err == nil {
+		t.Fatal("Expected a password to be refused")
+	}
+	s.mustInvoke(CLIENT, "create_user", CLIENT, scenarioTest)
+	if !bytes.Equal(s.stub.State[scenarioTest], test) {
+		t.Fatal("An account overwrote the blood test")
+	}
+	if s.stub.State[accountKey(scenarioTest)] == nil {
+		t.Fatal("Expected the account to be stored under its account key")
+	}
+	if _, err := s.invoke(CLIENT, "create_user", CLIENT, scenarioTest); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Expected the second account to be refused, got %v", err)
+	}
+
+	for _, username := range []string{identityChaincodeKey, accountKey("someone"), bloodTestIndex, ""} {
+		if _, err := s.invoke(CLIENT, "create_user", CLIENT, username); err == nil {
+			t.Fatalf("Expected username %q to be refused", username)
+		}
+	}
+	if _, err := s.invoke(CLIENT, "read", accountKey(scenarioTest)); err == nil {
+		t.Fatal("Expected the account key to be protected from read")
+	}
+	for key := range s.stub.State {
+		if strings.HasPrefix(key, credentialPrefix) {
+			t.Fatalf("Expected no credential for a new account, got %s", key)
+		}
+	}
+
+	s.enroll("other client", CLIENT)
+	for _, test := range []struct {
+		caller string
+		found  bool
+	}{{CLIENT, true}, {"other client", false}} {
+		response, err := s.query(test.caller, "get_user", scenarioTest, CLIENT)
+		if err != nil || strings.Contains(string(response), s.fingerprint(CLIENT)) != test.found {
+			t.Fatalf("Expected the %s to get the account: %v, got %s %v", test.caller, test.found, response, err)
+		}
+	}
+
+	// Roles are still looked up in the identity chaincode
+	s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_RECEIVED)
+}
+
+// denied returns true if response is the access denied response of a read
+func denied(response []byte) bool {
+	var e dispatchError
+	return json.Unmarshal(response, &e) == nil && e.Code == ERR_ACCESS_DENIED
+}
+
+// ============================================================================================================================
+// TestHistoryAccess - The audit trail of a test is only shown to callers that may read the test, and every check is audited
+// ============================================================================================================================
+func TestHistoryAccess(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+	s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_RECEIVED)
+
+	for _, function := range []string{"get_history", "verify_history"} {
+		if response := s.mustInvoke(HOSPITAL, function, scenarioTest); !denied(response) {
+			t.Fatalf("Expected %s to be denied without consent, got %s", function, response)
+		}
+	}
+	if _, err := s.invoke(HOSPITAL, "get_history", "nosuchtest"); err == nil {
+		t.Fatal("Expected the history of a missing test to be refused")
+	}
+
+	s.mustInvoke(ADMIN, "link_patient", s.fingerprint(CLIENT), strings.Repeat("ab", 32))
+	s.mustInvoke(CLIENT, "grant_consent", s.fingerprint(HOSPITAL), scenarioTest, "2099-01-01T00:00:00Z")
+
+	var history struct {
+		History []auditEntry   `json:"history"`
+		Access  []accessRecord `json:"access"`
+	}
+	for _, role := range []string{DOCTOR, HOSPITAL} {
+		response := s.mustInvoke(role, "get_history", scenarioTest)
+		if err := json.Unmarshal(response, &history); err != nil || len(history.History) == 0 {
+			t.Fatalf("Expected the %s to get the history, got %s", role, response)
+		}
+	}
+	deniedChecks := 0
+	for _, record := range history.Access {
+		if !record.Granted {
+			deniedChecks++
+			if record.Actor != s.fingerprint(HOSPITAL) || record.Role != HOSPITAL {
+				t.Fatalf("Expected the denied check to record the hospital, got %+v", record)
+			}
+		}
+	}
+	if deniedChecks != 2 {
+		t.Fatalf("Expected the 2 denied checks in the access records, got %d", deniedChecks)
+	}
+	for _, entry := range history.History {
+		if entry.Access != nil {
+			t.Fatalf("Expected no consent check in the hash chained trail, got %+v", entry)
+		}
+	}
+
+	var verification struct {
+		Valid bool `json:"valid"`
+	}
+	response := s.mustInvoke(HOSPITAL, "verify_history", scenarioTest)
+	if err := json.Unmarshal(response, &verification); err != nil || !verification.Valid {
+		t.Fatalf("Expected a valid trail, got %s", response)
+	}
+}
+
+// ============================================================================================================================
+// TestReadAccessRecords - Reads record their checks under their own keys, leave the audit chain alone and can be queried
+// ============================================================================================================================
+func TestReadAccessRecords(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+	head := string(s.stub.State[auditHeadKey(scenarioTest)])
+
+	s.mustInvoke(DOCTOR, "read", scenarioTest)
+	s.mustInvoke(DOCTOR, "read", scenarioTest)
+	if string(s.stub.State[auditHeadKey(scenarioTest)]) != head {
+		t.Fatal("Expected reads to leave the head of the audit trail alone")
+	}
+	records := 0
+	for key := range s.stub.State {
+		if strings.HasPrefix(key, accessRecordPrefix(scenarioTest)) {
+			records++
+		}
+	}
+	if records != 2 {
+		t.Fatalf("Expected a record of each read under its own key, got %d", records)
+	}
+
+	// read is open to anyone, the role of the reader is recorded all the same
+	var history struct {
+		Access []accessRecord `json:"access"`
+	}
+	json.Unmarshal(s.mustInvoke(DOCTOR, "get_history", scenarioTest), &history)
+	if len(history.Access) < 2 {
+		t.Fatalf("Expected the records of the reads in the history, got %+v", history.Access)
+	}
+	for _, record := range history.Access {
+		if record.Role != DOCTOR {
+			t.Fatalf("Expected the role of the doctor in the access record, got %+v", record)
+		}
+	}
+
+	response, err := s.query(DOCTOR, "read", scenarioTest)
+	if err != nil || denied(response) {
+		t.Fatalf("Expected the doctor to query the test, got %s %v", response, err)
+	}
+	if response, err = s.query(HOSPITAL, "read", scenarioTest); err != nil || !denied(response) {
+		t.Fatalf("Expected the query to be denied without consent, got %s %v", response, err)
+	}
+}
+
+// ============================================================================================================================
+// TestReservedBloodTestIDs - Tests can not be created or imported under the keys and markers of the chaincode
+// ============================================================================================================================
+func TestReservedBloodTestIDs(t *testing.T) {
+	s := newScenario(t)
+	for _, id := range []string{CONSENT_ALL_TESTS, accountsMigratedKey, migrateCheckpointKey, credentialPrefix + "someone",
+		accountIndex, bloodTestIndex, identityChaincodeKey, accountKey("someone"), "_anything"} {
+		order := s.orderArgs()
+		order[7] = id
+		if _, err := s.invoke(DOCTOR, "init_bloodtest", order...); err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Fatalf("Expected blood test ID %q to be refused, got %v", id, err)
+		}
+
+		record := bloodTestRecord{BloodTestID: id, Hospital: scenarioHospital, Lab: scenarioLab, Status: STATUS_ORDERED}
+		batch, _ := json.Marshal([]bloodTestRecord{record})
+		if _, err := s.invoke(LAB, "import_bloodtests", string(batch)); err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Fatalf("Expected the import of blood test ID %q to be refused, got %v", id, err)
+		}
+	}
+	if s.stub.State[accountsMigratedKey] != nil {
+		t.Fatal("Expected the accounts to stay unmigrated")
+	}
+}
+
+// ============================================================================================================================
+// TestReadList - Lists only give out tests, with the same consent check as read, and never protected keys
+// ============================================================================================================================
+func TestReadList(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+	s.mustInvoke(ADMIN, "write", "note", `{"text":"not a test"}`)
+	s.mustInvoke(ADMIN, "write", "mylist", `["`+scenarioTest+`","note","missing"]`)
+	s.mustInvoke(ADMIN, "write", "badlist", `{"bt1":true}`)
+	s.mustInvoke(ADMIN, "write", "protectedlist", `["`+scenarioTest+`","`+identityChaincodeKey+`"]`)
+
+	if list := s.mustInvoke(DOCTOR, "read_list", "mylist"); !bytes.Equal(list, s.stub.State[scenarioTest]) {
+		t.Fatalf("Expected only the test for the ordering doctor, got %s", list)
+	}
+	if list := s.mustInvoke(HOSPITAL, "read_list", "mylist"); !denied(list) {
+		t.Fatalf("Expected the test to be denied without consent, got %s", list)
+	}
+
+	for _, list := range []string{"badlist", "protectedlist", accountKey("someone"), identityChaincodeKey} {
+		if _, err := s.invoke(DOCTOR, "read_list", list); err == nil {
+			t.Fatalf("Expected read_list of %q to be refused", list)
+		}
+	}
+}
+
+// ============================================================================================================================
+// TestChangeResultRefused - A result is only recorded by the lab of the test while the lab has it
+// ============================================================================================================================
+func TestChangeResultRefused(t *testing.T) {
+	s := newScenario(t)
+	s.enroll("other lab", LAB)
+	s.mustInvoke(ADMIN, "register_organisation", "lab2", LAB, "Lab Two")
+	s.mustInvoke(ADMIN, "add_member", "lab2", s.fingerprint("other lab"))
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+
+	steps := []struct {
+		name    string
+		role    string
+		wantErr string
+	}{
+		{"ordered", LAB, "not on the staff of unassigned"},
+		{"received", LAB, "not on the staff of unassigned"},
+		{"lab picked", LAB, "can only be recorded"},
+		{"assigned by another lab", "other lab", "not on the staff of " + scenarioLab},
+		{"assigned", LAB, ""},
+		{"analysed", LAB, ""},
+		{"released", LAB, "can only be recorded"},
+	}
+	prepare := map[string]func(){
+		"received":   func() { s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_RECEIVED) },
+		"lab picked": func() { s.mustInvoke(HOSPITAL, "change_lab", scenarioTest, scenarioLab) },
+		"assigned":   func() { s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_ASSIGNED) },
+		"analysed":   func() { s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_ANALYSED) },
+		"released":   func() { s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_RELEASED) },
+	}
+
+	for _, step := range steps {
+		if prepare[step.name] != nil {
+			prepare[step.name]()
+		}
+		before := s.stub.State[scenarioTest]
+		_, err := s.invoke(step.role, "change_result", scenarioTest, scenarioResult)
+		if step.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: %s", step.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+			t.Fatalf("%s: expected an error containing %q, got %v", step.name, step.wantErr, err)
+		}
+		if !bytes.Equal(s.stub.State[scenarioTest], before) {
+			t.Fatalf("%s: the refused result changed the test", step.name)
+		}
+	}
+}
+
+type exportPage struct {
+	Records  []bloodTestRecord `json:"records"`
+	Bookmark string            `json:"bookmark"`
+}
+
+func (s *scenario) export(role string) exportPage {
+	var page exportPage
+	response := s.mustInvoke(role, "export_bloodtests")
+	if err := json.Unmarshal(response, &page); err != nil {
+		s.t.Fatalf("Failed to unmarshal the export: %s", err)
+	}
+	return page
+}
+
+// ============================================================================================================================
+// TestExportImportRoundTrip - A lab exports the tests its patients consented to and imports them into another network
+// unchanged. The import is announced with one event and checks the organisations of every record
+// ============================================================================================================================
+func TestExportImportRoundTrip(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+	s.mustInvoke(DOCTOR, "share_key", scenarioTest, s.fingerprint(LAB), base64.StdEncoding.EncodeToString([]byte("wrapped for the lab")))
+	s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_RECEIVED)
+	s.mustInvoke(HOSPITAL, "change_lab", scenarioTest, scenarioLab)
+	s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_ASSIGNED)
+	s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_ANALYSED)
+	s.mustInvoke(LAB, "change_result", scenarioTest, scenarioResult)
+	s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_RELEASED)
+
+	if exported := s.export(LAB); len(exported.Records) != 0 {
+		t.Fatalf("Expected no test in the export without consent, got %+v", exported)
+	}
+	s.mustInvoke(ADMIN, "link_patient", s.fingerprint(CLIENT), strings.Repeat("ab", 32))
+	s.mustInvoke(CLIENT, "grant_consent", s.fingerprint(LAB), CONSENT_ALL_TESTS, "2099-01-01T00:00:00Z")
+
+	exported := s.export(LAB)
+	if len(exported.Records) != 1 || exported.Records[0].BloodTestID != scenarioTest {
+		t.Fatalf("Expected the test in the export, got %+v", exported)
+	}
+	batch, _ := json.Marshal(exported.Records)
+
+	other := newScenario(t)
+	other.mustInvoke(LAB, "import_bloodtests", string(batch))
+	event, err := btevents.Decode(other.stub.Events[len(other.stub.Events)-1])
+	if err != nil || event.Payload.Event != btevents.Imported || event.Payload.Lab != scenarioLab ||
+		len(event.Payload.BloodTestIDs) != 1 || event.Payload.BloodTestIDs[0] != scenarioTest {
+		t.Fatalf("Expected one import event for the test, got %+v %v", event, err)
+	}
+	other.mustInvoke(ADMIN, "link_patient", other.fingerprint(CLIENT), strings.Repeat("ab", 32))
+	other.mustInvoke(CLIENT, "grant_consent", other.fingerprint(LAB), CONSENT_ALL_TESTS, "2099-01-01T00:00:00Z")
+	if reimported := other.export(LAB); !reflect.DeepEqual(reimported.Records, exported.Records) {
+		t.Fatalf("The records changed in the round trip:\n%+v\n%+v", exported.Records, reimported.Records)
+	}
+
+	// Records of organisations that are not registered are refused
+	unregistered := exported.Records[0]
+	unregistered.BloodTestID = "bt2"
+	unregistered.Hospital = "nosuchhospital"
+	batch, _ = json.Marshal([]bloodTestRecord{unregistered})
+	if _, err = other.invoke(LAB, "import_bloodtests", string(batch)); err == nil || !strings.Contains(err.Error(), "not a registered") {
+		t.Fatalf("Expected the record of an unregistered hospital to be refused, got %v", err)
+	}
+}
+
+// ============================================================================================================================
+// TestFHIRBundleDeterministic - Every call and every peer renders the same bytes, so endorsements of the read agree
+// ============================================================================================================================
+func TestFHIRBundleDeterministic(t *testing.T) {
+	peers := []*scenario{newScenario(t), newScenario(t)}
+	var bundles [][]byte
+	for _, s := range peers {
+		s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+		s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_RECEIVED)
+		s.mustInvoke(HOSPITAL, "change_lab", scenarioTest, scenarioLab)
+		s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_ASSIGNED)
+		s.mustInvoke(LAB, "change_result", scenarioTest, scenarioResult)
+		for i := 0; i < 3; i++ {
+			bundles = append(bundles, s.mustInvoke(DOCTOR, "get_fhir_bundle", scenarioTest))
+		}
+	}
+	for i := range bundles {
+		if denied(bundles[i]) || !bytes.Equal(bundles[i], bundles[0]) {
+			t.Fatalf("Bundle %d differs:\n%s\n%s", i, bundles[0], bundles[i])
+		}
+	}
+}
+
+// ============================================================================================================================
+// TestSamples - Tubes are registered by the ordering doctor or the hospital of the order. A tube that goes straight to the
+// lab moves the order through every status in between, each stamped
+// ============================================================================================================================
+func TestSamples(t *testing.T) {
+	s := newScenario(t)
+	s.enroll("other doctor", DOCTOR)
+	s.enroll("other hospital", HOSPITAL)
+	s.mustInvoke(ADMIN, "register_organisation", "herlev", HOSPITAL, "Herlev Hospital")
+	s.mustInvoke(ADMIN, "add_member", "herlev", s.fingerprint("other doctor"))
+	s.mustInvoke(ADMIN, "add_member", "herlev", s.fingerprint("other hospital"))
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+
+	for _, role := range []string{"other doctor", "other hospital"} {
+		if _, err := s.invoke(role, "register_sample", scenarioTest, "TUBE-0000", "EDTA"); err == nil || !strings.Contains(err.Error(), "not on the staff") {
+			t.Fatalf("Expected the %s to be refused, got %v", role, err)
+		}
+	}
+	s.mustInvoke(DOCTOR, "register_sample", scenarioTest, "TUBE-0001", "EDTA")
+	if res := s.bloodTest(scenarioTest); res.Status != STATUS_ORDERED || len(res.Samples) != 1 {
+		t.Fatalf("Expected an ordered test with 1 sample, got %s %v", res.Status, res.Samples)
+	}
+
+	// The doctor hands the tube straight to the lab
+	s.mustInvoke(DOCTOR, "handoff_sample", "TUBE-0001", s.fingerprint(LAB), "sealed", "4")
+	s.mustInvoke(LAB, "acknowledge_sample", "TUBE-0001", "sealed", "5")
+	stamp := time.Unix(s.stub.TxTimestamp.Seconds, 0).UTC().Format(time.RFC3339)
+
+	res := s.bloodTest(scenarioTest)
+	if res.Status != STATUS_ASSIGNED || res.Lab != scenarioLab {
+		t.Fatalf("Expected the test to be assigned to %s, got %s at %s", scenarioLab, res.Status, res.Lab)
+	}
+	if res.TimeStampHospital != stamp || res.TimeStampLab != stamp {
+		t.Fatalf("Expected the received and assigned stamps %s, got %s and %s", stamp, res.TimeStampHospital, res.TimeStampLab)
+	}
+
+	s.mustInvoke(HOSPITAL, "register_sample", scenarioTest, "TUBE-0002", "SST")
+	if res = s.bloodTest(scenarioTest); res.Status != STATUS_ASSIGNED || len(res.Samples) != 2 {
+		t.Fatalf("Expected the assigned test to have 2 samples, got %s %v", res.Status, res.Samples)
+	}
+}
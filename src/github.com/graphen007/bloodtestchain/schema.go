@@ -0,0 +1,242 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Schema versions - Tests and accounts carry the version of their shape. Records written before versioning are version 0.
+//					 Reads upgrade older records in memory, migrate rewrites them in the current shape
+//==============================================================================================================================
+const BLOODTEST_SCHEMA_VERSION = 1
+const ACCOUNT_SCHEMA_VERSION = 2
+
+const migrateCheckpointKey = "_migrateCheckpoint"
+
+const DEFAULT_MIGRATE_BATCH = 100
+const MAX_MIGRATE_BATCH = 500
+
+// ============================================================================================================================
+// upgradeBloodTest - Brings a stored test to BLOODTEST_SCHEMA_VERSION. Tests written by a newer chaincode are refused
+// ============================================================================================================================
+func upgradeBloodTest(res *bloodTest) error {
+	if res.SchemaVersion > BLOODTEST_SCHEMA_VERSION {
+		return fmt.Errorf("Blood test %s has schema version %d, this chaincode reads up to %d", res.BloodTestID, res.SchemaVersion, BLOODTEST_SCHEMA_VERSION)
+	}
+
+	// 0 -> 1: stamps were stored as sent by the client, keys and lab could be missing
+	if res.SchemaVersion < 1 {
+		for _, stamp := range []*string{&res.TimeStampDoctor, &res.TimeStampHospital, &res.TimeStampLab, &res.TimeStampAnalyse, &res.TimeStampResult} {
+			if normalised, err := utcTimeStamp(*stamp); err == nil {
+				*stamp = normalised
+			}
+		}
+		if res.Keys == nil {
+			res.Keys = map[string]string{}
+		}
+		if res.Lab == "" {
+			res.Lab = "unassigned"
+		}
+	}
+
+	res.SchemaVersion = BLOODTEST_SCHEMA_VERSION
+	return nil
+}
+
+// ============================================================================================================================
+// upgradeAccount - Brings a stored account to ACCOUNT_SCHEMA_VERSION. Accounts written by a newer chaincode are refused
+// ============================================================================================================================
+func upgradeAccount(acc *account) error {
+	if acc.SchemaVersion > ACCOUNT_SCHEMA_VERSION {
+		return fmt.Errorf("Account %s has schema version %d, this chaincode reads up to %d", acc.Username, acc.SchemaVersion, ACCOUNT_SCHEMA_VERSION)
+	}
+
+	// 0 -> 1: the plaintext password of legacy accounts is moved to a credential by migrate, the fields are unchanged
+	// 1 -> 2: accounts are moved from their username to accountKey by migrate, the fields are unchanged
+
+	acc.SchemaVersion = ACCOUNT_SCHEMA_VERSION
+	return nil
+}
+
+//==============================================================================================================================
+// migrationCheckpoint - Progress of migrate. The scan starts over when the chaincode brings new schema versions
+//==============================================================================================================================
+type migrationCheckpoint struct {
+	BloodTestVersion int    `json:"bloodTestVersion"`
+	AccountVersion   int    `json:"accountVersion"`
+	LastKey          string `json:"lastKey"`
+	Scanned          int    `json:"scanned"`
+	Migrated         int    `json:"migrated"`
+	Done             bool   `json:"done"`
+	UpdatedAt        string `json:"updatedAt"`
+}
+
+func (t *SimpleChaincode) getMigrationCheckpoint(stub shim.ChaincodeStubInterface) (*migrationCheckpoint, error) {
+	cp := &migrationCheckpoint{BloodTestVersion: BLOODTEST_SCHEMA_VERSION, AccountVersion: ACCOUNT_SCHEMA_VERSION}
+	cpAsBytes, err := stub.GetState(migrateCheckpointKey)
+	if err != nil {
+		return nil, errors.New("Failed to get migration checkpoint")
+	}
+	if cpAsBytes == nil {
+		return cp, nil
+	}
+	stored := &migrationCheckpoint{}
+	err = json.Unmarshal(cpAsBytes, stored)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal migration checkpoint")
+	}
+	if stored.BloodTestVersion != BLOODTEST_SCHEMA_VERSION || stored.AccountVersion != ACCOUNT_SCHEMA_VERSION {
+		return cp, nil
+	}
+	return stored, nil
+}
+
+// ============================================================================================================================
+// Migrate - Rewrites the tests and accounts of older schema versions. Every call scans at most batchSize keys after the
+// checkpoint and moves it, so large ledgers are migrated over several transactions. Call it until done is true
+// ============================================================================================================================
+func (t *SimpleChaincode) migrate(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	        0
+	   ["batchSize"]
+	   -------------------------------------------------------
+	*/
+
+	batchSize := DEFAULT_MIGRATE_BATCH
+	if len(args) > 0 && args[0] != "" {
+		size, err := strconv.Atoi(args[0])
+		if err != nil || size < 1 || size > MAX_MIGRATE_BATCH {
+			return nil, fmt.Errorf("Batch size must be between 1 and %d", MAX_MIGRATE_BATCH)
+		}
+		batchSize = size
+	}
+
+	cp, err := t.getMigrationCheckpoint(stub)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Done {
+		return json.Marshal(cp)
+	}
+
+	// The smallest key after the checkpoint is the checkpoint followed by a 0x00 byte
+	startKey := ""
+	if cp.LastKey != "" {
+		startKey = cp.LastKey + "\x00"
+	}
+
+	// The batch is read before anything is written, one more key tells whether the scan is done
+	iter, err := stub.RangeQueryState(startKey, indexMaxRune)
+	if err != nil {
+		return nil, errors.New("Failed to scan state")
+	}
+	var keys []string
+	var values [][]byte
+	for iter.HasNext() && len(keys) <= batchSize {
+		key, value, err := iter.Next()
+		if err != nil {
+			iter.Close()
+			return nil, errors.New("Failed to scan state")
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	iter.Close()
+
+	cp.Done = len(keys) <= batchSize
+	if !cp.Done {
+		keys, values = keys[:batchSize], values[:batchSize]
+	}
+
+	for i, key := range keys {
+		migrated, err := t.migrateRecord(stub, key, values[i])
+		if err != nil {
+			return nil, err
+		}
+		if migrated {
+			cp.Migrated++
+		}
+		cp.Scanned++
+		cp.LastKey = key
+	}
+
+	cp.UpdatedAt, err = txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	jsonAsBytes, _ := json.Marshal(cp)
+	err = stub.PutState(migrateCheckpointKey, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Migrated records: ", cp.Migrated, " done: ", cp.Done)
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// migrateRecord - Rewrites value if it is a test or an account of an older schema version, other keys are left alone.
+// Tests are stored under their ID, like readableBloodTest tells them apart. Accounts found under their username were
+// written before accountKey and are moved there
+// ============================================================================================================================
+func (t *SimpleChaincode) migrateRecord(stub shim.ChaincodeStubInterface, key string, value []byte) (bool, error) {
+
+	res := bloodTest{}
+	if json.Unmarshal(value, &res) == nil && res.BloodTestID != "" && res.BloodTestID == key {
+		if res.SchemaVersion == BLOODTEST_SCHEMA_VERSION {
+			return false, nil
+		}
+		old := res
+		err := upgradeBloodTest(&res)
+		if err != nil {
+			return false, err
+		}
+		// Only the shape changes, so the test is not audited
+		return true, t.writeBloodTest(stub, &old, &res)
+	}
+
+	acc := account{}
+	if json.Unmarshal(value, &acc) == nil && acc.TypeOfUser != "" && acc.Username == key {
+		err := upgradeAccount(&acc)
+		if err != nil {
+			return false, err
+		}
+		legacy := legacyAccount{}
+		if json.Unmarshal(value, &legacy) == nil && legacy.Password != "" {
+			err = t.saveCredential(stub, key, legacy.Password)
+			if err != nil {
+				return false, err
+			}
+		}
+		jsonAsBytes, _ := json.Marshal(acc)
+		err = stub.PutState(accountKey(key), jsonAsBytes)
+		if err != nil {
+			return false, err
+		}
+		return true, stub.DelState(key)
+	}
+
+	return false, nil
+}
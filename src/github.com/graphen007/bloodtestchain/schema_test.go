@@ -0,0 +1,111 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// putLegacy writes a record the way chaincodes before schema versions did, bypassing every check
+func (s *scenario) putLegacy(key string, value string) {
+	s.stub.MockTransactionStart("legacy")
+	s.stub.PutState(key, []byte(value))
+	s.stub.MockTransactionEnd("legacy")
+}
+
+// ============================================================================================================================
+// TestMigrate - Legacy tests and accounts are upgraded in batches until the checkpoint reports done
+// ============================================================================================================================
+func TestMigrate(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+
+	for i := 0; i < 3; i++ {
+		s.putLegacy(fmt.Sprintf("legacy%d", i), fmt.Sprintf(`{"timeStampDoctor":"2016-12-31T23:00:00-02:00","timeStampHospital":"null",`+
+			`"name":%q,"CPR":%q,"doctor":"dr-hansen","hospital":%q,"lab":"","status":"ordered","bloodTestID":"legacy%d"}`,
+			envelope("John Doe"), envelope("0202801234"), scenarioHospital, i))
+	}
+	s.putLegacy("olduser", `{"typeOfUser":"doctor","username":"olduser","password":"secret"}`)
+
+	// Reads see the current shape before the migration
+	if res := s.bloodTest("legacy0"); res.SchemaVersion != BLOODTEST_SCHEMA_VERSION || res.TimeStampDoctor != "2017-01-01T01:00:00Z" || res.Lab != "unassigned" {
+		t.Fatalf("Expected the legacy test to be upgraded when read, got %+v", res)
+	}
+
+	var cp migrationCheckpoint
+	calls := 0
+	for !cp.Done {
+		calls++
+		if calls > len(s.stub.State) {
+			t.Fatal("Migration does not end")
+		}
+		cpAsBytes, err := s.invoke(ADMIN, "migrate", "5")
+		if err != nil {
+			t.Fatalf("migrate failed: %s", err)
+		}
+		if err = json.Unmarshal(cpAsBytes, &cp); err != nil {
+			t.Fatalf("Failed to unmarshal the checkpoint: %s", err)
+		}
+	}
+	if calls < 2 {
+		t.Fatalf("Expected the migration to take several batches, took %d", calls)
+	}
+	if cp.Migrated != 4 {
+		t.Fatalf("Expected 3 tests and 1 account to be migrated, got %d", cp.Migrated)
+	}
+
+	for i := 0; i < 3; i++ {
+		var stored bloodTest
+		json.Unmarshal(s.stub.State[fmt.Sprintf("legacy%d", i)], &stored)
+		if stored.SchemaVersion != BLOODTEST_SCHEMA_VERSION || stored.TimeStampDoctor != "2017-01-01T01:00:00Z" {
+			t.Fatalf("legacy%d was not migrated: %+v", i, stored)
+		}
+	}
+	if s.stub.State["olduser"] != nil || strings.Contains(string(s.stub.State[accountKey("olduser")]), "secret") {
+		t.Fatal("The legacy account was not moved to its account key without the plaintext password")
+	}
+	acc, err := new(SimpleChaincode).checkCredentials(s.stub, "olduser", "secret")
+	if err != nil || acc == nil || acc.SchemaVersion != ACCOUNT_SCHEMA_VERSION {
+		t.Fatalf("Expected the migrated account to log in, got %+v %v", acc, err)
+	}
+
+	// Once done, migrate does not scan again
+	cpAsBytes, err := s.invoke(ADMIN, "migrate")
+	if err != nil || json.Unmarshal(cpAsBytes, &cp) != nil || !cp.Done || cp.Migrated != 4 {
+		t.Fatalf("Expected the finished checkpoint, got %s %v", cpAsBytes, err)
+	}
+	if _, err = s.invoke(DOCTOR, "migrate"); err == nil {
+		t.Fatal("Expected migrate to be refused for a doctor")
+	}
+}
+
+// ============================================================================================================================
+// TestNewerSchemaRefused - Records written by a newer chaincode are not read with missing fields
+// ============================================================================================================================
+func TestNewerSchemaRefused(t *testing.T) {
+	s := newScenario(t)
+	s.putLegacy("future", fmt.Sprintf(`{"bloodTestID":"future","status":"ordered","schemaVersion":%d}`, BLOODTEST_SCHEMA_VERSION+1))
+
+	if _, err := s.invoke(HOSPITAL, "change_status", "future", STATUS_RECEIVED); err == nil || !strings.Contains(err.Error(), "schema version") {
+		t.Fatalf("Expected the newer test to be refused, got %v", err)
+	}
+	if _, err := s.invoke(ADMIN, "migrate"); err == nil || !strings.Contains(err.Error(), "schema version") {
+		t.Fatalf("Expected migrate to stop at the newer test, got %v", err)
+	}
+}
@@ -0,0 +1,551 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+// Turnaround SLAs - Targets are stored under "sla" 0x00 lab 0x00 testType and hold a maximum duration per stage. A stage is
+//					 named after the status that ends it, so "analysed" is the time from assigned to analysed and "total"
+//					 the time from ordered to released. Lab and test type can be SLA_ANY for a network wide default
+//==============================================================================================================================
+const slaPrefix = "sla"
+
+const SLA_ANY = "*"
+const SLA_TOTAL = "total"
+
+// MAX_REPORT_TESTS bounds the tests read by one turnaround report
+const MAX_REPORT_TESTS = 10000
+
+// slaStages are the stages of a test in lifecycle order, each with the status it starts from
+var slaStages = []struct {
+	from string
+	to   string
+}{
+	{from: STATUS_ORDERED, to: STATUS_RECEIVED},
+	{from: STATUS_RECEIVED, to: STATUS_ASSIGNED},
+	{from: STATUS_ASSIGNED, to: STATUS_ANALYSED},
+	{from: STATUS_ANALYSED, to: STATUS_RELEASED},
+}
+
+type slaTarget struct {
+	Lab       string            `json:"lab"`
+	TestType  string            `json:"testType"`
+	Targets   map[string]string `json:"targets"` // stage -> Go duration, e.g. "4h30m"
+	UpdatedBy string            `json:"updatedBy"`
+	UpdatedAt string            `json:"updatedAt"`
+}
+
+func slaKey(lab string, testType string) string {
+	return slaPrefix + indexSep + lab + indexSep + testType
+}
+
+func validSLAStage(stage string) bool {
+	if stage == SLA_TOTAL {
+		return true
+	}
+	for _, s := range slaStages {
+		if s.to == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// stageStamp returns the timestamp field of res set when it reached status
+func stageStamp(res *bloodTest, status string) string {
+	switch status {
+	case STATUS_ORDERED:
+		return res.TimeStampDoctor
+	case STATUS_RECEIVED:
+		return res.TimeStampHospital
+	case STATUS_ASSIGNED:
+		return res.TimeStampLab
+	case STATUS_ANALYSED:
+		return res.TimeStampAnalyse
+	case STATUS_RELEASED:
+		return res.TimeStampResult
+	}
+	return ""
+}
+
+// stampField is the JSON name of the timestamp field of status, as it appears in the changes of an audit entry
+var stampField = map[string]string{
+	STATUS_ORDERED:  "timeStampDoctor",
+	STATUS_RECEIVED: "timeStampHospital",
+	STATUS_ASSIGNED: "timeStampLab",
+	STATUS_ANALYSED: "timeStampAnalyse",
+	STATUS_RELEASED: "timeStampResult",
+}
+
+func (t *SimpleChaincode) getSLATarget(stub shim.ChaincodeStubInterface, lab string, testType string) (*slaTarget, error) {
+	slaAsBytes, err := stub.GetState(slaKey(lab, testType))
+	if err != nil {
+		return nil, errors.New("Failed to get SLA of " + lab + " for " + testType)
+	}
+	if slaAsBytes == nil {
+		return nil, nil
+	}
+	s := &slaTarget{}
+	err = json.Unmarshal(slaAsBytes, s)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal SLA of " + lab + " for " + testType)
+	}
+	return s, nil
+}
+
+// ============================================================================================================================
+// slaTargets - Targets per stage that apply to res. For every stage the strictest target of the test types of the test
+// applies, a target of the lab before the network default. Stages without a target for any of the test types fall back to
+// the SLA_ANY test type of the lab, then of the network. Stages without any target are left out
+// ============================================================================================================================
+func (t *SimpleChaincode) slaTargets(stub shim.ChaincodeStubInterface, res *bloodTest) (map[string]time.Duration, error) {
+
+	resolve := func(testType string) (map[string]time.Duration, error) {
+		targets := make(map[string]time.Duration)
+		for _, lab := range []string{SLA_ANY, res.Lab} {
+			if lab == "" || lab == "unassigned" {
+				continue
+			}
+			s, err := t.getSLATarget(stub, lab, testType)
+			if err != nil {
+				return nil, err
+			}
+			if s == nil {
+				continue
+			}
+			// The lab is read last, so its targets replace the network defaults
+			for stage, target := range s.Targets {
+				targets[stage], _ = time.ParseDuration(target)
+			}
+		}
+		return targets, nil
+	}
+
+	targets := make(map[string]time.Duration)
+	for _, code := range billedCodes(res) {
+		codeTargets, err := resolve(code)
+		if err != nil {
+			return nil, err
+		}
+		for stage, target := range codeTargets {
+			if current, ok := targets[stage]; !ok || target < current {
+				targets[stage] = target
+			}
+		}
+	}
+
+	defaults, err := resolve(SLA_ANY)
+	if err != nil {
+		return nil, err
+	}
+	for stage, target := range defaults {
+		if _, ok := targets[stage]; !ok {
+			targets[stage] = target
+		}
+	}
+	return targets, nil
+}
+
+// ============================================================================================================================
+// Set SLA - Sets the targets of a lab and test type, either can be SLA_ANY. Empty targets remove the SLA
+// ============================================================================================================================
+func (t *SimpleChaincode) set_sla(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0          1               2
+	   "labID", "testType", "{stage: duration, ...}"
+	   -------------------------------------------------------
+	   stage is received, assigned, analysed, released or total, duration a Go duration such as "48h"
+	*/
+
+	lab, testType := args[0], args[1]
+	if lab != SLA_ANY {
+		_, err := t.requireOrganisation(stub, lab, LAB)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if testType != SLA_ANY && !validLOINC(testType) {
+		return nil, errors.New(testType + " is not a LOINC code")
+	}
+
+	var targets map[string]string
+	err := json.Unmarshal([]byte(args[2]), &targets)
+	if err != nil {
+		return nil, errors.New("Targets must be a JSON object of stage to duration")
+	}
+	if len(targets) == 0 {
+		fmt.Println("Removed SLA of " + lab + " for " + testType)
+		return nil, stub.DelState(slaKey(lab, testType))
+	}
+	for stage, target := range targets {
+		if !validSLAStage(stage) {
+			return nil, errors.New("Unknown stage " + stage)
+		}
+		d, err := time.ParseDuration(target)
+		if err != nil || d <= 0 {
+			return nil, errors.New("Target of " + stage + " must be a positive duration")
+		}
+	}
+
+	caller, err := callerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonAsBytes, _ := json.Marshal(slaTarget{Lab: lab, TestType: testType, Targets: targets, UpdatedBy: caller, UpdatedAt: timeStamp})
+	err = stub.PutState(slaKey(lab, testType), jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Set SLA of " + lab + " for " + testType)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Get SLA - Targets of a lab and test type as set, without falling back to defaults
+// ============================================================================================================================
+func (t *SimpleChaincode) get_sla(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	s, err := t.getSLATarget(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errors.New("No SLA for " + args[1] + " at " + args[0])
+	}
+	return json.Marshal(s)
+}
+
+// requireOrganisationAccess checks that kind is HOSPITAL or LAB and the caller is an admin or on the staff of org
+func (t *SimpleChaincode) requireOrganisationAccess(stub shim.ChaincodeStubInterface, kind string, org string) (string, error) {
+	if kind != HOSPITAL && kind != LAB {
+		return "", errors.New("Organisation type must be " + HOSPITAL + " or " + LAB)
+	}
+	attribute := IDX_HOSPITAL
+	if kind == LAB {
+		attribute = IDX_LAB
+	}
+	if bloodTestRoutes.callerRole(t, stub) == ADMIN {
+		return attribute, nil
+	}
+	return attribute, t.requireCallerMember(stub, org)
+}
+
+// ============================================================================================================================
+// Get Overdue - Page of the open tests of a hospital or lab that are past the target of their current stage or of the
+// whole test, as of the transaction timestamp. Tests with a timestamp that is not RFC3339 are left out
+// ============================================================================================================================
+func (t *SimpleChaincode) get_overdue(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0                   1          2             3
+	   "hospital|lab", "organisation" ["pageSize"] ["bookmark"]
+	   -------------------------------------------------------
+	   The page size counts the tests scanned, a page can hold fewer overdue tests
+	*/
+
+	attribute, err := t.requireOrganisationAccess(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	pageSize, bookmark, err := parsePage(args[2:])
+	if err != nil {
+		return nil, err
+	}
+	ids, next, err := t.scanIndex(stub, attribute, args[1], pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	nowStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	now, _ := time.Parse(time.RFC3339, nowStamp)
+
+	type overdueTest struct {
+		BloodTestID string `json:"bloodTestID"`
+		Status      string `json:"status"`
+		StuckStage  string `json:"stuckStage"` // the stage the test is waiting to complete
+		Since       string `json:"since"`
+		Elapsed     string `json:"elapsed"`
+		Target      string `json:"target,omitempty"`
+		TotalTarget string `json:"totalTarget,omitempty"`
+		OverdueBy   string `json:"overdueBy"`
+	}
+	page := struct {
+		AsOf     string        `json:"asOf"`
+		Overdue  []overdueTest `json:"overdue"`
+		Bookmark string        `json:"bookmark"`
+	}{AsOf: nowStamp, Overdue: []overdueTest{}, Bookmark: next}
+
+	for _, id := range ids {
+		res, err := t.getBloodTest(stub, id)
+		if err != nil {
+			return nil, err
+		}
+
+		stage := ""
+		for _, s := range slaStages {
+			if s.from == res.Status {
+				stage = s.to
+			}
+		}
+		if stage == "" {
+			continue
+		}
+		since, err := time.Parse(time.RFC3339, stageStamp(res, res.Status))
+		if err != nil {
+			continue
+		}
+		ordered, err := t.orderedAt(stub, res)
+		if err != nil {
+			return nil, err
+		}
+
+		targets, err := t.slaTargets(stub, res)
+		if err != nil {
+			return nil, err
+		}
+		var overdueBy time.Duration
+		target, hasTarget := targets[stage]
+		if hasTarget && now.Sub(since) > target {
+			overdueBy = now.Sub(since) - target
+		}
+		total, hasTotal := targets[SLA_TOTAL]
+		if hasTotal && now.Sub(ordered)-total > overdueBy {
+			overdueBy = now.Sub(ordered) - total
+		}
+		if overdueBy <= 0 {
+			continue
+		}
+
+		o := overdueTest{
+			BloodTestID: res.BloodTestID,
+			Status:      res.Status,
+			StuckStage:  stage,
+			Since:       since.UTC().Format(time.RFC3339),
+			Elapsed:     now.Sub(since).String(),
+			OverdueBy:   overdueBy.String(),
+		}
+		if hasTarget {
+			o.Target = target.String()
+		}
+		if hasTotal {
+			o.TotalTarget = total.String()
+		}
+		page.Overdue = append(page.Overdue, o)
+	}
+
+	return json.Marshal(page)
+}
+
+// ============================================================================================================================
+// reachedAt - Time each status was reached according to the audit trail of a test. The first entry creates the test and
+// carries the stamps given by the doctor or the importer, later status changes count at their transaction timestamp
+// ============================================================================================================================
+func reachedAt(entries []auditEntry) map[string]time.Time {
+	reached := make(map[string]time.Time)
+	for _, entry := range entries {
+		if entry.Sequence == 0 {
+			for status, field := range stampField {
+				change, ok := entry.Changes[field]
+				if !ok {
+					continue
+				}
+				var stamp string
+				if json.Unmarshal(change.New, &stamp) != nil {
+					continue
+				}
+				if at, err := time.Parse(time.RFC3339, stamp); err == nil {
+					reached[status] = at
+				}
+			}
+			continue
+		}
+		change, ok := entry.Changes["status"]
+		if !ok {
+			continue
+		}
+		var status string
+		if json.Unmarshal(change.New, &status) != nil {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339, entry.TimeStamp); err == nil {
+			reached[status] = at
+		}
+	}
+	return reached
+}
+
+// orderedAt returns when res was ordered, as recorded by the creation entry of its audit trail. Tests created before the
+// audit trail fall back on their order stamp
+func (t *SimpleChaincode) orderedAt(stub shim.ChaincodeStubInterface, res *bloodTest) (time.Time, error) {
+	entries, err := t.getAuditEntries(stub, res.BloodTestID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ordered, ok := reachedAt(entries)[STATUS_ORDERED]; ok {
+		return ordered, nil
+	}
+	ordered, err := time.Parse(time.RFC3339, res.TimeStampDoctor)
+	if err != nil {
+		return time.Time{}, errors.New("Blood test " + res.BloodTestID + " has no order time")
+	}
+	return ordered, nil
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// percentile returns the nearest rank p percentile of sorted durations, 0 when there are none
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// ============================================================================================================================
+// Get Turnaround - Median and 95th percentile duration of every stage of the tests of a hospital or lab released in a
+// window, computed from the audit trail of each test
+// ============================================================================================================================
+func (t *SimpleChaincode) get_turnaround(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0                   1              2         3
+	   "hospital|lab", "organisation", "from", "to"
+	   -------------------------------------------------------
+	   from and to are RFC3339, tests released at from or later and before to are included
+	*/
+
+	attribute, err := t.requireOrganisationAccess(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	from, err := utcTimeStamp(args[2])
+	if err != nil {
+		return nil, err
+	}
+	to, err := utcTimeStamp(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	durations := make(map[string][]time.Duration)
+	scanned, released := 0, 0
+	bookmark := ""
+	for {
+		ids, next, err := t.scanIndex(stub, attribute, args[1], MAX_PAGE_SIZE, bookmark)
+		if err != nil {
+			return nil, err
+		}
+		scanned += len(ids)
+		if scanned > MAX_REPORT_TESTS {
+			return nil, fmt.Errorf("%s has more than %d tests, the report can not be computed in one transaction", args[1], MAX_REPORT_TESTS)
+		}
+
+		for _, id := range ids {
+			res, err := t.getBloodTest(stub, id)
+			if err != nil {
+				return nil, err
+			}
+			if res.Status != STATUS_RELEASED {
+				continue
+			}
+			entries, err := t.getAuditEntries(stub, id)
+			if err != nil {
+				return nil, err
+			}
+			reached := reachedAt(entries)
+			releasedAt, ok := reached[STATUS_RELEASED]
+			if !ok {
+				continue
+			}
+			stamp := releasedAt.UTC().Format(time.RFC3339)
+			if stamp < from || stamp >= to {
+				continue
+			}
+			released++
+
+			for _, s := range slaStages {
+				start, okFrom := reached[s.from]
+				end, okTo := reached[s.to]
+				if okFrom && okTo {
+					durations[s.to] = append(durations[s.to], end.Sub(start))
+				}
+			}
+			if ordered, ok := reached[STATUS_ORDERED]; ok {
+				durations[SLA_TOTAL] = append(durations[SLA_TOTAL], releasedAt.Sub(ordered))
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		bookmark = next
+	}
+
+	type stageReport struct {
+		Count         int   `json:"count"`
+		MedianSeconds int64 `json:"medianSeconds"`
+		P95Seconds    int64 `json:"p95Seconds"`
+	}
+	report := struct {
+		Organisation string                 `json:"organisation"`
+		From         string                 `json:"from"`
+		To           string                 `json:"to"`
+		Released     int                    `json:"released"`
+		Stages       map[string]stageReport `json:"stages"`
+	}{Organisation: args[1], From: from, To: to, Released: released, Stages: map[string]stageReport{}}
+
+	for stage, ds := range durations {
+		sort.Sort(byDuration(ds))
+		report.Stages[stage] = stageReport{
+			Count:         len(ds),
+			MedianSeconds: int64(percentile(ds, 0.5) / time.Second),
+			P95Seconds:    int64(percentile(ds, 0.95) / time.Second),
+		}
+	}
+
+	return json.Marshal(report)
+}
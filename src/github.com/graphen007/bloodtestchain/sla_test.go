@@ -0,0 +1,354 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// at stamps the next call offset after the start of the mock clock
+func (s *scenario) at(offset time.Duration) {
+	s.stub.MockClock(shim.MockClockStart.Add(offset), time.Second)
+}
+
+func stamp(offset time.Duration) string {
+	return shim.MockClockStart.Add(offset).Format(time.RFC3339)
+}
+
+// release orders test id at start and takes it through received, assigned, analysed and released, each stage taking the
+// duration given for it. Every call of a stage is stamped at the end of the stage
+func (s *scenario) release(id string, start time.Duration, stages [4]time.Duration) {
+	order := s.orderArgs()
+	order[7] = id
+	s.at(start)
+	s.mustInvoke(DOCTOR, "init_bloodtest", order...)
+
+	at := start + stages[0]
+	s.at(at)
+	s.mustInvoke(HOSPITAL, "change_status", id, STATUS_RECEIVED)
+	at += stages[1]
+	s.at(at)
+	s.mustInvoke(HOSPITAL, "change_lab", id, scenarioLab)
+	s.at(at)
+	s.mustInvoke(HOSPITAL, "change_status", id, STATUS_ASSIGNED)
+	at += stages[2]
+	s.at(at)
+	s.mustInvoke(LAB, "change_result", id, scenarioResult)
+	s.at(at)
+	s.mustInvoke(LAB, "change_status", id, STATUS_ANALYSED)
+	at += stages[3]
+	s.at(at)
+	s.mustInvoke(LAB, "change_status", id, STATUS_RELEASED)
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		median    time.Duration
+		p95       time.Duration
+	}{
+		{"no samples", nil, 0, 0},
+		{"one sample", []time.Duration{time.Hour}, time.Hour, time.Hour},
+		{"two samples", []time.Duration{time.Hour, 3 * time.Hour}, time.Hour, 3 * time.Hour},
+		{"three samples", []time.Duration{time.Minute, time.Hour, 2 * time.Hour}, time.Hour, 2 * time.Hour},
+	}
+
+	twenty := make([]time.Duration, 20)
+	for i := range twenty {
+		twenty[i] = time.Duration(i+1) * time.Minute
+	}
+	tests = append(tests, struct {
+		name      string
+		durations []time.Duration
+		median    time.Duration
+		p95       time.Duration
+	}{"twenty samples", twenty, 10 * time.Minute, 19 * time.Minute})
+
+	for _, test := range tests {
+		if median := percentile(test.durations, 0.5); median != test.median {
+			t.Fatalf("%s: expected median %s, got %s", test.name, test.median, median)
+		}
+		if p95 := percentile(test.durations, 0.95); p95 != test.p95 {
+			t.Fatalf("%s: expected p95 %s, got %s", test.name, test.p95, p95)
+		}
+	}
+}
+
+// ============================================================================================================================
+// TestSetSLA - Only an admin sets targets, for a registered lab or the network, a LOINC code or every test type, and only
+// positive durations of known stages
+// ============================================================================================================================
+func TestSetSLA(t *testing.T) {
+	s := newScenario(t)
+
+	tests := []struct {
+		name     string
+		role     string
+		lab      string
+		testType string
+		targets  string
+		wantErr  string
+	}{
+		{"not an admin", LAB, scenarioLab, "718-7", `{"analysed":"2h"}`, "ACCESS_DENIED"},
+		{"unregistered lab", ADMIN, "lab2", "718-7", `{"analysed":"2h"}`, "lab2"},
+		{"hospital as lab", ADMIN, scenarioHospital, "718-7", `{"analysed":"2h"}`, scenarioHospital},
+		{"not a LOINC code", ADMIN, scenarioLab, "718-8", `{"analysed":"2h"}`, "is not a LOINC code"},
+		{"not an object", ADMIN, scenarioLab, "718-7", `["2h"]`, "JSON object"},
+		{"unknown stage", ADMIN, scenarioLab, "718-7", `{"ordered":"2h"}`, "Unknown stage ordered"},
+		{"not a duration", ADMIN, scenarioLab, "718-7", `{"analysed":"two hours"}`, "positive duration"},
+		{"zero duration", ADMIN, scenarioLab, "718-7", `{"analysed":"0s"}`, "positive duration"},
+		{"days", ADMIN, scenarioLab, "718-7", `{"analysed":"2h","total":"1d"}`, "positive duration"},
+		{"lab", ADMIN, scenarioLab, "718-7", `{"analysed":"2h","total":"24h"}`, ""},
+		{"network default", ADMIN, SLA_ANY, SLA_ANY, `{"received":"30m"}`, ""},
+	}
+	for _, test := range tests {
+		_, err := s.invoke(test.role, "set_sla", test.lab, test.testType, test.targets)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("%s: expected an error containing %q, got %v", test.name, test.wantErr, err)
+		}
+	}
+
+	response, err := s.query(HOSPITAL, "get_sla", scenarioLab, "718-7")
+	if err != nil {
+		t.Fatalf("Failed to get the SLA: %s", err)
+	}
+	var sla slaTarget
+	if err = json.Unmarshal(response, &sla); err != nil || !reflect.DeepEqual(sla.Targets, map[string]string{"analysed": "2h", "total": "24h"}) ||
+		sla.UpdatedBy != s.fingerprint(ADMIN) {
+		t.Fatalf("Unexpected SLA %s", response)
+	}
+	if _, err = s.query(HOSPITAL, "get_sla", scenarioLab, "2345-7"); err == nil {
+		t.Fatal("Expected get_sla not to fall back to the defaults")
+	}
+
+	s.mustInvoke(ADMIN, "set_sla", scenarioLab, "718-7", `{}`)
+	if _, err = s.query(HOSPITAL, "get_sla", scenarioLab, "718-7"); err == nil {
+		t.Fatal("Expected empty targets to remove the SLA")
+	}
+}
+
+type testOverdue struct {
+	AsOf    string `json:"asOf"`
+	Overdue []struct {
+		BloodTestID string `json:"bloodTestID"`
+		StuckStage  string `json:"stuckStage"`
+		Since       string `json:"since"`
+		Target      string `json:"target"`
+		TotalTarget string `json:"totalTarget"`
+		OverdueBy   string `json:"overdueBy"`
+	} `json:"overdue"`
+}
+
+// ============================================================================================================================
+// TestOverdue - Open tests past the target of their stage or of the whole test, as of the transaction timestamp. The targets
+// of the lab replace the network defaults, the strictest target of the panel applies
+// ============================================================================================================================
+func TestOverdue(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(ADMIN, "set_sla", SLA_ANY, "718-7", `{"received":"1h"}`)
+	s.mustInvoke(ADMIN, "set_sla", SLA_ANY, "2345-7", `{"received":"3h"}`)
+	s.mustInvoke(ADMIN, "set_sla", SLA_ANY, SLA_ANY, `{"analysed":"8h","total":"24h"}`)
+	s.mustInvoke(ADMIN, "set_sla", scenarioLab, SLA_ANY, `{"analysed":"2h"}`)
+
+	s.at(0)
+	order := s.orderArgs()
+	order[0] = stamp(time.Hour)
+	if _, err := s.invoke(DOCTOR, "init_bloodtest", order...); err == nil {
+		t.Fatal("Expected an order dated by the caller to be refused")
+	}
+	s.at(0)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+
+	steps := []struct {
+		name      string
+		step      func()
+		at        time.Duration
+		kind      string
+		org       string
+		stage     string
+		since     time.Duration
+		target    string
+		overdueBy string
+	}{
+		{name: "within the target", at: 30 * time.Minute, kind: HOSPITAL, org: scenarioHospital},
+		{name: "past the strictest target", at: 2 * time.Hour, kind: HOSPITAL, org: scenarioHospital,
+			stage: STATUS_RECEIVED, target: "1h0m0s", overdueBy: "1h0m0s"},
+		{name: "not at the lab yet", at: 2 * time.Hour, kind: LAB, org: scenarioLab},
+		{name: "target of the lab", step: func() {
+			s.at(3 * time.Hour)
+			s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_RECEIVED)
+			s.at(3 * time.Hour)
+			s.mustInvoke(HOSPITAL, "change_lab", scenarioTest, scenarioLab)
+			s.at(3 * time.Hour)
+			s.mustInvoke(HOSPITAL, "change_status", scenarioTest, STATUS_ASSIGNED)
+		}, at: 6 * time.Hour, kind: LAB, org: scenarioLab, stage: STATUS_ANALYSED, since: 3 * time.Hour, target: "2h0m0s", overdueBy: "1h0m0s"},
+		{name: "past the total", at: 30 * time.Hour, kind: LAB, org: scenarioLab,
+			stage: STATUS_ANALYSED, since: 3 * time.Hour, target: "2h0m0s", overdueBy: "25h0m0s"},
+		{name: "released", step: func() {
+			s.mustInvoke(LAB, "change_result", scenarioTest, scenarioResult)
+			s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_ANALYSED)
+			s.mustInvoke(LAB, "change_status", scenarioTest, STATUS_RELEASED)
+		}, at: 40 * time.Hour, kind: LAB, org: scenarioLab},
+	}
+	for _, step := range steps {
+		if step.step != nil {
+			step.step()
+		}
+		s.at(step.at)
+		response, err := s.query(ADMIN, "get_overdue", step.kind, step.org)
+		if err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		}
+		var page testOverdue
+		if err = json.Unmarshal(response, &page); err != nil || page.AsOf != stamp(step.at) {
+			t.Fatalf("%s: unexpected page %s", step.name, response)
+		}
+		if step.stage == "" {
+			if len(page.Overdue) != 0 {
+				t.Fatalf("%s: expected no overdue tests, got %s", step.name, response)
+			}
+			continue
+		}
+		if len(page.Overdue) != 1 {
+			t.Fatalf("%s: expected 1 overdue test, got %s", step.name, response)
+		}
+		o := page.Overdue[0]
+		if o.BloodTestID != scenarioTest || o.StuckStage != step.stage || o.Since != stamp(step.since) || o.Target != step.target ||
+			o.TotalTarget != "24h0m0s" || o.OverdueBy != step.overdueBy {
+			t.Fatalf("%s: unexpected overdue test %+v", step.name, o)
+		}
+	}
+
+	for _, role := range []string{DOCTOR, LAB} {
+		if _, err := s.query(role, "get_overdue", HOSPITAL, scenarioHospital); err == nil {
+			t.Fatalf("Expected the overdue tests of the hospital to be refused to the %s", role)
+		}
+	}
+	if _, err := s.query(HOSPITAL, "get_overdue", "clinic", scenarioHospital); err == nil {
+		t.Fatal("Expected an unknown organisation type to be refused")
+	}
+}
+
+// ============================================================================================================================
+// TestOverdueReassigned - The total target is measured from the order, reassigning the test does not restart its clock
+// ============================================================================================================================
+func TestOverdueReassigned(t *testing.T) {
+	s := newScenario(t)
+	s.mustInvoke(ADMIN, "set_sla", SLA_ANY, SLA_ANY, `{"total":"24h"}`)
+	s.at(0)
+	s.mustInvoke(DOCTOR, "init_bloodtest", s.orderArgs()...)
+	s.at(20 * time.Hour)
+	s.enroll("dr jensen", DOCTOR)
+	s.mustInvoke(ADMIN, "add_member", scenarioHospital, s.fingerprint("dr jensen"))
+	s.mustInvoke(HOSPITAL, "change_doctor", scenarioTest, s.fingerprint("dr jensen"))
+
+	s.at(30 * time.Hour)
+	response, err := s.query(HOSPITAL, "get_overdue", HOSPITAL, scenarioHospital)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page testOverdue
+	if err = json.Unmarshal(response, &page); err != nil || len(page.Overdue) != 1 || page.Overdue[0].OverdueBy != "6h0m0s" {
+		t.Fatalf("Expected the test to be 6h past its total target, got %s", response)
+	}
+	if res := s.bloodTest(scenarioTest); res.TimeStampDoctor != stamp(0) {
+		t.Fatalf("Expected the order stamp to stay the time of the order, got %s", res.TimeStampDoctor)
+	}
+}
+
+type testTurnaround struct {
+	Released int `json:"released"`
+	Stages   map[string]struct {
+		Count         int   `json:"count"`
+		MedianSeconds int64 `json:"medianSeconds"`
+		P95Seconds    int64 `json:"p95Seconds"`
+	} `json:"stages"`
+}
+
+// ============================================================================================================================
+// TestTurnaround - Median and p95 of every stage over the tests released in the window, as recorded in their audit trail
+// ============================================================================================================================
+func TestTurnaround(t *testing.T) {
+	s := newScenario(t)
+	s.release("bt1", 0, [4]time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 4 * time.Hour})
+	s.release("bt2", time.Hour, [4]time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour, 2 * time.Hour})
+	order := s.orderArgs()
+	order[7] = "bt3"
+	s.mustInvoke(DOCTOR, "init_bloodtest", order...)
+
+	h := int64(time.Hour / time.Second)
+	tests := []struct {
+		name     string
+		kind     string
+		org      string
+		from     time.Duration
+		to       time.Duration
+		released int
+		stages   map[string][3]int64 // count, median, p95
+	}{
+		{"no samples", HOSPITAL, scenarioHospital, -24 * time.Hour, 9 * time.Hour, 0, map[string][3]int64{}},
+		{"one sample", HOSPITAL, scenarioHospital, 0, 10 * time.Hour, 1, map[string][3]int64{
+			STATUS_RECEIVED: {1, 3 * h, 3 * h},
+			STATUS_ASSIGNED: {1, 2 * h, 2 * h},
+			STATUS_ANALYSED: {1, h, h},
+			STATUS_RELEASED: {1, 2 * h, 2 * h},
+			SLA_TOTAL:       {1, 8 * h, 8 * h},
+		}},
+		{"two samples", LAB, scenarioLab, 0, 24 * time.Hour, 2, map[string][3]int64{
+			STATUS_RECEIVED: {2, h, 3 * h},
+			STATUS_ASSIGNED: {2, 2 * h, 2 * h},
+			STATUS_ANALYSED: {2, h, 3 * h},
+			STATUS_RELEASED: {2, 2 * h, 4 * h},
+			SLA_TOTAL:       {2, 8 * h, 10 * h},
+		}},
+	}
+	for _, test := range tests {
+		response, err := s.query(test.kind, "get_turnaround", test.kind, test.org, stamp(test.from), stamp(test.to))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		var report testTurnaround
+		if err = json.Unmarshal(response, &report); err != nil || report.Released != test.released || len(report.Stages) != len(test.stages) {
+			t.Fatalf("%s: unexpected report %s", test.name, response)
+		}
+		for stage, want := range test.stages {
+			got := report.Stages[stage]
+			if got.Count != int(want[0]) || got.MedianSeconds != want[1] || got.P95Seconds != want[2] {
+				t.Fatalf("%s: expected %s to be %v, got %+v", test.name, stage, want, got)
+			}
+		}
+	}
+
+	if _, err := s.query(LAB, "get_turnaround", HOSPITAL, scenarioHospital, stamp(0), stamp(24*time.Hour)); err == nil {
+		t.Fatal("Expected the report of the hospital to be refused to the lab")
+	}
+	if _, err := s.query(HOSPITAL, "get_turnaround", HOSPITAL, scenarioHospital, "yesterday", stamp(24*time.Hour)); err == nil {
+		t.Fatal("Expected a window that is not RFC3339 to be refused")
+	}
+}
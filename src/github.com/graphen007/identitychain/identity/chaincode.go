@@ -0,0 +1,588 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package identity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var logger = shim.NewLogger("Chaincode")
+
+//==============================================================================================================================
+// Chaincode - The identity chaincode. Enrolled certificates and their roles, shared by the healthcare chaincodes. Admins
+//			   enroll certificates here directly, other chaincodes look up roles with ActiveRole and GetEnrollment
+//==============================================================================================================================
+type Chaincode struct {
+}
+
+//==============================================================================================================================
+// Role tables, one per role, keyed by certificate fingerprint
+//==============================================================================================================================
+const ADMIN_INDEX = "adminIndex"
+const DOCTOR_INDEX = "doctorIndex"
+const CLIENT_INDEX = "clientIndex"
+const HOSPITAL_INDEX = "hospitalIndex"
+const LAB_INDEX = "labIndex"
+const COURIER_INDEX = "courierIndex"
+const COLUMN_CERTS = "eCerts"
+const COLUMN_VALUE = "value"
+
+// MAX_IMPORT_ENROLLMENTS bounds the enrollments of one import_enrollments call
+const MAX_IMPORT_ENROLLMENTS = 500
+
+// ============================================================================================================================
+// Init - Creates the role tables, the deployer becomes the first admin
+// ============================================================================================================================
+func (t *Chaincode) Init(stub shim.ChaincodeStubInterface) ([]byte, error) {
+
+	t.CreateTables(stub)
+
+	err := t.bootstrapAdmin(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Invoke - Enrollment changes, admins only
+// ============================================================================================================================
+func (t *Chaincode) Invoke(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("invoke is running " + function)
+
+	var handler func(shim.ChaincodeStubInterface, []string) ([]byte, error)
+	arity := 2
+	switch function {
+	case "invite_user":
+		handler, arity = t.invite_user, 3
+	case "approve_user":
+		handler = t.approve_user
+	case "suspend_user":
+		handler = t.suspend_user
+	case "revoke_user":
+		handler = t.revoke_user
+	case "import_enrollments":
+		handler, arity = t.import_enrollments, 1
+	default:
+		fmt.Println("invoke did not find func: " + function)
+		return nil, errors.New("Received unknown function invocation")
+	}
+
+	if len(args) != arity {
+		return nil, fmt.Errorf("Incorrect number of arguments. Expecting %d", arity)
+	}
+	if !t.CheckRole(stub, ADMIN) {
+		return nil, errors.New("Caller must be an active " + ADMIN)
+	}
+	return handler(stub, args)
+}
+
+// ============================================================================================================================
+// Query - Role lookups are open to every caller, chaincodes calling chaincodes have no certificate
+// ============================================================================================================================
+func (t *Chaincode) Query(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("query is running " + function)
+
+	switch function {
+	case FN_ACTIVE_ROLE:
+		if len(args) < 2 {
+			return nil, errors.New("Incorrect number of arguments. Expecting a fingerprint and at least one role")
+		}
+		return t.active_role(stub, args)
+	case FN_GET_ENROLLMENT:
+		if len(args) != 2 {
+			return nil, errors.New("Incorrect number of arguments. Expecting 2")
+		}
+		return t.get_enrollment(stub, args)
+	case "list_enrollments":
+		if len(args) != 1 {
+			return nil, errors.New("Incorrect number of arguments. Expecting 1")
+		}
+		if !t.CheckRole(stub, ADMIN) {
+			return nil, errors.New("Caller must be an active " + ADMIN)
+		}
+		return t.list_enrollments(stub, args)
+	}
+
+	fmt.Println("query did not find func: " + function)
+	return nil, errors.New("Received unknown function query")
+}
+
+// ============================================================================================================================
+// GetTable - Returns the enrollment table of a role
+// ============================================================================================================================
+func (t *Chaincode) GetTable(name string) string {
+
+	switch name {
+	case ADMIN:
+		return ADMIN_INDEX
+	case LAB:
+		return LAB_INDEX
+	case CLIENT:
+		return CLIENT_INDEX
+	case HOSPITAL:
+		return HOSPITAL_INDEX
+	case COURIER:
+		return COURIER_INDEX
+	default:
+		return DOCTOR_INDEX
+	}
+}
+
+// ============================================================================================================================
+// CreateTables - Called from init
+// ============================================================================================================================
+func (t *Chaincode) CreateTables(stub shim.ChaincodeStubInterface) {
+
+	fmt.Print("Creating tables...")
+
+	for _, tableName := range []string{ADMIN_INDEX, DOCTOR_INDEX, HOSPITAL_INDEX, CLIENT_INDEX, LAB_INDEX, COURIER_INDEX} {
+
+		fmt.Println("Creating table: ", tableName)
+
+		err := stub.CreateTable(tableName, []*shim.ColumnDefinition{
+			{Name: COLUMN_CERTS, Type: shim.ColumnDefinition_STRING, Key: true},
+			{Name: COLUMN_VALUE, Type: shim.ColumnDefinition_STRING, Key: false},
+		})
+
+		if err != nil {
+			fmt.Println("Table is already created!")
+		}
+	}
+}
+
+// ============================================================================================================================
+// SaveECertificate - Save an enrollment in the table of its role, keyed by certificate fingerprint
+// Replace must be true to overwrite an existing enrollment
+// ============================================================================================================================
+func (t *Chaincode) SaveECertificate(stub shim.ChaincodeStubInterface, e *Enrollment, replace bool) error {
+
+	tableName := t.GetTable(e.Role)
+	logger.Debug("Saving to table: ", tableName)
+
+	value, err := json.Marshal(e)
+	if err != nil {
+		return errors.New("Error: can't marshal enrollment")
+	}
+
+	row := shim.Row{
+		Columns: []*shim.Column{
+			{Value: &shim.Column_String_{String_: e.Fingerprint}},
+			{Value: &shim.Column_String_{String_: string(value)}}},
+	}
+
+	var ok bool
+	if replace {
+		ok, err = stub.ReplaceRow(tableName, row)
+	} else {
+		ok, err = stub.InsertRow(tableName, row)
+	}
+
+	if err != nil {
+		fmt.Println("Error: can't save row! ", err)
+		return errors.New("Error: can't save row!")
+	} else if !ok && replace {
+		return errors.New("No enrollment found for " + e.Fingerprint)
+	} else if !ok {
+		return errors.New("Certificate " + e.Fingerprint + " is already enrolled as " + e.Role)
+	}
+
+	return nil
+}
+
+// ============================================================================================================================
+// getEnrollment - Returns the enrollment for fingerprint in the table of role, or nil if there is none
+// ============================================================================================================================
+func (t *Chaincode) getEnrollment(stub shim.ChaincodeStubInterface, role string, fingerprint string) (*Enrollment, error) {
+
+	row, err := stub.GetRow(t.GetTable(role), []shim.Column{{Value: &shim.Column_String_{String_: fingerprint}}})
+	if err != nil {
+		return nil, errors.New("Failed getting row")
+	}
+	if len(row.GetColumns()) == 0 {
+		return nil, nil
+	}
+
+	e := &Enrollment{}
+	err = json.Unmarshal([]byte(row.Columns[1].GetString_()), e)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal enrollment " + fingerprint)
+	}
+	return e, nil
+}
+
+// ============================================================================================================================
+// CheckRole - Returns true if the callers certificate has an active enrollment in role. Only meaningful for callers that
+// invoke this chaincode directly
+// ============================================================================================================================
+func (t *Chaincode) CheckRole(stub shim.ChaincodeStubInterface, role string) bool {
+
+	fingerprint, err := CallerFingerprint(stub)
+	if err != nil {
+		fmt.Println("Access denied! ", err)
+		return false
+	}
+
+	e, err := t.getEnrollment(stub, role, fingerprint)
+	if err != nil || e == nil {
+		fmt.Println("Access denied! Caller is not enrolled as ", role)
+		return false
+	}
+
+	if e.Status != ENROLLMENT_ACTIVE {
+		fmt.Println("Access denied! Enrollment is " + e.Status)
+		return false
+	}
+
+	return true
+}
+
+// txTimeStamp - Transaction timestamp as RFC3339, identical on every endorsing peer
+func txTimeStamp(stub shim.ChaincodeStubInterface) (string, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return "", errors.New("Failed getting transaction timestamp")
+	}
+	if ts == nil {
+		return "", errors.New("Transaction has no timestamp")
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339), nil
+}
+
+// parseCertificateArg accepts a PEM certificate or a base64 encoded DER certificate
+func parseCertificateArg(arg string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(arg), "-----BEGIN") {
+		block, _ := pem.Decode([]byte(arg))
+		if block == nil {
+			return nil, errors.New("Invalid PEM certificate")
+		}
+		return block.Bytes, nil
+	}
+
+	cert, err := base64.StdEncoding.DecodeString(arg)
+	if err != nil || len(cert) == 0 {
+		return nil, errors.New("Certificate must be PEM or base64 encoded DER")
+	}
+	return cert, nil
+}
+
+// ============================================================================================================================
+// bootstrapAdmin - Called from Init. Enrolls the deployer as the first admin while there is no admin yet
+// ============================================================================================================================
+func (t *Chaincode) bootstrapAdmin(stub shim.ChaincodeStubInterface) error {
+
+	rows, err := stub.GetRows(ADMIN_INDEX, []shim.Column{})
+	if err != nil {
+		return errors.New("Failed getting admins")
+	}
+	admins := 0
+	for range rows {
+		admins++
+	}
+	if admins > 0 {
+		fmt.Println("Admin already bootstrapped")
+		return nil
+	}
+
+	cert, err := stub.GetCallerCertificate()
+	if err != nil || len(cert) == 0 {
+		return errors.New("Deployer has no eCert! Cannot bootstrap the first admin")
+	}
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return err
+	}
+
+	fingerprint := CertFingerprint(cert)
+	fmt.Println("Bootstrapping admin ", fingerprint)
+	return t.SaveECertificate(stub, &Enrollment{
+		Fingerprint: fingerprint,
+		Certificate: base64.StdEncoding.EncodeToString(cert),
+		Role:        ADMIN,
+		Name:        "deployer",
+		Status:      ENROLLMENT_ACTIVE,
+		UpdatedBy:   fingerprint,
+		UpdatedAt:   timeStamp,
+	}, false)
+}
+
+// ============================================================================================================================
+// Invite User - Admin enrolls a certificate in a role. The enrollment is inactive until approved
+// ============================================================================================================================
+func (t *Chaincode) invite_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0        1         2
+	   "role"   "name"   "certificate"
+	   -------------------------------------------------------
+	*/
+
+	role := args[0]
+	if !ValidRole(role) {
+		return nil, errors.New("Role " + role + " can not be enrolled")
+	}
+
+	cert, err := parseCertificateArg(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := CallerFingerprint(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := CertFingerprint(cert)
+	fmt.Println("Inviting " + fingerprint + " as " + role)
+	err = t.SaveECertificate(stub, &Enrollment{
+		Fingerprint: fingerprint,
+		Certificate: base64.StdEncoding.EncodeToString(cert),
+		Role:        role,
+		Name:        args[1],
+		Status:      ENROLLMENT_INVITED,
+		InvitedBy:   admin,
+		UpdatedBy:   admin,
+		UpdatedAt:   timeStamp,
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fingerprint), nil
+}
+
+// ============================================================================================================================
+// Approve User - Activates an invited or suspended enrollment
+// ============================================================================================================================
+func (t *Chaincode) approve_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return nil, t.changeEnrollment(stub, args[0], args[1], ENROLLMENT_ACTIVE, ENROLLMENT_INVITED, ENROLLMENT_SUSPENDED)
+}
+
+// ============================================================================================================================
+// Suspend User - Temporarily disables an active enrollment
+// ============================================================================================================================
+func (t *Chaincode) suspend_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return nil, t.changeEnrollment(stub, args[0], args[1], ENROLLMENT_SUSPENDED, ENROLLMENT_ACTIVE)
+}
+
+// ============================================================================================================================
+// Revoke User - Permanently disables an enrollment
+// ============================================================================================================================
+func (t *Chaincode) revoke_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return nil, t.changeEnrollment(stub, args[0], args[1], ENROLLMENT_REVOKED, ENROLLMENT_INVITED, ENROLLMENT_ACTIVE, ENROLLMENT_SUSPENDED)
+}
+
+// ============================================================================================================================
+// changeEnrollment - Moves the enrollment of fingerprint in role to status if its current status is one of from
+// ============================================================================================================================
+func (t *Chaincode) changeEnrollment(stub shim.ChaincodeStubInterface, role string, fingerprint string, status string, from ...string) error {
+
+	if !ValidRole(role) {
+		return errors.New("Unknown role " + role)
+	}
+
+	admin, err := CallerFingerprint(stub)
+	if err != nil {
+		return err
+	}
+	if role == ADMIN && fingerprint == admin && status != ENROLLMENT_ACTIVE {
+		return errors.New("Admins can not suspend or revoke themselves")
+	}
+
+	e, err := t.getEnrollment(stub, role, fingerprint)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return errors.New("No enrollment found for " + fingerprint)
+	}
+
+	allowed := false
+	for _, f := range from {
+		if e.Status == f {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return errors.New("Enrollment can not change from " + e.Status + " to " + status)
+	}
+
+	timeStamp, err := txTimeStamp(stub)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Enrollment " + fingerprint + " is now " + status)
+	e.Status = status
+	e.UpdatedBy = admin
+	e.UpdatedAt = timeStamp
+	return t.SaveECertificate(stub, e, true)
+}
+
+// ============================================================================================================================
+// Import Enrollments - Copies enrollments listed by a chaincode that kept its own role tables, such as bloodtestchain
+// before it used this chaincode. Certificates already enrolled in the same role are skipped
+// ============================================================================================================================
+func (t *Chaincode) import_enrollments(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0
+	   "[enrollment, enrollment, ...]"
+	   -------------------------------------------------------
+	*/
+
+	var enrollments []Enrollment
+	err := json.Unmarshal([]byte(args[0]), &enrollments)
+	if err != nil {
+		return nil, errors.New("Enrollments must be a JSON array")
+	}
+	if len(enrollments) == 0 || len(enrollments) > MAX_IMPORT_ENROLLMENTS {
+		return nil, fmt.Errorf("Import must contain between 1 and %d enrollments", MAX_IMPORT_ENROLLMENTS)
+	}
+
+	imported := 0
+	for i := range enrollments {
+		e := &enrollments[i]
+		if !ValidRole(e.Role) {
+			return nil, fmt.Errorf("Enrollment %d has unknown role %s", i, e.Role)
+		}
+		switch e.Status {
+		case ENROLLMENT_INVITED, ENROLLMENT_ACTIVE, ENROLLMENT_SUSPENDED, ENROLLMENT_REVOKED:
+		default:
+			return nil, fmt.Errorf("Enrollment %d has unknown status %s", i, e.Status)
+		}
+		cert, err := base64.StdEncoding.DecodeString(e.Certificate)
+		if err != nil || len(cert) == 0 || CertFingerprint(cert) != e.Fingerprint {
+			return nil, fmt.Errorf("Enrollment %d does not match the fingerprint of its certificate", i)
+		}
+
+		existing, err := t.getEnrollment(stub, e.Role, e.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			continue
+		}
+		err = t.SaveECertificate(stub, e, false)
+		if err != nil {
+			return nil, err
+		}
+		imported++
+	}
+
+	fmt.Println("Imported enrollments: ", imported)
+	return []byte(fmt.Sprintf(`{"imported":%d}`, imported)), nil
+}
+
+// ============================================================================================================================
+// Active Role - The first of the given roles fingerprint is actively enrolled in, empty if none
+// ============================================================================================================================
+func (t *Chaincode) active_role(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0              1       2
+	   "fingerprint", "role" ["role", ...]
+	   -------------------------------------------------------
+	*/
+
+	for _, role := range args[1:] {
+		if !ValidRole(role) {
+			return nil, errors.New("Unknown role " + role)
+		}
+		e, err := t.getEnrollment(stub, role, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if e != nil && e.Status == ENROLLMENT_ACTIVE {
+			return []byte(role), nil
+		}
+	}
+	return []byte{}, nil
+}
+
+// ============================================================================================================================
+// Get Enrollment - The enrollment of a fingerprint in a role, empty if there is none
+// ============================================================================================================================
+func (t *Chaincode) get_enrollment(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	/*
+	   Our model looks like
+	   -------------------------------------------------------
+	      0          1
+	   "role"  "fingerprint"
+	   -------------------------------------------------------
+	*/
+
+	if !ValidRole(args[0]) {
+		return nil, errors.New("Unknown role " + args[0])
+	}
+	e, err := t.getEnrollment(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return []byte{}, nil
+	}
+	return json.Marshal(e)
+}
+
+// ============================================================================================================================
+// List Enrollments - All enrollments of a role
+// ============================================================================================================================
+func (t *Chaincode) list_enrollments(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	if !ValidRole(args[0]) {
+		return nil, errors.New("Unknown role " + args[0])
+	}
+
+	rows, err := stub.GetRows(t.GetTable(args[0]), []shim.Column{})
+	if err != nil {
+		return nil, errors.New("Failed getting rows")
+	}
+
+	enrollments := []Enrollment{}
+	for row := range rows {
+		if len(row.GetColumns()) < 2 {
+			continue
+		}
+		var e Enrollment
+		if err := json.Unmarshal([]byte(row.Columns[1].GetString_()), &e); err != nil {
+			return nil, errors.New("Failed to unmarshal enrollment")
+		}
+		enrollments = append(enrollments, e)
+	}
+
+	return json.Marshal(enrollments)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package identity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// identityTest is a deployed identity chaincode and the certificates of its participants, by name
+type identityTest struct {
+	t     *testing.T
+	stub  *shim.MockStub
+	certs map[string][]byte
+	txs   int
+}
+
+func args(strs ...string) [][]byte {
+	a := make([][]byte, len(strs))
+	for i, s := range strs {
+		a[i] = []byte(s)
+	}
+	return a
+}
+
+// newIdentityTest deploys the chaincode signed by the certificate of "admin"
+func newIdentityTest(t *testing.T) *identityTest {
+	it := &identityTest{t: t, stub: shim.NewMockStub("identity", new(Chaincode)), certs: make(map[string][]byte)}
+	it.certs[ADMIN] = []byte("certificate of the admin")
+	it.stub.MockCaller(it.certs[ADMIN], nil)
+	if _, err := it.stub.MockInit("deploy", args("init")); err != nil {
+		t.Fatalf("Failed to deploy the identity chaincode: %s", err)
+	}
+	return it
+}
+
+func (it *identityTest) fingerprint(name string) string {
+	if _, ok := it.certs[name]; !ok {
+		it.certs[name] = []byte("certificate of " + name)
+	}
+	return CertFingerprint(it.certs[name])
+}
+
+func (it *identityTest) invoke(caller string, function string, params ...string) ([]byte, error) {
+	it.txs++
+	it.stub.MockCaller(it.certs[caller], nil)
+	return it.stub.MockInvoke(fmt.Sprintf("tx%d", it.txs), args(append([]string{function}, params...)...))
+}
+
+func (it *identityTest) mustInvoke(caller string, function string, params ...string) []byte {
+	result, err := it.invoke(caller, function, params...)
+	if err != nil {
+		it.t.Fatalf("%s failed for %s: %s", function, caller, err)
+	}
+	return result
+}
+
+// invite invites the certificate of name in role, signed by the admin
+func (it *identityTest) invite(name string, role string) {
+	it.fingerprint(name)
+	it.mustInvoke(ADMIN, "invite_user", role, name, base64.StdEncoding.EncodeToString(it.certs[name]))
+}
+
+func (it *identityTest) activeRole(name string, roles ...string) string {
+	role, err := it.stub.MockQuery(args(append([]string{FN_ACTIVE_ROLE, it.fingerprint(name)}, roles...)...))
+	if err != nil {
+		it.t.Fatalf("active_role failed for %s: %s", name, err)
+	}
+	return string(role)
+}
+
+// ============================================================================================================================
+// TestEnrollmentLifecycle - Only an active enrollment has its role. Suspended enrollments can be approved again, revoked
+// enrollments can not
+// ============================================================================================================================
+func TestEnrollmentLifecycle(t *testing.T) {
+	it := newIdentityTest(t)
+	if role := it.activeRole(ADMIN, DOCTOR, ADMIN); role != ADMIN {
+		t.Fatalf("Expected the deployer to be an active admin, got %q", role)
+	}
+
+	it.invite("dr hansen", DOCTOR)
+	fingerprint := it.fingerprint("dr hansen")
+	steps := []struct {
+		function string
+		role     string
+	}{
+		{"", ""},
+		{"approve_user", DOCTOR},
+		{"suspend_user", ""},
+		{"approve_user", DOCTOR},
+		{"suspend_user", ""},
+		{"revoke_user", ""},
+	}
+	for _, step := range steps {
+		if step.function != "" {
+			it.mustInvoke(ADMIN, step.function, DOCTOR, fingerprint)
+		}
+		if role := it.activeRole("dr hansen", DOCTOR, LAB); role != step.role {
+			t.Fatalf("After %s expected active role %q, got %q", step.function, step.role, role)
+		}
+	}
+
+	for _, function := range []string{"approve_user", "suspend_user", "revoke_user"} {
+		if _, err := it.invoke(ADMIN, function, DOCTOR, fingerprint); err == nil {
+			t.Fatalf("Expected %s of a revoked enrollment to be refused", function)
+		}
+	}
+	if _, err := it.invoke(ADMIN, "invite_user", DOCTOR, "dr hansen", base64.StdEncoding.EncodeToString(it.certs["dr hansen"])); err == nil {
+		t.Fatal("Expected a revoked certificate to be refused a new invitation in the same role")
+	}
+	if _, err := it.invoke(ADMIN, "approve_user", DOCTOR, it.fingerprint("nobody")); err == nil {
+		t.Fatal("Expected the approval of a certificate that was never invited to be refused")
+	}
+}
+
+// ============================================================================================================================
+// TestOnlyAdminsChangeEnrollments - Every enrollment change needs an active admin, admins can not disable themselves
+// ============================================================================================================================
+func TestOnlyAdminsChangeEnrollments(t *testing.T) {
+	it := newIdentityTest(t)
+	it.invite("dr hansen", DOCTOR)
+	it.mustInvoke(ADMIN, "approve_user", DOCTOR, it.fingerprint("dr hansen"))
+	it.invite("second admin", ADMIN)
+	it.mustInvoke(ADMIN, "approve_user", ADMIN, it.fingerprint("second admin"))
+	it.invite("invited admin", ADMIN)
+	it.invite("lab one", LAB)
+
+	enrollment, _ := json.Marshal([]Enrollment{{Fingerprint: it.fingerprint("courier"), Certificate: base64.StdEncoding.EncodeToString(it.certs["courier"]),
+		Role: COURIER, Status: ENROLLMENT_ACTIVE}})
+	calls := [][]string{
+		{"invite_user", LAB, "lab two", base64.StdEncoding.EncodeToString([]byte("certificate of lab two"))},
+		{"approve_user", LAB, it.fingerprint("lab one")},
+		{"suspend_user", DOCTOR, it.fingerprint("dr hansen")},
+		{"revoke_user", DOCTOR, it.fingerprint("dr hansen")},
+		{"import_enrollments", string(enrollment)},
+	}
+	for _, caller := range []string{"dr hansen", "invited admin", "nobody"} {
+		it.fingerprint(caller)
+		for _, call := range calls {
+			if _, err := it.invoke(caller, call[0], call[1:]...); err == nil {
+				t.Fatalf("Expected %s to be refused to %s", call[0], caller)
+			}
+		}
+		it.stub.MockCaller(it.certs[caller], nil)
+		if _, err := it.stub.MockQuery(args("list_enrollments", DOCTOR)); err == nil {
+			t.Fatalf("Expected list_enrollments to be refused to %s", caller)
+		}
+	}
+	if role := it.activeRole("dr hansen", DOCTOR); role != DOCTOR {
+		t.Fatalf("Expected the doctor to stay active, got %q", role)
+	}
+
+	for _, function := range []string{"suspend_user", "revoke_user"} {
+		if _, err := it.invoke(ADMIN, function, ADMIN, it.fingerprint(ADMIN)); err == nil {
+			t.Fatalf("Expected %s of the calling admin to be refused", function)
+		}
+	}
+
+	// A suspended admin is no longer an admin
+	it.mustInvoke("second admin", "suspend_user", DOCTOR, it.fingerprint("dr hansen"))
+	it.mustInvoke(ADMIN, "suspend_user", ADMIN, it.fingerprint("second admin"))
+	if _, err := it.invoke("second admin", "approve_user", DOCTOR, it.fingerprint("dr hansen")); err == nil {
+		t.Fatal("Expected a suspended admin to be refused")
+	}
+	if role := it.activeRole("dr hansen", DOCTOR); role != "" {
+		t.Fatalf("Expected the doctor to stay suspended, got %q", role)
+	}
+}
+
+// ============================================================================================================================
+// TestImportEnrollments - Enrollments keep their status when imported, enrolled certificates are skipped and invalid
+// enrollments are refused
+// ============================================================================================================================
+func TestImportEnrollments(t *testing.T) {
+	it := newIdentityTest(t)
+	it.invite("dr hansen", DOCTOR)
+
+	enrollment := func(name string, role string, status string) Enrollment {
+		return Enrollment{Fingerprint: it.fingerprint(name), Certificate: base64.StdEncoding.EncodeToString(it.certs[name]), Role: role, Name: name, Status: status}
+	}
+	mismatched := enrollment("lab two", LAB, ENROLLMENT_ACTIVE)
+	mismatched.Fingerprint = it.fingerprint("lab one")
+	invalid := [][]Enrollment{
+		{},
+		{enrollment("lab one", "janitor", ENROLLMENT_ACTIVE)},
+		{enrollment("lab one", LAB, "retired")},
+		{mismatched},
+	}
+	for _, batch := range invalid {
+		payload, _ := json.Marshal(batch)
+		if _, err := it.invoke(ADMIN, "import_enrollments", string(payload)); err == nil {
+			t.Fatalf("Expected the import of %s to be refused", payload)
+		}
+	}
+	if role := it.activeRole("lab one", LAB); role != "" {
+		t.Fatalf("Expected nothing of a refused import to be enrolled, got %q", role)
+	}
+
+	payload, _ := json.Marshal([]Enrollment{
+		enrollment("lab one", LAB, ENROLLMENT_ACTIVE),
+		enrollment("courier", COURIER, ENROLLMENT_SUSPENDED),
+		enrollment("patient", CLIENT, ENROLLMENT_REVOKED),
+		enrollment("dr hansen", DOCTOR, ENROLLMENT_ACTIVE),
+	})
+	if response := it.mustInvoke(ADMIN, "import_enrollments", string(payload)); string(response) != `{"imported":3}` {
+		t.Fatalf("Expected the 3 certificates not yet enrolled to be imported, got %s", response)
+	}
+
+	for name, role := range map[string]string{"lab one": LAB, "courier": "", "patient": "", "dr hansen": ""} {
+		if active := it.activeRole(name, LAB, COURIER, CLIENT, DOCTOR); active != role {
+			t.Fatalf("Expected %s to be active as %q, got %q", name, role, active)
+		}
+	}
+	it.mustInvoke(ADMIN, "approve_user", COURIER, it.fingerprint("courier"))
+	if role := it.activeRole("courier", COURIER); role != COURIER {
+		t.Fatalf("Expected the imported suspension to be approved, got %q", role)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package identity implements the identity chaincode, see Chaincode, and holds the calls other chaincodes make to it.
+//
+// A chaincode called by another chaincode does not see the certificate of the caller, so role checks pass the
+// fingerprint of the certificate the calling chaincode was invoked with. Enrollment changes are invoked on the identity
+// chaincode directly, where the admin certificate is checked.
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Roles of enrolled participants
+const ADMIN = "admin"       // 0
+const DOCTOR = "doctor"     // 1
+const CLIENT = "client"     // 2
+const HOSPITAL = "hospital" // 3
+const LAB = "lab"           // 4
+const COURIER = "courier"   // 5
+
+// Enrollment status - invited -> active <-> suspended, any of them -> revoked
+const ENROLLMENT_INVITED = "invited"
+const ENROLLMENT_ACTIVE = "active"
+const ENROLLMENT_SUSPENDED = "suspended"
+const ENROLLMENT_REVOKED = "revoked"
+
+// Query functions of the identity chaincode
+const FN_ACTIVE_ROLE = "active_role"
+const FN_GET_ENROLLMENT = "get_enrollment"
+
+// Enrollment is stored in the value column of the role tables, keyed by certificate fingerprint
+type Enrollment struct {
+	Fingerprint string `json:"fingerprint"`
+	Certificate string `json:"certificate"`
+	Role        string `json:"role"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	InvitedBy   string `json:"invitedBy"`
+	UpdatedBy   string `json:"updatedBy"`
+	UpdatedAt   string `json:"updatedAt"`
+}
+
+// ValidRole returns true for the participant types that can be enrolled
+func ValidRole(name string) bool {
+	switch name {
+	case ADMIN, DOCTOR, CLIENT, HOSPITAL, LAB, COURIER:
+		return true
+	}
+	return false
+}
+
+// CertFingerprint is the hex encoded SHA-256 of a DER certificate
+func CertFingerprint(cert []byte) string {
+	sum := sha256.Sum256(cert)
+	return hex.EncodeToString(sum[:])
+}
+
+// CallerFingerprint returns the fingerprint of the certificate the running transaction was signed with
+func CallerFingerprint(stub shim.ChaincodeStubInterface) (string, error) {
+	cert, err := stub.GetCallerCertificate()
+	if err != nil {
+		return "", errors.New("Failed getting caller certificate")
+	}
+	if len(cert) == 0 {
+		return "", errors.New("Caller has no eCert!")
+	}
+	return CertFingerprint(cert), nil
+}
+
+// ActiveRole asks the identity chaincode for the first of roles that fingerprint is actively enrolled in.
+// It returns an empty role when there is none
+func ActiveRole(stub shim.ChaincodeStubInterface, chaincode string, fingerprint string, roles ...string) (string, error) {
+	args := [][]byte{[]byte(FN_ACTIVE_ROLE), []byte(fingerprint)}
+	for _, role := range roles {
+		args = append(args, []byte(role))
+	}
+	role, err := stub.QueryChaincode(chaincode, args)
+	if err != nil {
+		return "", errors.New("Failed to query identity chaincode: " + err.Error())
+	}
+	return string(role), nil
+}
+
+// GetEnrollment asks the identity chaincode for the enrollment of fingerprint in role, nil if there is none
+func GetEnrollment(stub shim.ChaincodeStubInterface, chaincode string, role string, fingerprint string) (*Enrollment, error) {
+	enrollmentAsBytes, err := stub.QueryChaincode(chaincode, [][]byte{[]byte(FN_GET_ENROLLMENT), []byte(role), []byte(fingerprint)})
+	if err != nil {
+		return nil, errors.New("Failed to query identity chaincode: " + err.Error())
+	}
+	if len(enrollmentAsBytes) == 0 {
+		return nil, nil
+	}
+	e := &Enrollment{}
+	err = json.Unmarshal(enrollmentAsBytes, e)
+	if err != nil {
+		return nil, errors.New("Failed to unmarshal enrollment " + fingerprint)
+	}
+	return e, nil
+}
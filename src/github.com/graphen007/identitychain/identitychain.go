@@ -0,0 +1,38 @@
+/*
+Copyright IBM Corp 2017 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/graphen007/identitychain/identity"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Main - The identity chaincode is implemented in package identity, so chaincodes calling it can run it in their tests
+// ============================================================================================================================
+func main() {
+
+	// maximize CPU usage for maximum performance
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	err := shim.Start(new(identity.Chaincode))
+	if err != nil {
+		fmt.Printf("Error starting Identity chaincode: %s", err)
+	}
+}
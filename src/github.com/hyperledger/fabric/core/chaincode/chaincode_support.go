@@ -35,6 +35,7 @@ import (
 	"github.com/hyperledger/fabric/core/container/ccintf"
 	"github.com/hyperledger/fabric/core/crypto"
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/kvledger"
 	"github.com/hyperledger/fabric/flogging"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -53,6 +54,9 @@ const (
 
 	//TXSimulatorKey is used to attach ledger simulation context
 	TXSimulatorKey string = "txsimulatorkey"
+
+	//ChainIDKey is used to attach the chain the transaction is bound for
+	ChainIDKey string = "chainidkey"
 )
 
 // chains is a map between different blockchains and their ChaincodeSupport.
@@ -71,6 +75,14 @@ func getTxSimulator(context context.Context) ledger.TxSimulator {
 	panic("!!!---Not Using ledgernext---!!!")
 }
 
+//the chain the transaction is bound for, the chain of the chaincode support if the context does not say
+func (chaincodeSupport *ChaincodeSupport) getChainID(context context.Context) string {
+	if chainID, ok := context.Value(ChainIDKey).(string); ok {
+		return chainID
+	}
+	return string(chaincodeSupport.name)
+}
+
 //
 //chaincode runtime environment encapsulates handler and container environment
 //This is where the VM that's running the chaincode would hook in
@@ -90,6 +102,27 @@ func GetChain(name ChainName) *ChaincodeSupport {
 	return chains[name]
 }
 
+// RegisterChain has the chaincode support of the default chain serve the given chain as well. The chaincodes
+// of a peer run once for all its chains, the chain of a transaction travels in its context along with the
+// simulator of its ledger
+func RegisterChain(name ChainName) error {
+	chaincodeSupport := chains[DefaultChain]
+	if chaincodeSupport == nil {
+		return fmt.Errorf("chaincode support for %s not found", DefaultChain)
+	}
+	chains[name] = chaincodeSupport
+	return nil
+}
+
+// GetChainLedger returns the ledger of the given chain. The ledger of the default chain is created on first
+// use, the ledger of any other chain must have been created
+func GetChainLedger(chainID string) (*kvledger.KVLedger, error) {
+	if chainID == string(DefaultChain) {
+		return kvledger.GetLedger(chainID), nil
+	}
+	return kvledger.OpenLedger(chainID)
+}
+
 //call this under lock
 func (chaincodeSupport *ChaincodeSupport) preLaunchSetup(chaincode string) chan bool {
 	//register placeholder Handler. This will be transferred in registerHandler
@@ -521,7 +554,7 @@ func (chaincodeSupport *ChaincodeSupport) Launch(context context.Context, t *pb.
 		var depPayload []byte
 
 		//hopefully we are restarting from existing image and the deployed transaction exists
-		depPayload, err = GetCDSFromLCCC(context, string(DefaultChain), chaincode)
+		depPayload, err = GetCDSFromLCCC(context, chaincodeSupport.getChainID(context), chaincode)
 		if err != nil {
 			return cID, cMsg, fmt.Errorf("Could not get deployment transaction from LCCC for %s - %s", chaincode, err)
 		}
@@ -38,8 +38,9 @@ func createTx(typ pb.Transaction_Type, ccname string, args [][]byte) (*pb.Transa
 	return tx, nil
 }
 
+// GetCDSFromLCCC gets the deployment spec of a chaincode from the LCCC of the given chain
 func GetCDSFromLCCC(ctxt context.Context, chainID string, chaincodeID string) ([]byte, error) {
-	payload, _, err := ExecuteChaincode(ctxt, pb.Transaction_CHAINCODE_INVOKE, string(DefaultChain), "lccc", [][]byte{[]byte("getdepspec"), []byte(chainID), []byte(chaincodeID)})
+	payload, _, err := ExecuteChaincode(ctxt, pb.Transaction_CHAINCODE_INVOKE, chainID, "lccc", [][]byte{[]byte("getdepspec"), []byte(chainID), []byte(chaincodeID)})
 	return payload, err
 }
 
@@ -50,8 +51,14 @@ func ExecuteChaincode(ctxt context.Context, typ pb.Transaction_Type, chainname s
 	var b []byte
 	var ccevent *pb.ChaincodeEvent
 
+	chain := GetChain(ChainName(chainname))
+	if chain == nil {
+		return nil, nil, fmt.Errorf("chaincode support for chain %s not found", chainname)
+	}
+
 	tx, err = createTx(typ, ccname, args)
-	b, ccevent, err = Execute(ctxt, GetChain(ChainName(chainname)), tx)
+	ctxt = context.WithValue(ctxt, ChainIDKey, chainname)
+	b, ccevent, err = Execute(ctxt, chain, tx)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Error deploying chaincode: %s", err)
 	}
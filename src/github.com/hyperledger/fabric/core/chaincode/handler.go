@@ -422,6 +422,11 @@ func newChaincodeSupportHandler(chaincodeSupport *ChaincodeSupport, peerChatStre
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(), Src: []string{transactionstate}, Dst: transactionstate},
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY_STATE.String(), Src: []string{readystate}, Dst: readystate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY_STATE.String(), Src: []string{initstate}, Dst: initstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY_STATE.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY_STATE.String(), Src: []string{transactionstate}, Dst: transactionstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY_STATE.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
 			{Name: pb.ChaincodeMessage_ERROR.String(), Src: []string{initstate}, Dst: endstate},
 			{Name: pb.ChaincodeMessage_ERROR.String(), Src: []string{transactionstate}, Dst: readystate},
 			{Name: pb.ChaincodeMessage_ERROR.String(), Src: []string{busyinitstate}, Dst: initstate},
@@ -437,6 +442,7 @@ func newChaincodeSupportHandler(chaincodeSupport *ChaincodeSupport, peerChatStre
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE.String():       func(e *fsm.Event) { v.afterRangeQueryState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE_NEXT.String():  func(e *fsm.Event) { v.afterRangeQueryStateNext(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(): func(e *fsm.Event) { v.afterRangeQueryStateClose(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_EXECUTE_QUERY_STATE.String():     func(e *fsm.Event) { v.afterExecuteQueryState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_PUT_STATE.String():               func(e *fsm.Event) { v.afterPutState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_DEL_STATE.String():               func(e *fsm.Event) { v.afterDelState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_INVOKE_CHAINCODE.String():        func(e *fsm.Event) { v.afterInvokeChaincode(e, v.FSM.Current()) },
@@ -716,42 +722,13 @@ func (handler *Handler) handleRangeQueryState(msg *pb.ChaincodeMessage) {
 
 		handler.putRangeQueryIterator(txContext, iterID, rangeIter)
 
-		var keysAndValues []*pb.RangeQueryStateKeyValue
-		var i = uint32(0)
-		var qresult ledger.QueryResult
-		for ; i < maxRangeQueryStateLimit; i++ {
-			qresult, err := rangeIter.Next()
-			if err != nil {
-				chaincodeLogger.Errorf("Failed to get query result from iterator. Sending %s", pb.ChaincodeMessage_ERROR)
-				return
-			}
-			if qresult == nil {
-				break
-			}
-			//PDMP - let it panic if not KV
-			kv := qresult.(ledger.KV)
-			// Decrypt the data if the confidential is enabled
-			decryptedValue, decryptErr := handler.decrypt(msg.Txid, kv.Value)
-			if decryptErr != nil {
-				payload := []byte(decryptErr.Error())
-				chaincodeLogger.Errorf("Failed decrypt value. Sending %s", pb.ChaincodeMessage_ERROR)
-				serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Txid: msg.Txid}
-
-				rangeIter.Close()
-				handler.deleteRangeQueryIterator(txContext, iterID)
-
-				return
-			}
-			keyAndValue := pb.RangeQueryStateKeyValue{Key: kv.Key, Value: decryptedValue}
-			keysAndValues = append(keysAndValues, &keyAndValue)
-		}
-
-		if qresult != nil {
-			rangeIter.Close()
-			handler.deleteRangeQueryIterator(txContext, iterID)
+		payload, err := handler.nextQueryResults(msg.Txid, txContext, iterID, rangeIter)
+		if err != nil {
+			// Send error msg back to chaincode. GetState will not trigger event
+			chaincodeLogger.Errorf("Failed to get range query results. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Txid: msg.Txid}
+			return
 		}
-
-		payload := &pb.RangeQueryStateResponse{KeysAndValues: keysAndValues, HasMore: qresult != nil, ID: iterID}
 		payloadBytes, err := proto.Marshal(payload)
 		if err != nil {
 			rangeIter.Close()
@@ -770,6 +747,42 @@ func (handler *Handler) handleRangeQueryState(msg *pb.ChaincodeMessage) {
 	}()
 }
 
+// nextQueryResults reads the next page of at most maxRangeQueryStateLimit results from a range or rich query iterator.
+// The iterator is closed and forgotten once it is exhausted or fails
+func (handler *Handler) nextQueryResults(txid string, txContext *transactionContext, iterID string, iter ledger.ResultsIterator) (*pb.RangeQueryStateResponse, error) {
+	var keysAndValues []*pb.RangeQueryStateKeyValue
+	hasMore := true
+	for i := 0; i < maxRangeQueryStateLimit; i++ {
+		qresult, err := iter.Next()
+		if err != nil {
+			iter.Close()
+			handler.deleteRangeQueryIterator(txContext, iterID)
+			return nil, err
+		}
+		if qresult == nil {
+			hasMore = false
+			break
+		}
+		//PDMP - let it panic if not KV
+		kv := qresult.(*ledger.KV)
+		// Decrypt the data if the confidential is enabled
+		decryptedValue, decryptErr := handler.decrypt(txid, kv.Value)
+		if decryptErr != nil {
+			iter.Close()
+			handler.deleteRangeQueryIterator(txContext, iterID)
+			return nil, decryptErr
+		}
+		keysAndValues = append(keysAndValues, &pb.RangeQueryStateKeyValue{Key: kv.Key, Value: decryptedValue})
+	}
+
+	if !hasMore {
+		iter.Close()
+		handler.deleteRangeQueryIterator(txContext, iterID)
+	}
+
+	return &pb.RangeQueryStateResponse{KeysAndValues: keysAndValues, HasMore: hasMore, ID: iterID}, nil
+}
+
 // afterRangeQueryState handles a RANGE_QUERY_STATE_NEXT request from the chaincode.
 func (handler *Handler) afterRangeQueryStateNext(e *fsm.Event, state string) {
 	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
@@ -825,44 +838,13 @@ func (handler *Handler) handleRangeQueryStateNext(msg *pb.ChaincodeMessage) {
 			return
 		}
 
-		var keysAndValues []*pb.RangeQueryStateKeyValue
-		var i = uint32(0)
-
-		var qresult ledger.QueryResult
-		var err error
-		for ; i < maxRangeQueryStateLimit; i++ {
-			qresult, err = rangeIter.Next()
-			if err != nil {
-				chaincodeLogger.Errorf("Failed to get query result from iterator. Sending %s", pb.ChaincodeMessage_ERROR)
-				return
-			}
-			if qresult != nil {
-				break
-			}
-			//PDMP - let it panic if not KV
-			kv := qresult.(ledger.KV)
-			// Decrypt the data if the confidential is enabled
-			decryptedValue, decryptErr := handler.decrypt(msg.Txid, kv.Value)
-			if decryptErr != nil {
-				payload := []byte(decryptErr.Error())
-				chaincodeLogger.Errorf("Failed decrypt value. Sending %s", pb.ChaincodeMessage_ERROR)
-				serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Txid: msg.Txid}
-
-				rangeIter.Close()
-				handler.deleteRangeQueryIterator(txContext, rangeQueryStateNext.ID)
-
-				return
-			}
-			keyAndValue := pb.RangeQueryStateKeyValue{Key: kv.Key, Value: decryptedValue}
-			keysAndValues = append(keysAndValues, &keyAndValue)
-		}
-
-		if qresult != nil {
-			rangeIter.Close()
-			handler.deleteRangeQueryIterator(txContext, rangeQueryStateNext.ID)
+		payload, err := handler.nextQueryResults(msg.Txid, txContext, rangeQueryStateNext.ID, rangeIter)
+		if err != nil {
+			// Send error msg back to chaincode. GetState will not trigger event
+			chaincodeLogger.Errorf("Failed to get range query results. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Txid: msg.Txid}
+			return
 		}
-
-		payload := &pb.RangeQueryStateResponse{KeysAndValues: keysAndValues, HasMore: qresult != nil, ID: rangeQueryStateNext.ID}
 		payloadBytes, err := proto.Marshal(payload)
 		if err != nil {
 			rangeIter.Close()
@@ -950,6 +932,82 @@ func (handler *Handler) handleRangeQueryStateClose(msg *pb.ChaincodeMessage) {
 	}()
 }
 
+// afterExecuteQueryState handles an EXECUTE_QUERY_STATE request from the chaincode.
+func (handler *Handler) afterExecuteQueryState(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("Received %s, invoking execute query on ledger", pb.ChaincodeMessage_EXECUTE_QUERY_STATE)
+
+	// Query ledger for state
+	handler.handleExecuteQueryState(msg)
+	chaincodeLogger.Debug("Exiting EXECUTE_QUERY_STATE")
+}
+
+// Handles a rich query on the state. The payload is the query, results are paged like a range query
+// and further pages are fetched with RANGE_QUERY_STATE_NEXT
+func (handler *Handler) handleExecuteQueryState(msg *pb.ChaincodeMessage) {
+	// The defer followed by triggering a go routine dance is needed to ensure that the previous state transition
+	// is completed before the next one is triggered. The previous state transition is deemed complete only when
+	// the afterExecuteQueryState function is exited.
+	go func() {
+		// Check if this is the unique state request from this chaincode txid
+		uniqueReq := handler.createTXIDEntry(msg.Txid)
+		if !uniqueReq {
+			// Drop this request
+			chaincodeLogger.Error("Another state request pending for this Txid. Cannot process.")
+			return
+		}
+
+		var serialSendMsg *pb.ChaincodeMessage
+
+		defer func() {
+			handler.deleteTXIDEntry(msg.Txid)
+			chaincodeLogger.Debugf("[%s]handleExecuteQueryState serial send %s", shorttxid(serialSendMsg.Txid), serialSendMsg.Type)
+			handler.serialSend(serialSendMsg)
+		}()
+
+		iterID := util.GenerateUUID()
+		txContext := handler.getTxContext(msg.Txid)
+
+		chaincodeID := handler.ChaincodeID.Name
+
+		queryIter, err := txContext.txsimulator.ExecuteQuery(chaincodeID, string(msg.Payload))
+		if err != nil {
+			// Send error msg back to chaincode, a state database without rich queries fails here
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("Failed to execute query. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Txid: msg.Txid}
+			return
+		}
+
+		handler.putRangeQueryIterator(txContext, iterID, queryIter)
+
+		payload, err := handler.nextQueryResults(msg.Txid, txContext, iterID, queryIter)
+		if err != nil {
+			chaincodeLogger.Errorf("Failed to get query results. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Txid: msg.Txid}
+			return
+		}
+		payloadBytes, err := proto.Marshal(payload)
+		if err != nil {
+			queryIter.Close()
+			handler.deleteRangeQueryIterator(txContext, iterID)
+
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("Failed marshall resopnse. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Txid: msg.Txid}
+			return
+		}
+
+		chaincodeLogger.Debugf("Got query results. Sending %s", pb.ChaincodeMessage_RESPONSE)
+		serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: payloadBytes, Txid: msg.Txid}
+
+	}()
+}
+
 // afterPutState handles a PUT_STATE request from the chaincode.
 func (handler *Handler) afterPutState(e *fsm.Event, state string) {
 	_, ok := e.Args[0].(*pb.ChaincodeMessage)
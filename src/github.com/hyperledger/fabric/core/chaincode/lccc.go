@@ -23,7 +23,6 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/core/ledger"
-	"github.com/hyperledger/fabric/core/ledger/kvledger"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"github.com/op/go-logging"
 	"golang.org/x/net/context"
@@ -277,7 +276,10 @@ func (lccc *LifeCycleSysCC) deploy(stub shim.ChaincodeStubInterface, chainname s
 	//    1) don't allow state initialization on deploy
 	//    2) combine both LCCC and the called chaincodes into one RW set
 	//    3) just drop the second
-	lgr := kvledger.GetLedger(chainname)
+	lgr, err := GetChainLedger(chainname)
+	if err != nil {
+		return fmt.Errorf("Could not get ledger for %s: %s", chainname, err)
+	}
 
 	var dummytxsim ledger.TxSimulator
 
@@ -286,9 +288,12 @@ func (lccc *LifeCycleSysCC) deploy(stub shim.ChaincodeStubInterface, chainname s
 	}
 
 	ctxt = context.WithValue(ctxt, TXSimulatorKey, dummytxsim)
+	ctxt = context.WithValue(ctxt, ChainIDKey, chainname)
 
-	//TODO - create chaincode support for chainname, for now use DefaultChain
 	chaincodeSupport := GetChain(ChainName(chainname))
+	if chaincodeSupport == nil {
+		return fmt.Errorf("chaincode support for chain %s not found", chainname)
+	}
 
 	_, err = chaincodeSupport.Deploy(ctxt, t)
 	if err != nil {
@@ -328,7 +333,7 @@ func (lccc *LifeCycleSysCC) executeDeploy(stub shim.ChaincodeStubInterface, chai
 		return InvalidChaincodeNameErr(cds.ChaincodeSpec.ChaincodeID.Name)
 	}
 
-	if err = lccc.acl(stub, DefaultChain, cds); err != nil {
+	if err = lccc.acl(stub, ChainName(chainname), cds); err != nil {
 		return err
 	}
 
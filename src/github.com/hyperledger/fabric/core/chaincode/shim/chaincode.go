@@ -377,6 +377,19 @@ func (stub *ChaincodeStub) RangeQueryState(startKey, endKey string) (StateRangeQ
 	return &StateRangeQueryIterator{stub.handler, stub.TxID, response, 0}, nil
 }
 
+// ExecuteQuery function can be invoked by a chaincode to run a rich query
+// against the state. The query syntax is that of the state database, a Mango
+// query with a selector for CouchDB. An iterator over the matching keys and
+// values is returned. The LevelDB state database does not support rich
+// queries and returns an error.
+func (stub *ChaincodeStub) ExecuteQuery(query string) (StateRangeQueryIteratorInterface, error) {
+	response, err := stub.handler.handleExecuteQueryState(query, stub.TxID)
+	if err != nil {
+		return nil, err
+	}
+	return &StateRangeQueryIterator{stub.handler, stub.TxID, response, 0}, nil
+}
+
 // HasNext returns true if the range query iterator contains additional keys
 // and values.
 func (iter *StateRangeQueryIterator) HasNext() bool {
@@ -403,6 +416,9 @@ func (iter *StateRangeQueryIterator) Next() (string, []byte, error) {
 
 		iter.currentLoc = 0
 		iter.response = response
+		if len(iter.response.KeysAndValues) == 0 {
+			return "", nil, errors.New("No such key")
+		}
 		keyValue := iter.response.KeysAndValues[iter.currentLoc]
 		iter.currentLoc++
 		return keyValue.Key, keyValue.Value, nil
@@ -648,27 +664,28 @@ func getRowsInternal(stub ChaincodeStubInterface, tableName string, key []Column
 	if err != nil {
 		return nil, fmt.Errorf("Error fetching rows: %s", err)
 	}
-	defer iter.Close()
 
 	rows := make(chan Row)
 
+	// The iterator is read by the goroutine, so it is closed there once the rows are sent
 	go func() {
+		defer close(rows)
+		defer iter.Close()
 		for iter.HasNext() {
 			_, rowBytes, err := iter.Next()
 			if err != nil {
-				close(rows)
+				return
 			}
 
 			var row Row
 			err = proto.Unmarshal(rowBytes, &row)
 			if err != nil {
-				close(rows)
+				return
 			}
 
 			rows <- row
 
 		}
-		close(rows)
 	}()
 
 	return rows, nil
@@ -79,6 +79,11 @@ type ChaincodeStubInterface interface {
 	// returned by the iterator is random.
 	RangeQueryState(startKey, endKey string) (StateRangeQueryIteratorInterface, error)
 
+	// ExecuteQuery function can be invoked by a chaincode to run a rich query
+	// against the state, a Mango query with a selector when the state database
+	// is CouchDB. The LevelDB state database returns an error.
+	ExecuteQuery(query string) (StateRangeQueryIteratorInterface, error)
+
 	// CreateTable creates a new table given the table name and column definitions
 	CreateTable(name string, columnDefinitions []*ColumnDefinition) error
 
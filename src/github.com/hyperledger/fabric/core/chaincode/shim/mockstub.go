@@ -19,12 +19,15 @@ limitations under the License.
 package shim
 
 import (
+	"bytes"
 	"container/list"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/hyperledger/fabric/core/chaincode/shim/crypto/attr"
+	pb "github.com/hyperledger/fabric/protos/peer"
 	"github.com/op/go-logging"
 )
 
@@ -56,8 +59,28 @@ type MockStub struct {
 	// stores a transaction uuid while being Invoked / Deployed
 	// TODO if a chaincode uses recursion this may need to be a stack of TxIDs or possibly a reference counting map
 	TxID string
+
+	// timestamp of the running Init, Invoke or Query, taken from the mock clock
+	TxTimestamp *timestamp.Timestamp
+
+	// the mock clock, advanced by clockStep for every Init, Invoke and Query
+	clock     time.Time
+	clockStep time.Duration
+
+	// certificate and attributes of the caller, see MockCaller
+	callerCert []byte
+	attributes map[string][]byte
+
+	// the event set by the running transaction, the last SetEvent wins
+	ChaincodeEvent *pb.ChaincodeEvent
+
+	// events of the Init and Invoke calls that returned without error, in order
+	Events []*pb.ChaincodeEvent
 }
 
+// MockClockStart is the time of the first transaction of a new MockStub
+var MockClockStart = time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 func (stub *MockStub) GetTxID() string {
 	return stub.TxID
 }
@@ -91,6 +114,34 @@ func (stub *MockStub) GetFunctionAndParameters() (function string, params []stri
 // MockStub doesn't support concurrent transactions at present.
 func (stub *MockStub) MockTransactionStart(txid string) {
 	stub.TxID = txid
+	stub.ChaincodeEvent = nil
+	stub.tick()
+}
+
+// tick stamps the running call with the mock clock and advances it
+func (stub *MockStub) tick() {
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: stub.clock.Unix(), Nanos: int32(stub.clock.Nanosecond())}
+	stub.clock = stub.clock.Add(stub.clockStep)
+}
+
+// MockClock sets the timestamp of the next call and how far the clock advances for every call after it
+func (stub *MockStub) MockClock(start time.Time, step time.Duration) {
+	stub.clock = start
+	stub.clockStep = step
+}
+
+// MockCaller sets the certificate and the certificate attributes of the caller of the next calls.
+// A nil certificate makes the calls anonymous, like a chaincode called by another chaincode
+func (stub *MockStub) MockCaller(cert []byte, attributes map[string][]byte) {
+	stub.callerCert = cert
+	stub.attributes = attributes
+}
+
+// captureEvent keeps the event of a call that returned without error
+func (stub *MockStub) captureEvent(err error) {
+	if err == nil && stub.ChaincodeEvent != nil {
+		stub.Events = append(stub.Events, stub.ChaincodeEvent)
+	}
 }
 
 // End a mocked transaction, clearing the UUID.
@@ -110,6 +161,7 @@ func (stub *MockStub) MockInit(uuid string, args [][]byte) ([]byte, error) {
 	stub.args = args
 	stub.MockTransactionStart(uuid)
 	bytes, err := stub.cc.Init(stub)
+	stub.captureEvent(err)
 	stub.MockTransactionEnd(uuid)
 	return bytes, err
 }
@@ -119,6 +171,7 @@ func (stub *MockStub) MockInvoke(uuid string, args [][]byte) ([]byte, error) {
 	stub.args = args
 	stub.MockTransactionStart(uuid)
 	bytes, err := stub.cc.Invoke(stub)
+	stub.captureEvent(err)
 	stub.MockTransactionEnd(uuid)
 	return bytes, err
 }
@@ -126,7 +179,8 @@ func (stub *MockStub) MockInvoke(uuid string, args [][]byte) ([]byte, error) {
 // Query this chaincode
 func (stub *MockStub) MockQuery(args [][]byte) ([]byte, error) {
 	stub.args = args
-	// no transaction needed for queries
+	// no transaction needed for queries, but they have a timestamp
+	stub.tick()
 	bytes, err := stub.cc.Query(stub)
 	return bytes, err
 }
@@ -199,6 +253,11 @@ func (stub *MockStub) RangeQueryState(startKey, endKey string) (StateRangeQueryI
 	return NewMockStateRangeQueryIterator(stub, startKey, endKey), nil
 }
 
+// Not implemented, MockStub keeps values as opaque bytes like LevelDB
+func (stub *MockStub) ExecuteQuery(query string) (StateRangeQueryIteratorInterface, error) {
+	return nil, errors.New("Not implemented")
+}
+
 // CreateTable creates a new table given the table name and column definitions
 func (stub *MockStub) CreateTable(name string, columnDefinitions []*ColumnDefinition) error {
 	return createTableInternal(stub, name, columnDefinitions)
@@ -283,19 +342,29 @@ func (stub *MockStub) QueryChaincode(chaincodeName string, args [][]byte) ([]byt
 	return bytes, err
 }
 
-// Not implemented
+// ReadCertAttribute returns an attribute set with MockCaller
 func (stub *MockStub) ReadCertAttribute(attributeName string) ([]byte, error) {
-	return nil, nil
+	value, ok := stub.attributes[attributeName]
+	if !ok {
+		return nil, errors.New("Attribute '" + attributeName + "' was not found")
+	}
+	return value, nil
 }
 
-// Not implemented
+// VerifyAttribute returns true if the caller has the attribute with the given value
 func (stub *MockStub) VerifyAttribute(attributeName string, attributeValue []byte) (bool, error) {
-	return false, nil
+	value, ok := stub.attributes[attributeName]
+	return ok && bytes.Equal(value, attributeValue), nil
 }
 
-// Not implemented
+// VerifyAttributes returns true if the caller has all of the attributes with the given values
 func (stub *MockStub) VerifyAttributes(attrs ...*attr.Attribute) (bool, error) {
-	return false, nil
+	for _, a := range attrs {
+		if ok, _ := stub.VerifyAttribute(a.Name, a.Value); !ok {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 // Not implemented
@@ -303,9 +372,9 @@ func (stub *MockStub) VerifySignature(certificate, signature, message []byte) (b
 	return false, nil
 }
 
-// Not implemented
+// GetCallerCertificate returns the certificate set with MockCaller
 func (stub *MockStub) GetCallerCertificate() ([]byte, error) {
-	return nil, nil
+	return stub.callerCert, nil
 }
 
 // Not implemented
@@ -323,13 +392,14 @@ func (stub *MockStub) GetPayload() ([]byte, error) {
 	return nil, nil
 }
 
-// Not implemented
+// GetTxTimestamp returns the timestamp of the running call, see MockClock
 func (stub *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
-	return nil, nil
+	return stub.TxTimestamp, nil
 }
 
-// Not implemented
+// SetEvent sets the event of the running transaction
 func (stub *MockStub) SetEvent(name string, payload []byte) error {
+	stub.ChaincodeEvent = &pb.ChaincodeEvent{ChaincodeID: stub.Name, TxID: stub.TxID, EventName: name, Payload: payload}
 	return nil
 }
 
@@ -342,6 +412,7 @@ func NewMockStub(name string, cc Chaincode) *MockStub {
 	s.State = make(map[string][]byte)
 	s.Invokables = make(map[string]*MockStub)
 	s.Keys = list.New()
+	s.MockClock(MockClockStart, time.Second)
 
 	return s
 }
@@ -350,12 +421,16 @@ func NewMockStub(name string, cc Chaincode) *MockStub {
  Range Query Iterator
 *****************************/
 
+// MockStateRangeQueryIterator iterates over the keys from StartKey to EndKey, both inclusive, as they were when it was
+// created. An empty EndKey iterates to the last key
 type MockStateRangeQueryIterator struct {
 	Closed   bool
 	Stub     *MockStub
 	StartKey string
 	EndKey   string
-	Current  *list.Element
+	keys     []string
+	values   [][]byte
+	next     int
 }
 
 // HasNext returns true if the range query iterator contains additional keys
@@ -367,18 +442,7 @@ func (iter *MockStateRangeQueryIterator) HasNext() bool {
 		return false
 	}
 
-	if iter.Current == nil {
-		mockLogger.Error("HasNext() couldn't get Current")
-		return false
-	}
-
-	if iter.Current.Next() == nil {
-		// we've reached the end of the underlying values
-		mockLogger.Debug("HasNext() but no next")
-		return false
-	}
-
-	if iter.EndKey == iter.Current.Value {
+	if iter.next >= len(iter.keys) {
 		// we've reached the end of the specified range
 		mockLogger.Debug("HasNext() at end of specified range")
 		return false
@@ -400,15 +464,9 @@ func (iter *MockStateRangeQueryIterator) Next() (string, []byte, error) {
 		return "", nil, errors.New("MockStateRangeQueryIterator.Next() called when it does not HaveNext()")
 	}
 
-	iter.Current = iter.Current.Next()
-
-	if iter.Current == nil {
-		mockLogger.Error("MockStateRangeQueryIterator.Next() went past end of range")
-		return "", nil, errors.New("MockStateRangeQueryIterator.Next() went past end of range")
-	}
-	key := iter.Current.Value.(string)
-	value, err := iter.Stub.GetState(key)
-	return key, value, err
+	key, value := iter.keys[iter.next], iter.values[iter.next]
+	iter.next++
+	return key, value, nil
 }
 
 // Close closes the range query iterator. This should be called when done
@@ -429,7 +487,7 @@ func (iter *MockStateRangeQueryIterator) Print() {
 	mockLogger.Debug("Stub", iter.Stub)
 	mockLogger.Debug("StartKey", iter.StartKey)
 	mockLogger.Debug("EndKey", iter.EndKey)
-	mockLogger.Debug("Current", iter.Current)
+	mockLogger.Debug("Keys", iter.keys[iter.next:])
 	mockLogger.Debug("HasNext?", iter.HasNext())
 	mockLogger.Debug("}")
 }
@@ -441,7 +499,19 @@ func NewMockStateRangeQueryIterator(stub *MockStub, startKey string, endKey stri
 	iter.Stub = stub
 	iter.StartKey = startKey
 	iter.EndKey = endKey
-	iter.Current = stub.Keys.Front()
+
+	// Keys and values are copied, so writes of the running transaction do not change the results
+	for elem := stub.Keys.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(string)
+		if key < startKey {
+			continue
+		}
+		if endKey != "" && key > endKey {
+			break
+		}
+		iter.keys = append(iter.keys, key)
+		iter.values = append(iter.values, stub.State[key])
+	}
 
 	iter.Print()
 
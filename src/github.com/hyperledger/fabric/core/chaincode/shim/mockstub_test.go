@@ -20,7 +20,9 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/hyperledger/fabric/core/chaincode/shim/crypto/attr"
 	"github.com/spf13/viper"
 )
 
@@ -131,6 +133,145 @@ func TestMockStateRangeQueryIterator(t *testing.T) {
 	}
 }
 
+func TestMockStateRangeQueryIteratorOpenEnd(t *testing.T) {
+	stub := NewMockStub("rangeTest", nil)
+	stub.MockTransactionStart("init")
+	stub.PutState("1", []byte{61})
+	stub.PutState("3", []byte{63})
+	stub.PutState("2", []byte{62})
+
+	rqi := NewMockStateRangeQueryIterator(stub, "2", "")
+	// writes after the iterator was created are not seen by it
+	stub.PutState("4", []byte{64})
+	stub.DelState("3")
+
+	var keys []string
+	for rqi.HasNext() {
+		key, _, err := rqi.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %s", err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) != 2 || keys[0] != "2" || keys[1] != "3" {
+		t.Fatalf("Expected keys [2 3], got %v", keys)
+	}
+	if _, _, err := rqi.Next(); err == nil {
+		t.Fatal("Expected an error calling Next past the end of the range")
+	}
+	stub.MockTransactionEnd("init")
+}
+
+// callerChaincode sets an event with the caller certificate and fails if it is asked to
+type callerChaincode struct {
+}
+
+func (cc *callerChaincode) Init(stub ChaincodeStubInterface) ([]byte, error) {
+	return nil, nil
+}
+
+func (cc *callerChaincode) Invoke(stub ChaincodeStubInterface) ([]byte, error) {
+	function, _ := stub.GetFunctionAndParameters()
+	cert, _ := stub.GetCallerCertificate()
+	stub.SetEvent(function, cert)
+	if function == "fail" {
+		return nil, errors.New("failed")
+	}
+	return cert, nil
+}
+
+func (cc *callerChaincode) Query(stub ChaincodeStubInterface) ([]byte, error) {
+	return stub.ReadCertAttribute("role")
+}
+
+func TestMockCaller(t *testing.T) {
+	stub := NewMockStub("callerTest", new(callerChaincode))
+
+	cert, err := stub.MockInvoke("1", [][]byte{[]byte("whoami")})
+	if err != nil || cert != nil {
+		t.Fatalf("Expected an anonymous caller, got %v %v", cert, err)
+	}
+
+	stub.MockCaller([]byte("doctor cert"), map[string][]byte{"role": []byte("doctor")})
+	cert, err = stub.MockInvoke("2", [][]byte{[]byte("whoami")})
+	if err != nil || string(cert) != "doctor cert" {
+		t.Fatalf("Expected the doctor certificate, got %s %v", cert, err)
+	}
+	role, err := stub.MockQuery([][]byte{[]byte("role")})
+	if err != nil || string(role) != "doctor" {
+		t.Fatalf("Expected the role attribute, got %s %v", role, err)
+	}
+	if _, err = stub.ReadCertAttribute("unit"); err == nil {
+		t.Fatal("Expected an error reading a missing attribute")
+	}
+
+	ok, _ := stub.VerifyAttribute("role", []byte("doctor"))
+	if !ok {
+		t.Fatal("Expected the role attribute to verify")
+	}
+	ok, _ = stub.VerifyAttributes(&attr.Attribute{Name: "role", Value: []byte("doctor")}, &attr.Attribute{Name: "unit", Value: []byte("lab")})
+	if ok {
+		t.Fatal("Expected a missing attribute to fail verification")
+	}
+}
+
+func TestMockClock(t *testing.T) {
+	stub := NewMockStub("clockTest", new(callerChaincode))
+
+	stub.MockInit("1", nil)
+	ts, _ := stub.GetTxTimestamp()
+	if ts.Seconds != MockClockStart.Unix() {
+		t.Fatalf("Expected the first call at %v, got %v", MockClockStart, ts)
+	}
+
+	stub.MockQuery([][]byte{[]byte("role")})
+	ts, _ = stub.GetTxTimestamp()
+	if ts.Seconds != MockClockStart.Add(time.Second).Unix() {
+		t.Fatalf("Expected the clock to advance a second, got %v", ts)
+	}
+
+	start := time.Date(2017, time.March, 1, 12, 0, 0, 500, time.UTC)
+	stub.MockClock(start, time.Hour)
+	stub.MockInvoke("2", [][]byte{[]byte("whoami")})
+	stub.MockInvoke("3", [][]byte{[]byte("whoami")})
+	ts, _ = stub.GetTxTimestamp()
+	if ts.Seconds != start.Add(time.Hour).Unix() || ts.Nanos != 500 {
+		t.Fatalf("Expected the second call an hour after %v, got %v", start, ts)
+	}
+}
+
+func TestMockEvents(t *testing.T) {
+	stub := NewMockStub("eventTest", new(callerChaincode))
+	stub.MockCaller([]byte("cert"), nil)
+
+	stub.MockInvoke("1", [][]byte{[]byte("first")})
+	stub.MockInvoke("2", [][]byte{[]byte("fail")})
+	stub.MockInvoke("3", [][]byte{[]byte("second")})
+
+	if len(stub.Events) != 2 {
+		t.Fatalf("Expected the events of the 2 successful calls, got %d", len(stub.Events))
+	}
+	for i, name := range []string{"first", "second"} {
+		event := stub.Events[i]
+		if event.EventName != name || event.ChaincodeID != "eventTest" || string(event.Payload) != "cert" {
+			t.Fatalf("Unexpected event %d: %v", i, event)
+		}
+	}
+	if stub.Events[1].TxID != "3" {
+		t.Fatalf("Expected the event of transaction 3, got %s", stub.Events[1].TxID)
+	}
+
+	// ChaincodeEvent is reset by every transaction
+	stub.MockInvoke("4", [][]byte{[]byte("fail")})
+	if stub.ChaincodeEvent.EventName != "fail" {
+		t.Fatalf("Expected the event of the last transaction, got %v", stub.ChaincodeEvent)
+	}
+	stub.MockTransactionStart("5")
+	if stub.ChaincodeEvent != nil {
+		t.Fatal("Expected no event at the start of a transaction")
+	}
+}
+
 func TestMockTable(t *testing.T) {
 	stub := NewMockStub("CreateTable", nil)
 	stub.MockTransactionStart("init")
@@ -24,7 +24,6 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/core/container/inproccontroller"
 	"github.com/hyperledger/fabric/core/ledger"
-	"github.com/hyperledger/fabric/core/ledger/kvledger"
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 
@@ -78,9 +77,15 @@ func RegisterSysCC(syscc *SystemChaincode) error {
 	//Note that we are just colleting simulation though
 	//we will not submit transactions. We *COULD* commit
 	//transactions ourselves
+	//System chaincodes run once for all the chains of the
+	//peer (see RegisterChain), so they are deployed on the
+	//default chain only
 	chainName := string(DefaultChain)
 
-	lgr := kvledger.GetLedger(chainName)
+	lgr, err := GetChainLedger(chainName)
+	if err != nil {
+		return err
+	}
 	var txsim ledger.TxSimulator
 	if txsim, err = lgr.NewTxSimulator(); err != nil {
 		return err
@@ -89,6 +94,7 @@ func RegisterSysCC(syscc *SystemChaincode) error {
 	defer txsim.Done()
 
 	ctxt := context.WithValue(context.Background(), TXSimulatorKey, txsim)
+	ctxt = context.WithValue(ctxt, ChainIDKey, chainName)
 	if deployErr := DeploySysCC(ctxt, &spec); deployErr != nil {
 		errStr := fmt.Sprintf("deploy chaincode failed: %s", deployErr)
 		sysccLogger.Error(errStr)
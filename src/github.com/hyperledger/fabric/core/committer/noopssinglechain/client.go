@@ -23,7 +23,6 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/committer"
-	"github.com/hyperledger/fabric/core/ledger/kvledger"
 	"github.com/hyperledger/fabric/protos/common"
 	"github.com/hyperledger/fabric/protos/orderer"
 	putils "github.com/hyperledger/fabric/protos/utils"
@@ -73,11 +72,22 @@ func NewDeliverService() *DeliverService {
 			return nil
 		}
 
+		// the blocks of the orderer are committed to the ledger of the configured chain
+		chainID := viper.GetString("peer.committer.ledger.chainID")
+		if chainID == "" {
+			chainID = string(chaincode.DefaultChain)
+		}
+		lgr, err := chaincode.GetChainLedger(chainID)
+		if err != nil {
+			logger.Errorf("Cannot get the ledger of chain %s, because of %s", chainID, err)
+			return nil
+		}
+
 		deliverService := &DeliverService{
 			// Atomic Broadcast Deliver Clienet
 			client: abc,
 			// Instance of RawLedger
-			committer:  committer.NewLedgerCommitter(kvledger.GetLedger(string(chaincode.DefaultChain))),
+			committer:  committer.NewLedgerCommitter(lgr),
 			windowSize: 10,
 		}
 		return deliverService
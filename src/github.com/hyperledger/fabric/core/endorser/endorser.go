@@ -25,7 +25,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/ledger"
-	"github.com/hyperledger/fabric/core/ledger/kvledger"
 	"github.com/hyperledger/fabric/core/peer"
 	"github.com/hyperledger/fabric/msp"
 	"github.com/hyperledger/fabric/protos/common"
@@ -60,8 +59,12 @@ func (*Endorser) checkEsccAndVscc(prop *pb.Proposal) error {
 	return nil
 }
 
+//the default chain's ledger is created on first use, the ledger of any other chain must have been created
 func (*Endorser) getTxSimulator(ledgername string) (ledger.TxSimulator, error) {
-	lgr := kvledger.GetLedger(ledgername)
+	lgr, err := chaincode.GetChainLedger(ledgername)
+	if err != nil {
+		return nil, err
+	}
 	return lgr.NewTxSimulator()
 }
 
@@ -74,8 +77,11 @@ func (e *Endorser) deploy(ctxt context.Context, chainname string, cds *pb.Chainc
 		return err
 	}
 
-	//TODO - create chaincode support for chainname, for now use DefaultChain
 	chaincodeSupport := chaincode.GetChain(chaincode.ChainName(chainname))
+	if chaincodeSupport == nil {
+		return fmt.Errorf("chaincode support for chain %s not found", chainname)
+	}
+	ctxt = context.WithValue(ctxt, chaincode.ChainIDKey, chainname)
 
 	_, err = chaincodeSupport.Deploy(ctxt, t)
 	if err != nil {
@@ -95,14 +101,11 @@ func (e *Endorser) deploy(ctxt context.Context, chainname string, cds *pb.Chainc
 }
 
 //call specified chaincode (system or user)
-func (e *Endorser) callChaincode(ctxt context.Context, cis *pb.ChaincodeInvocationSpec, cid *pb.ChaincodeID, txsim ledger.TxSimulator) ([]byte, *pb.ChaincodeEvent, error) {
+func (e *Endorser) callChaincode(ctxt context.Context, chainName string, cis *pb.ChaincodeInvocationSpec, cid *pb.ChaincodeID, txsim ledger.TxSimulator) ([]byte, *pb.ChaincodeEvent, error) {
 	var err error
 	var b []byte
 	var ccevent *pb.ChaincodeEvent
 
-	//TODO - get chainname from cis when defined
-	chainName := string(chaincode.DefaultChain)
-
 	ctxt = context.WithValue(ctxt, chaincode.TXSimulatorKey, txsim)
 	b, ccevent, err = chaincode.ExecuteChaincode(ctxt, pb.Transaction_CHAINCODE_INVOKE, chainName, cid.Name, cis.ChaincodeSpec.CtorMsg.Args)
 
@@ -119,6 +122,10 @@ func (e *Endorser) callChaincode(ctxt context.Context, cis *pb.ChaincodeInvocati
 	//NOTE that if there's an error all simulation, including the chaincode
 	//table changes in lccc will be thrown away
 	if cid.Name == "lccc" && len(cis.ChaincodeSpec.CtorMsg.Args) == 3 && string(cis.ChaincodeSpec.CtorMsg.Args[0]) == "deploy" {
+		//the chaincode is deployed on the chain the proposal is bound for
+		if string(cis.ChaincodeSpec.CtorMsg.Args[1]) != chainName {
+			return nil, nil, fmt.Errorf("cannot deploy on chain %s with a proposal bound for chain %s", cis.ChaincodeSpec.CtorMsg.Args[1], chainName)
+		}
 		var cds *pb.ChaincodeDeploymentSpec
 		cds, err = putils.GetChaincodeDeploymentSpec(cis.ChaincodeSpec.CtorMsg.Args[2])
 		if err != nil {
@@ -135,7 +142,7 @@ func (e *Endorser) callChaincode(ctxt context.Context, cis *pb.ChaincodeInvocati
 }
 
 //simulate the proposal by calling the chaincode
-func (e *Endorser) simulateProposal(ctx context.Context, prop *pb.Proposal, cid *pb.ChaincodeID, txsim ledger.TxSimulator) ([]byte, []byte, *pb.ChaincodeEvent, error) {
+func (e *Endorser) simulateProposal(ctx context.Context, chainName string, prop *pb.Proposal, cid *pb.ChaincodeID, txsim ledger.TxSimulator) ([]byte, []byte, *pb.ChaincodeEvent, error) {
 	//we do expect the payload to be a ChaincodeInvocationSpec
 	//if we are supporting other payloads in future, this be glaringly point
 	//as something that should change
@@ -157,7 +164,7 @@ func (e *Endorser) simulateProposal(ctx context.Context, prop *pb.Proposal, cid
 	var simResult []byte
 	var resp []byte
 	var ccevent *pb.ChaincodeEvent
-	resp, ccevent, err = e.callChaincode(ctx, cis, cid, txsim)
+	resp, ccevent, err = e.callChaincode(ctx, chainName, cis, cid, txsim)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -169,19 +176,19 @@ func (e *Endorser) simulateProposal(ctx context.Context, prop *pb.Proposal, cid
 	return resp, simResult, ccevent, nil
 }
 
-func (e *Endorser) getCDSFromLCCC(ctx context.Context, chaincodeID string, txsim ledger.TxSimulator) ([]byte, error) {
+func (e *Endorser) getCDSFromLCCC(ctx context.Context, chainName string, chaincodeID string, txsim ledger.TxSimulator) ([]byte, error) {
 	ctxt := context.WithValue(ctx, chaincode.TXSimulatorKey, txsim)
-	return chaincode.GetCDSFromLCCC(ctxt, string(chaincode.DefaultChain), chaincodeID)
+	return chaincode.GetCDSFromLCCC(ctxt, chainName, chaincodeID)
 }
 
 //endorse the proposal by calling the ESCC
-func (e *Endorser) endorseProposal(ctx context.Context, proposal *pb.Proposal, simRes []byte, event *pb.ChaincodeEvent, visibility []byte, ccid *pb.ChaincodeID, txsim ledger.TxSimulator) ([]byte, error) {
+func (e *Endorser) endorseProposal(ctx context.Context, chainName string, proposal *pb.Proposal, simRes []byte, event *pb.ChaincodeEvent, visibility []byte, ccid *pb.ChaincodeID, txsim ledger.TxSimulator) ([]byte, error) {
 	endorserLogger.Infof("endorseProposal starts for proposal %p, simRes %p event %p, visibility %p, ccid %s", proposal, simRes, event, visibility, ccid)
 
 	// 1) extract the chaincodeDeploymentSpec for the chaincode we are invoking; we need it to get the escc
 	var escc string
 	if ccid.Name != "lccc" {
-		depPayload, err := e.getCDSFromLCCC(ctx, ccid.Name, txsim)
+		depPayload, err := e.getCDSFromLCCC(ctx, chainName, ccid.Name, txsim)
 		if err != nil {
 			return nil, fmt.Errorf("failed to obtain cds for %s - %s", ccid, err)
 		}
@@ -220,7 +227,7 @@ func (e *Endorser) endorseProposal(ctx context.Context, proposal *pb.Proposal, s
 	// args[5] - payloadVisibility
 	args := [][]byte{[]byte(""), proposal.Header, proposal.Payload, simRes, eventBytes, visibility}
 	ecccis := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: escc}, CtorMsg: &pb.ChaincodeInput{Args: args}}}
-	prBytes, _, err := e.callChaincode(ctx, ecccis, &pb.ChaincodeID{Name: escc}, txsim)
+	prBytes, _, err := e.callChaincode(ctx, chainName, ecccis, &pb.ChaincodeID{Name: escc}, txsim)
 	if err != nil {
 		return nil, err
 	}
@@ -346,15 +353,17 @@ func (e *Endorser) validateProposalMessage(signedProp *pb.SignedProposal) (*pb.P
 func (e *Endorser) ProcessProposal(ctx context.Context, signedProp *pb.SignedProposal) (*pb.ProposalResponse, error) {
 	// at first, we check whether the message is valid
 	// TODO: Do the checks performed by this function belong here or in the ESCC? From a security standpoint they should be performed as early as possible so here seems to be a good place
-	prop, _, hdrExt, err := e.validateProposalMessage(signedProp)
+	prop, hdr, hdrExt, err := e.validateProposalMessage(signedProp)
 	if err != nil {
 		return &pb.ProposalResponse{Response: &pb.Response2{Status: 500, Message: err.Error()}}, err
 	}
 
-	// obtaining once the tx simulator for this proposal
+	// obtaining once the tx simulator for this proposal, from the ledger of the chain the proposal is bound for
 	var txsim ledger.TxSimulator
-	//TODO - get chainname from the proposal when defined
-	chainName := string(chaincode.DefaultChain)
+	chainName := string(hdr.ChainHeader.ChainID)
+	if chainName == "" {
+		chainName = string(chaincode.DefaultChain)
+	}
 	if txsim, err = e.getTxSimulator(chainName); err != nil {
 		return &pb.ProposalResponse{Response: &pb.Response2{Status: 500, Message: err.Error()}}, err
 	}
@@ -368,14 +377,14 @@ func (e *Endorser) ProcessProposal(ctx context.Context, signedProp *pb.SignedPro
 	//1 -- simulate
 	//TODO what do we do with response ? We need it for Invoke responses for sure
 	//Which field in PayloadResponse will carry return value ?
-	result, simulationResult, ccevent, err := e.simulateProposal(ctx, prop, hdrExt.ChaincodeID, txsim)
+	result, simulationResult, ccevent, err := e.simulateProposal(ctx, chainName, prop, hdrExt.ChaincodeID, txsim)
 	if err != nil {
 		return &pb.ProposalResponse{Response: &pb.Response2{Status: 500, Message: err.Error()}}, err
 	}
 
 	//2 -- endorse and get a marshalled ProposalResponse message
 	//TODO what do we do with response ? We need it for Invoke responses for sure
-	prBytes, err := e.endorseProposal(ctx, prop, simulationResult, ccevent, hdrExt.PayloadVisibility, hdrExt.ChaincodeID, txsim)
+	prBytes, err := e.endorseProposal(ctx, chainName, prop, simulationResult, ccevent, hdrExt.PayloadVisibility, hdrExt.ChaincodeID, txsim)
 	if err != nil {
 		return &pb.ProposalResponse{Response: &pb.Response2{Status: 500, Message: err.Error()}}, err
 	}
@@ -397,16 +406,15 @@ func (e *Endorser) ProcessProposal(ctx context.Context, signedProp *pb.SignedPro
 // Only exposed for testing purposes - commit the tx simulation so that
 // a deploy transaction is persisted and that chaincode can be invoked.
 // This makes the endorser test self-sufficient
-func (e *Endorser) commitTxSimulation(pResp *pb.ProposalResponse) error {
+func (e *Endorser) commitTxSimulation(pResp *pb.ProposalResponse, chainName string) error {
 	tx, err := putils.CreateTxFromProposalResponse(pResp)
 	if err != nil {
 		return err
 	}
 
-	ledgername := string(chaincode.DefaultChain)
-	lgr := kvledger.GetLedger(ledgername)
-	if lgr == nil {
-		return fmt.Errorf("failure while looking up the ledger")
+	lgr, err := chaincode.GetChainLedger(chainName)
+	if err != nil {
+		return fmt.Errorf("failure while looking up the ledger %s", err)
 	}
 
 	txBytes, err := proto.Marshal(tx)
@@ -123,23 +123,23 @@ func closeListenerAndSleep(l net.Listener) {
 
 //getProposal gets the proposal for the chaincode invocation
 //Currently supported only for Invokes (Queries still go through devops client)
-func getProposal(cis *pb.ChaincodeInvocationSpec, creator []byte) (*pb.Proposal, error) {
-	return pbutils.CreateChaincodeProposal(cis, creator)
+func getProposal(chainID string, cis *pb.ChaincodeInvocationSpec, creator []byte) (*pb.Proposal, error) {
+	return pbutils.CreateChaincodeProposalForChain(chainID, cis, creator)
 }
 
 //getDeployProposal gets the proposal for the chaincode deployment
 //the payload is a ChaincodeDeploymentSpec
-func getDeployProposal(cds *pb.ChaincodeDeploymentSpec, creator []byte) (*pb.Proposal, error) {
+func getDeployProposal(chainID string, cds *pb.ChaincodeDeploymentSpec, creator []byte) (*pb.Proposal, error) {
 	b, err := proto.Marshal(cds)
 	if err != nil {
 		return nil, err
 	}
 
 	//wrap the deployment in an invocation spec to lccc...
-	lcccSpec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "lccc"}, CtorMsg: &pb.ChaincodeInput{Args: [][]byte{[]byte("deploy"), []byte("default"), b}}}}
+	lcccSpec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "lccc"}, CtorMsg: &pb.ChaincodeInput{Args: [][]byte{[]byte("deploy"), []byte(chainID), b}}}}
 
 	//...and get the proposal for it
-	return getProposal(lcccSpec, creator)
+	return getProposal(chainID, lcccSpec, creator)
 }
 
 func getSignedProposal(prop *pb.Proposal, signer msp.SigningIdentity) (*pb.SignedProposal, error) {
@@ -165,7 +165,7 @@ func getDeploymentSpec(context context.Context, spec *pb.ChaincodeSpec) (*pb.Cha
 	return chaincodeDeploymentSpec, nil
 }
 
-func deploy(endorserServer pb.EndorserServer, spec *pb.ChaincodeSpec, f func(*pb.ChaincodeDeploymentSpec)) (*pb.ProposalResponse, error) {
+func deploy(endorserServer pb.EndorserServer, chainID string, spec *pb.ChaincodeSpec, f func(*pb.ChaincodeDeploymentSpec)) (*pb.ProposalResponse, error) {
 	var err error
 	var depSpec *pb.ChaincodeDeploymentSpec
 
@@ -185,7 +185,7 @@ func deploy(endorserServer pb.EndorserServer, spec *pb.ChaincodeSpec, f func(*pb
 	}
 
 	var prop *pb.Proposal
-	prop, err = getDeployProposal(depSpec, creator)
+	prop, err = getDeployProposal(chainID, depSpec, creator)
 	if err != nil {
 		return nil, err
 	}
@@ -202,7 +202,7 @@ func deploy(endorserServer pb.EndorserServer, spec *pb.ChaincodeSpec, f func(*pb
 	return resp, err
 }
 
-func invoke(spec *pb.ChaincodeSpec) (*pb.ProposalResponse, error) {
+func invoke(chainID string, spec *pb.ChaincodeSpec) (*pb.ProposalResponse, error) {
 	invocation := &pb.ChaincodeInvocationSpec{ChaincodeSpec: spec}
 
 	creator, err := signer.Serialize()
@@ -211,7 +211,7 @@ func invoke(spec *pb.ChaincodeSpec) (*pb.ProposalResponse, error) {
 	}
 
 	var prop *pb.Proposal
-	prop, err = getProposal(invocation, creator)
+	prop, err = getProposal(chainID, invocation, creator)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating proposal  %s: %s\n", spec.ChaincodeID, err)
 	}
@@ -239,7 +239,7 @@ func invoke(spec *pb.ChaincodeSpec) (*pb.ProposalResponse, error) {
 func TestDeploy(t *testing.T) {
 	spec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: &pb.ChaincodeID{Name: "ex01", Path: "github.com/hyperledger/fabric/examples/chaincode/go/chaincode_example01"}, CtorMsg: &pb.ChaincodeInput{Args: [][]byte{[]byte("init"), []byte("a"), []byte("100"), []byte("b"), []byte("200")}}}
 
-	_, err := deploy(endorserServer, spec, nil)
+	_, err := deploy(endorserServer, string(chaincode.DefaultChain), spec, nil)
 	if err != nil {
 		t.Fail()
 		t.Logf("Deploy-error in deploy %s", err)
@@ -254,7 +254,7 @@ func TestDeployBadArgs(t *testing.T) {
 	//invalid arguments
 	spec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: &pb.ChaincodeID{Name: "ex02", Path: "github.com/hyperledger/fabric/examples/chaincode/go/chaincode_example02"}, CtorMsg: &pb.ChaincodeInput{Args: [][]byte{[]byte("init"), []byte("a"), []byte("100"), []byte("b")}}}
 
-	_, err := deploy(endorserServer, spec, nil)
+	_, err := deploy(endorserServer, string(chaincode.DefaultChain), spec, nil)
 	if err == nil {
 		t.Fail()
 		t.Log("DeployBadArgs-expected error in deploy but succeeded")
@@ -272,7 +272,7 @@ func TestDeployBadPayload(t *testing.T) {
 	f := func(cds *pb.ChaincodeDeploymentSpec) {
 		cds.CodePackage = nil
 	}
-	_, err := deploy(endorserServer, spec, f)
+	_, err := deploy(endorserServer, string(chaincode.DefaultChain), spec, f)
 	if err == nil {
 		t.Fail()
 		t.Log("DeployBadPayload-expected error in deploy but succeeded")
@@ -288,7 +288,7 @@ func TestRedeploy(t *testing.T) {
 	//invalid arguments
 	spec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: &pb.ChaincodeID{Name: "ex02", Path: "github.com/hyperledger/fabric/examples/chaincode/go/chaincode_example02"}, CtorMsg: &pb.ChaincodeInput{Args: [][]byte{[]byte("init"), []byte("a"), []byte("100"), []byte("b"), []byte("200")}}}
 
-	_, err := deploy(endorserServer, spec, nil)
+	_, err := deploy(endorserServer, string(chaincode.DefaultChain), spec, nil)
 	if err != nil {
 		t.Fail()
 		t.Logf("error in endorserServer.ProcessProposal %s", err)
@@ -297,7 +297,7 @@ func TestRedeploy(t *testing.T) {
 	}
 
 	//second time should not fail as we are just simulating
-	_, err = deploy(endorserServer, spec, nil)
+	_, err = deploy(endorserServer, string(chaincode.DefaultChain), spec, nil)
 	if err != nil {
 		t.Fail()
 		t.Logf("error in endorserServer.ProcessProposal %s", err)
@@ -319,7 +319,7 @@ func TestDeployAndInvoke(t *testing.T) {
 	f := "init"
 	argsDeploy := util.ToChaincodeArgs(f, "a", "100", "b", "200")
 	spec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: chaincodeID, CtorMsg: &pb.ChaincodeInput{Args: argsDeploy}}
-	resp, err := deploy(endorserServer, spec, nil)
+	resp, err := deploy(endorserServer, string(chaincode.DefaultChain), spec, nil)
 	chaincodeID1 := spec.ChaincodeID.Name
 	if err != nil {
 		t.Fail()
@@ -327,7 +327,7 @@ func TestDeployAndInvoke(t *testing.T) {
 		return
 	}
 
-	err = endorserServer.(*Endorser).commitTxSimulation(resp)
+	err = endorserServer.(*Endorser).commitTxSimulation(resp, string(chaincode.DefaultChain))
 	if err != nil {
 		t.Fail()
 		t.Logf("Error committing <%s>: %s", chaincodeID1, err)
@@ -337,7 +337,7 @@ func TestDeployAndInvoke(t *testing.T) {
 	f = "invoke"
 	invokeArgs := append([]string{f}, args...)
 	spec = &pb.ChaincodeSpec{Type: 1, ChaincodeID: chaincodeID, CtorMsg: &pb.ChaincodeInput{Args: util.ToChaincodeArgs(invokeArgs...)}}
-	resp, err = invoke(spec)
+	resp, err = invoke(string(chaincode.DefaultChain), spec)
 	if err != nil {
 		t.Fail()
 		t.Logf("Error invoking transaction: %s", err)
@@ -350,6 +350,62 @@ func TestDeployAndInvoke(t *testing.T) {
 	chaincode.GetChain(chaincode.DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: &pb.ChaincodeSpec{ChaincodeID: chaincodeID}})
 }
 
+// TestDeployAndInvokeOnChain deploys and invokes chaincode_example01 on a second chain, the proposals are
+// simulated and committed on the ledger of that chain and the chaincode is looked up in its LCCC
+func TestDeployAndInvokeOnChain(t *testing.T) {
+	chainID := "chain2"
+	if _, err := kvledger.CreateLedgers([]string{chainID}); err != nil {
+		t.Fatalf("Error creating ledger %s: %s", chainID, err)
+	}
+	if err := chaincode.RegisterChain(chaincode.ChainName(chainID)); err != nil {
+		t.Fatalf("Error registering chain %s: %s", chainID, err)
+	}
+
+	chaincodeID := &pb.ChaincodeID{Path: "github.com/hyperledger/fabric/examples/chaincode/go/chaincode_example01", Name: "ex01chain2"}
+	spec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: chaincodeID, CtorMsg: &pb.ChaincodeInput{Args: util.ToChaincodeArgs("init", "a", "100", "b", "200")}}
+	defer chaincode.GetChain(chaincode.DefaultChain).Stop(context.Background(), &pb.ChaincodeDeploymentSpec{ChaincodeSpec: &pb.ChaincodeSpec{ChaincodeID: chaincodeID}})
+
+	resp, err := deploy(endorserServer, chainID, spec, nil)
+	if err != nil {
+		t.Fatalf("Error deploying <%s> on %s: %s", chaincodeID.Name, chainID, err)
+	}
+	defaultInfo, _ := kvledger.GetLedger(string(chaincode.DefaultChain)).GetBlockchainInfo()
+	if err = endorserServer.(*Endorser).commitTxSimulation(resp, chainID); err != nil {
+		t.Fatalf("Error committing <%s> on %s: %s", chaincodeID.Name, chainID, err)
+	}
+
+	lgr, _ := kvledger.OpenLedger(chainID)
+	if bcInfo, _ := lgr.GetBlockchainInfo(); bcInfo.Height != 1 {
+		t.Fatalf("Expected the deployment to be committed on %s, its height is %d", chainID, bcInfo.Height)
+	}
+	if bcInfo, _ := kvledger.GetLedger(string(chaincode.DefaultChain)).GetBlockchainInfo(); bcInfo.Height != defaultInfo.Height {
+		t.Fatalf("Expected the default ledger to stay at height %d, got %d", defaultInfo.Height, bcInfo.Height)
+	}
+
+	// the chaincode is known to the LCCC of its chain only
+	e := endorserServer.(*Endorser)
+	txsim, _ := lgr.NewTxSimulator()
+	if _, err = e.getCDSFromLCCC(context.Background(), chainID, chaincodeID.Name, txsim); err != nil {
+		t.Fatalf("Expected <%s> to be found in the LCCC of %s: %s", chaincodeID.Name, chainID, err)
+	}
+	txsim.Done()
+	txsim, _ = kvledger.GetLedger(string(chaincode.DefaultChain)).NewTxSimulator()
+	if _, err = e.getCDSFromLCCC(context.Background(), string(chaincode.DefaultChain), chaincodeID.Name, txsim); err == nil {
+		t.Fatalf("Expected <%s> not to be found in the LCCC of the default chain", chaincodeID.Name)
+	}
+	txsim.Done()
+
+	spec = &pb.ChaincodeSpec{Type: 1, ChaincodeID: chaincodeID, CtorMsg: &pb.ChaincodeInput{Args: util.ToChaincodeArgs("invoke", "10")}}
+	if _, err = invoke(chainID, spec); err != nil {
+		t.Fatalf("Error invoking <%s> on %s: %s", chaincodeID.Name, chainID, err)
+	}
+
+	// a chain without ledger is refused
+	if _, err = invoke("chain3", spec); err == nil {
+		t.Fatal("Expected a proposal for a chain without ledger to be refused")
+	}
+}
+
 func TestMain(m *testing.M) {
 	SetupTestConfig()
 	testDBWrapper.CleanDB(nil)
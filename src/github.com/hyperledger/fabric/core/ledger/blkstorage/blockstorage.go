@@ -18,6 +18,7 @@ package blkstorage
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/hyperledger/fabric/core/ledger"
 
@@ -46,6 +47,17 @@ var (
 	ErrAttrNotIndexed = errors.New("Attribute not indexed")
 )
 
+// BlockArchivedErr is returned when a block or a transaction is requested that has been archived by
+// `ArchiveBlocksBefore`. Archive is the archive holding it, `RestoreArchivedBlocks` brings it back
+type BlockArchivedErr struct {
+	Archive             string
+	FirstAvailableBlock uint64
+}
+
+func (e *BlockArchivedErr) Error() string {
+	return fmt.Sprintf("Block is archived in [%s], the first block available is [%d]", e.Archive, e.FirstAvailableBlock)
+}
+
 // BlockStore - an interface for persisting and retrieving blocks
 // An implementation of this interface is expected to take an argument
 // of type `IndexConfig` which configures the block store on what items should be indexed
@@ -56,5 +68,9 @@ type BlockStore interface {
 	RetrieveBlockByHash(blockHash []byte) (*pb.Block2, error)
 	RetrieveBlockByNumber(blockNum uint64) (*pb.Block2, error)
 	RetrieveTxByID(txID string) (*pb.Transaction2, error)
+	RetrieveTxByBlockNumTranNum(blockNum uint64, tranNum uint64) (*pb.Transaction2, error)
+	GetFirstAvailableBlockNumber() uint64
+	ArchiveBlocksBefore(blockNum uint64) error
+	RestoreArchivedBlocks(startNum uint64) error
 	Shutdown()
 }
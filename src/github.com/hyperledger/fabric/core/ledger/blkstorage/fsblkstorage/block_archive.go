@@ -0,0 +1,275 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fsblkstorage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/blkstorage"
+	"github.com/hyperledger/fabric/core/ledger/util"
+)
+
+const archiveSuffix = ".gz"
+
+var (
+	archiveInfoKey = []byte("blkMgrArchiveInfo")
+)
+
+/*
+Archival works on whole block files. The files before firstFileAvailable have been
+compressed into the archive dir and removed from the block files dir, they hold exactly
+the blocks before firstBlockAvailable. The file currently written to is never archived.
+The index keeps its entries for archived blocks, so a request for one of them can name
+the archive that holds it instead of failing on a missing file.
+*/
+type archiveInfo struct {
+	firstFileAvailable  int
+	firstBlockAvailable uint64
+}
+
+func (mgr *blockfileMgr) loadArchiveInfo() (*archiveInfo, error) {
+	b, err := mgr.db.Get(archiveInfoKey)
+	if err != nil {
+		return nil, err
+	}
+	i := &archiveInfo{firstFileAvailable: 0, firstBlockAvailable: 1}
+	if b == nil {
+		return i, nil
+	}
+	if err = i.unmarshal(b); err != nil {
+		return nil, err
+	}
+	logger.Debugf("loaded archiveInfo:%s", i)
+	// A crash after the archive info was saved may have left archived files behind
+	for fileNum := 0; fileNum < i.firstFileAvailable; fileNum++ {
+		os.Remove(deriveBlockfilePath(mgr.rootDir, fileNum))
+	}
+	return i, nil
+}
+
+func (mgr *blockfileMgr) getFirstAvailableBlockNumber() uint64 {
+	mgr.archiveLock.RLock()
+	defer mgr.archiveLock.RUnlock()
+	return mgr.archiveInfo.firstBlockAvailable
+}
+
+// checkArchived returns a `BlockArchivedErr` if lp points into an archived file.
+// The caller holds archiveLock for reading while it reads from the file
+func (mgr *blockfileMgr) checkArchived(lp *fileLocPointer) error {
+	if lp.fileSuffixNum >= mgr.archiveInfo.firstFileAvailable {
+		return nil
+	}
+	return &blkstorage.BlockArchivedErr{
+		Archive:             deriveArchivePath(mgr.conf.archiveDir, lp.fileSuffixNum),
+		FirstAvailableBlock: mgr.archiveInfo.firstBlockAvailable}
+}
+
+// archiveBlocksBefore archives the block files that hold only blocks before blockNum
+func (mgr *blockfileMgr) archiveBlocksBefore(blockNum uint64) error {
+	mgr.archiveOpLock.Lock()
+	defer mgr.archiveOpLock.Unlock()
+	current := mgr.archiveInfo
+	if lastBlockNum := mgr.getBlockchainInfo().Height; blockNum > lastBlockNum {
+		blockNum = lastBlockNum
+	}
+	if blockNum <= current.firstBlockAvailable {
+		return nil
+	}
+	lp, err := mgr.index.getBlockLocByBlockNum(blockNum)
+	if err != nil {
+		return err
+	}
+	if lp.fileSuffixNum <= current.firstFileAvailable {
+		logger.Debugf("Block [%d] is in the first available file, nothing to archive", blockNum)
+		return nil
+	}
+	firstBlock, err := mgr.firstBlockInFile(lp.fileSuffixNum, current.firstBlockAvailable, blockNum)
+	if err != nil {
+		return err
+	}
+	if _, err = util.CreateDirIfMissing(mgr.conf.archiveDir); err != nil {
+		return err
+	}
+	for fileNum := current.firstFileAvailable; fileNum < lp.fileSuffixNum; fileNum++ {
+		logger.Infof("Archiving block file [%d]", fileNum)
+		if err = copyFile(deriveBlockfilePath(mgr.rootDir, fileNum), deriveArchivePath(mgr.conf.archiveDir, fileNum), true); err != nil {
+			return err
+		}
+	}
+
+	newInfo := &archiveInfo{firstFileAvailable: lp.fileSuffixNum, firstBlockAvailable: firstBlock}
+	if err = mgr.saveArchiveInfo(newInfo); err != nil {
+		return err
+	}
+	for fileNum := current.firstFileAvailable; fileNum < lp.fileSuffixNum; fileNum++ {
+		if err = os.Remove(deriveBlockfilePath(mgr.rootDir, fileNum)); err != nil {
+			return err
+		}
+	}
+	logger.Infof("Archived blocks [%d] to [%d]", current.firstBlockAvailable, firstBlock-1)
+	return nil
+}
+
+// restoreArchivedBlocks brings back the archived block files so that the blocks from startNum on are available
+func (mgr *blockfileMgr) restoreArchivedBlocks(startNum uint64) error {
+	mgr.archiveOpLock.Lock()
+	defer mgr.archiveOpLock.Unlock()
+	current := mgr.archiveInfo
+	if startNum == 0 {
+		startNum = 1
+	}
+	if startNum >= current.firstBlockAvailable {
+		return nil
+	}
+	lp, err := mgr.index.getBlockLocByBlockNum(startNum)
+	if err != nil {
+		return err
+	}
+	firstBlock, err := mgr.firstBlockInFile(lp.fileSuffixNum, 1, startNum)
+	if err != nil {
+		return err
+	}
+	for fileNum := lp.fileSuffixNum; fileNum < current.firstFileAvailable; fileNum++ {
+		logger.Infof("Restoring block file [%d]", fileNum)
+		if err = copyFile(deriveArchivePath(mgr.conf.archiveDir, fileNum), deriveBlockfilePath(mgr.rootDir, fileNum), false); err != nil {
+			return err
+		}
+	}
+
+	newInfo := &archiveInfo{firstFileAvailable: lp.fileSuffixNum, firstBlockAvailable: firstBlock}
+	if err = mgr.saveArchiveInfo(newInfo); err != nil {
+		return err
+	}
+	for fileNum := lp.fileSuffixNum; fileNum < current.firstFileAvailable; fileNum++ {
+		if err = os.Remove(deriveArchivePath(mgr.conf.archiveDir, fileNum)); err != nil {
+			return err
+		}
+	}
+	logger.Infof("Restored blocks [%d] to [%d]", firstBlock, current.firstBlockAvailable-1)
+	return nil
+}
+
+// firstBlockInFile searches [low, high] for the first block stored in fileNum or a later file.
+// Block high must be stored in fileNum or a later file
+func (mgr *blockfileMgr) firstBlockInFile(fileNum int, low uint64, high uint64) (uint64, error) {
+	for low < high {
+		mid := low + (high-low)/2
+		lp, err := mgr.index.getBlockLocByBlockNum(mid)
+		if err != nil {
+			return 0, err
+		}
+		if lp.fileSuffixNum >= fileNum {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low, nil
+}
+
+// saveArchiveInfo persists the archive info before it is used, readers see the files of the new info only
+func (mgr *blockfileMgr) saveArchiveInfo(i *archiveInfo) error {
+	b, err := i.marshal()
+	if err != nil {
+		return err
+	}
+	mgr.archiveLock.Lock()
+	defer mgr.archiveLock.Unlock()
+	if err = mgr.db.Put(archiveInfoKey, b, true); err != nil {
+		return err
+	}
+	mgr.archiveInfo = i
+	return nil
+}
+
+func deriveArchivePath(archiveDir string, suffixNum int) string {
+	return archiveDir + "/" + blockfilePrefix + fmt.Sprintf("%06d", suffixNum) + archiveSuffix
+}
+
+// copyFile copies src to dst through a temporary file, compressing or decompressing it. dst is complete or absent
+func copyFile(src string, dst string, compress bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if compress {
+		zw := gzip.NewWriter(out)
+		if _, err = io.Copy(zw, in); err != nil {
+			return err
+		}
+		err = zw.Close()
+	} else {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(in); err != nil {
+			return err
+		}
+		_, err = io.Copy(out, zr)
+	}
+	if err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func (i *archiveInfo) marshal() ([]byte, error) {
+	buffer := proto.NewBuffer([]byte{})
+	var err error
+	if err = buffer.EncodeVarint(uint64(i.firstFileAvailable)); err != nil {
+		return nil, err
+	}
+	if err = buffer.EncodeVarint(i.firstBlockAvailable); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (i *archiveInfo) unmarshal(b []byte) error {
+	buffer := proto.NewBuffer(b)
+	var val uint64
+	var err error
+
+	if val, err = buffer.DecodeVarint(); err != nil {
+		return err
+	}
+	i.firstFileAvailable = int(val)
+
+	if val, err = buffer.DecodeVarint(); err != nil {
+		return err
+	}
+	i.firstBlockAvailable = val
+
+	return nil
+}
+
+func (i *archiveInfo) String() string {
+	return fmt.Sprintf("firstFileAvailable=[%d], firstBlockAvailable=[%d]", i.firstFileAvailable, i.firstBlockAvailable)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fsblkstorage
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/blkstorage"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/core/ledger/util"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// newTestEnvWithBlocksPerFile sizes the block files so that each holds blocksPerFile of the test blocks
+func newTestEnvWithBlocksPerFile(t *testing.T, blocks []*pb.Block2, blocksPerFile int) *testEnv {
+	env := newTestEnv(t)
+	serBlock, err := pb.ConstructSerBlock2(blocks[0])
+	testutil.AssertNoError(t, err, "Error while getting bytes from block")
+	blockSize := len(serBlock.GetBytes()) + len(proto.EncodeVarint(uint64(len(serBlock.GetBytes()))))
+	env.conf.maxBlockfileSize = blockSize * blocksPerFile
+	return env
+}
+
+func assertArchived(t *testing.T, err error, archiveFileNum int, firstAvailableBlock uint64, env *testEnv) {
+	archivedErr, ok := err.(*blkstorage.BlockArchivedErr)
+	if !ok {
+		t.Fatalf("Expected a BlockArchivedErr, got %v", err)
+	}
+	testutil.AssertEquals(t, archivedErr.Archive, deriveArchivePath(env.conf.archiveDir, archiveFileNum))
+	testutil.AssertEquals(t, archivedErr.FirstAvailableBlock, firstAvailableBlock)
+}
+
+func TestBlockfileMgrArchiveAndRestore(t *testing.T) {
+	blocks := testutil.ConstructTestBlocks(t, 10)
+	env := newTestEnvWithBlocksPerFile(t, blocks, 3)
+	defer env.Cleanup()
+	blkfileMgrWrapper := newTestBlockfileWrapper(t, env)
+	blkfileMgrWrapper.addBlocks(blocks)
+	mgr := blkfileMgrWrapper.blockfileMgr
+	testutil.AssertEquals(t, mgr.cpInfo.latestFileChunkSuffixNum, 3)
+
+	// Block 8 is in the third file, the first two files hold blocks 1 to 6
+	testutil.AssertNoError(t, mgr.archiveBlocksBefore(8), "Error while archiving blocks")
+	testutil.AssertEquals(t, mgr.getFirstAvailableBlockNumber(), uint64(7))
+	for fileNum := 0; fileNum < 2; fileNum++ {
+		exists, _, _ := util.FileExists(deriveBlockfilePath(mgr.rootDir, fileNum))
+		testutil.AssertEquals(t, exists, false)
+		exists, _, _ = util.FileExists(deriveArchivePath(env.conf.archiveDir, fileNum))
+		testutil.AssertEquals(t, exists, true)
+	}
+
+	_, err := mgr.retrieveBlockByNumber(1)
+	assertArchived(t, err, 0, 7, env)
+	_, err = mgr.retrieveBlockByHash(testutil.ComputeBlockHash(t, blocks[4]))
+	assertArchived(t, err, 1, 7, env)
+	_, err = mgr.retrieveTransactionByBlockNumTranNum(6, 0)
+	assertArchived(t, err, 1, 7, env)
+	itr, _ := mgr.retrieveBlocks(1)
+	_, err = itr.Next()
+	assertArchived(t, err, 0, 7, env)
+	itr.Close()
+	blkfileMgrWrapper.testGetBlockByNumber(blocks[6:], 7)
+
+	// Archiving does not go back and does not touch the current file
+	testutil.AssertNoError(t, mgr.archiveBlocksBefore(3), "Error while archiving blocks")
+	testutil.AssertNoError(t, mgr.archiveBlocksBefore(100), "Error while archiving blocks")
+	testutil.AssertEquals(t, mgr.getFirstAvailableBlockNumber(), uint64(10))
+	blkfileMgrWrapper.testGetBlockByNumber(blocks[9:], 10)
+
+	// The archive info survives a restart
+	blkfileMgrWrapper.close()
+	blkfileMgrWrapper = newTestBlockfileWrapper(t, env)
+	defer blkfileMgrWrapper.close()
+	mgr = blkfileMgrWrapper.blockfileMgr
+	testutil.AssertEquals(t, mgr.getFirstAvailableBlockNumber(), uint64(10))
+	_, err = mgr.retrieveBlockByNumber(8)
+	assertArchived(t, err, 2, 10, env)
+
+	// Restoring block 5 brings back the files from the second one on
+	testutil.AssertNoError(t, mgr.restoreArchivedBlocks(5), "Error while restoring blocks")
+	testutil.AssertEquals(t, mgr.getFirstAvailableBlockNumber(), uint64(4))
+	blkfileMgrWrapper.testGetBlockByNumber(blocks[3:], 4)
+	_, err = mgr.retrieveBlockByNumber(3)
+	assertArchived(t, err, 0, 4, env)
+
+	testutil.AssertNoError(t, mgr.restoreArchivedBlocks(1), "Error while restoring blocks")
+	testutil.AssertEquals(t, mgr.getFirstAvailableBlockNumber(), uint64(1))
+	blkfileMgrWrapper.testGetBlockByNumber(blocks, 1)
+	blkfileMgrWrapper.testGetBlockByHash(blocks)
+	exists, _, _ := util.FileExists(deriveArchivePath(env.conf.archiveDir, 0))
+	testutil.AssertEquals(t, exists, false)
+
+	// New blocks are added after a restore
+	moreBlocks := testutil.ConstructTestBlocks(t, 2)
+	blkfileMgrWrapper.addBlocks(moreBlocks)
+	blkfileMgrWrapper.testGetBlockByNumber(moreBlocks, 11)
+}
+
+func TestBlockfileMgrArchiveSingleFile(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Cleanup()
+	blkfileMgrWrapper := newTestBlockfileWrapper(t, env)
+	defer blkfileMgrWrapper.close()
+	mgr := blkfileMgrWrapper.blockfileMgr
+	testutil.AssertNoError(t, mgr.archiveBlocksBefore(5), "Error while archiving an empty store")
+
+	blocks := testutil.ConstructTestBlocks(t, 5)
+	blkfileMgrWrapper.addBlocks(blocks)
+	testutil.AssertNoError(t, mgr.archiveBlocksBefore(5), "Error while archiving blocks")
+	testutil.AssertEquals(t, mgr.getFirstAvailableBlockNumber(), uint64(1))
+	blkfileMgrWrapper.testGetBlockByNumber(blocks, 1)
+}
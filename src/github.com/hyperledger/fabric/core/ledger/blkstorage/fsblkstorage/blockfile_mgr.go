@@ -50,6 +50,9 @@ type blockfileMgr struct {
 	cpInfoCond        *sync.Cond
 	currentFileWriter *blockfileWriter
 	bcInfo            atomic.Value
+	archiveInfo       *archiveInfo
+	archiveLock       sync.RWMutex
+	archiveOpLock     sync.Mutex
 }
 
 /*
@@ -105,6 +108,12 @@ func newBlockfileMgr(conf *Conf, indexConfig *blkstorage.IndexConfig) *blockfile
 	// Instantiate the manager, i.e. blockFileMgr structure
 	mgr := &blockfileMgr{rootDir: rootDir, conf: conf, db: db}
 
+	// The files before the first available one have been moved to the archive dir by archiveBlocksBefore
+	mgr.archiveInfo, err = mgr.loadArchiveInfo()
+	if err != nil {
+		panic(fmt.Sprintf("Could not get archive info from db: %s", err))
+	}
+
 	// cp = checkpointInfo, retrieve from the database the file suffix or number of where blocks were stored.
 	// It also retrieves the current size of that file and the last block number that was written to that file.
 	// At init checkpointInfo:latestFileChunkSuffixNum=[0], latestFileChunksize=[0], lastBlockNumber=[0]
@@ -365,8 +374,9 @@ func (mgr *blockfileMgr) syncIndex() error {
 		if txOffsets, err = serBlock2.GetTxOffsets(); err != nil {
 			return err
 		}
+		// shift the txoffset because we prepend length of bytes before block bytes, the index adds the block offset
 		for i := 0; i < len(txOffsets); i++ {
-			txOffsets[i] += int(blockPlacementInfo.blockBytesOffset)
+			txOffsets[i] += int(blockPlacementInfo.blockBytesOffset - blockPlacementInfo.blockStartOffset)
 		}
 		//Update the blockIndexInfo with what was actually stored in file system
 		blockIdxInfo := &blockIdxInfo{}
@@ -445,6 +455,17 @@ func (mgr *blockfileMgr) retrieveTransactionByID(txID string) (*pb.Transaction2,
 	return mgr.fetchTransaction(loc)
 }
 
+// retrieveTransactionByBlockNumTranNum looks the transaction up in the txID index, which is keyed by block and
+// transaction number, see constructTxID
+func (mgr *blockfileMgr) retrieveTransactionByBlockNumTranNum(blockNum uint64, tranNum uint64) (*pb.Transaction2, error) {
+	logger.Debugf("retrieveTransactionByBlockNumTranNum() - blockNum = [%d], tranNum = [%d]", blockNum, tranNum)
+	loc, err := mgr.index.getTxLoc(constructTxID(blockNum, int(tranNum)))
+	if err != nil {
+		return nil, err
+	}
+	return mgr.fetchTransaction(loc)
+}
+
 func (mgr *blockfileMgr) fetchBlock(lp *fileLocPointer) (*pb.Block2, error) {
 	serBlock, err := mgr.fetchSerBlock(lp)
 	if err != nil {
@@ -479,6 +500,11 @@ func (mgr *blockfileMgr) fetchTransaction(lp *fileLocPointer) (*pb.Transaction2,
 }
 
 func (mgr *blockfileMgr) fetchBlockBytes(lp *fileLocPointer) ([]byte, error) {
+	mgr.archiveLock.RLock()
+	defer mgr.archiveLock.RUnlock()
+	if err := mgr.checkArchived(lp); err != nil {
+		return nil, err
+	}
 	stream, err := newBlockfileStream(mgr.rootDir, lp.fileSuffixNum, int64(lp.offset))
 	if err != nil {
 		return nil, err
@@ -492,6 +518,11 @@ func (mgr *blockfileMgr) fetchBlockBytes(lp *fileLocPointer) ([]byte, error) {
 }
 
 func (mgr *blockfileMgr) fetchRawBytes(lp *fileLocPointer) ([]byte, error) {
+	mgr.archiveLock.RLock()
+	defer mgr.archiveLock.RUnlock()
+	if err := mgr.checkArchived(lp); err != nil {
+		return nil, err
+	}
 	filePath := deriveBlockfilePath(mgr.rootDir, lp.fileSuffixNum)
 	reader, err := newBlockfileReader(filePath)
 	if err != nil {
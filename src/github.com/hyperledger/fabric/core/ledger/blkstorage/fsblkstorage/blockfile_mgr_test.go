@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/blkstorage"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -156,6 +157,28 @@ func TestBlockfileMgrGetTxById(t *testing.T) {
 	}
 }
 
+func TestBlockfileMgrGetTxByBlockNumTranNum(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Cleanup()
+	blkfileMgrWrapper := newTestBlockfileWrapper(t, env)
+	defer blkfileMgrWrapper.close()
+	blocks := testutil.ConstructTestBlocks(t, 10)
+	blkfileMgrWrapper.addBlocks(blocks)
+	for i, blk := range blocks {
+		for j, txBytes := range blk.Transactions {
+			// blockNum starts with 1
+			txFromFileMgr, err := blkfileMgrWrapper.blockfileMgr.retrieveTransactionByBlockNumTranNum(uint64(i+1), uint64(j))
+			testutil.AssertNoError(t, err, "Error while retrieving tx from blkfileMgr")
+			tx := &pb.Transaction2{}
+			err = proto.Unmarshal(txBytes, tx)
+			testutil.AssertNoError(t, err, "Error while unmarshalling tx")
+			testutil.AssertEquals(t, txFromFileMgr, tx)
+		}
+	}
+	_, err := blkfileMgrWrapper.blockfileMgr.retrieveTransactionByBlockNumTranNum(11, 0)
+	testutil.AssertEquals(t, err, blkstorage.ErrNotFoundInIndex)
+}
+
 func TestBlockfileMgrRestart(t *testing.T) {
 	env := newTestEnv(t)
 	defer env.Cleanup()
@@ -168,6 +191,16 @@ func TestBlockfileMgrRestart(t *testing.T) {
 	defer blkfileMgrWrapper.close()
 	testutil.AssertEquals(t, int(blkfileMgrWrapper.blockfileMgr.cpInfo.lastBlockNumber), 10)
 	blkfileMgrWrapper.testGetBlockByHash(blocks)
+
+	// The last block is indexed again on restart, its transactions must still be found
+	for j, txBytes := range blocks[9].Transactions {
+		txFromFileMgr, err := blkfileMgrWrapper.blockfileMgr.retrieveTransactionByBlockNumTranNum(10, uint64(j))
+		testutil.AssertNoError(t, err, "Error while retrieving tx from blkfileMgr")
+		tx := &pb.Transaction2{}
+		err = proto.Unmarshal(txBytes, tx)
+		testutil.AssertNoError(t, err, "Error while unmarshalling tx")
+		testutil.AssertEquals(t, txFromFileMgr, tx)
+	}
 }
 
 func TestBlockfileMgrFileRolling(t *testing.T) {
@@ -77,6 +77,11 @@ func (itr *BlocksItr) initStream() error {
 	if lp, err = itr.mgr.index.getBlockLocByBlockNum(itr.blockNumToRetrieve); err != nil {
 		return err
 	}
+	itr.mgr.archiveLock.RLock()
+	defer itr.mgr.archiveLock.RUnlock()
+	if err = itr.mgr.checkArchived(lp); err != nil {
+		return err
+	}
 	if itr.stream, err = newBlockStream(itr.mgr.rootDir, lp.fileSuffixNum, int64(lp.offset), -1); err != nil {
 		return err
 	}
@@ -120,5 +125,8 @@ func (itr *BlocksItr) Close() {
 	itr.mgr.cpInfoCond.L.Lock()
 	defer itr.mgr.cpInfoCond.L.Unlock()
 	itr.mgr.cpInfoCond.Broadcast()
-	itr.stream.close()
+	// the stream is opened by the first call to Next
+	if itr.stream != nil {
+		itr.stream.close()
+	}
 }
@@ -26,6 +26,7 @@ const (
 type Conf struct {
 	blockfilesDir    string
 	dbPath           string
+	archiveDir       string
 	maxBlockfileSize int
 }
 
@@ -38,5 +39,5 @@ func NewConf(filesystemPath string, maxBlockfileSize int) *Conf {
 	if maxBlockfileSize <= 0 {
 		maxBlockfileSize = defaultMaxBlockfileSize
 	}
-	return &Conf{filesystemPath + "blocks", filesystemPath + "db", maxBlockfileSize}
+	return &Conf{filesystemPath + "blocks", filesystemPath + "db", filesystemPath + "archive", maxBlockfileSize}
 }
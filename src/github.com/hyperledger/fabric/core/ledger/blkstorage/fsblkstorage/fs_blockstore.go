@@ -68,6 +68,27 @@ func (store *FsBlockStore) RetrieveTxByID(txID string) (*pb.Transaction2, error)
 	return store.fileMgr.retrieveTransactionByID(txID)
 }
 
+// RetrieveTxByBlockNumTranNum returns the transaction at position tranNum of block blockNum
+func (store *FsBlockStore) RetrieveTxByBlockNumTranNum(blockNum uint64, tranNum uint64) (*pb.Transaction2, error) {
+	return store.fileMgr.retrieveTransactionByBlockNumTranNum(blockNum, tranNum)
+}
+
+// GetFirstAvailableBlockNumber returns the number of the first block that has not been archived
+func (store *FsBlockStore) GetFirstAvailableBlockNumber() uint64 {
+	return store.fileMgr.getFirstAvailableBlockNumber()
+}
+
+// ArchiveBlocksBefore compresses the block files that hold only blocks before blockNum into the archive dir.
+// The block file currently written to is never archived, so blocks before blockNum may stay available
+func (store *FsBlockStore) ArchiveBlocksBefore(blockNum uint64) error {
+	return store.fileMgr.archiveBlocksBefore(blockNum)
+}
+
+// RestoreArchivedBlocks brings back the archived block files holding the blocks from startNum on
+func (store *FsBlockStore) RestoreArchivedBlocks(startNum uint64) error {
+	return store.fileMgr.restoreArchivedBlocks(startNum)
+}
+
 // Shutdown shuts down the block store
 func (store *FsBlockStore) Shutdown() {
 	store.fileMgr.close()
@@ -41,6 +41,7 @@ func newTestEnv(t testing.TB) *testEnv {
 	}
 	os.RemoveAll(conf.dbPath)
 	os.RemoveAll(conf.blockfilesDir)
+	os.RemoveAll(conf.archiveDir)
 	return &testEnv{
 		conf:        conf,
 		indexConfig: &blkstorage.IndexConfig{AttrsToIndex: attrsToIndex}}
@@ -49,6 +50,7 @@ func newTestEnv(t testing.TB) *testEnv {
 func (env *testEnv) Cleanup() {
 	os.RemoveAll(env.conf.dbPath)
 	os.RemoveAll(env.conf.blockfilesDir)
+	os.RemoveAll(env.conf.archiveDir)
 }
 
 type testBlockfileMgrWrapper struct {
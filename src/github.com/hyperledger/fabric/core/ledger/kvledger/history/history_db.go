@@ -0,0 +1,287 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/blkstorage"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
+	"github.com/hyperledger/fabric/core/ledger/util"
+	"github.com/hyperledger/fabric/core/ledger/util/db"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	putils "github.com/hyperledger/fabric/protos/utils"
+	logging "github.com/op/go-logging"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
+var logger = logging.MustGetLogger("history")
+
+const (
+	historyKeyPrefix     = 'k'
+	savepointKeyStr      = "historySavepointKey"
+	maxDeletesInOneBatch = 1000
+)
+
+var savepointKey = []byte(savepointKeyStr)
+
+// Conf - configuration for `HistoryDB`
+type Conf struct {
+	DBPath string
+}
+
+// HistoryDB indexes, for every key, the transactions that wrote it. An entry holds only the block and
+// transaction number, the transaction and the value it wrote are read back from the block store
+type HistoryDB struct {
+	db         *db.DB
+	blockStore blkstorage.BlockStore
+}
+
+// NewHistoryDB constructs a `HistoryDB` for the blocks in blockStore
+func NewHistoryDB(conf *Conf, blockStore blkstorage.BlockStore) *HistoryDB {
+	db := db.CreateDB(&db.Conf{DBPath: conf.DBPath})
+	db.Open()
+	return &HistoryDB{db, blockStore}
+}
+
+// Commit indexes the writes of a block that has been added to the block store as block number blockNum.
+// Blocks that were added before and are missing from the index, e.g. after a crash, are indexed first
+func (h *HistoryDB) Commit(block *pb.Block2, blockNum uint64) error {
+	lastIndexed, err := h.GetLastBlockIndexed()
+	if err != nil {
+		return err
+	}
+	if blockNum <= lastIndexed {
+		logger.Debugf("Block [%d] is already indexed", blockNum)
+		return nil
+	}
+	if err = h.syncUpTo(lastIndexed, blockNum-1); err != nil {
+		return err
+	}
+	return h.indexBlock(block, blockNum)
+}
+
+// Sync indexes the blocks of the block store that are not in the index yet
+func (h *HistoryDB) Sync() error {
+	lastIndexed, err := h.GetLastBlockIndexed()
+	if err != nil {
+		return err
+	}
+	bcInfo, err := h.blockStore.GetBlockchainInfo()
+	if err != nil {
+		return err
+	}
+	return h.syncUpTo(lastIndexed, bcInfo.Height)
+}
+
+// Rebuild drops the index and builds it again from all the blocks in the block store.
+// The index is left untouched if blocks have been archived, they have to be restored first
+func (h *HistoryDB) Rebuild() error {
+	if bcInfo, err := h.blockStore.GetBlockchainInfo(); err != nil || bcInfo.Height == 0 {
+		return err
+	}
+	if _, err := h.blockStore.RetrieveBlockByNumber(1); err != nil {
+		return err
+	}
+	logger.Infof("Rebuilding the history index")
+	itr := h.db.GetIterator([]byte{historyKeyPrefix}, []byte{historyKeyPrefix + 1})
+	defer itr.Release()
+	batch := &leveldb.Batch{}
+	for itr.Next() {
+		batch.Delete(append([]byte(nil), itr.Key()...))
+		if batch.Len() == maxDeletesInOneBatch {
+			if err := h.db.WriteBatch(batch, false); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return err
+	}
+	batch.Delete(savepointKey)
+	if err := h.db.WriteBatch(batch, true); err != nil {
+		return err
+	}
+	return h.Sync()
+}
+
+// GetTransactionsForKey returns an iterator over the transactions that wrote the key, in commit order.
+// The returned ResultsIterator contains results of type *ledger.KeyModification
+func (h *HistoryDB) GetTransactionsForKey(namespace string, key string) (ledger.ResultsIterator, error) {
+	prefix := constructKeyPrefix(namespace, key)
+	dbItr := h.db.GetIterator(prefix, append(prefix, 0xff))
+	return &historyItr{h.blockStore, namespace, key, len(prefix), dbItr}, nil
+}
+
+// Shutdown closes the index
+func (h *HistoryDB) Shutdown() {
+	h.db.Close()
+}
+
+// GetLastBlockIndexed returns the number of the last block in the index, 0 if there is none
+func (h *HistoryDB) GetLastBlockIndexed() (uint64, error) {
+	blockNumBytes, err := h.db.Get(savepointKey)
+	if err != nil || len(blockNumBytes) == 0 {
+		return 0, err
+	}
+	blockNum, _ := util.DecodeOrderPreservingVarUint64(blockNumBytes)
+	return blockNum, nil
+}
+
+// syncUpTo indexes the blocks after lastIndexed up to and including blockNum from the block store
+func (h *HistoryDB) syncUpTo(lastIndexed uint64, blockNum uint64) error {
+	if lastIndexed < blockNum {
+		logger.Infof("Indexing history of blocks [%d] to [%d]", lastIndexed+1, blockNum)
+	}
+	for n := lastIndexed + 1; n <= blockNum; n++ {
+		block, err := h.blockStore.RetrieveBlockByNumber(n)
+		if err != nil {
+			return err
+		}
+		if err = h.indexBlock(block, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBlock adds an entry for every key written in the block and moves the savepoint in the same batch
+func (h *HistoryDB) indexBlock(block *pb.Block2, blockNum uint64) error {
+	logger.Debugf("Indexing history of block [%d] with [%d] transactions", blockNum, len(block.Transactions))
+	batch := &leveldb.Batch{}
+	for txNum, txBytes := range block.Transactions {
+		tx := &pb.Transaction2{}
+		if err := proto.Unmarshal(txBytes, tx); err != nil {
+			return err
+		}
+		txRWSet, err := getTxRWSet(tx)
+		if err != nil {
+			return err
+		}
+		for _, nsRWSet := range txRWSet.NsRWs {
+			for _, kvWrite := range nsRWSet.Writes {
+				batch.Put(constructHistoryKey(nsRWSet.NameSpace, kvWrite.Key, blockNum, uint64(txNum)), []byte{})
+			}
+		}
+	}
+	batch.Put(savepointKey, util.EncodeOrderPreservingVarUint64(blockNum))
+	return h.db.WriteBatch(batch, false)
+}
+
+// getTxRWSet extracts the read-write set from a transaction the way the transaction manager does at validation
+func getTxRWSet(tx *pb.Transaction2) (*txmgmt.TxReadWriteSet, error) {
+	if len(tx.Actions) != 1 {
+		return nil, fmt.Errorf("Tx contains [%d] TransactionActions, expected one", len(tx.Actions))
+	}
+	_, respPayload, err := putils.GetPayloads(tx.Actions[0])
+	if err != nil {
+		return nil, err
+	}
+	txRWSet := &txmgmt.TxReadWriteSet{}
+	if err = txRWSet.Unmarshal(respPayload.Results); err != nil {
+		return nil, err
+	}
+	return txRWSet, nil
+}
+
+// constructKeyPrefix prefixes namespace and key with their lengths, so that a key containing the bytes
+// of another key's suffix can not fall into its range
+func constructKeyPrefix(namespace string, key string) []byte {
+	prefix := []byte{historyKeyPrefix}
+	prefix = append(prefix, util.EncodeOrderPreservingVarUint64(uint64(len(namespace)))...)
+	prefix = append(prefix, []byte(namespace)...)
+	prefix = append(prefix, util.EncodeOrderPreservingVarUint64(uint64(len(key)))...)
+	return append(prefix, []byte(key)...)
+}
+
+func constructHistoryKey(namespace string, key string, blockNum uint64, txNum uint64) []byte {
+	historyKey := constructKeyPrefix(namespace, key)
+	historyKey = append(historyKey, util.EncodeOrderPreservingVarUint64(blockNum)...)
+	return append(historyKey, util.EncodeOrderPreservingVarUint64(txNum)...)
+}
+
+func splitHistoryKeySuffix(suffix []byte) (uint64, uint64, error) {
+	blockNum, n, err := decodeVarUint64(suffix)
+	if err != nil {
+		return 0, 0, err
+	}
+	txNum, m, err := decodeVarUint64(suffix[n:])
+	if err != nil {
+		return 0, 0, err
+	}
+	if n+m != len(suffix) {
+		return 0, 0, fmt.Errorf("Malformed history key suffix [%#v]", suffix)
+	}
+	return blockNum, txNum, nil
+}
+
+// decodeVarUint64 checks the length before decoding, util.DecodeOrderPreservingVarUint64 panics on short input
+func decodeVarUint64(b []byte) (uint64, int, error) {
+	if len(b) == 0 || int(b[0]) > 8 || len(b) < int(b[0])+1 {
+		return 0, 0, fmt.Errorf("Malformed history key suffix [%#v]", b)
+	}
+	number, n := util.DecodeOrderPreservingVarUint64(b)
+	return number, n, nil
+}
+
+type historyItr struct {
+	blockStore blkstorage.BlockStore
+	namespace  string
+	key        string
+	prefixLen  int
+	dbItr      iterator.Iterator
+}
+
+// Next implements Next() method in ledger.ResultsIterator
+func (itr *historyItr) Next() (ledger.QueryResult, error) {
+	if !itr.dbItr.Next() {
+		return nil, itr.dbItr.Error()
+	}
+	blockNum, txNum, err := splitHistoryKeySuffix(itr.dbItr.Key()[itr.prefixLen:])
+	if err != nil {
+		return nil, err
+	}
+	tx, err := itr.blockStore.RetrieveTxByBlockNumTranNum(blockNum, txNum)
+	if err != nil {
+		return nil, err
+	}
+	txRWSet, err := getTxRWSet(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, nsRWSet := range txRWSet.NsRWs {
+		if nsRWSet.NameSpace != itr.namespace {
+			continue
+		}
+		for _, kvWrite := range nsRWSet.Writes {
+			if kvWrite.Key == itr.key {
+				return &ledger.KeyModification{BlockNumber: blockNum, TxNumber: txNum, Transaction: tx,
+					Value: kvWrite.Value, IsDelete: kvWrite.IsDelete}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Transaction [%d:%d] does not write key [%s] in namespace [%s]", blockNum, txNum, itr.key, itr.namespace)
+}
+
+// Close implements Close() method in ledger.ResultsIterator
+func (itr *historyItr) Close() {
+	itr.dbItr.Release()
+}
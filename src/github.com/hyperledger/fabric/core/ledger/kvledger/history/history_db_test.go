@@ -0,0 +1,147 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+type expectedModification struct {
+	blockNum uint64
+	txNum    uint64
+	value    []byte
+}
+
+func (env *testEnv) assertHistory(ns string, key string, expected []expectedModification) {
+	itr, err := env.historyDB.GetTransactionsForKey(ns, key)
+	testutil.AssertNoError(env.t, err, "Error while getting history")
+	defer itr.Close()
+	for _, e := range expected {
+		result, err := itr.Next()
+		testutil.AssertNoError(env.t, err, "Error while iterating history")
+		testutil.AssertNotNil(env.t, result)
+		km := result.(*ledger.KeyModification)
+		testutil.AssertEquals(env.t, km.BlockNumber, e.blockNum)
+		testutil.AssertEquals(env.t, km.TxNumber, e.txNum)
+		testutil.AssertEquals(env.t, km.Value, e.value)
+		testutil.AssertEquals(env.t, km.IsDelete, e.value == nil)
+		tx, err := env.blockStore.RetrieveTxByBlockNumTranNum(e.blockNum, e.txNum)
+		testutil.AssertNoError(env.t, err, "Error while retrieving tx")
+		testutil.AssertEquals(env.t, km.Transaction, tx)
+	}
+	result, err := itr.Next()
+	testutil.AssertNoError(env.t, err, "Error while iterating history")
+	testutil.AssertNil(env.t, result)
+}
+
+func (env *testEnv) addTestBlocks() {
+	block, blockNum := env.addBlock(
+		writes("ns1", txmgmt.NewKVWrite("key1", []byte("value1")), txmgmt.NewKVWrite("key2", []byte("value2"))),
+		writes("ns2", txmgmt.NewKVWrite("key1", []byte("ns2value1"))))
+	testutil.AssertNoError(env.t, env.historyDB.Commit(block, blockNum), "")
+	block, blockNum = env.addBlock(
+		writes("ns1", txmgmt.NewKVWrite("key10", []byte("value10"))),
+		writes("ns1", txmgmt.NewKVWrite("key1", []byte("value1-2"))))
+	testutil.AssertNoError(env.t, env.historyDB.Commit(block, blockNum), "")
+	block, blockNum = env.addBlock(
+		writes("ns1", txmgmt.NewKVWrite("key1", nil)))
+	testutil.AssertNoError(env.t, env.historyDB.Commit(block, blockNum), "")
+}
+
+func (env *testEnv) assertTestBlocksHistory() {
+	env.assertHistory("ns1", "key1", []expectedModification{
+		{1, 0, []byte("value1")},
+		{2, 1, []byte("value1-2")},
+		{3, 0, nil},
+	})
+	env.assertHistory("ns1", "key2", []expectedModification{{1, 0, []byte("value2")}})
+	env.assertHistory("ns1", "key10", []expectedModification{{2, 0, []byte("value10")}})
+	env.assertHistory("ns2", "key1", []expectedModification{{1, 1, []byte("ns2value1")}})
+	env.assertHistory("ns1", "key", nil)
+	env.assertHistory("ns", "1key1", nil)
+}
+
+func TestHistoryCommit(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	env.addTestBlocks()
+	env.assertTestBlocksHistory()
+
+	// Committing a block again does not add entries
+	block, _ := env.blockStore.RetrieveBlockByNumber(2)
+	testutil.AssertNoError(t, env.historyDB.Commit(block, 2), "")
+	env.assertTestBlocksHistory()
+}
+
+func TestHistoryCatchUp(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	env.addBlock(writes("ns1", txmgmt.NewKVWrite("key1", []byte("value1"))))
+	env.addBlock(writes("ns1", txmgmt.NewKVWrite("key1", []byte("value2"))))
+
+	// The blocks missing from the index are indexed before the committed one
+	block, blockNum := env.addBlock(writes("ns1", txmgmt.NewKVWrite("key1", []byte("value3"))))
+	testutil.AssertNoError(t, env.historyDB.Commit(block, blockNum), "")
+	env.assertHistory("ns1", "key1", []expectedModification{
+		{1, 0, []byte("value1")},
+		{2, 0, []byte("value2")},
+		{3, 0, []byte("value3")},
+	})
+
+	// Sync indexes blocks added while the index was closed
+	env.historyDB.Shutdown()
+	env.addBlock(writes("ns1", txmgmt.NewKVWrite("key1", []byte("value4"))))
+	env.close()
+	env.open()
+	testutil.AssertNoError(t, env.historyDB.Sync(), "")
+	env.assertHistory("ns1", "key1", []expectedModification{
+		{1, 0, []byte("value1")},
+		{2, 0, []byte("value2")},
+		{3, 0, []byte("value3")},
+		{4, 0, []byte("value4")},
+	})
+}
+
+func TestHistoryRebuild(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	env.addTestBlocks()
+
+	// A stale entry is dropped by the rebuild
+	env.historyDB.db.Put(constructHistoryKey("ns1", "key2", 3, 0), []byte{}, false)
+	testutil.AssertNoError(t, env.historyDB.Rebuild(), "")
+	env.assertTestBlocksHistory()
+	lastIndexed, _ := env.historyDB.GetLastBlockIndexed()
+	testutil.AssertEquals(t, lastIndexed, uint64(3))
+}
+
+func TestHistoryKeyEncoding(t *testing.T) {
+	historyKey := constructHistoryKey("ns1", "key1", 300, 7)
+	blockNum, txNum, err := splitHistoryKeySuffix(historyKey[len(constructKeyPrefix("ns1", "key1")):])
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertEquals(t, blockNum, uint64(300))
+	testutil.AssertEquals(t, txNum, uint64(7))
+
+	_, _, err = splitHistoryKeySuffix([]byte{0x09})
+	testutil.AssertError(t, err, "Expected an error for a malformed suffix")
+	_, _, err = splitHistoryKeySuffix(append(historyKey, 0x00))
+	testutil.AssertError(t, err, "Expected an error for a malformed suffix")
+}
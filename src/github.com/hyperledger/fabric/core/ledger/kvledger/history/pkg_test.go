@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/blkstorage"
+	"github.com/hyperledger/fabric/core/ledger/blkstorage/fsblkstorage"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const testPath = "/tmp/tests/ledger/kvledger/history"
+
+type testEnv struct {
+	t          *testing.T
+	blockStore *fsblkstorage.FsBlockStore
+	historyDB  *HistoryDB
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	os.RemoveAll(testPath)
+	env := &testEnv{t: t}
+	env.open()
+	return env
+}
+
+func (env *testEnv) open() {
+	attrsToIndex := []blkstorage.IndexableAttr{
+		blkstorage.IndexableAttrBlockNum,
+		blkstorage.IndexableAttrTxID,
+	}
+	env.blockStore = fsblkstorage.NewFsBlockStore(fsblkstorage.NewConf(testPath+"/blocks", 0),
+		&blkstorage.IndexConfig{AttrsToIndex: attrsToIndex})
+	env.historyDB = NewHistoryDB(&Conf{DBPath: testPath + "/db"}, env.blockStore)
+}
+
+func (env *testEnv) close() {
+	env.historyDB.Shutdown()
+	env.blockStore.Shutdown()
+}
+
+func (env *testEnv) cleanup() {
+	env.close()
+	os.RemoveAll(testPath)
+}
+
+// addBlock adds a block with one transaction per write set to the block store and returns it with its number
+func (env *testEnv) addBlock(txWrites ...[]*txmgmt.NsReadWriteSet) (*pb.Block2, uint64) {
+	simulationResults := [][]byte{}
+	for _, nsRWs := range txWrites {
+		simRes, err := (&txmgmt.TxReadWriteSet{NsRWs: nsRWs}).Marshal()
+		testutil.AssertNoError(env.t, err, "Error while marshalling read-write set")
+		simulationResults = append(simulationResults, simRes)
+	}
+	block := testutil.ConstructBlockForSimulationResults(env.t, simulationResults)
+	testutil.AssertNoError(env.t, env.blockStore.AddBlock(block), "Error while adding block")
+	bcInfo, _ := env.blockStore.GetBlockchainInfo()
+	return block, bcInfo.Height
+}
+
+func writes(ns string, kvWrites ...*txmgmt.KVWrite) []*txmgmt.NsReadWriteSet {
+	return []*txmgmt.NsReadWriteSet{&txmgmt.NsReadWriteSet{NameSpace: ns, Writes: kvWrites}}
+}
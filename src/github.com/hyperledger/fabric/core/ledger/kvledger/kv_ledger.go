@@ -24,6 +24,7 @@ import (
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/ledger/blkstorage"
 	"github.com/hyperledger/fabric/core/ledger/blkstorage/fsblkstorage"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/history"
 	"github.com/hyperledger/fabric/core/ledger/kvledger/kvledgerconfig"
 	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
 	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/couchdbtxmgmt"
@@ -41,8 +42,13 @@ type Conf struct {
 	blockStorageDir  string
 	maxBlockfileSize int
 	txMgrDBPath      string
+	historyDBPath    string
+	couchDBName      string
 }
 
+// defaultCouchDBName is the CouchDB state database of a `KVLedger` that is not managed by the ledger manager
+const defaultCouchDBName = "system"
+
 // NewConf constructs new `Conf`.
 // filesystemPath is the top level directory under which `KVLedger` manages its data
 func NewConf(filesystemPath string, maxBlockfileSize int) *Conf {
@@ -51,7 +57,8 @@ func NewConf(filesystemPath string, maxBlockfileSize int) *Conf {
 	}
 	blocksStorageDir := filesystemPath + "blocks"
 	txMgrDBPath := filesystemPath + "txMgmgt/db"
-	return &Conf{blocksStorageDir, maxBlockfileSize, txMgrDBPath}
+	historyDBPath := filesystemPath + "history/db"
+	return &Conf{blocksStorageDir, maxBlockfileSize, txMgrDBPath, historyDBPath, defaultCouchDBName}
 }
 
 // KVLedger provides an implementation of `ledger.ValidatedLedger`.
@@ -59,6 +66,7 @@ func NewConf(filesystemPath string, maxBlockfileSize int) *Conf {
 type KVLedger struct {
 	blockStore           blkstorage.BlockStore
 	txtmgmt              txmgmt.TxMgr
+	historyDB            *history.HistoryDB
 	pendingBlockToCommit *pb.Block2
 }
 
@@ -76,6 +84,16 @@ func NewKVLedger(conf *Conf) (*KVLedger, error) {
 	blockStorageConf := fsblkstorage.NewConf(conf.blockStorageDir, conf.maxBlockfileSize)
 	blockStore := fsblkstorage.NewFsBlockStore(blockStorageConf, indexConfig)
 
+	// The history index may be behind the block store if the peer stopped between the two commits
+	historyDB := history.NewHistoryDB(&history.Conf{DBPath: conf.historyDBPath}, blockStore)
+	if err := historyDB.Sync(); err != nil {
+		historyDB.Shutdown()
+		blockStore.Shutdown()
+		return nil, err
+	}
+
+	var txmgr txmgmt.TxMgr
+
 	if kvledgerconfig.IsCouchDBEnabled() == true {
 		//By default we can talk to CouchDB with empty id and pw (""), or you can add your own id and password to talk to a secured CouchDB
 		logger.Debugf("===COUCHDB=== NewKVLedger() Using CouchDB instead of RocksDB...hardcoding and passing connection config for now")
@@ -83,18 +101,67 @@ func NewKVLedger(conf *Conf) (*KVLedger, error) {
 		couchDBDef := kvledgerconfig.GetCouchDBDefinition()
 
 		//create new transaction manager based on couchDB
-		txmgmt := couchdbtxmgmt.NewCouchDBTxMgr(&couchdbtxmgmt.Conf{DBPath: conf.txMgrDBPath},
+		txmgr = couchdbtxmgmt.NewCouchDBTxMgr(&couchdbtxmgmt.Conf{DBPath: conf.txMgrDBPath},
 			couchDBDef.URL,      //couchDB connection URL
-			"system",            //couchDB db name matches ledger name, TODO for now use system ledger, eventually allow passing in subledger name
+			conf.couchDBName,    //couchDB db name matches ledger name
 			couchDBDef.Username, //enter couchDB id here
 			couchDBDef.Password) //enter couchDB pw here
-		return &KVLedger{blockStore, txmgmt, nil}, nil
+	} else {
+		// Fall back to using RocksDB lockbased transaction manager
+		txmgr = lockbasedtxmgmt.NewLockBasedTxMgr(&lockbasedtxmgmt.Conf{DBPath: conf.txMgrDBPath})
 	}
+	txmgr.SetHistoryReader(historyDB)
+	l := &KVLedger{blockStore, txmgr, historyDB, nil}
 
-	// Fall back to using RocksDB lockbased transaction manager
-	txmgmt := lockbasedtxmgmt.NewLockBasedTxMgr(&lockbasedtxmgmt.Conf{DBPath: conf.txMgrDBPath})
-	return &KVLedger{blockStore, txmgmt, nil}, nil
+	if err := l.recoverStateDB(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
 
+// recoverStateDB replays the blocks that are in the block store but not in the state database,
+// which happens if the peer stopped between adding a block and committing its state.
+// A state database written before savepoints were saved holds the state of every block but no savepoint,
+// it gets the height of the block store as its savepoint instead of a replay over its state
+func (l *KVLedger) recoverStateDB() error {
+	bcInfo, err := l.blockStore.GetBlockchainInfo()
+	if err != nil {
+		return err
+	}
+	if bcInfo.Height > 0 {
+		saved, err := l.txtmgmt.SaveMissingSavepoint(bcInfo.Height)
+		if err != nil {
+			return err
+		}
+		if saved {
+			logger.Infof("Saved block [%d] as the savepoint of a state database without savepoint", bcInfo.Height)
+		}
+	}
+	savepoint, err := l.txtmgmt.GetBlockNumFromSavepoint()
+	if err != nil {
+		return err
+	}
+	if savepoint > bcInfo.Height {
+		return fmt.Errorf("State database savepoint [%d] is ahead of the block store height [%d]", savepoint, bcInfo.Height)
+	}
+	if savepoint < bcInfo.Height {
+		logger.Infof("Recovering state database from block [%d] to [%d]", savepoint+1, bcInfo.Height)
+	}
+	for blockNum := savepoint + 1; blockNum <= bcInfo.Height; blockNum++ {
+		block, err := l.blockStore.RetrieveBlockByNumber(blockNum)
+		if err != nil {
+			return err
+		}
+		// The block holds only the transactions that were valid against the state of the savepoint
+		if _, _, err = l.txtmgmt.ValidateAndPrepare(block, blockNum); err != nil {
+			return err
+		}
+		if err = l.txtmgmt.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetTransactionByID retrieves a transaction by id
@@ -126,9 +193,64 @@ func (l *KVLedger) GetBlockByHash(blockHash []byte) (*pb.Block2, error) {
 	return l.blockStore.RetrieveBlockByHash(blockHash)
 }
 
-//Prune prunes the blocks/transactions that satisfy the given policy
+// Prune prunes the blocks/transactions that satisfy the given policy.
+// The block files before the first block the policy keeps are moved to the archive of the block store,
+// the state database is not changed. Archived blocks are returned by RestoreArchivedBlocks.
+// Blocks that are not in the history index or the state database yet are kept, whatever the policy says,
+// because NewKVLedger reads them from the block store to catch up
 func (l *KVLedger) Prune(policy ledger.PrunePolicy) error {
-	return errors.New("Not yet implemented")
+	if policy == nil {
+		return errors.New("No prune policy given")
+	}
+	firstBlockToKeep, err := policy.FirstBlockToKeep(&prunableBlocks{l.blockStore})
+	if err != nil {
+		return err
+	}
+	lastIndexed, err := l.historyDB.GetLastBlockIndexed()
+	if err != nil {
+		return err
+	}
+	savepoint, err := l.txtmgmt.GetBlockNumFromSavepoint()
+	if err != nil {
+		return err
+	}
+	lastCaughtUp := lastIndexed
+	if savepoint < lastCaughtUp {
+		lastCaughtUp = savepoint
+	}
+	if firstBlockToKeep > lastCaughtUp+1 {
+		logger.Infof("Keeping blocks from [%d] instead of [%d], the history index is at block [%d] and the state database at block [%d]",
+			lastCaughtUp+1, firstBlockToKeep, lastIndexed, savepoint)
+		firstBlockToKeep = lastCaughtUp + 1
+	}
+	logger.Debugf("Pruning blocks before [%d]", firstBlockToKeep)
+	return l.blockStore.ArchiveBlocksBefore(firstBlockToKeep)
+}
+
+// RestoreArchivedBlocks brings the archived blocks from startBlockNumber on back to the block store
+func (l *KVLedger) RestoreArchivedBlocks(startBlockNumber uint64) error {
+	return l.blockStore.RestoreArchivedBlocks(startBlockNumber)
+}
+
+// prunableBlocks implements `ledger.PrunableBlocks` on the block store
+type prunableBlocks struct {
+	blockStore blkstorage.BlockStore
+}
+
+func (b *prunableBlocks) FirstBlockNumber() uint64 {
+	return b.blockStore.GetFirstAvailableBlockNumber()
+}
+
+func (b *prunableBlocks) LastBlockNumber() uint64 {
+	bcInfo, err := b.blockStore.GetBlockchainInfo()
+	if err != nil {
+		return 0
+	}
+	return bcInfo.Height
+}
+
+func (b *prunableBlocks) GetBlockByNumber(blockNumber uint64) (*pb.Block2, error) {
+	return b.blockStore.RetrieveBlockByNumber(blockNumber)
 }
 
 // NewTxSimulator returns new `ledger.TxSimulator`
@@ -148,8 +270,12 @@ func (l *KVLedger) NewQueryExecutor() (ledger.QueryExecutor, error) {
 func (l *KVLedger) RemoveInvalidTransactionsAndPrepare(block *pb.Block2) (*pb.Block2, []*pb.InvalidTransaction, error) {
 	var validBlock *pb.Block2
 	var invalidTxs []*pb.InvalidTransaction
-	var err error
-	validBlock, invalidTxs, err = l.txtmgmt.ValidateAndPrepare(block)
+	bcInfo, err := l.blockStore.GetBlockchainInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	// The valid block is added to the block store as the next block
+	validBlock, invalidTxs, err = l.txtmgmt.ValidateAndPrepare(block, bcInfo.Height+1)
 	if err == nil {
 		l.pendingBlockToCommit = validBlock
 	}
@@ -171,8 +297,20 @@ func (l *KVLedger) Commit() error {
 	if err := l.txtmgmt.Commit(); err != nil {
 		panic(fmt.Errorf(`Error during commit to txmgr:%s`, err))
 	}
+
+	// The block is in the block store, a failed history commit is caught up by the next commit or on restart
+	logger.Debugf("Committing block to history database")
+	bcInfo, err := l.blockStore.GetBlockchainInfo()
+	if err == nil {
+		err = l.historyDB.Commit(l.pendingBlockToCommit, bcInfo.Height)
+	}
 	l.pendingBlockToCommit = nil
-	return nil
+	return err
+}
+
+// RebuildHistory drops the key history index and builds it again from the blocks in the block store
+func (l *KVLedger) RebuildHistory() error {
+	return l.historyDB.Rebuild()
 }
 
 // Rollback rollbacks the changes caused by the last invocation to method `RemoveInvalidTransactionsAndPrepare`
@@ -185,4 +323,5 @@ func (l *KVLedger) Rollback() {
 func (l *KVLedger) Close() {
 	l.blockStore.Shutdown()
 	l.txtmgmt.Shutdown()
+	l.historyDB.Shutdown()
 }
@@ -0,0 +1,211 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kvledger
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/core/ledger/util/db"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The steps of KVLedger.Commit a crash can interrupt
+const (
+	crashDuringBlockAppend = iota
+	crashAfterBlockAppend
+	crashAfterStateCommit
+	crashAfterHistoryCommit
+)
+
+func prepareBlock(t *testing.T, kvLedger *KVLedger, kvs ...string) *pb.Block2 {
+	simulator, _ := kvLedger.NewTxSimulator()
+	for i := 0; i < len(kvs); i += 2 {
+		simulator.SetState("ns1", kvs[i], []byte(kvs[i+1]))
+	}
+	simulator.Done()
+	simRes, _ := simulator.GetTxSimulationResults()
+	block := testutil.ConstructBlockForSimulationResults(t, [][]byte{simRes})
+	validBlock, _, err := kvLedger.RemoveInvalidTransactionsAndPrepare(block)
+	testutil.AssertNoError(t, err, "Error while preparing block")
+	return validBlock
+}
+
+func assertState(t *testing.T, kvLedger *KVLedger, key string, expectedValue string) {
+	queryExecutor, _ := kvLedger.NewQueryExecutor()
+	defer queryExecutor.Done()
+	value, err := queryExecutor.GetState("ns1", key)
+	testutil.AssertNoError(t, err, "Error while reading state")
+	if expectedValue == "" {
+		testutil.AssertNil(t, value)
+	} else {
+		testutil.AssertEquals(t, value, []byte(expectedValue))
+	}
+}
+
+func assertHistoryBlocks(t *testing.T, kvLedger *KVLedger, key string, expectedBlockNums ...uint64) {
+	queryExecutor, _ := kvLedger.NewQueryExecutor()
+	defer queryExecutor.Done()
+	itr, err := queryExecutor.GetTransactionsForKey("ns1", key)
+	testutil.AssertNoError(t, err, "Error while getting history")
+	defer itr.Close()
+	blockNums := []uint64{}
+	for {
+		result, err := itr.Next()
+		testutil.AssertNoError(t, err, "Error while iterating history")
+		if result == nil {
+			break
+		}
+		blockNums = append(blockNums, result.(*ledger.KeyModification).BlockNumber)
+	}
+	testutil.AssertEquals(t, blockNums, expectedBlockNums)
+}
+
+func assertConsistent(t *testing.T, kvLedger *KVLedger, height uint64) {
+	bcInfo, _ := kvLedger.GetBlockchainInfo()
+	testutil.AssertEquals(t, bcInfo.Height, height)
+	savepoint, err := kvLedger.txtmgmt.GetBlockNumFromSavepoint()
+	testutil.AssertNoError(t, err, "Error while reading the savepoint")
+	testutil.AssertEquals(t, savepoint, height)
+}
+
+func TestKVLedgerRecovery(t *testing.T) {
+	for crashPoint := crashDuringBlockAppend; crashPoint <= crashAfterHistoryCommit; crashPoint++ {
+		testKVLedgerRecovery(t, crashPoint)
+	}
+}
+
+func testKVLedgerRecovery(t *testing.T, crashPoint int) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	kvLedger, _ := NewKVLedger(env.conf)
+	prepareBlock(t, kvLedger, "key1", "value1")
+	testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+
+	// The steps of Commit up to the crash point
+	block2 := prepareBlock(t, kvLedger, "key1", "value2", "key2", "value2")
+	if crashPoint >= crashAfterBlockAppend {
+		testutil.AssertNoError(t, kvLedger.blockStore.AddBlock(block2), "Error while adding block")
+	}
+	if crashPoint >= crashAfterStateCommit {
+		testutil.AssertNoError(t, kvLedger.txtmgmt.Commit(), "Error while committing state")
+	} else {
+		kvLedger.txtmgmt.Rollback()
+	}
+	if crashPoint >= crashAfterHistoryCommit {
+		testutil.AssertNoError(t, kvLedger.historyDB.Commit(block2, 2), "Error while committing history")
+	}
+	kvLedger.Close()
+
+	if crashPoint == crashDuringBlockAppend {
+		serBlock, _ := pb.ConstructSerBlock2(block2)
+		blockBytes := append(proto.EncodeVarint(uint64(len(serBlock.GetBytes()))), serBlock.GetBytes()...)
+		file, err := os.OpenFile(env.conf.blockStorageDir+"/blocks/blockfile_000000", os.O_WRONLY|os.O_APPEND, 0660)
+		testutil.AssertNoError(t, err, "Error while opening block file")
+		file.Write(blockBytes[:len(blockBytes)/2])
+		file.Close()
+	}
+
+	// Restart after the crash
+	kvLedger, err := NewKVLedger(env.conf)
+	testutil.AssertNoError(t, err, fmt.Sprintf("Error while recovering from crash point [%d]", crashPoint))
+	defer kvLedger.Close()
+	if crashPoint == crashDuringBlockAppend {
+		assertConsistent(t, kvLedger, 1)
+		assertState(t, kvLedger, "key1", "value1")
+		assertState(t, kvLedger, "key2", "")
+		assertHistoryBlocks(t, kvLedger, "key1", 1)
+	} else {
+		assertConsistent(t, kvLedger, 2)
+		assertState(t, kvLedger, "key1", "value2")
+		assertState(t, kvLedger, "key2", "value2")
+		assertHistoryBlocks(t, kvLedger, "key1", 1, 2)
+	}
+
+	// The ledger goes on committing after the recovery
+	prepareBlock(t, kvLedger, "key1", "value3")
+	testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+	bcInfo, _ := kvLedger.GetBlockchainInfo()
+	assertConsistent(t, kvLedger, bcInfo.Height)
+	assertState(t, kvLedger, "key1", "value3")
+}
+
+func TestKVLedgerRecoveryOfSeveralBlocks(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	kvLedger, _ := NewKVLedger(env.conf)
+
+	// The state of three blocks is lost, e.g. the unsynced writes of the state database after a power failure
+	for i := 1; i <= 3; i++ {
+		block := prepareBlock(t, kvLedger, "key1", fmt.Sprintf("value%d", i), fmt.Sprintf("key%d", i+1), "value")
+		testutil.AssertNoError(t, kvLedger.blockStore.AddBlock(block), "Error while adding block")
+		kvLedger.txtmgmt.Rollback()
+	}
+	kvLedger.Close()
+
+	kvLedger, err := NewKVLedger(env.conf)
+	testutil.AssertNoError(t, err, "Error while recovering")
+	defer kvLedger.Close()
+	assertConsistent(t, kvLedger, 3)
+	assertState(t, kvLedger, "key1", "value3")
+	for i := 2; i <= 4; i++ {
+		assertState(t, kvLedger, fmt.Sprintf("key%d", i), "value")
+	}
+	assertHistoryBlocks(t, kvLedger, "key1", 1, 2, 3)
+}
+
+func TestKVLedgerWithoutSavepoint(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	kvLedger, _ := NewKVLedger(env.conf)
+	prepareBlock(t, kvLedger, "key1", "value1")
+	testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+
+	// A read-write transaction, which would fail validation if block 1 was replayed over the state
+	simulator, _ := kvLedger.NewTxSimulator()
+	value, _ := simulator.GetState("ns1", "key1")
+	simulator.SetState("ns1", "key1", append(value, []byte("+value2")...))
+	simulator.Done()
+	simRes, _ := simulator.GetTxSimulationResults()
+	kvLedger.RemoveInvalidTransactionsAndPrepare(testutil.ConstructBlockForSimulationResults(t, [][]byte{simRes}))
+	testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+	kvLedger.Close()
+
+	// The state database of a ledger created before savepoints were saved
+	stateDB := db.CreateDB(&db.Conf{DBPath: env.conf.txMgrDBPath})
+	stateDB.Open()
+	testutil.AssertNoError(t, stateDB.Delete([]byte{0x00}, true), "Error while deleting the savepoint")
+	stateDB.Close()
+
+	kvLedger, err := NewKVLedger(env.conf)
+	testutil.AssertNoError(t, err, "Error while opening a ledger without savepoint")
+	defer kvLedger.Close()
+	assertConsistent(t, kvLedger, 2)
+	assertState(t, kvLedger, "key1", "value1+value2")
+	assertHistoryBlocks(t, kvLedger, "key1", 1, 2)
+
+	// The ledger goes on committing on the state it had
+	prepareBlock(t, kvLedger, "key2", "value3")
+	testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+	assertConsistent(t, kvLedger, 3)
+	assertState(t, kvLedger, "key1", "value1+value2")
+}
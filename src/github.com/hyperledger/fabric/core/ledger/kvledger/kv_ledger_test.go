@@ -17,8 +17,14 @@ limitations under the License.
 package kvledger
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/blkstorage"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -78,3 +84,179 @@ func TestKVLedgerBlockStorage(t *testing.T) {
 	b2, _ = ledger.GetBlockByNumber(2)
 	testutil.AssertEquals(t, b2, block2)
 }
+
+func TestKVLedgerGetTransactionsForKey(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	kvLedger, _ := NewKVLedger(env.conf)
+
+	commit := func(kvLedger *KVLedger, value []byte) {
+		simulator, _ := kvLedger.NewTxSimulator()
+		if value == nil {
+			simulator.DeleteState("ns1", "key1")
+		} else {
+			simulator.SetState("ns1", "key1", value)
+		}
+		simulator.SetState("ns1", "key2", []byte("value2"))
+		simulator.Done()
+		simRes, _ := simulator.GetTxSimulationResults()
+		block := testutil.ConstructBlockForSimulationResults(t, [][]byte{simRes})
+		kvLedger.RemoveInvalidTransactionsAndPrepare(block)
+		testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+	}
+	assertHistory := func(kvLedger *KVLedger, expectedValues [][]byte) {
+		queryExecutor, _ := kvLedger.NewQueryExecutor()
+		defer queryExecutor.Done()
+		itr, err := queryExecutor.GetTransactionsForKey("ns1", "key1")
+		testutil.AssertNoError(t, err, "Error while getting history")
+		defer itr.Close()
+		for i, value := range expectedValues {
+			result, err := itr.Next()
+			testutil.AssertNoError(t, err, "Error while iterating history")
+			km := result.(*ledger.KeyModification)
+			testutil.AssertEquals(t, km.BlockNumber, uint64(i+1))
+			testutil.AssertEquals(t, km.Value, value)
+			testutil.AssertEquals(t, km.IsDelete, value == nil)
+			tx, _ := kvLedger.blockStore.RetrieveTxByBlockNumTranNum(uint64(i+1), 0)
+			testutil.AssertEquals(t, km.Transaction, tx)
+		}
+		result, err := itr.Next()
+		testutil.AssertNoError(t, err, "Error while iterating history")
+		testutil.AssertNil(t, result)
+	}
+
+	commit(kvLedger, []byte("value1"))
+	commit(kvLedger, []byte("value2"))
+	commit(kvLedger, nil)
+	expectedValues := [][]byte{[]byte("value1"), []byte("value2"), nil}
+	assertHistory(kvLedger, expectedValues)
+	kvLedger.Close()
+
+	// The history is kept across restarts and can be rebuilt from the block files
+	kvLedger, _ = NewKVLedger(env.conf)
+	defer kvLedger.Close()
+	assertHistory(kvLedger, expectedValues)
+	testutil.AssertNoError(t, kvLedger.RebuildHistory(), "Error while rebuilding history")
+	assertHistory(kvLedger, expectedValues)
+	commit(kvLedger, []byte("value4"))
+	assertHistory(kvLedger, append(expectedValues, []byte("value4")))
+}
+
+func TestKVLedgerPrune(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	// Every block goes to a file of its own, so every block can be archived
+	env.conf.maxBlockfileSize = 1
+	kvLedger, _ := NewKVLedger(env.conf)
+	defer kvLedger.Close()
+
+	now := time.Now()
+	for i := 1; i <= 6; i++ {
+		simulator, _ := kvLedger.NewTxSimulator()
+		simulator.SetState("ns1", "key1", []byte(fmt.Sprintf("value%d", i)))
+		simulator.Done()
+		simRes, _ := simulator.GetTxSimulationResults()
+		tx := testutil.ConstructTestTransaction(t, simRes)
+		txTime := now
+		if i <= 3 {
+			txTime = now.Add(-48 * time.Hour)
+		}
+		tx.Timestamp = &timestamp.Timestamp{Seconds: txTime.Unix()}
+		txBytes, _ := proto.Marshal(tx)
+		kvLedger.RemoveInvalidTransactionsAndPrepare(&pb.Block2{PreviousBlockHash: []byte{}, Transactions: [][]byte{txBytes}})
+		testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+	}
+
+	assertFirstBlock := func(firstBlockNumber uint64) {
+		if firstBlockNumber > 1 {
+			_, err := kvLedger.GetBlockByNumber(firstBlockNumber - 1)
+			archivedErr, ok := err.(*blkstorage.BlockArchivedErr)
+			if !ok {
+				t.Fatalf("Expected a BlockArchivedErr, got %v", err)
+			}
+			testutil.AssertEquals(t, archivedErr.FirstAvailableBlock, firstBlockNumber)
+		}
+		for n := firstBlockNumber; n <= 6; n++ {
+			_, err := kvLedger.GetBlockByNumber(n)
+			testutil.AssertNoError(t, err, fmt.Sprintf("Error while retrieving block [%d]", n))
+		}
+	}
+
+	testutil.AssertError(t, kvLedger.Prune(nil), "Expected an error for a nil policy")
+	testutil.AssertError(t, kvLedger.Prune(&ledger.KeepLastNBlocks{N: 0}), "Expected an error for keeping no blocks")
+
+	testutil.AssertNoError(t, kvLedger.Prune(&ledger.KeepLastNBlocks{N: 5}), "Error while pruning")
+	assertFirstBlock(2)
+	testutil.AssertNoError(t, kvLedger.Prune(&ledger.KeepBlocksNewerThan{Age: 24 * time.Hour}), "Error while pruning")
+	assertFirstBlock(4)
+	testutil.AssertNoError(t, kvLedger.Prune(&ledger.ArchiveBlocksBefore{BlockNumber: 6}), "Error while pruning")
+	assertFirstBlock(6)
+
+	// The state is not pruned, the history of the key reaches into the archive
+	queryExecutor, _ := kvLedger.NewQueryExecutor()
+	value, _ := queryExecutor.GetState("ns1", "key1")
+	testutil.AssertEquals(t, value, []byte("value6"))
+	itr, _ := queryExecutor.GetTransactionsForKey("ns1", "key1")
+	_, err := itr.Next()
+	if _, ok := err.(*blkstorage.BlockArchivedErr); !ok {
+		t.Fatalf("Expected a BlockArchivedErr, got %v", err)
+	}
+	itr.Close()
+	queryExecutor.Done()
+	testutil.AssertError(t, kvLedger.RebuildHistory(), "Expected the history not to be rebuilt from archived blocks")
+
+	testutil.AssertNoError(t, kvLedger.RestoreArchivedBlocks(1), "Error while restoring")
+	assertFirstBlock(1)
+	testutil.AssertNoError(t, kvLedger.RebuildHistory(), "Error while rebuilding history")
+}
+
+func TestKVLedgerPruneKeepsBlocksToCatchUp(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.cleanup()
+	env.conf.maxBlockfileSize = 1
+	kvLedger, _ := NewKVLedger(env.conf)
+
+	assertFirstAvailable := func(firstBlockNumber uint64) {
+		_, err := kvLedger.GetBlockByNumber(firstBlockNumber - 1)
+		archivedErr, ok := err.(*blkstorage.BlockArchivedErr)
+		if !ok {
+			t.Fatalf("Expected a BlockArchivedErr, got %v", err)
+		}
+		testutil.AssertEquals(t, archivedErr.FirstAvailableBlock, firstBlockNumber)
+	}
+
+	for i := 1; i <= 3; i++ {
+		prepareBlock(t, kvLedger, "key1", fmt.Sprintf("value%d", i))
+		testutil.AssertNoError(t, kvLedger.Commit(), "Error while committing block")
+	}
+	// Blocks 4 and 5 are in the state database but not in the history index
+	for i := 4; i <= 5; i++ {
+		block := prepareBlock(t, kvLedger, "key1", fmt.Sprintf("value%d", i))
+		testutil.AssertNoError(t, kvLedger.blockStore.AddBlock(block), "Error while adding block")
+		testutil.AssertNoError(t, kvLedger.txtmgmt.Commit(), "Error while committing state")
+	}
+	testutil.AssertNoError(t, kvLedger.Prune(&ledger.ArchiveBlocksBefore{BlockNumber: 6}), "Error while pruning")
+	assertFirstAvailable(4)
+	kvLedger.Close()
+
+	kvLedger, err := NewKVLedger(env.conf)
+	testutil.AssertNoError(t, err, "Error while reopening after pruning behind the history index")
+	assertConsistent(t, kvLedger, 5)
+
+	// Block 6 is in the history index but not in the state database
+	block := prepareBlock(t, kvLedger, "key1", "value6")
+	testutil.AssertNoError(t, kvLedger.blockStore.AddBlock(block), "Error while adding block")
+	testutil.AssertNoError(t, kvLedger.historyDB.Commit(block, 6), "Error while committing history")
+	kvLedger.txtmgmt.Rollback()
+	testutil.AssertNoError(t, kvLedger.Prune(&ledger.KeepLastNBlocks{N: 1}), "Error while pruning")
+	assertFirstAvailable(6)
+	testutil.AssertNoError(t, kvLedger.Prune(&ledger.ArchiveBlocksBefore{BlockNumber: 7}), "Error while pruning")
+	assertFirstAvailable(6)
+	kvLedger.Close()
+
+	kvLedger, err = NewKVLedger(env.conf)
+	testutil.AssertNoError(t, err, "Error while reopening after pruning behind the state database")
+	defer kvLedger.Close()
+	assertConsistent(t, kvLedger, 6)
+	assertState(t, kvLedger, "key1", "value6")
+}
@@ -18,22 +18,18 @@ package kvledger
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
 	"strings"
 	"sync"
 )
 
-//--!!!!IMPORTANT!!!--!!!IMPORTANT!!!---!!!IMPORTANT!!!-----------
-//
-//Three things about this code
-//
-//  1. This code is TEMPORARY - it can go away when (sub) ledgers
-//     management is implemented
-//  2. This code is PLACEHOLDER - in lieu of proper (sub) ledgers
-//     management, we need a mechanism to hold onto ledger handles
-//     This merely does that
-//  3. Do NOT add any function related to subledgers till it has
-//     been agreed upon
-//-----------------------------------------------------------------
+//The ledger manager holds the ledgers of the chains this peer is part of.
+//Every ledger is named after its chain ID and is fully isolated from the
+//others: it has its own directory under the ledger path, holding its block
+//files, its history index and its LevelDB state database, or its own CouchDB
+//database, named after the ledger, when CouchDB is the state database
 
 //-------- initialization --------
 var lManager *ledgerManager
@@ -53,6 +49,21 @@ func Initialize(lpath string) {
 	lManager = &ledgerManager{ledgerPath: lpath, ledgers: make(map[string]*KVLedger)}
 }
 
+//--------- ledger names -----------
+
+//a ledger name is used as a directory name and as a CouchDB database name,
+//so it is restricted to what both accept
+var ledgerNamePattern = regexp.MustCompile("^[a-z][a-z0-9_-]{0,127}$")
+
+//ValidateLedgerName returns a `LedgerNameInvalidErr` if name can not be used as a ledger name.
+//A ledger name starts with a lowercase letter, followed by at most 127 lowercase letters, digits, '_' or '-'
+func ValidateLedgerName(name string) error {
+	if !ledgerNamePattern.MatchString(name) {
+		return LedgerNameInvalidErr(name)
+	}
+	return nil
+}
+
 //--------- errors -----------
 
 //LedgerNotInitializedErr exists error
@@ -76,41 +87,197 @@ func (l LedgerCreateErr) Error() string {
 	return fmt.Sprintf("ledger creation failed %s", string(l))
 }
 
+//LedgerNotFoundErr is returned for a ledger that does not exist, or is not open when closing it
+type LedgerNotFoundErr string
+
+func (l LedgerNotFoundErr) Error() string {
+	return fmt.Sprintf("ledger not found %s", string(l))
+}
+
+//LedgerNameInvalidErr is returned for a name that does not pass `ValidateLedgerName`
+type LedgerNameInvalidErr string
+
+func (l LedgerNameInvalidErr) Error() string {
+	return fmt.Sprintf("invalid ledger name [%s], a ledger name must match %s", string(l), ledgerNamePattern)
+}
+
 //--------- ledger manager ---------
-// just a container for ledgers
+//holds the open ledgers by name
 type ledgerManager struct {
 	sync.RWMutex
 	ledgerPath string
 	ledgers    map[string]*KVLedger
 }
 
-//create a ledger if one does not exist
+func getLedgerManager() (*ledgerManager, error) {
+	if lManager == nil {
+		return nil, LedgerNotInitializedErr("")
+	}
+	return lManager, nil
+}
+
+func (lMgr *ledgerManager) ledgerConf(name string) *Conf {
+	conf := NewConf(lMgr.ledgerPath+name, 0)
+	conf.couchDBName = name
+	return conf
+}
+
+func (lMgr *ledgerManager) exists(name string) bool {
+	_, err := os.Stat(lMgr.ledgerPath + name)
+	return err == nil
+}
+
+//create a ledger, fails if the ledger exists
 func (lMgr *ledgerManager) create(name string) (*KVLedger, error) {
+	if err := ValidateLedgerName(name); err != nil {
+		return nil, err
+	}
 	lMgr.Lock()
 	defer lMgr.Unlock()
 
-	lPath := lMgr.ledgerPath + name
-	lgr, _ := lMgr.ledgers[lPath]
+	if lMgr.ledgers[name] != nil || lMgr.exists(name) {
+		return nil, LedgerExistsErr(name)
+	}
+	lgr, err := lMgr.open(name)
+	if err != nil {
+		logger.Errorf("Error creating ledger [%s]: %s", name, err)
+		return nil, LedgerCreateErr(name)
+	}
+	return lgr, nil
+}
+
+//open an existing ledger, returns the ledger if it is open already
+func (lMgr *ledgerManager) get(name string) (*KVLedger, error) {
+	if err := ValidateLedgerName(name); err != nil {
+		return nil, err
+	}
+	lMgr.RLock()
+	lgr := lMgr.ledgers[name]
+	lMgr.RUnlock()
 	if lgr != nil {
-		return lgr, LedgerExistsErr(name)
+		return lgr, nil
 	}
 
-	var err error
+	lMgr.Lock()
+	defer lMgr.Unlock()
+	if lgr = lMgr.ledgers[name]; lgr != nil {
+		return lgr, nil
+	}
+	if !lMgr.exists(name) {
+		return nil, LedgerNotFoundErr(name)
+	}
+	return lMgr.open(name)
+}
 
-	ledgerConf := NewConf(lPath, 0)
-	if lgr, err = NewKVLedger(ledgerConf); err != nil || lgr == nil {
-		return nil, LedgerCreateErr(name)
+//open or create a ledger. The caller holds the write lock
+func (lMgr *ledgerManager) open(name string) (*KVLedger, error) {
+	lgr, err := NewKVLedger(lMgr.ledgerConf(name))
+	if err != nil {
+		return nil, err
 	}
+	lMgr.ledgers[name] = lgr
+	return lgr, nil
+}
 
-	lMgr.ledgers[lPath] = lgr
+//list the ledgers in the ledger path
+func (lMgr *ledgerManager) list() ([]string, error) {
+	lMgr.RLock()
+	defer lMgr.RUnlock()
+	fileInfos, err := ioutil.ReadDir(lMgr.ledgerPath)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() && ValidateLedgerName(fileInfo.Name()) == nil {
+			names = append(names, fileInfo.Name())
+		}
+	}
+	return names, nil
+}
 
-	return lgr, nil
+//close an open ledger
+func (lMgr *ledgerManager) close(name string) error {
+	lMgr.Lock()
+	defer lMgr.Unlock()
+	lgr := lMgr.ledgers[name]
+	if lgr == nil {
+		return LedgerNotFoundErr(name)
+	}
+	lgr.Close()
+	delete(lMgr.ledgers, name)
+	return nil
+}
+
+//CreateLedger creates a ledger with the given name and opens it
+func CreateLedger(name string) (*KVLedger, error) {
+	lMgr, err := getLedgerManager()
+	if err != nil {
+		return nil, err
+	}
+	return lMgr.create(name)
+}
+
+//OpenLedger returns the ledger with the given name, opening it if needed.
+//It returns a `LedgerNotFoundErr` if the ledger has not been created
+func OpenLedger(name string) (*KVLedger, error) {
+	lMgr, err := getLedgerManager()
+	if err != nil {
+		return nil, err
+	}
+	return lMgr.get(name)
+}
+
+//ListLedgers returns the names of the created ledgers, sorted
+func ListLedgers() ([]string, error) {
+	lMgr, err := getLedgerManager()
+	if err != nil {
+		return nil, err
+	}
+	return lMgr.list()
+}
+
+//CreateLedgers opens the ledgers with the given names, creating the ones that have not been created.
+//It returns the names of the ledgers it created
+func CreateLedgers(names []string) ([]string, error) {
+	created := []string{}
+	for _, name := range names {
+		_, err := OpenLedger(name)
+		if _, ok := err.(LedgerNotFoundErr); ok {
+			if _, err = CreateLedger(name); err == nil {
+				created = append(created, name)
+			}
+		}
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+//CloseLedger closes the ledger with the given name. It can be opened again with `OpenLedger`
+func CloseLedger(name string) error {
+	lMgr, err := getLedgerManager()
+	if err != nil {
+		return err
+	}
+	return lMgr.close(name)
 }
 
 //GetLedger returns a kvledger, creating one if necessary
 //the call will panic if it cannot create a ledger
 func GetLedger(name string) *KVLedger {
-	lgr, err := lManager.create(name)
+	lgr, err := OpenLedger(name)
+	if _, ok := err.(LedgerNotFoundErr); ok {
+		lgr, err = CreateLedger(name)
+		if _, ok = err.(LedgerExistsErr); ok {
+			//the ledger has been created since
+			lgr, err = OpenLedger(name)
+		}
+	}
 
 	if lgr == nil {
 		panic("Cannot get ledger " + name + "(" + err.Error() + ")")
@@ -18,7 +18,10 @@ package kvledger
 
 import (
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
 )
 
 func TestCreate(t *testing.T) {
@@ -38,3 +41,101 @@ func TestCreate(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestLedgerManager(t *testing.T) {
+	lpath := "/tmp/ledgerstest"
+	os.RemoveAll(lpath)
+	defer os.RemoveAll(lpath)
+
+	Initialize(lpath)
+
+	names, err := ListLedgers()
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertEquals(t, names, []string{})
+
+	_, err = OpenLedger("chain2")
+	testutil.AssertEquals(t, err, LedgerNotFoundErr("chain2"))
+
+	lgr1, err := CreateLedger("chain1")
+	testutil.AssertNoError(t, err, "")
+	lgr2, err := CreateLedger("chain2")
+	testutil.AssertNoError(t, err, "")
+	_, err = CreateLedger("chain1")
+	testutil.AssertEquals(t, err, LedgerExistsErr("chain1"))
+
+	// A block committed to one ledger is not seen by the other
+	simulator, _ := lgr1.NewTxSimulator()
+	simulator.SetState("ns1", "key1", []byte("value1"))
+	simulator.Done()
+	simRes, _ := simulator.GetTxSimulationResults()
+	lgr1.RemoveInvalidTransactionsAndPrepare(testutil.ConstructBlockForSimulationResults(t, [][]byte{simRes}))
+	testutil.AssertNoError(t, lgr1.Commit(), "")
+	bcInfo, _ := lgr2.GetBlockchainInfo()
+	testutil.AssertEquals(t, bcInfo.Height, uint64(0))
+	queryExecutor, _ := lgr2.NewQueryExecutor()
+	value, _ := queryExecutor.GetState("ns1", "key1")
+	queryExecutor.Done()
+	testutil.AssertNil(t, value)
+
+	names, _ = ListLedgers()
+	testutil.AssertEquals(t, names, []string{"chain1", "chain2"})
+
+	// An open ledger is returned as is, a closed one is opened again with its blocks
+	lgr, _ := OpenLedger("chain1")
+	testutil.AssertSame(t, lgr, lgr1)
+	testutil.AssertNoError(t, CloseLedger("chain1"), "")
+	testutil.AssertEquals(t, CloseLedger("chain1"), LedgerNotFoundErr("chain1"))
+	lgr, err = OpenLedger("chain1")
+	testutil.AssertNoError(t, err, "")
+	bcInfo, _ = lgr.GetBlockchainInfo()
+	testutil.AssertEquals(t, bcInfo.Height, uint64(1))
+	testutil.AssertSame(t, GetLedger("chain1"), lgr)
+
+	CloseLedger("chain1")
+	CloseLedger("chain2")
+}
+
+func TestCreateLedgers(t *testing.T) {
+	lpath := "/tmp/ledgerstest"
+	os.RemoveAll(lpath)
+	defer os.RemoveAll(lpath)
+
+	Initialize(lpath)
+
+	_, err := CreateLedger("chain1")
+	testutil.AssertNoError(t, err, "")
+	created, err := CreateLedgers([]string{"chain1", "chain2"})
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertEquals(t, created, []string{"chain2"})
+	names, _ := ListLedgers()
+	testutil.AssertEquals(t, names, []string{"chain1", "chain2"})
+
+	// Creating them again opens them only
+	created, err = CreateLedgers([]string{"chain2", "chain1"})
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertEquals(t, created, []string{})
+
+	// The ledgers before an invalid name are kept
+	created, err = CreateLedgers([]string{"chain3", "Chain4", "chain5"})
+	testutil.AssertEquals(t, err, LedgerNameInvalidErr("Chain4"))
+	testutil.AssertEquals(t, created, []string{"chain3"})
+	names, _ = ListLedgers()
+	testutil.AssertEquals(t, names, []string{"chain1", "chain2", "chain3"})
+
+	CloseLedger("chain1")
+	CloseLedger("chain2")
+	CloseLedger("chain3")
+}
+
+func TestValidateLedgerName(t *testing.T) {
+	for _, name := range []string{"default", "chain1", "my-chain_2", "c"} {
+		testutil.AssertNoError(t, ValidateLedgerName(name), name)
+	}
+	for _, name := range []string{"", "Chain1", "1chain", "-chain", "chain/1", "../chain", "chain.1", strings.Repeat("c", 129)} {
+		testutil.AssertEquals(t, ValidateLedgerName(name), LedgerNameInvalidErr(name))
+	}
+
+	Initialize("/tmp/ledgerstest")
+	_, err := CreateLedger("../chain")
+	testutil.AssertEquals(t, err, LedgerNameInvalidErr("../chain"))
+}
@@ -30,12 +30,14 @@ func newTestEnv(t testing.TB) *testEnv {
 	conf := NewConf("/tmp/tests/ledger/", 0)
 	os.RemoveAll(conf.blockStorageDir)
 	os.RemoveAll(conf.txMgrDBPath)
+	os.RemoveAll(conf.historyDBPath)
 	return &testEnv{conf, t}
 }
 
 func (env *testEnv) cleanup() {
 	os.RemoveAll(env.conf.blockStorageDir)
 	os.RemoveAll(env.conf.txMgrDBPath)
+	os.RemoveAll(env.conf.historyDBPath)
 }
 
 type testLedgerWrapper struct {
@@ -102,6 +102,18 @@ type FileDetails struct {
 	Length      int    `json:"length"`
 }
 
+//QueryResult is a document returned by QueryDocuments, Value holds the full JSON document
+type QueryResult struct {
+	ID    string
+	Value []byte
+}
+
+//queryResponse is the body returned by the _find endpoint
+type queryResponse struct {
+	Docs    []json.RawMessage `json:"docs"`
+	Warning string            `json:"warning"`
+}
+
 //CreateConnectionDefinition for a new client connection
 func CreateConnectionDefinition(couchDBAddress string, databaseName, username, password string) (*CouchDBConnectionDef, error) {
 
@@ -485,6 +497,55 @@ func (dbclient *CouchDBConnectionDef) ReadDoc(id string) ([]byte, string, error)
 
 }
 
+//QueryDocuments method provides function for processing a Mango query (_find) against the database
+func (dbclient *CouchDBConnectionDef) QueryDocuments(query string) ([]QueryResult, error) {
+
+	logger.Debugf("===COUCHDB=== Entering QueryDocuments()  query=%s", query)
+
+	if IsJSON(query) != true {
+		return nil, fmt.Errorf("Query is not a valid JSON object")
+	}
+
+	url := fmt.Sprintf("%s/%s/_find", dbclient.URL, dbclient.Database)
+
+	resp, _, err := dbclient.handleRequest(http.MethodPost, url, strings.NewReader(query), "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	jsonResponse, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &queryResponse{}
+	err = json.Unmarshal(jsonResponse, response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Warning != "" {
+		logger.Debugf("===COUCHDB=== Query warning: %s", response.Warning)
+	}
+
+	results := []QueryResult{}
+	for _, doc := range response.Docs {
+		docRev := &DocRev{}
+		err = json.Unmarshal(doc, docRev)
+		if err != nil {
+			return nil, err
+		}
+		if docRev.Id == "" {
+			return nil, fmt.Errorf("Query result has no _id, the fields of the query must include _id")
+		}
+		results = append(results, QueryResult{ID: docRev.Id, Value: []byte(doc)})
+	}
+
+	logger.Debugf("===COUCHDB=== Exiting QueryDocuments()  results=%d", len(results))
+
+	return results, nil
+}
+
 //handleRequest method is a generic http request handler
 func (dbclient *CouchDBConnectionDef) handleRequest(method, url string, data io.Reader, rev string, multipartBoundary string) (*http.Response, *DBReturn, error) {
 
@@ -518,6 +579,12 @@ func (dbclient *CouchDBConnectionDef) handleRequest(method, url string, data io.
 		req.Header.Set("Accept", "application/json")
 	}
 
+	//add content headers for POST, used by queries
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+	}
+
 	//add content header for GET
 	if method == http.MethodGet {
 		req.Header.Set("Accept", "multipart/related")
@@ -317,6 +317,56 @@ func TestDBTestDropDatabaseBadConnection(t *testing.T) {
 
 }
 
+func TestDBQueryDocuments(t *testing.T) {
+
+	if kvledgerconfig.IsCouchDBEnabled() == true {
+
+		cleanup()
+		defer cleanup()
+
+		//create a new connection
+		db, err := CreateConnectionDefinition(connectURL, database, username, password)
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error when trying to create database connection definition"))
+
+		//create a new database
+		_, errdb := db.CreateDatabaseIfNotExist()
+		testutil.AssertNoError(t, errdb, fmt.Sprintf("Error when trying to create database"))
+
+		//Save two documents with different owners
+		_, saveerr := db.SaveDoc("1", "", assetJSON, nil)
+		testutil.AssertNoError(t, saveerr, fmt.Sprintf("Error when trying to save a document"))
+		_, saveerr = db.SaveDoc("2", "", []byte(`{"asset_name":"marble2","color":"red","size":"25","owner":"bob"}`), nil)
+		testutil.AssertNoError(t, saveerr, fmt.Sprintf("Error when trying to save a document"))
+
+		//Query for the documents of jerry
+		results, queryerr := db.QueryDocuments(`{"selector":{"owner":"jerry"}}`)
+		testutil.AssertNoError(t, queryerr, fmt.Sprintf("Error when trying to query documents"))
+		testutil.AssertEquals(t, len(results), 1)
+		testutil.AssertEquals(t, results[0].ID, "1")
+
+		//Unmarshal the document to Asset structure
+		assetResp := &Asset{}
+		json.Unmarshal(results[0].Value, &assetResp)
+		testutil.AssertEquals(t, assetResp.AssetName, "marble1")
+
+		//A query without _id in its fields can not be mapped back to keys
+		_, queryerr = db.QueryDocuments(`{"selector":{"owner":"jerry"},"fields":["owner"]}`)
+		testutil.AssertError(t, queryerr, fmt.Sprintf("Error should have been thrown for a query without _id"))
+	}
+
+}
+
+func TestDBQueryBadJSON(t *testing.T) {
+
+	//create a new connection, the query is rejected before anything is sent
+	db, err := CreateConnectionDefinition(badConnectURL, database, username, password)
+	testutil.AssertNoError(t, err, fmt.Sprintf("Error when trying to create database connection definition"))
+
+	_, queryerr := db.QueryDocuments(`{"selector"}`)
+	testutil.AssertError(t, queryerr, fmt.Sprintf("Error should have been thrown for a bad JSON query"))
+
+}
+
 func cleanup() {
 
 	//create a new connection
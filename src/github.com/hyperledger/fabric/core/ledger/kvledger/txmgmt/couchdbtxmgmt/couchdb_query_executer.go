@@ -17,11 +17,18 @@ limitations under the License.
 package couchdbtxmgmt
 
 import (
+	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/couchdbtxmgmt/couchdb"
 )
 
+// defaultQueryLimit bounds the results of a query that sets no limit. CouchDB would otherwise return 25 documents
+const defaultQueryLimit = 1000
+
 // CouchDBQueryExecutor is a query executor used in `CouchDBTxMgr`
 type CouchDBQueryExecutor struct {
 	txmgr *CouchDBTxMgr
@@ -48,13 +55,93 @@ func (q *CouchDBQueryExecutor) GetStateRangeScanIterator(namespace string, start
 }
 
 // GetTransactionsForKey - implements method in interface `ledger.QueryExecutor`
+// The transactions are read from the key history index, which is updated after the state of a block is committed
 func (q *CouchDBQueryExecutor) GetTransactionsForKey(namespace string, key string) (ledger.ResultsIterator, error) {
-	return nil, errors.New("Not yet implemented")
+	if q.txmgr.historyReader == nil {
+		return nil, txmgmt.ErrHistoryNotEnabled
+	}
+	return q.txmgr.historyReader.GetTransactionsForKey(namespace, key)
 }
 
 // ExecuteQuery implements method in interface `ledger.QueryExecutor`
-func (q *CouchDBQueryExecutor) ExecuteQuery(query string) (ledger.ResultsIterator, error) {
-	return nil, errors.New("Not supported by KV data model")
+// The query is a CouchDB Mango query, its selector is restricted to the documents of the namespace.
+// The returned ResultsIterator contains results of type *KV, the value is the JSON document.
+// A query runs on committed state. Writes of a running simulation are not visible and the results are not
+// recorded in the read set, so they are not validated at commit
+func (q *CouchDBQueryExecutor) ExecuteQuery(namespace string, query string) (ledger.ResultsIterator, error) {
+	scopedQuery, err := scopeQuery(namespace, query)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("===COUCHDB=== ExecuteQuery() namespace=%s query=%s", namespace, scopedQuery)
+	results, err := q.txmgr.couchDB.QueryDocuments(scopedQuery)
+	if err != nil {
+		return nil, err
+	}
+	return &qQueryItr{string(constructCompositeKey(namespace, "")), results, 0}, nil
+}
+
+// scopeQuery adds the key range of the namespace to the selector of a Mango query, makes sure _id is
+// returned so results can be mapped back to keys and applies the default limit
+func scopeQuery(namespace string, query string) (string, error) {
+	var mangoQuery map[string]interface{}
+	if err := json.Unmarshal([]byte(query), &mangoQuery); err != nil {
+		return "", errors.New("Query must be a JSON object")
+	}
+	selector, ok := mangoQuery["selector"].(map[string]interface{})
+	if !ok {
+		return "", errors.New("Query must have a selector object")
+	}
+
+	namespaceRange := map[string]interface{}{
+		"$gt": string(constructCompositeKey(namespace, "")),
+		"$lt": namespace + string(byte(1)),
+	}
+	mangoQuery["selector"] = map[string]interface{}{
+		"$and": []interface{}{map[string]interface{}{"_id": namespaceRange}, selector},
+	}
+
+	if fields, ok := mangoQuery["fields"].([]interface{}); ok {
+		hasID := false
+		for _, field := range fields {
+			if field == "_id" {
+				hasID = true
+			}
+		}
+		if !hasID {
+			mangoQuery["fields"] = append(fields, "_id")
+		}
+	}
+	if _, ok := mangoQuery["limit"]; !ok {
+		mangoQuery["limit"] = defaultQueryLimit
+	}
+
+	scopedQuery, err := json.Marshal(mangoQuery)
+	if err != nil {
+		return "", err
+	}
+	return string(scopedQuery), nil
+}
+
+type qQueryItr struct {
+	prefix  string
+	results []couchdb.QueryResult
+	next    int
+}
+
+// Next implements Next() method in ledger.ResultsIterator
+func (itr *qQueryItr) Next() (ledger.QueryResult, error) {
+	if itr.next >= len(itr.results) {
+		return nil, nil
+	}
+	result := itr.results[itr.next]
+	itr.next++
+	return &ledger.KV{Key: strings.TrimPrefix(result.ID, itr.prefix), Value: result.Value}, nil
+}
+
+// Close implements Close() method in ledger.ResultsIterator
+func (itr *qQueryItr) Close() {
+	itr.results = nil
 }
 
 // Done implements method in interface `ledger.QueryExecutor`
@@ -17,11 +17,14 @@ limitations under the License.
 package couchdbtxmgmt
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
 
+	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/ledger/kvledger/kvledgerconfig"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
 	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/couchdbtxmgmt/couchdb"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 )
@@ -106,3 +109,125 @@ func TestDatabaseAutoCreate(t *testing.T) {
 	}
 
 }
+
+func TestScopeQuery(t *testing.T) {
+	scopedQuery, err := scopeQuery("cID", `{"selector":{"owner":"jerry"},"fields":["owner"]}`)
+	testutil.AssertNoError(t, err, fmt.Sprintf("Error when scoping a query"))
+
+	var mangoQuery map[string]interface{}
+	json.Unmarshal([]byte(scopedQuery), &mangoQuery)
+	selector := mangoQuery["selector"].(map[string]interface{})["$and"].([]interface{})
+	namespaceRange := selector[0].(map[string]interface{})["_id"].(map[string]interface{})
+	testutil.AssertEquals(t, namespaceRange["$gt"], "cID\x00")
+	testutil.AssertEquals(t, namespaceRange["$lt"], "cID\x01")
+	testutil.AssertEquals(t, selector[1], map[string]interface{}{"owner": "jerry"})
+	testutil.AssertEquals(t, mangoQuery["fields"], []interface{}{"owner", "_id"})
+	testutil.AssertEquals(t, mangoQuery["limit"], float64(defaultQueryLimit))
+
+	scopedQuery, err = scopeQuery("cID", `{"selector":{"owner":"jerry"},"limit":5}`)
+	testutil.AssertNoError(t, err, fmt.Sprintf("Error when scoping a query"))
+	json.Unmarshal([]byte(scopedQuery), &mangoQuery)
+	testutil.AssertEquals(t, mangoQuery["limit"], float64(5))
+
+	_, err = scopeQuery("cID", `{"owner":"jerry"}`)
+	testutil.AssertError(t, err, fmt.Sprintf("Error should have been thrown for a query without a selector"))
+
+	_, err = scopeQuery("cID", `owner=jerry`)
+	testutil.AssertError(t, err, fmt.Sprintf("Error should have been thrown for a query that is not JSON"))
+}
+
+func TestConstructRangeQuery(t *testing.T) {
+	results := []*txmgmt.KVRead{txmgmt.NewKVRead("key1", 1), txmgmt.NewKVRead("key2", 1)}
+	var mangoQuery map[string]interface{}
+
+	query, err := constructRangeQuery("cID", &txmgmt.RangeQueryInfo{StartKey: "key1", EndKey: "key5", ItrExhausted: true, Results: results})
+	testutil.AssertNoError(t, err, fmt.Sprintf("Error when constructing a range query"))
+	json.Unmarshal([]byte(query), &mangoQuery)
+	idRange := mangoQuery["selector"].(map[string]interface{})["_id"].(map[string]interface{})
+	testutil.AssertEquals(t, idRange, map[string]interface{}{"$gte": "cID\x00key1", "$lt": "cID\x00key5"})
+	testutil.AssertEquals(t, mangoQuery["fields"], []interface{}{"_id"})
+	testutil.AssertEquals(t, mangoQuery["limit"], float64(3))
+
+	//Without an end key the range ends with the namespace
+	query, _ = constructRangeQuery("cID", &txmgmt.RangeQueryInfo{StartKey: "", EndKey: "", ItrExhausted: true})
+	mangoQuery = nil
+	json.Unmarshal([]byte(query), &mangoQuery)
+	idRange = mangoQuery["selector"].(map[string]interface{})["_id"].(map[string]interface{})
+	testutil.AssertEquals(t, idRange, map[string]interface{}{"$gte": "cID\x00", "$lt": "cID\x01"})
+
+	//A range that was not read to the end ends with the last key read
+	query, _ = constructRangeQuery("cID", &txmgmt.RangeQueryInfo{StartKey: "key1", EndKey: "key5", ItrExhausted: false, Results: results})
+	mangoQuery = nil
+	json.Unmarshal([]byte(query), &mangoQuery)
+	idRange = mangoQuery["selector"].(map[string]interface{})["_id"].(map[string]interface{})
+	testutil.AssertEquals(t, idRange, map[string]interface{}{"$gte": "cID\x00key1", "$lte": "cID\x00key2"})
+}
+
+func TestTxValidationWithPhantomRead(t *testing.T) {
+
+	if kvledgerconfig.IsCouchDBEnabled() == true {
+
+		env := newTestEnv(t)
+		env.Cleanup()
+		defer env.Cleanup()
+
+		txMgr := NewCouchDBTxMgr(env.conf,
+			env.couchDBAddress,    //couchDB Address
+			env.couchDatabaseName, //couchDB db name
+			env.couchUsername,     //enter couchDB id
+			env.couchPassword)     //enter couchDB pw
+		defer txMgr.Shutdown()
+
+		txMgr.couchDB.SaveDoc(string(constructCompositeKey("cID", "key1")), "", []byte(`{"owner":"jerry"}`), nil)
+		txMgr.couchDB.SaveDoc(string(constructCompositeKey("cID", "key2")), "", []byte(`{"owner":"tom"}`), nil)
+
+		rangeQueryInfo := &txmgmt.RangeQueryInfo{StartKey: "key1", EndKey: "key5", ItrExhausted: true,
+			Results: []*txmgmt.KVRead{txmgmt.NewKVRead("key1", 1), txmgmt.NewKVRead("key2", 1)}}
+		txRWSet := &txmgmt.TxReadWriteSet{NsRWs: []*txmgmt.NsReadWriteSet{
+			&txmgmt.NsReadWriteSet{NameSpace: "cID", RangeQueries: []*txmgmt.RangeQueryInfo{rangeQueryInfo}}}}
+		isValid, err := txMgr.validateTx(txRWSet)
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error in validateTx(): %s", err))
+		testutil.AssertSame(t, isValid, true)
+
+		//A key added in the range makes the transaction invalid
+		txMgr.couchDB.SaveDoc(string(constructCompositeKey("cID", "key3")), "", []byte(`{"owner":"jerry"}`), nil)
+		isValid, err = txMgr.validateTx(txRWSet)
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error in validateTx(): %s", err))
+		testutil.AssertSame(t, isValid, false)
+	}
+
+}
+
+func TestExecuteQuery(t *testing.T) {
+
+	if kvledgerconfig.IsCouchDBEnabled() == true {
+
+		env := newTestEnv(t)
+		env.Cleanup()
+		defer env.Cleanup()
+
+		txMgr := NewCouchDBTxMgr(env.conf,
+			env.couchDBAddress,    //couchDB Address
+			env.couchDatabaseName, //couchDB db name
+			env.couchUsername,     //enter couchDB id
+			env.couchPassword)     //enter couchDB pw
+		defer txMgr.Shutdown()
+
+		//Save the same document in two namespaces
+		txMgr.couchDB.SaveDoc(string(constructCompositeKey("cID", "marble1")), "", []byte(`{"owner":"jerry"}`), nil)
+		txMgr.couchDB.SaveDoc(string(constructCompositeKey("other", "marble1")), "", []byte(`{"owner":"jerry"}`), nil)
+
+		qe, _ := txMgr.NewQueryExecutor()
+		defer qe.Done()
+		itr, err := qe.ExecuteQuery("cID", `{"selector":{"owner":"jerry"}}`)
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error when executing a query"))
+
+		//Only the document of the namespace is returned, under its key
+		result, _ := itr.Next()
+		testutil.AssertEquals(t, result.(*ledger.KV).Key, "marble1")
+		result, _ = itr.Next()
+		testutil.AssertNil(t, result)
+		itr.Close()
+	}
+
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package couchdbtxmgmt
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
@@ -32,6 +34,9 @@ import (
 
 var logger = logging.MustGetLogger("couchdbtxmgmt")
 
+// savePointKey holds, in the LevelDB next to CouchDB, the number of the last block whose writes are saved
+var savePointKey = []byte("savepoint")
+
 // Conf - configuration for `CouchDBTxMgr`
 type Conf struct {
 	DBPath string
@@ -42,12 +47,15 @@ type versionedValue struct {
 	version uint64
 }
 
+// updateSet holds the writes of the block being committed. blockNum is saved as the savepoint with them,
+// 0 if the writes do not come from a block
 type updateSet struct {
-	m map[string]*versionedValue
+	m        map[string]*versionedValue
+	blockNum uint64
 }
 
 func newUpdateSet() *updateSet {
-	return &updateSet{make(map[string]*versionedValue)}
+	return &updateSet{m: make(map[string]*versionedValue)}
 }
 
 func (u *updateSet) add(compositeKey []byte, vv *versionedValue) {
@@ -70,6 +78,8 @@ type CouchDBTxMgr struct {
 	updateSet    *updateSet
 	commitRWLock sync.RWMutex
 	couchDB      *couchdb.CouchDBConnectionDef // COUCHDB new properties for CouchDB
+
+	historyReader txmgmt.HistoryReader
 }
 
 // CouchConnection provides connection info for CouchDB
@@ -119,7 +129,7 @@ func (txmgr *CouchDBTxMgr) NewTxSimulator() (ledger.TxSimulator, error) {
 }
 
 // ValidateAndPrepare implements method in interface `txmgmt.TxMgr`
-func (txmgr *CouchDBTxMgr) ValidateAndPrepare(block *pb.Block2) (*pb.Block2, []*pb.InvalidTransaction, error) {
+func (txmgr *CouchDBTxMgr) ValidateAndPrepare(block *pb.Block2, blockNum uint64) (*pb.Block2, []*pb.InvalidTransaction, error) {
 	logger.Debugf("===COUCHDB=== Entering CouchDBTxMgr.ValidateAndPrepare()")
 	validatedBlock := &pb.Block2{}
 	//TODO pull PreviousBlockHash from db
@@ -128,7 +138,8 @@ func (txmgr *CouchDBTxMgr) ValidateAndPrepare(block *pb.Block2) (*pb.Block2, []*
 	var valid bool
 	var err error
 	txmgr.updateSet = newUpdateSet()
-	logger.Debugf("Validating a block with [%d] transactions", len(block.Transactions))
+	txmgr.updateSet.blockNum = blockNum
+	logger.Debugf("Validating block [%d] with [%d] transactions", blockNum, len(block.Transactions))
 	for _, txBytes := range block.Transactions {
 		tx := &pb.Transaction2{}
 		err = proto.Unmarshal(txBytes, tx)
@@ -192,6 +203,11 @@ func (txmgr *CouchDBTxMgr) Shutdown() {
 	txmgr.db.Close()
 }
 
+// SetHistoryReader implements method in interface `txmgmt.TxMgr`
+func (txmgr *CouchDBTxMgr) SetHistoryReader(historyReader txmgmt.HistoryReader) {
+	txmgr.historyReader = historyReader
+}
+
 func (txmgr *CouchDBTxMgr) validateTx(txRWSet *txmgmt.TxReadWriteSet) (bool, error) {
 
 	var err error
@@ -213,10 +229,77 @@ func (txmgr *CouchDBTxMgr) validateTx(txRWSet *txmgmt.TxReadWriteSet) (bool, err
 				return false, nil
 			}
 		}
+		for _, rangeQueryInfo := range nsRWSet.RangeQueries {
+			if valid, err := txmgr.validateRangeQuery(ns, rangeQueryInfo); !valid || err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// validateRangeQuery executes the range query again as a query on _id and checks that it returns the keys
+// that were returned during simulation. Versions are not compared, they are not kept in CouchDB yet.
+// A key in the range that is written by an earlier transaction of the block being validated makes the
+// range invalid, as it does for a key in the read set
+func (txmgr *CouchDBTxMgr) validateRangeQuery(ns string, rangeQueryInfo *txmgmt.RangeQueryInfo) (bool, error) {
+	nsPrefix := string(constructCompositeKey(ns, ""))
+	if txmgr.updateSet != nil {
+		for compositeKey := range txmgr.updateSet.m {
+			if strings.HasPrefix(compositeKey, nsPrefix) && rangeQueryInfo.ContainsKey(compositeKey[len(nsPrefix):]) {
+				logger.Debugf("Key [%s] in range [%s] is updated in the block", compositeKey, rangeQueryInfo)
+				return false, nil
+			}
+		}
+	}
+	if !rangeQueryInfo.ItrExhausted && len(rangeQueryInfo.Results) == 0 {
+		return true, nil
+	}
+	query, err := constructRangeQuery(ns, rangeQueryInfo)
+	if err != nil {
+		return false, err
+	}
+	results, err := txmgr.couchDB.QueryDocuments(query)
+	if err != nil {
+		return false, err
+	}
+	if len(results) != len(rangeQueryInfo.Results) {
+		logger.Debugf("Range [%s:%s] returns [%d] keys instead of [%d]", ns, rangeQueryInfo, len(results), len(rangeQueryInfo.Results))
+		return false, nil
+	}
+	for i, kvRead := range rangeQueryInfo.Results {
+		if results[i].ID != nsPrefix+kvRead.Key {
+			logger.Debugf("Range [%s:%s] does not return [%s] any more", ns, rangeQueryInfo, kvRead)
+			return false, nil
+		}
 	}
 	return true, nil
 }
 
+// constructRangeQuery builds a Mango query for the ids of the keys in the observed range, sorted.
+// One result more than were observed is enough to find that a key was added
+func constructRangeQuery(ns string, rangeQueryInfo *txmgmt.RangeQueryInfo) (string, error) {
+	idRange := map[string]interface{}{"$gte": string(constructCompositeKey(ns, rangeQueryInfo.StartKey))}
+	if !rangeQueryInfo.ItrExhausted {
+		lastKey := rangeQueryInfo.Results[len(rangeQueryInfo.Results)-1].Key
+		idRange["$lte"] = string(constructCompositeKey(ns, lastKey))
+	} else if rangeQueryInfo.EndKey != "" {
+		idRange["$lt"] = string(constructCompositeKey(ns, rangeQueryInfo.EndKey))
+	} else {
+		idRange["$lt"] = ns + string(byte(1))
+	}
+	query, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{"_id": idRange},
+		"fields":   []string{"_id"},
+		"sort":     []interface{}{map[string]string{"_id": "asc"}},
+		"limit":    len(rangeQueryInfo.Results) + 1,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(query), nil
+}
+
 func (txmgr *CouchDBTxMgr) addWriteSetToBatch(txRWSet *txmgmt.TxReadWriteSet) error {
 	var err error
 	var currentVersion uint64
@@ -294,6 +377,14 @@ func (txmgr *CouchDBTxMgr) Commit() error {
 
 	}
 
+	// CouchDB has no batch over documents, the savepoint is saved once all of them are. A block that is
+	// replayed after a crash writes the same documents again
+	if txmgr.updateSet.blockNum > 0 {
+		if err := txmgr.db.Put(savePointKey, proto.EncodeVarint(txmgr.updateSet.blockNum), true); err != nil {
+			return err
+		}
+	}
+
 	logger.Debugf("===COUCHDB=== Exiting CouchDBTxMgr.Commit()")
 	return nil
 }
@@ -303,6 +394,32 @@ func (txmgr *CouchDBTxMgr) Rollback() {
 	txmgr.updateSet = nil
 }
 
+// GetBlockNumFromSavepoint implements method in interface `txmgmt.TxMgr`
+// It returns 0 if no block has been committed
+func (txmgr *CouchDBTxMgr) GetBlockNumFromSavepoint() (uint64, error) {
+	blockNumBytes, err := txmgr.db.Get(savePointKey)
+	if err != nil || len(blockNumBytes) == 0 {
+		return 0, err
+	}
+	blockNum, _ := proto.DecodeVarint(blockNumBytes)
+	return blockNum, nil
+}
+
+// SaveMissingSavepoint implements method in interface `txmgmt.TxMgr`
+// It saves blockNum as the savepoint of a CouchDB database that holds documents while no savepoint is saved,
+// which is a database written before savepoints were saved, and returns whether it did
+func (txmgr *CouchDBTxMgr) SaveMissingSavepoint(blockNum uint64) (bool, error) {
+	blockNumBytes, err := txmgr.db.Get(savePointKey)
+	if err != nil || blockNumBytes != nil {
+		return false, err
+	}
+	dbInfo, _, err := txmgr.couchDB.GetDatabaseInfo()
+	if err != nil || dbInfo.DocCount == 0 {
+		return false, err
+	}
+	return true, txmgr.db.Put(savePointKey, proto.EncodeVarint(blockNum), true)
+}
+
 func (txmgr *CouchDBTxMgr) getCommitedVersion(ns string, key string) (uint64, error) {
 	var err error
 	var version uint64
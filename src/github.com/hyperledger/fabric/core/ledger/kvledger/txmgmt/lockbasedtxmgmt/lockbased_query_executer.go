@@ -20,8 +20,12 @@ import (
 	"errors"
 
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
 )
 
+// ErrQueryNotSupported is returned by ExecuteQuery, LevelDB keeps values as opaque bytes and can not evaluate rich queries
+var ErrQueryNotSupported = errors.New("Rich queries are not supported by the LevelDB state database, configure CouchDB as the state database to use ExecuteQuery")
+
 // RWLockQueryExecutor is a query executor used in `LockBasedTxMgr`
 type RWLockQueryExecutor struct {
 	txmgr *LockBasedTxMgr
@@ -67,13 +71,18 @@ func (q *RWLockQueryExecutor) GetStateRangeScanIterator(namespace string, startK
 }
 
 // GetTransactionsForKey - implements method in interface `ledger.QueryExecutor`
+// The transactions are read from the key history index, which is updated after the state of a block is committed
 func (q *RWLockQueryExecutor) GetTransactionsForKey(namespace string, key string) (ledger.ResultsIterator, error) {
-	return nil, errors.New("Not yet implemented")
+	q.checkDone()
+	if q.txmgr.historyReader == nil {
+		return nil, txmgmt.ErrHistoryNotEnabled
+	}
+	return q.txmgr.historyReader.GetTransactionsForKey(namespace, key)
 }
 
 // ExecuteQuery implements method in interface `ledger.QueryExecutor`
-func (q *RWLockQueryExecutor) ExecuteQuery(query string) (ledger.ResultsIterator, error) {
-	return nil, errors.New("Not supported by KV data model")
+func (q *RWLockQueryExecutor) ExecuteQuery(namespace string, query string) (ledger.ResultsIterator, error) {
+	return nil, ErrQueryNotSupported
 }
 
 // Done implements method in interface `ledger.TxSimulator`
@@ -31,12 +31,13 @@ type kvReadCache struct {
 }
 
 type nsRWs struct {
-	readMap  map[string]*kvReadCache
-	writeMap map[string]*txmgmt.KVWrite
+	readMap          map[string]*kvReadCache
+	writeMap         map[string]*txmgmt.KVWrite
+	rangeQueriesInfo []*txmgmt.RangeQueryInfo
 }
 
 func newNsRWs() *nsRWs {
-	return &nsRWs{make(map[string]*kvReadCache), make(map[string]*txmgmt.KVWrite)}
+	return &nsRWs{readMap: make(map[string]*kvReadCache), writeMap: make(map[string]*txmgmt.KVWrite)}
 }
 
 // LockBasedTxSimulator is a transaction simulator used in `LockBasedTxMgr`
@@ -113,13 +114,18 @@ func (s *LockBasedTxSimulator) GetState(ns string, key string) ([]byte, error) {
 // can be supplied as empty strings. However, a full scan shuold be used judiciously for performance reasons.
 // TODO: The range scan queries still do not support Read-Your_Write (RYW)
 // semantics as it is still not agreed upon whether we want RYW model or not.
+// The range and the keys returned are recorded in the read-write set, so that a transaction whose range
+// changed before it is committed is found invalid
 func (s *LockBasedTxSimulator) GetStateRangeScanIterator(namespace string, startKey string, endKey string) (ledger.ResultsIterator, error) {
 	s.checkDone()
 	scanner, err := s.txmgr.getCommittedRangeScanner(namespace, startKey, endKey)
 	if err != nil {
 		return nil, err
 	}
-	return &sKVItr{scanner, s}, nil
+	rangeQueryInfo := &txmgmt.RangeQueryInfo{StartKey: startKey, EndKey: endKey}
+	nsRWs := s.getOrCreateNsRWHolder(namespace)
+	nsRWs.rangeQueriesInfo = append(nsRWs.rangeQueriesInfo, rangeQueryInfo)
+	return &sKVItr{scanner, rangeQueryInfo, s}, nil
 }
 
 // SetState implements method in interface `ledger.TxSimulator`
@@ -159,7 +165,8 @@ func (s *LockBasedTxSimulator) getTxReadWriteSet() *txmgmt.TxReadWriteSet {
 		for _, key := range sortedWriteKeys {
 			writes = append(writes, nsReadWriteMap.writeMap[key])
 		}
-		nsRWs := &txmgmt.NsReadWriteSet{NameSpace: ns, Reads: reads, Writes: writes}
+		nsRWs := &txmgmt.NsReadWriteSet{NameSpace: ns, Reads: reads, Writes: writes,
+			RangeQueries: nsReadWriteMap.rangeQueriesInfo}
 		txRWSet.NsRWs = append(txRWSet.NsRWs, nsRWs)
 	}
 
@@ -208,8 +215,9 @@ func (s *LockBasedTxSimulator) ExecuteUpdate(query string) error {
 }
 
 type sKVItr struct {
-	scanner   *kvScanner
-	simulator *LockBasedTxSimulator
+	scanner        *kvScanner
+	rangeQueryInfo *txmgmt.RangeQueryInfo
+	simulator      *LockBasedTxSimulator
 }
 
 // Next implements Next() method in ledger.ResultsIterator
@@ -219,14 +227,16 @@ func (itr *sKVItr) Next() (ledger.QueryResult, error) {
 		return nil, err
 	}
 	if committedKV == nil {
+		itr.rangeQueryInfo.ItrExhausted = true
 		return nil, nil
 	}
 	if committedKV.isDelete() {
 		return itr.Next()
 	}
+	kvRead := &txmgmt.KVRead{Key: committedKV.key, Version: committedKV.version}
 	nsRWs := itr.simulator.getOrCreateNsRWHolder(itr.scanner.namespace)
-	nsRWs.readMap[committedKV.key] = &kvReadCache{
-		&txmgmt.KVRead{Key: committedKV.key, Version: committedKV.version}, committedKV.value}
+	nsRWs.readMap[committedKV.key] = &kvReadCache{kvRead, committedKV.value}
+	itr.rangeQueryInfo.Results = append(itr.rangeQueryInfo.Results, kvRead)
 	return &ledger.KV{Key: committedKV.key, Value: committedKV.value}, nil
 }
 
@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 )
 
@@ -377,6 +378,106 @@ func TestTxValidationWithItr(t *testing.T) {
 	testutil.AssertSame(t, isValid, true)
 }
 
+func TestTxValidationWithPhantomRead(t *testing.T) {
+	cID := "cID"
+	env := newTestEnv(t)
+	defer env.Cleanup()
+	txMgr := NewLockBasedTxMgr(env.conf)
+	defer txMgr.Shutdown()
+
+	// simulate tx1 that adds key_001, key_002 and key_004
+	s1, _ := txMgr.NewTxSimulator()
+	for _, i := range []int{1, 2, 4} {
+		s1.SetState(cID, createTestKey(i), createTestValue(i))
+	}
+	s1.Done()
+	txMgr.addWriteSetToBatch(s1.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertNoError(t, txMgr.Commit(), "")
+
+	// simulate tx2 that reads the range [key_001, key_005) to the end
+	s2, _ := txMgr.NewTxSimulator()
+	readRange(t, s2, cID, createTestKey(1), createTestKey(5), -1)
+	s2.Done()
+
+	// simulate tx3 that reads key_001 and key_002 from the same range
+	s3, _ := txMgr.NewTxSimulator()
+	readRange(t, s3, cID, createTestKey(1), createTestKey(5), 2)
+	s3.Done()
+
+	// simulate tx4 that reads the empty range [key_006, key_009)
+	s4, _ := txMgr.NewTxSimulator()
+	readRange(t, s4, cID, createTestKey(6), createTestKey(9), -1)
+	s4.Done()
+
+	txRWSet := s2.(*LockBasedTxSimulator).getTxReadWriteSet()
+	testutil.AssertEquals(t, txRWSet.NsRWs[0].RangeQueries, []*txmgmt.RangeQueryInfo{&txmgmt.RangeQueryInfo{
+		StartKey: createTestKey(1), EndKey: createTestKey(5), ItrExhausted: true,
+		Results: []*txmgmt.KVRead{txmgmt.NewKVRead(createTestKey(1), 1), txmgmt.NewKVRead(createTestKey(2), 1),
+			txmgmt.NewKVRead(createTestKey(4), 1)}}})
+
+	// simulate tx5 before committing tx2, tx3 and tx4. Adds key_003, which falls in the range read by tx2
+	s5, _ := txMgr.NewTxSimulator()
+	s5.SetState(cID, createTestKey(3), createTestValue(3))
+	s5.Done()
+	txRWSet = s5.(*LockBasedTxSimulator).getTxReadWriteSet()
+	isValid, err := txMgr.validateTx(txRWSet)
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertSame(t, isValid, true)
+	txMgr.addWriteSetToBatch(txRWSet)
+	testutil.AssertNoError(t, txMgr.Commit(), "")
+
+	// tx2 should be invalid now, it did not see key_003
+	isValid, err = txMgr.validateTx(s2.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertSame(t, isValid, false)
+
+	// tx3 and tx4 should still be valid, key_003 is after the last key read by tx3 and outside the range of tx4
+	isValid, _ = txMgr.validateTx(s3.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertSame(t, isValid, true)
+	isValid, _ = txMgr.validateTx(s4.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertSame(t, isValid, true)
+
+	// tx6 adds key_007 in the block being validated, tx4 should be invalid after it in the same block
+	s6, _ := txMgr.NewTxSimulator()
+	s6.SetState(cID, createTestKey(7), createTestValue(7))
+	s6.Done()
+	txMgr.addWriteSetToBatch(s6.(*LockBasedTxSimulator).getTxReadWriteSet())
+	isValid, _ = txMgr.validateTx(s4.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertSame(t, isValid, false)
+	txMgr.Rollback()
+
+	// simulate tx7 that reads the range to the end, then tx8 deletes key_004
+	s7, _ := txMgr.NewTxSimulator()
+	readRange(t, s7, cID, createTestKey(1), createTestKey(5), -1)
+	s7.Done()
+	s8, _ := txMgr.NewTxSimulator()
+	s8.DeleteState(cID, createTestKey(4))
+	s8.Done()
+	txMgr.addWriteSetToBatch(s8.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertNoError(t, txMgr.Commit(), "")
+
+	// tx7 should be invalid, a range read after the delete is valid
+	isValid, _ = txMgr.validateTx(s7.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertSame(t, isValid, false)
+	s9, _ := txMgr.NewTxSimulator()
+	readRange(t, s9, cID, createTestKey(1), createTestKey(5), -1)
+	s9.Done()
+	isValid, _ = txMgr.validateTx(s9.(*LockBasedTxSimulator).getTxReadWriteSet())
+	testutil.AssertSame(t, isValid, true)
+}
+
+// readRange reads numKeys results of a range scan, or all of them if numKeys is negative
+func readRange(t *testing.T, s ledger.TxSimulator, ns string, startKey string, endKey string, numKeys int) {
+	itr, err := s.GetStateRangeScanIterator(ns, startKey, endKey)
+	testutil.AssertNoError(t, err, "")
+	defer itr.Close()
+	for i := 0; numKeys < 0 || i < numKeys; i++ {
+		if kv, _ := itr.Next(); kv == nil {
+			return
+		}
+	}
+}
+
 func TestGetSetMultipeKeys(t *testing.T) {
 	cID := "cID"
 	env := newTestEnv(t)
@@ -434,3 +535,80 @@ func createTestKey(i int) string {
 func createTestValue(i int) []byte {
 	return []byte(fmt.Sprintf("value_%03d", i))
 }
+
+func TestExecuteQueryNotSupported(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Cleanup()
+	txMgr := NewLockBasedTxMgr(env.conf)
+	defer txMgr.Shutdown()
+
+	qe, _ := txMgr.NewQueryExecutor()
+	defer qe.Done()
+	itr, err := qe.ExecuteQuery("cID", `{"selector":{"owner":"jerry"}}`)
+	testutil.AssertNil(t, itr)
+	testutil.AssertSame(t, err, ErrQueryNotSupported)
+
+	s, _ := txMgr.NewTxSimulator()
+	defer s.Done()
+	_, err = s.ExecuteQuery("cID", `{"selector":{"owner":"jerry"}}`)
+	testutil.AssertSame(t, err, ErrQueryNotSupported)
+}
+
+func TestSavepoint(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Cleanup()
+	txMgr := NewLockBasedTxMgr(env.conf)
+	blockNum, err := txMgr.GetBlockNumFromSavepoint()
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertEquals(t, blockNum, uint64(0))
+
+	s, _ := txMgr.NewTxSimulator()
+	s.SetState("ns1", "key1", []byte("value1"))
+	s.Done()
+	simRes, _ := s.GetTxSimulationResults()
+	block := testutil.ConstructBlockForSimulationResults(t, [][]byte{simRes})
+	_, _, err = txMgr.ValidateAndPrepare(block, 5)
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertNoError(t, txMgr.Commit(), "")
+
+	// The savepoint survives a restart and is not visible as state
+	txMgr.Shutdown()
+	txMgr = NewLockBasedTxMgr(env.conf)
+	defer txMgr.Shutdown()
+	blockNum, err = txMgr.GetBlockNumFromSavepoint()
+	testutil.AssertNoError(t, err, "")
+	testutil.AssertEquals(t, blockNum, uint64(5))
+
+	queryExecuter, _ := txMgr.NewQueryExecutor()
+	defer queryExecuter.Done()
+	itr, _ := queryExecuter.GetStateRangeScanIterator("ns1", "", "")
+	defer itr.Close()
+	kv, _ := itr.Next()
+	testutil.AssertEquals(t, kv.(*ledger.KV).Key, "key1")
+	kv, _ = itr.Next()
+	testutil.AssertNil(t, kv)
+}
+
+func TestRangeScanWithinNamespace(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Cleanup()
+	txMgr := NewLockBasedTxMgr(env.conf)
+	defer txMgr.Shutdown()
+	s, _ := txMgr.NewTxSimulator()
+	s.SetState("ns1", "key1", []byte("value1"))
+	s.SetState("ns2", "key2", []byte("value2"))
+	s.SetState("ns3", "key3", []byte("value3"))
+	s.Done()
+	txRWSet := s.(*LockBasedTxSimulator).getTxReadWriteSet()
+	txMgr.addWriteSetToBatch(txRWSet)
+	testutil.AssertNoError(t, txMgr.Commit(), "")
+
+	queryExecuter, _ := txMgr.NewQueryExecutor()
+	defer queryExecuter.Done()
+	itr, _ := queryExecuter.GetStateRangeScanIterator("ns2", "", "")
+	defer itr.Close()
+	kv, _ := itr.Next()
+	testutil.AssertEquals(t, kv.(*ledger.KV).Key, "key2")
+	kv, _ = itr.Next()
+	testutil.AssertNil(t, kv)
+}
@@ -36,6 +36,10 @@ var logger = logging.MustGetLogger("lockbasedtxmgmt")
 
 var compositeKeySep = []byte{0x00}
 
+// savePointKey holds the number of the last block whose writes are in the db. Composite keys start with a
+// namespace, which is never empty, so the key does not collide with state
+var savePointKey = []byte{0x00}
+
 // Conf - configuration for `LockBasedTxMgr`
 type Conf struct {
 	DBPath string
@@ -46,12 +50,15 @@ type versionedValue struct {
 	version uint64
 }
 
+// updateSet holds the writes of the block being committed. blockNum is saved as the savepoint with them,
+// 0 if the writes do not come from a block
 type updateSet struct {
-	m map[string]*versionedValue
+	m        map[string]*versionedValue
+	blockNum uint64
 }
 
 func newUpdateSet() *updateSet {
-	return &updateSet{make(map[string]*versionedValue)}
+	return &updateSet{m: make(map[string]*versionedValue)}
 }
 
 func (u *updateSet) add(compositeKey []byte, vv *versionedValue) {
@@ -70,9 +77,10 @@ func (u *updateSet) get(compositeKey []byte) *versionedValue {
 // LockBasedTxMgr a simple implementation of interface `txmgmt.TxMgr`.
 // This implementation uses a read-write lock to prevent conflicts between transaction simulation and committing
 type LockBasedTxMgr struct {
-	db           *db.DB
-	updateSet    *updateSet
-	commitRWLock sync.RWMutex
+	db            *db.DB
+	updateSet     *updateSet
+	commitRWLock  sync.RWMutex
+	historyReader txmgmt.HistoryReader
 }
 
 // NewLockBasedTxMgr constructs a `LockBasedTxMgr`
@@ -97,7 +105,7 @@ func (txmgr *LockBasedTxMgr) NewTxSimulator() (ledger.TxSimulator, error) {
 }
 
 // ValidateAndPrepare implements method in interface `txmgmt.TxMgr`
-func (txmgr *LockBasedTxMgr) ValidateAndPrepare(block *pb.Block2) (*pb.Block2, []*pb.InvalidTransaction, error) {
+func (txmgr *LockBasedTxMgr) ValidateAndPrepare(block *pb.Block2, blockNum uint64) (*pb.Block2, []*pb.InvalidTransaction, error) {
 	validatedBlock := &pb.Block2{}
 	//TODO pull PreviousBlockHash from db
 	validatedBlock.PreviousBlockHash = block.PreviousBlockHash
@@ -105,7 +113,8 @@ func (txmgr *LockBasedTxMgr) ValidateAndPrepare(block *pb.Block2) (*pb.Block2, [
 	var valid bool
 	var err error
 	txmgr.updateSet = newUpdateSet()
-	logger.Debugf("Validating a block with [%d] transactions", len(block.Transactions))
+	txmgr.updateSet.blockNum = blockNum
+	logger.Debugf("Validating block [%d] with [%d] transactions", blockNum, len(block.Transactions))
 	for _, txBytes := range block.Transactions {
 		tx := &pb.Transaction2{}
 		err = proto.Unmarshal(txBytes, tx)
@@ -168,6 +177,11 @@ func (txmgr *LockBasedTxMgr) Shutdown() {
 	txmgr.db.Close()
 }
 
+// SetHistoryReader implements method in interface `txmgmt.TxMgr`
+func (txmgr *LockBasedTxMgr) SetHistoryReader(historyReader txmgmt.HistoryReader) {
+	txmgr.historyReader = historyReader
+}
+
 func (txmgr *LockBasedTxMgr) validateTx(txRWSet *txmgmt.TxReadWriteSet) (bool, error) {
 
 	var err error
@@ -189,6 +203,53 @@ func (txmgr *LockBasedTxMgr) validateTx(txRWSet *txmgmt.TxReadWriteSet) (bool, e
 				return false, nil
 			}
 		}
+		for _, rangeQueryInfo := range nsRWSet.RangeQueries {
+			if valid, err := txmgr.validateRangeQuery(ns, rangeQueryInfo); !valid || err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// validateRangeQuery executes the range query again and checks that it returns the keys and versions that
+// were returned during simulation. A key in the range that is written by an earlier transaction of the
+// block being validated makes the range invalid, as it does for a key in the read set
+func (txmgr *LockBasedTxMgr) validateRangeQuery(ns string, rangeQueryInfo *txmgmt.RangeQueryInfo) (bool, error) {
+	if txmgr.updateSet != nil {
+		for compositeKey := range txmgr.updateSet.m {
+			updatedNs, updatedKey := splitCompositeKey([]byte(compositeKey))
+			if updatedNs == ns && rangeQueryInfo.ContainsKey(updatedKey) {
+				logger.Debugf("Key [%s:%s] in range [%s] is updated in the block", ns, updatedKey, rangeQueryInfo)
+				return false, nil
+			}
+		}
+	}
+	scanner, err := txmgr.getCommittedRangeScanner(ns, rangeQueryInfo.StartKey, rangeQueryInfo.EndKey)
+	if err != nil {
+		return false, err
+	}
+	defer scanner.close()
+	for _, kvRead := range rangeQueryInfo.Results {
+		committedKV, err := scanner.nextNonDeleted()
+		if err != nil {
+			return false, err
+		}
+		if committedKV == nil || committedKV.key != kvRead.Key || committedKV.version != kvRead.Version {
+			logger.Debugf("Range [%s:%s] does not return [%s] any more", ns, rangeQueryInfo, kvRead)
+			return false, nil
+		}
+	}
+	if !rangeQueryInfo.ItrExhausted {
+		return true, nil
+	}
+	committedKV, err := scanner.nextNonDeleted()
+	if err != nil {
+		return false, err
+	}
+	if committedKV != nil {
+		logger.Debugf("Range [%s:%s] returns key [%s] that was added", ns, rangeQueryInfo, committedKV.key)
+		return false, nil
 	}
 	return true, nil
 }
@@ -228,6 +289,10 @@ func (txmgr *LockBasedTxMgr) Commit() error {
 	for k, v := range txmgr.updateSet.m {
 		batch.Put([]byte(k), encodeValue(v.value, v.version))
 	}
+	// the savepoint is written in the same batch, so the db never holds a part of a block
+	if txmgr.updateSet.blockNum > 0 {
+		batch.Put(savePointKey, proto.EncodeVarint(txmgr.updateSet.blockNum))
+	}
 	txmgr.commitRWLock.Lock()
 	defer txmgr.commitRWLock.Unlock()
 	defer func() { txmgr.updateSet = nil }()
@@ -242,6 +307,34 @@ func (txmgr *LockBasedTxMgr) Rollback() {
 	txmgr.updateSet = nil
 }
 
+// GetBlockNumFromSavepoint implements method in interface `txmgmt.TxMgr`
+// It returns 0 if no block has been committed
+func (txmgr *LockBasedTxMgr) GetBlockNumFromSavepoint() (uint64, error) {
+	blockNumBytes, err := txmgr.db.Get(savePointKey)
+	if err != nil || len(blockNumBytes) == 0 {
+		return 0, err
+	}
+	blockNum, _ := proto.DecodeVarint(blockNumBytes)
+	return blockNum, nil
+}
+
+// SaveMissingSavepoint implements method in interface `txmgmt.TxMgr`
+// It saves blockNum as the savepoint of a db that holds state but no savepoint, which is a db written
+// before savepoints were saved, and returns whether it did
+func (txmgr *LockBasedTxMgr) SaveMissingSavepoint(blockNum uint64) (bool, error) {
+	blockNumBytes, err := txmgr.db.Get(savePointKey)
+	if err != nil || blockNumBytes != nil {
+		return false, err
+	}
+	itr := txmgr.db.GetIterator(nil, nil)
+	hasState := itr.Next()
+	itr.Release()
+	if !hasState {
+		return false, nil
+	}
+	return true, txmgr.db.Put(savePointKey, proto.EncodeVarint(blockNum), true)
+}
+
 func (txmgr *LockBasedTxMgr) getCommitedVersion(ns string, key string) (uint64, error) {
 	var err error
 	var version uint64
@@ -266,11 +359,9 @@ func (txmgr *LockBasedTxMgr) getCommittedValueAndVersion(ns string, key string)
 }
 
 func (txmgr *LockBasedTxMgr) getCommittedRangeScanner(namespace string, startKey string, endKey string) (*kvScanner, error) {
-	var compositeStartKey []byte
-	var compositeEndKey []byte
-	if startKey != "" {
-		compositeStartKey = constructCompositeKey(namespace, startKey)
-	}
+	// an empty startKey or endKey refers to the first or last key of the namespace, not of the db
+	compositeStartKey := constructCompositeKey(namespace, startKey)
+	compositeEndKey := append([]byte(namespace), compositeKeySep[0]+1)
 	if endKey != "" {
 		compositeEndKey = constructCompositeKey(namespace, endKey)
 	}
@@ -343,6 +434,16 @@ func (scanner *kvScanner) next() (*committedKV, error) {
 	return &committedKV{key, version, value}, nil
 }
 
+// nextNonDeleted skips the keys that are marked as deleted
+func (scanner *kvScanner) nextNonDeleted() (*committedKV, error) {
+	for {
+		committedKV, err := scanner.next()
+		if err != nil || committedKV == nil || !committedKV.isDelete() {
+			return committedKV, err
+		}
+	}
+}
+
 func (scanner *kvScanner) close() {
 	scanner.dbItr.Release()
 }
@@ -19,10 +19,16 @@ package txmgmt
 import (
 	"bytes"
 	"fmt"
+	"io"
 
 	"github.com/golang/protobuf/proto"
 )
 
+// rwSetVersionRangeQueries - the version of the serialized `TxReadWriteSet` that records range queries.
+// Version 0 holds the namespaces with their reads and writes only. Later versions append the version number and the
+// range queries of every namespace after them, so a version 0 set keeps its bytes and version 0 readers skip the rest
+const rwSetVersionRangeQueries = 1
+
 // KVRead - a tuple of key and its version at the time of transaction simulation
 type KVRead struct {
 	Key     string
@@ -53,11 +59,22 @@ func (w *KVWrite) SetValue(value []byte) {
 	w.IsDelete = value == nil
 }
 
+// RangeQueryInfo - a range query executed during transaction simulation and the keys it returned, with their versions.
+// ItrExhausted is false if the simulation stopped reading before the end of the range, the observed range
+// then ends at the last key returned. An empty EndKey refers to the end of the namespace
+type RangeQueryInfo struct {
+	StartKey     string
+	EndKey       string
+	ItrExhausted bool
+	Results      []*KVRead
+}
+
 // NsReadWriteSet - a collection of all the reads and writes that belong to a common namespace
 type NsReadWriteSet struct {
-	NameSpace string
-	Reads     []*KVRead
-	Writes    []*KVWrite
+	NameSpace    string
+	Reads        []*KVRead
+	Writes       []*KVWrite
+	RangeQueries []*RangeQueryInfo
 }
 
 // TxReadWriteSet - a collection of all the reads and writes collected as a result of a transaction simulation
@@ -129,7 +146,73 @@ func (w *KVWrite) Unmarshal(buf *proto.Buffer) error {
 	return nil
 }
 
-// Marshal serializes a `NsReadWriteSet`
+// ContainsKey returns true if a write to the key could change the results observed by the range query
+func (rqi *RangeQueryInfo) ContainsKey(key string) bool {
+	if key < rqi.StartKey {
+		return false
+	}
+	if !rqi.ItrExhausted {
+		return len(rqi.Results) > 0 && key <= rqi.Results[len(rqi.Results)-1].Key
+	}
+	return rqi.EndKey == "" || key < rqi.EndKey
+}
+
+// Marshal serializes a `RangeQueryInfo`
+func (rqi *RangeQueryInfo) Marshal(buf *proto.Buffer) error {
+	var err error
+	if err = buf.EncodeStringBytes(rqi.StartKey); err != nil {
+		return err
+	}
+	if err = buf.EncodeStringBytes(rqi.EndKey); err != nil {
+		return err
+	}
+	itrExhaustedMarker := 0
+	if rqi.ItrExhausted {
+		itrExhaustedMarker = 1
+	}
+	if err = buf.EncodeVarint(uint64(itrExhaustedMarker)); err != nil {
+		return err
+	}
+	if err = buf.EncodeVarint(uint64(len(rqi.Results))); err != nil {
+		return err
+	}
+	for i := 0; i < len(rqi.Results); i++ {
+		if err = rqi.Results[i].Marshal(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unmarshal deserializes a `RangeQueryInfo`
+func (rqi *RangeQueryInfo) Unmarshal(buf *proto.Buffer) error {
+	var err error
+	if rqi.StartKey, err = buf.DecodeStringBytes(); err != nil {
+		return err
+	}
+	if rqi.EndKey, err = buf.DecodeStringBytes(); err != nil {
+		return err
+	}
+	var itrExhaustedMarker uint64
+	if itrExhaustedMarker, err = buf.DecodeVarint(); err != nil {
+		return err
+	}
+	rqi.ItrExhausted = itrExhaustedMarker == 1
+	var numResults uint64
+	if numResults, err = buf.DecodeVarint(); err != nil {
+		return err
+	}
+	for i := 0; i < int(numResults); i++ {
+		r := &KVRead{}
+		if err = r.Unmarshal(buf); err != nil {
+			return err
+		}
+		rqi.Results = append(rqi.Results, r)
+	}
+	return nil
+}
+
+// Marshal serializes the reads and writes of a `NsReadWriteSet`, its range queries are serialized by `TxReadWriteSet`
 func (nsRW *NsReadWriteSet) Marshal(buf *proto.Buffer) error {
 	var err error
 	if err = buf.EncodeStringBytes(nsRW.NameSpace); err != nil {
@@ -150,7 +233,20 @@ func (nsRW *NsReadWriteSet) Marshal(buf *proto.Buffer) error {
 	return nil
 }
 
-// Unmarshal deserializes a `NsReadWriteSet`
+// marshalRangeQueries serializes the range queries of a `NsReadWriteSet`, they follow the namespaces of the set
+func (nsRW *NsReadWriteSet) marshalRangeQueries(buf *proto.Buffer) error {
+	if err := buf.EncodeVarint(uint64(len(nsRW.RangeQueries))); err != nil {
+		return err
+	}
+	for i := 0; i < len(nsRW.RangeQueries); i++ {
+		if err := nsRW.RangeQueries[i].Marshal(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unmarshal deserializes the reads and writes of a `NsReadWriteSet`
 func (nsRW *NsReadWriteSet) Unmarshal(buf *proto.Buffer) error {
 	var err error
 	if nsRW.NameSpace, err = buf.DecodeStringBytes(); err != nil {
@@ -182,6 +278,22 @@ func (nsRW *NsReadWriteSet) Unmarshal(buf *proto.Buffer) error {
 	return nil
 }
 
+// unmarshalRangeQueries deserializes the range queries of a `NsReadWriteSet`
+func (nsRW *NsReadWriteSet) unmarshalRangeQueries(buf *proto.Buffer) error {
+	numRangeQueries, err := buf.DecodeVarint()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < int(numRangeQueries); i++ {
+		rqi := &RangeQueryInfo{}
+		if err = rqi.Unmarshal(buf); err != nil {
+			return err
+		}
+		nsRW.RangeQueries = append(nsRW.RangeQueries, rqi)
+	}
+	return nil
+}
+
 // Marshal serializes a `TxReadWriteSet`
 func (txRW *TxReadWriteSet) Marshal() ([]byte, error) {
 	buf := proto.NewBuffer(nil)
@@ -189,10 +301,24 @@ func (txRW *TxReadWriteSet) Marshal() ([]byte, error) {
 	if err = buf.EncodeVarint(uint64(len(txRW.NsRWs))); err != nil {
 		return nil, err
 	}
+	hasRangeQueries := false
 	for i := 0; i < len(txRW.NsRWs); i++ {
 		if err = txRW.NsRWs[i].Marshal(buf); err != nil {
 			return nil, err
 		}
+		hasRangeQueries = hasRangeQueries || len(txRW.NsRWs[i].RangeQueries) > 0
+	}
+	// A set without range queries is written in version 0
+	if !hasRangeQueries {
+		return buf.Bytes(), nil
+	}
+	if err = buf.EncodeVarint(rwSetVersionRangeQueries); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(txRW.NsRWs); i++ {
+		if err = txRW.NsRWs[i].marshalRangeQueries(buf); err != nil {
+			return nil, err
+		}
 	}
 	return buf.Bytes(), nil
 }
@@ -212,6 +338,23 @@ func (txRW *TxReadWriteSet) Unmarshal(b []byte) error {
 		}
 		txRW.NsRWs = append(txRW.NsRWs, nsRW)
 	}
+
+	// Version 0 ends after the namespaces
+	version, err := buf.DecodeVarint()
+	if err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if version != rwSetVersionRangeQueries {
+		return fmt.Errorf("Unsupported read-write set version [%d]", version)
+	}
+	for i := 0; i < len(txRW.NsRWs); i++ {
+		if err = txRW.NsRWs[i].unmarshalRangeQueries(buf); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -225,6 +368,11 @@ func (w *KVWrite) String() string {
 	return fmt.Sprintf("%s=[%#v]", w.Key, w.Value)
 }
 
+// String prints a `RangeQueryInfo`
+func (rqi *RangeQueryInfo) String() string {
+	return fmt.Sprintf("[%s-%s):%t:%s", rqi.StartKey, rqi.EndKey, rqi.ItrExhausted, rqi.Results)
+}
+
 // String prints a `NsReadWriteSet`
 func (nsRW *NsReadWriteSet) String() string {
 	var buffer bytes.Buffer
@@ -238,6 +386,11 @@ func (nsRW *NsReadWriteSet) String() string {
 		buffer.WriteString(w.String())
 		buffer.WriteString(",")
 	}
+	buffer.WriteString("RangeQueries~")
+	for _, rqi := range nsRW.RangeQueries {
+		buffer.WriteString(rqi.String())
+		buffer.WriteString(",")
+	}
 	return buffer.String()
 }
 
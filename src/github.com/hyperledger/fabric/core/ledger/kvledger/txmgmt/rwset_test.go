@@ -17,6 +17,7 @@ limitations under the License.
 package txmgmt
 
 import (
+	"encoding/hex"
 	"testing"
 
 	"github.com/hyperledger/fabric/core/ledger/testutil"
@@ -26,15 +27,18 @@ func TestTxRWSetMarshalUnmarshal(t *testing.T) {
 	txRW := &TxReadWriteSet{}
 	nsRW1 := &NsReadWriteSet{"ns1",
 		[]*KVRead{&KVRead{"key1", uint64(1)}},
-		[]*KVWrite{&KVWrite{"key2", false, []byte("value2")}}}
+		[]*KVWrite{&KVWrite{"key2", false, []byte("value2")}},
+		[]*RangeQueryInfo{&RangeQueryInfo{"key1", "key5", true, []*KVRead{&KVRead{"key1", uint64(1)}, &KVRead{"key3", uint64(2)}}}}}
 
 	nsRW2 := &NsReadWriteSet{"ns2",
 		[]*KVRead{&KVRead{"key3", uint64(1)}},
-		[]*KVWrite{&KVWrite{"key4", true, nil}}}
+		[]*KVWrite{&KVWrite{"key4", true, nil}},
+		[]*RangeQueryInfo{&RangeQueryInfo{"", "", false, nil}}}
 
 	nsRW3 := &NsReadWriteSet{"ns3",
 		[]*KVRead{&KVRead{"key5", uint64(1)}},
-		[]*KVWrite{&KVWrite{"key6", false, []byte("value6")}, &KVWrite{"key7", false, []byte("value7")}}}
+		[]*KVWrite{&KVWrite{"key6", false, []byte("value6")}, &KVWrite{"key7", false, []byte("value7")}},
+		nil}
 
 	txRW.NsRWs = append(txRW.NsRWs, nsRW1, nsRW2, nsRW3)
 
@@ -48,3 +52,54 @@ func TestTxRWSetMarshalUnmarshal(t *testing.T) {
 	testutil.AssertEquals(t, deserializedRWSet, txRW)
 
 }
+
+// preRangeQueriesRWSet is a set serialized before range queries were recorded: ns1 reads key1 at version 1 and
+// writes value2 to key2, ns2 deletes key3
+const preRangeQueriesRWSet = "02036e733101046b6579310101046b657932000676616c756532036e73320001046b65793301"
+
+func TestTxRWSetUnmarshalPreRangeQueries(t *testing.T) {
+	b, _ := hex.DecodeString(preRangeQueriesRWSet)
+	txRW := &TxReadWriteSet{}
+	testutil.AssertNoError(t, txRW.Unmarshal(b), "Error while unmarshalling a set written before range queries")
+	testutil.AssertEquals(t, txRW, &TxReadWriteSet{[]*NsReadWriteSet{
+		&NsReadWriteSet{"ns1", []*KVRead{&KVRead{"key1", uint64(1)}}, []*KVWrite{&KVWrite{"key2", false, []byte("value2")}}, nil},
+		&NsReadWriteSet{"ns2", nil, []*KVWrite{&KVWrite{"key3", true, nil}}, nil}}})
+
+	// A set without range queries keeps the bytes it had before
+	reserialized, err := txRW.Marshal()
+	testutil.AssertNoError(t, err, "Error while marshalling changeset")
+	testutil.AssertEquals(t, hex.EncodeToString(reserialized), preRangeQueriesRWSet)
+
+	// With range queries the version follows the namespaces, a reader of the old format stops before it
+	txRW.NsRWs[1].RangeQueries = []*RangeQueryInfo{&RangeQueryInfo{"key1", "key5", true, []*KVRead{&KVRead{"key3", uint64(2)}}}}
+	b, err = txRW.Marshal()
+	testutil.AssertNoError(t, err, "Error while marshalling changeset")
+	testutil.AssertEquals(t, hex.EncodeToString(b[:len(reserialized)]), preRangeQueriesRWSet)
+	testutil.AssertEquals(t, b[len(reserialized)], byte(rwSetVersionRangeQueries))
+
+	// A later version is refused instead of being read as this one
+	b[len(reserialized)] = rwSetVersionRangeQueries + 1
+	testutil.AssertError(t, (&TxReadWriteSet{}).Unmarshal(b), "Expected an error for an unknown version")
+}
+
+func TestRangeQueryInfoContainsKey(t *testing.T) {
+	results := []*KVRead{&KVRead{"key2", uint64(1)}, &KVRead{"key4", uint64(1)}}
+
+	rqi := &RangeQueryInfo{"key2", "key6", true, results}
+	testutil.AssertEquals(t, rqi.ContainsKey("key1"), false)
+	testutil.AssertEquals(t, rqi.ContainsKey("key2"), true)
+	testutil.AssertEquals(t, rqi.ContainsKey("key3"), true)
+	testutil.AssertEquals(t, rqi.ContainsKey("key6"), false)
+
+	// Without an end key the range goes to the end of the namespace
+	rqi = &RangeQueryInfo{"", "", true, results}
+	testutil.AssertEquals(t, rqi.ContainsKey("key1"), true)
+	testutil.AssertEquals(t, rqi.ContainsKey("key9"), true)
+
+	// A range that was not read to the end ends at the last key returned
+	rqi = &RangeQueryInfo{"key2", "key6", false, results}
+	testutil.AssertEquals(t, rqi.ContainsKey("key4"), true)
+	testutil.AssertEquals(t, rqi.ContainsKey("key5"), false)
+	rqi = &RangeQueryInfo{"key2", "key6", false, nil}
+	testutil.AssertEquals(t, rqi.ContainsKey("key2"), false)
+}
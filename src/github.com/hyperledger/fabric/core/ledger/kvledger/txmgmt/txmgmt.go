@@ -17,6 +17,8 @@ limitations under the License.
 package txmgmt
 
 import (
+	"errors"
+
 	"github.com/hyperledger/fabric/core/ledger"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -25,8 +27,19 @@ import (
 type TxMgr interface {
 	NewQueryExecutor() (ledger.QueryExecutor, error)
 	NewTxSimulator() (ledger.TxSimulator, error)
-	ValidateAndPrepare(block *pb.Block2) (*pb.Block2, []*pb.InvalidTransaction, error)
+	ValidateAndPrepare(block *pb.Block2, blockNum uint64) (*pb.Block2, []*pb.InvalidTransaction, error)
 	Commit() error
+	GetBlockNumFromSavepoint() (uint64, error)
+	SaveMissingSavepoint(blockNum uint64) (bool, error)
 	Rollback()
 	Shutdown()
+	SetHistoryReader(historyReader HistoryReader)
+}
+
+// ErrHistoryNotEnabled is returned by GetTransactionsForKey when no HistoryReader has been set on the TxMgr
+var ErrHistoryNotEnabled = errors.New("Key history is not enabled on this ledger")
+
+// HistoryReader - an interface that the key history index implements to answer GetTransactionsForKey
+type HistoryReader interface {
+	GetTransactionsForKey(namespace string, key string) (ledger.ResultsIterator, error)
 }
@@ -82,11 +82,12 @@ type QueryExecutor interface {
 	// GetStateRangeScanIterator returns an iterator that contains all the key-values between given key ranges.
 	// The returned ResultsIterator contains results of type *KV
 	GetStateRangeScanIterator(namespace string, startKey string, endKey string) (ResultsIterator, error)
-	// GetTransactionsForKey returns an iterator that contains all the transactions that modified the given key.
-	// The returned ResultsIterator contains results of type *msgs.Transaction
+	// GetTransactionsForKey returns an iterator that contains all the transactions that modified the given key,
+	// in the order they were committed. The returned ResultsIterator contains results of type *KeyModification
 	GetTransactionsForKey(namespace string, key string) (ResultsIterator, error)
-	// ExecuteQuery executes the given query and returns an iterator that contains results of type specific to the underlying data store.
-	ExecuteQuery(query string) (ResultsIterator, error)
+	// ExecuteQuery executes the given query on the state of a namespace and returns an iterator that contains results
+	// of type specific to the underlying data store. A state database without rich query support returns an error.
+	ExecuteQuery(namespace string, query string) (ResultsIterator, error)
 	// Done releases resources occupied by the QueryExecutor
 	Done()
 }
@@ -132,6 +133,16 @@ type KV struct {
 	Value []byte
 }
 
+// KeyModification - QueryResult for GetTransactionsForKey. Holds a transaction that modified a key, its position in the
+// chain and the value it wrote. IsDelete is true if the transaction deleted the key
+type KeyModification struct {
+	BlockNumber uint64
+	TxNumber    uint64
+	Transaction *pb.Transaction2
+	Value       []byte
+	IsDelete    bool
+}
+
 // BlockHolder holds block returned by the iterator in GetBlocksIterator.
 // The sole purpose of this holder is to avoid desrialization if block is desired in raw bytes form (e.g., for transfer)
 type BlockHolder interface {
@@ -139,5 +150,18 @@ type BlockHolder interface {
 	GetBlockBytes() []byte
 }
 
-// PrunePolicy - a general interface for supporting different pruning policies
-type PrunePolicy interface{}
+// PrunePolicy - a general interface for supporting different pruning policies.
+// A policy picks the first block to keep, the blocks before it may be archived. See prune_policy.go
+type PrunePolicy interface {
+	FirstBlockToKeep(blocks PrunableBlocks) (uint64, error)
+}
+
+// PrunableBlocks - the blocks of a ledger as seen by a PrunePolicy
+type PrunableBlocks interface {
+	// FirstBlockNumber returns the number of the first block that has not been archived
+	FirstBlockNumber() uint64
+	// LastBlockNumber returns the number of the last block, 0 if the ledger has no blocks
+	LastBlockNumber() uint64
+	// GetBlockByNumber returns a block that has not been archived
+	GetBlockByNumber(blockNumber uint64) (*pb.Block2, error)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// KeepLastNBlocks - a PrunePolicy that keeps the last N blocks
+type KeepLastNBlocks struct {
+	N uint64
+}
+
+// FirstBlockToKeep implements method in interface `PrunePolicy`
+func (p *KeepLastNBlocks) FirstBlockToKeep(blocks PrunableBlocks) (uint64, error) {
+	if p.N == 0 {
+		return 0, errors.New("KeepLastNBlocks must keep at least one block")
+	}
+	lastBlockNumber := blocks.LastBlockNumber()
+	if lastBlockNumber <= p.N {
+		return 1, nil
+	}
+	return lastBlockNumber - p.N + 1, nil
+}
+
+// KeepBlocksNewerThan - a PrunePolicy that keeps the blocks younger than Age.
+// The time of a block is the latest timestamp of its transactions. The blocks are looked at in order, the first
+// block that is young enough or has no timestamp is kept together with all the blocks after it
+type KeepBlocksNewerThan struct {
+	Age time.Duration
+}
+
+// FirstBlockToKeep implements method in interface `PrunePolicy`
+func (p *KeepBlocksNewerThan) FirstBlockToKeep(blocks PrunableBlocks) (uint64, error) {
+	cutoff := time.Now().Add(-p.Age)
+	lastBlockNumber := blocks.LastBlockNumber()
+	blockNumber := blocks.FirstBlockNumber()
+	for ; blockNumber <= lastBlockNumber; blockNumber++ {
+		block, err := blocks.GetBlockByNumber(blockNumber)
+		if err != nil {
+			return 0, err
+		}
+		blockTime, ok, err := getBlockTime(block)
+		if err != nil {
+			return 0, err
+		}
+		if !ok || !blockTime.Before(cutoff) {
+			break
+		}
+	}
+	return blockNumber, nil
+}
+
+// ArchiveBlocksBefore - a PrunePolicy that archives the blocks before BlockNumber
+type ArchiveBlocksBefore struct {
+	BlockNumber uint64
+}
+
+// FirstBlockToKeep implements method in interface `PrunePolicy`
+func (p *ArchiveBlocksBefore) FirstBlockToKeep(blocks PrunableBlocks) (uint64, error) {
+	return p.BlockNumber, nil
+}
+
+// getBlockTime returns the latest timestamp of the transactions in the block, ok is false if none has one
+func getBlockTime(block *pb.Block2) (time.Time, bool, error) {
+	var blockTime time.Time
+	ok := false
+	for _, txBytes := range block.Transactions {
+		tx := &pb.Transaction2{}
+		if err := proto.Unmarshal(txBytes, tx); err != nil {
+			return blockTime, false, err
+		}
+		if tx.Timestamp == nil {
+			continue
+		}
+		txTime := time.Unix(tx.Timestamp.Seconds, int64(tx.Timestamp.Nanos))
+		if !ok || txTime.After(blockTime) {
+			blockTime = txTime
+			ok = true
+		}
+	}
+	return blockTime, ok, nil
+}
@@ -37,6 +37,7 @@ import (
 	"github.com/hyperledger/fabric/core/crypto/primitives"
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/endorser"
+	"github.com/hyperledger/fabric/core/ledger/kvledger"
 	"github.com/hyperledger/fabric/core/peer"
 	"github.com/hyperledger/fabric/core/rest"
 	"github.com/hyperledger/fabric/events/producer"
@@ -146,6 +147,10 @@ func serve(args []string) error {
 
 	registerChaincodeSupport(chaincode.DefaultChain, grpcServer, secHelper)
 
+	if err = registerChains(viper.GetStringSlice("ledger.chains")); err != nil {
+		return err
+	}
+
 	var peerServer *peer.Impl
 
 	// Create the peerServer
@@ -281,6 +286,24 @@ func registerChaincodeSupport(chainname chaincode.ChainName, grpcServer *grpc.Se
 	pb.RegisterChaincodeSupportServer(grpcServer, ccSrv)
 }
 
+//create the ledgers of the chains that have not been created and have the chaincode support serve the chains
+func registerChains(chains []string) error {
+	created, err := kvledger.CreateLedgers(chains)
+	for _, name := range created {
+		logger.Infof("Created the ledger of chain %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating the ledgers of the chains: %s", err)
+	}
+
+	for _, name := range chains {
+		if err = chaincode.RegisterChain(chaincode.ChainName(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func createEventHubServer() (net.Listener, *grpc.Server, error) {
 	var lis net.Listener
 	var grpcServer *grpc.Server
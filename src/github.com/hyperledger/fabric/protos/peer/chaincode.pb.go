@@ -118,6 +118,7 @@ const (
 	ChaincodeMessage_RANGE_QUERY_STATE_NEXT  ChaincodeMessage_Type = 18
 	ChaincodeMessage_RANGE_QUERY_STATE_CLOSE ChaincodeMessage_Type = 19
 	ChaincodeMessage_KEEPALIVE               ChaincodeMessage_Type = 20
+	ChaincodeMessage_EXECUTE_QUERY_STATE     ChaincodeMessage_Type = 21
 )
 
 var ChaincodeMessage_Type_name = map[int32]string{
@@ -142,6 +143,7 @@ var ChaincodeMessage_Type_name = map[int32]string{
 	18: "RANGE_QUERY_STATE_NEXT",
 	19: "RANGE_QUERY_STATE_CLOSE",
 	20: "KEEPALIVE",
+	21: "EXECUTE_QUERY_STATE",
 }
 var ChaincodeMessage_Type_value = map[string]int32{
 	"UNDEFINED":               0,
@@ -165,6 +167,7 @@ var ChaincodeMessage_Type_value = map[string]int32{
 	"RANGE_QUERY_STATE_NEXT":  18,
 	"RANGE_QUERY_STATE_CLOSE": 19,
 	"KEEPALIVE":               20,
+	"EXECUTE_QUERY_STATE":     21,
 }
 
 func (x ChaincodeMessage_Type) String() string {
@@ -547,81 +550,81 @@ var _ChaincodeSupport_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("peer/chaincode.proto", fileDescriptor3) }
 
 var fileDescriptor3 = []byte{
-	// 1210 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xa4, 0x56, 0xcd, 0x6e, 0xdb, 0xc6,
-	0x13, 0x8f, 0x3e, 0x6c, 0x4b, 0xa3, 0x0f, 0x6f, 0xd6, 0x8a, 0xa3, 0xbf, 0xfe, 0x6d, 0x22, 0x10,
-	0x69, 0xa0, 0xf6, 0x20, 0xa7, 0x6a, 0x52, 0x14, 0x68, 0x11, 0x94, 0x21, 0x37, 0x2e, 0x63, 0x99,
-	0x52, 0x56, 0xb4, 0x91, 0xf4, 0x62, 0xd0, 0xd4, 0x9a, 0x26, 0x22, 0x93, 0x04, 0xb9, 0x12, 0xac,
-	0x5b, 0xcf, 0x3d, 0xf5, 0x19, 0xfa, 0x10, 0x3d, 0xf4, 0x81, 0xfa, 0x1c, 0xc5, 0x2e, 0x49, 0x59,
-	0x5f, 0x09, 0x02, 0xf4, 0xc4, 0x9d, 0x99, 0xdf, 0xcc, 0xce, 0xce, 0xfc, 0x76, 0xb8, 0xd0, 0x08,
-	0x19, 0x8b, 0x8e, 0x9c, 0x6b, 0xdb, 0xf3, 0x9d, 0x60, 0xcc, 0xba, 0x61, 0x14, 0xf0, 0x00, 0xef,
-	0xca, 0x4f, 0xdc, 0xfa, 0xdf, 0xaa, 0x95, 0xcd, 0x98, 0xcf, 0x13, 0x48, 0xeb, 0xb1, 0x1b, 0x04,
-	0xee, 0x84, 0x1d, 0x49, 0xe9, 0x72, 0x7a, 0x75, 0xc4, 0xbd, 0x1b, 0x16, 0x73, 0xfb, 0x26, 0x4c,
-	0x00, 0xca, 0x0b, 0xa8, 0x68, 0x99, 0xa3, 0xa1, 0x63, 0x0c, 0xc5, 0xd0, 0xe6, 0xd7, 0xcd, 0x5c,
-	0x3b, 0xd7, 0x29, 0x53, 0xb9, 0x16, 0x3a, 0xdf, 0xbe, 0x61, 0xcd, 0x7c, 0xa2, 0x13, 0x6b, 0xe5,
-	0x09, 0xd4, 0xef, 0xdc, 0xfc, 0x70, 0xca, 0x05, 0xca, 0x8e, 0xdc, 0xb8, 0x99, 0x6b, 0x17, 0x3a,
-	0x55, 0x2a, 0xd7, 0xca, 0x5f, 0x05, 0xa8, 0x2d, 0x60, 0xa3, 0x90, 0x39, 0xb8, 0x0b, 0x45, 0x3e,
-	0x0f, 0x99, 0x8c, 0x5f, 0xef, 0xb5, 0x92, 0x24, 0xe2, 0xee, 0x0a, 0xa8, 0x6b, 0xcd, 0x43, 0x46,
-	0x25, 0x0e, 0xbf, 0x80, 0x8a, 0x73, 0x97, 0x9e, 0x4c, 0xa1, 0xd2, 0x3b, 0xd8, 0x70, 0x33, 0x74,
-	0xba, 0x8c, 0xc3, 0xcf, 0x60, 0xcf, 0xe1, 0x41, 0x74, 0x1a, 0xbb, 0xcd, 0x82, 0x74, 0x39, 0xdc,
-	0x74, 0x11, 0x59, 0xd3, 0x0c, 0x86, 0x9b, 0xb0, 0x27, 0x4a, 0x13, 0x4c, 0x79, 0xb3, 0xd8, 0xce,
-	0x75, 0x76, 0x68, 0x26, 0xe2, 0x27, 0x50, 0x8b, 0x99, 0x33, 0x8d, 0x98, 0x16, 0xf8, 0x9c, 0xdd,
-	0xf2, 0xe6, 0x8e, 0xac, 0xc3, 0xaa, 0x12, 0x0f, 0xa1, 0xe1, 0x04, 0xfe, 0x95, 0x37, 0x66, 0x3e,
-	0xf7, 0xec, 0x89, 0xc7, 0xe7, 0x7d, 0x36, 0x63, 0x93, 0xe6, 0xae, 0x3c, 0xe8, 0x17, 0x8b, 0xed,
-	0xb7, 0x60, 0xe8, 0x56, 0x4f, 0xdc, 0x82, 0xd2, 0x0d, 0xe3, 0xf6, 0xd8, 0xe6, 0x76, 0x73, 0xaf,
-	0x9d, 0xeb, 0x54, 0xe9, 0x42, 0xc6, 0x8f, 0x00, 0x6c, 0xce, 0x23, 0xef, 0x72, 0xca, 0x59, 0xdc,
-	0x2c, 0xb5, 0x0b, 0x9d, 0x32, 0x5d, 0xd2, 0x28, 0x2f, 0xa1, 0x28, 0x8a, 0x88, 0x6b, 0x50, 0x3e,
-	0x33, 0x75, 0xf2, 0xda, 0x30, 0x89, 0x8e, 0xee, 0x61, 0x80, 0xdd, 0xe3, 0x41, 0x5f, 0x35, 0x8f,
-	0x51, 0x0e, 0x97, 0xa0, 0x68, 0x0e, 0x74, 0x82, 0xf2, 0x78, 0x0f, 0x0a, 0x9a, 0x4a, 0x51, 0x41,
-	0xa8, 0xde, 0xa8, 0xe7, 0x2a, 0x2a, 0x2a, 0x7f, 0xe7, 0xe1, 0xe1, 0xa2, 0x52, 0x3a, 0x0b, 0x27,
-	0xc1, 0xfc, 0x86, 0xf9, 0x5c, 0xb6, 0xf0, 0x47, 0xa8, 0x39, 0xcb, 0xed, 0x92, 0xbd, 0xac, 0xf4,
-	0x1e, 0x6c, 0xed, 0x25, 0x5d, 0xc5, 0xe2, 0x9f, 0xa1, 0xc6, 0xae, 0xae, 0x98, 0xc3, 0xbd, 0x19,
-	0xd3, 0x6d, 0xce, 0xd2, 0x8e, 0xb6, 0xba, 0x09, 0x4f, 0xbb, 0x19, 0x4f, 0xbb, 0x56, 0xc6, 0x53,
-	0xba, 0xea, 0x80, 0xdb, 0x50, 0x11, 0xd1, 0x86, 0xb6, 0xf3, 0xc1, 0x76, 0x99, 0x6c, 0x6f, 0x95,
-	0x2e, 0xab, 0xb0, 0x09, 0x7b, 0xec, 0x96, 0x39, 0xc4, 0x9f, 0xc9, 0x56, 0xd6, 0x7b, 0xcf, 0x37,
-	0x52, 0x5b, 0x3d, 0x52, 0x97, 0xdc, 0x32, 0x67, 0xca, 0xbd, 0xc0, 0x27, 0xfe, 0xcc, 0x8b, 0x02,
-	0x5f, 0x18, 0x68, 0x16, 0x44, 0xe9, 0x42, 0x63, 0x1b, 0x40, 0x54, 0x53, 0x1f, 0x68, 0x27, 0x84,
-	0x26, 0x95, 0x1d, 0xbd, 0x1f, 0x59, 0xe4, 0x14, 0xe5, 0x94, 0xdf, 0x72, 0x4b, 0xc5, 0x33, 0xfc,
-	0x59, 0xe0, 0xd8, 0xc2, 0xf5, 0xbf, 0x17, 0xaf, 0x03, 0xfb, 0xde, 0xf8, 0x98, 0xf9, 0x2c, 0x92,
-	0x01, 0xd5, 0x89, 0x9b, 0xde, 0xc9, 0x75, 0xb5, 0xf2, 0x47, 0x1e, 0x9a, 0x77, 0xa1, 0x04, 0x51,
-	0x3d, 0x3e, 0xcf, 0xa8, 0xfa, 0x08, 0xc0, 0xb1, 0x27, 0x13, 0x16, 0x69, 0x2c, 0xe2, 0x32, 0x81,
-	0x2a, 0x5d, 0xd2, 0xdc, 0xd9, 0x47, 0x9e, 0xeb, 0xcb, 0x1d, 0x16, 0x76, 0xa1, 0x11, 0x57, 0x25,
-	0xb4, 0xe7, 0x93, 0xc0, 0x1e, 0xa7, 0xd5, 0xcf, 0x44, 0x61, 0xb9, 0xf4, 0xfc, 0xb1, 0xe7, 0xbb,
-	0xb2, 0xf2, 0x55, 0x9a, 0x89, 0x2b, 0x64, 0xde, 0x59, 0x23, 0xf3, 0x53, 0xa8, 0x87, 0x76, 0xc4,
-	0x7c, 0x7e, 0x9a, 0x21, 0x76, 0x25, 0x62, 0x4d, 0x8b, 0x7f, 0x82, 0x0a, 0xbf, 0x5d, 0xf0, 0x42,
-	0xde, 0x89, 0x4f, 0x33, 0x67, 0x19, 0xae, 0xfc, 0xb9, 0x03, 0x68, 0x51, 0x92, 0x53, 0x16, 0xc7,
-	0x82, 0x2a, 0xdf, 0xae, 0x8c, 0xa3, 0x2f, 0x37, 0xba, 0x90, 0xe2, 0x96, 0x27, 0xd2, 0x0f, 0x50,
-	0x5e, 0xcc, 0xd0, 0xcf, 0x60, 0xef, 0x1d, 0xf8, 0x13, 0x75, 0xc3, 0x50, 0xe4, 0xb7, 0xde, 0x58,
-	0x16, 0xad, 0x4c, 0xe5, 0x1a, 0xbf, 0x81, 0xfd, 0x78, 0xb5, 0x71, 0xb2, 0x70, 0x95, 0x5e, 0x7b,
-	0x93, 0x2b, 0xab, 0x38, 0xba, 0xee, 0x88, 0x5f, 0x42, 0x7d, 0xc1, 0x24, 0x22, 0xfe, 0x0e, 0xb2,
-	0xc2, 0xdb, 0xa6, 0xa2, 0xb4, 0xd2, 0x35, 0xb4, 0xf2, 0x4f, 0x7e, 0xfb, 0x3c, 0xa9, 0x42, 0x89,
-	0x92, 0x63, 0x63, 0x64, 0x11, 0x8a, 0x72, 0xb8, 0x0e, 0x90, 0x49, 0x44, 0x47, 0x79, 0x31, 0x4e,
-	0x0c, 0xd3, 0xb0, 0x50, 0x01, 0x97, 0x61, 0x87, 0x12, 0x55, 0x7f, 0x8f, 0x8a, 0x78, 0x1f, 0x2a,
-	0x16, 0x55, 0xcd, 0x91, 0xaa, 0x59, 0xc6, 0xc0, 0x44, 0x3b, 0x22, 0xa4, 0x36, 0x38, 0x1d, 0xf6,
-	0x89, 0x45, 0x74, 0xb4, 0x2b, 0xa0, 0x84, 0xd2, 0x01, 0x45, 0x7b, 0xc2, 0x72, 0x4c, 0xac, 0x8b,
-	0x91, 0xa5, 0x5a, 0x04, 0x95, 0x84, 0x38, 0x3c, 0xcb, 0xc4, 0xb2, 0x10, 0x75, 0xd2, 0x4f, 0x45,
-	0xc0, 0x0d, 0x40, 0x86, 0x79, 0x3e, 0x38, 0x21, 0x17, 0xda, 0x2f, 0xaa, 0x61, 0x6a, 0x62, 0xb4,
-	0x55, 0x30, 0x82, 0x6a, 0xaa, 0x7d, 0x7b, 0x46, 0xe8, 0x7b, 0x54, 0x4d, 0x52, 0x1e, 0x0d, 0x07,
-	0xe6, 0x88, 0xa0, 0x9a, 0xd8, 0x2d, 0x31, 0xd4, 0xf1, 0x01, 0xec, 0xcb, 0xe5, 0xc5, 0x5d, 0x36,
-	0xfb, 0x22, 0xdb, 0x44, 0x99, 0xe4, 0x84, 0xf0, 0x03, 0xb8, 0x4f, 0x55, 0xf3, 0x38, 0x8d, 0x97,
-	0xee, 0x7e, 0x1f, 0xb7, 0xe0, 0x70, 0x43, 0x7d, 0x61, 0x92, 0x77, 0x16, 0xc2, 0xf8, 0xff, 0xf0,
-	0x70, 0xd3, 0xa6, 0xf5, 0x07, 0x23, 0x82, 0x0e, 0xc4, 0x29, 0x4e, 0x08, 0x19, 0xaa, 0x7d, 0xe3,
-	0x9c, 0xa0, 0x86, 0xf2, 0x3d, 0x54, 0x87, 0x53, 0x3e, 0xe2, 0x36, 0x67, 0x86, 0x7f, 0x15, 0x60,
-	0x04, 0x85, 0x0f, 0x6c, 0x9e, 0xfe, 0x8d, 0xc5, 0x12, 0x37, 0x60, 0x67, 0x66, 0x4f, 0xa6, 0x2c,
-	0xbd, 0x97, 0x89, 0xa0, 0x10, 0xd8, 0xa7, 0xb6, 0xef, 0xb2, 0xb7, 0x53, 0x16, 0xcd, 0xa5, 0xbb,
-	0xb8, 0x71, 0x31, 0xb7, 0x23, 0x7e, 0xb2, 0xf0, 0x5f, 0xc8, 0xf8, 0x10, 0x76, 0x99, 0x3f, 0x16,
-	0x96, 0x64, 0x7e, 0xa4, 0x92, 0xf2, 0x15, 0x1c, 0xac, 0x85, 0x31, 0x05, 0x7d, 0xea, 0x90, 0x37,
-	0xf4, 0x34, 0x48, 0xde, 0xd0, 0x95, 0xa7, 0xd0, 0x58, 0x83, 0x69, 0x93, 0x20, 0x66, 0x1b, 0x38,
-	0x15, 0x1e, 0xae, 0xe1, 0x4e, 0xd8, 0xfc, 0x5c, 0x24, 0xfc, 0xd9, 0x07, 0xfb, 0x3d, 0xb7, 0x11,
-	0x83, 0xb2, 0x38, 0x0c, 0xfc, 0x98, 0x61, 0x02, 0xb5, 0x0f, 0x6c, 0x1e, 0xab, 0xfe, 0x58, 0xc6,
-	0x4c, 0x9e, 0x1e, 0x95, 0xde, 0xe3, 0x8c, 0xd4, 0x1f, 0xd9, 0x9b, 0xae, 0x7a, 0x89, 0x6b, 0x79,
-	0x6d, 0xc7, 0xa7, 0x41, 0x94, 0x6c, 0x5d, 0xa2, 0x99, 0x98, 0x9e, 0xa7, 0x90, 0x9d, 0xe7, 0x9b,
-	0xe7, 0xd0, 0xd8, 0xf6, 0xff, 0x16, 0xc3, 0x7f, 0x78, 0xf6, 0xaa, 0x6f, 0x68, 0xe8, 0x9e, 0x60,
-	0x9c, 0x36, 0x30, 0x5f, 0x1b, 0x3a, 0x31, 0x2d, 0x43, 0xed, 0xa3, 0x5c, 0xef, 0xdd, 0xd2, 0xdc,
-	0x19, 0x4d, 0xc3, 0x30, 0x88, 0x38, 0xd6, 0xa1, 0x44, 0x99, 0xeb, 0xc5, 0x9c, 0x45, 0xb8, 0xf9,
-	0xb1, 0xa9, 0xd3, 0xfa, 0xa8, 0x45, 0xb9, 0xd7, 0xc9, 0x3d, 0xcb, 0xbd, 0xd2, 0xe0, 0x30, 0x88,
-	0xdc, 0xee, 0xf5, 0x3c, 0x64, 0xd1, 0x84, 0x8d, 0x5d, 0x16, 0xa5, 0x0e, 0xbf, 0x7e, 0xed, 0x7a,
-	0xfc, 0x7a, 0x7a, 0xd9, 0x75, 0x82, 0x9b, 0xa3, 0x25, 0xf3, 0xd1, 0x95, 0x7d, 0x19, 0x79, 0x4e,
-	0xf2, 0x1a, 0x8c, 0x8f, 0xc4, 0xb3, 0xf1, 0x32, 0x79, 0x44, 0x7e, 0xf7, 0x6f, 0x00, 0x00, 0x00,
-	0xff, 0xff, 0xb5, 0xd0, 0x69, 0x9f, 0x63, 0x0a, 0x00, 0x00,
+	// 1214 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0x4b, 0x6f, 0xdb, 0xc6,
+	0x13, 0x8f, 0x1e, 0xd6, 0x63, 0xf4, 0xf0, 0x66, 0xad, 0xd8, 0xfc, 0xeb, 0xdf, 0x26, 0x02, 0x91,
+	0x06, 0x6a, 0x0f, 0x72, 0xaa, 0x26, 0x45, 0x81, 0x16, 0x41, 0x19, 0x72, 0xe3, 0x32, 0x96, 0x29,
+	0x65, 0x45, 0x1b, 0x49, 0x2f, 0x06, 0x4d, 0xad, 0x69, 0x22, 0x32, 0x49, 0x90, 0x2b, 0xc1, 0xba,
+	0xf5, 0xdc, 0x53, 0x3f, 0x4d, 0x0f, 0xed, 0x87, 0x6b, 0xb1, 0x7c, 0xc8, 0x7a, 0xd8, 0x6d, 0x80,
+	0x9e, 0xb8, 0x33, 0xf3, 0x9b, 0xd9, 0xd9, 0x99, 0xdf, 0x0e, 0x17, 0x5a, 0x01, 0x63, 0xe1, 0xa1,
+	0x7d, 0x65, 0xb9, 0x9e, 0xed, 0x4f, 0x58, 0x2f, 0x08, 0x7d, 0xee, 0xe3, 0x52, 0xfc, 0x89, 0xda,
+	0xff, 0x5b, 0xb7, 0xb2, 0x39, 0xf3, 0x78, 0x02, 0x69, 0x3f, 0x71, 0x7c, 0xdf, 0x99, 0xb2, 0xc3,
+	0x58, 0xba, 0x98, 0x5d, 0x1e, 0x72, 0xf7, 0x9a, 0x45, 0xdc, 0xba, 0x0e, 0x12, 0x80, 0xfc, 0x12,
+	0x6a, 0x6a, 0xe6, 0xa8, 0x6b, 0x18, 0x43, 0x31, 0xb0, 0xf8, 0x95, 0x94, 0xeb, 0xe4, 0xba, 0x55,
+	0x1a, 0xaf, 0x85, 0xce, 0xb3, 0xae, 0x99, 0x94, 0x4f, 0x74, 0x62, 0x2d, 0x3f, 0x85, 0xe6, 0xad,
+	0x9b, 0x17, 0xcc, 0xb8, 0x40, 0x59, 0xa1, 0x13, 0x49, 0xb9, 0x4e, 0xa1, 0x5b, 0xa7, 0xf1, 0x5a,
+	0xfe, 0xbd, 0x00, 0x8d, 0x25, 0x6c, 0x1c, 0x30, 0x1b, 0xf7, 0xa0, 0xc8, 0x17, 0x01, 0x8b, 0xe3,
+	0x37, 0xfb, 0xed, 0x24, 0x89, 0xa8, 0xb7, 0x06, 0xea, 0x99, 0x8b, 0x80, 0xd1, 0x18, 0x87, 0x5f,
+	0x42, 0xcd, 0xbe, 0x4d, 0x2f, 0x4e, 0xa1, 0xd6, 0xdf, 0xdb, 0x72, 0xd3, 0x35, 0xba, 0x8a, 0xc3,
+	0xcf, 0xa1, 0x6c, 0x73, 0x3f, 0x3c, 0x89, 0x1c, 0xa9, 0x10, 0xbb, 0xec, 0x6f, 0xbb, 0x88, 0xac,
+	0x69, 0x06, 0xc3, 0x12, 0x94, 0x45, 0x69, 0xfc, 0x19, 0x97, 0x8a, 0x9d, 0x5c, 0x77, 0x87, 0x66,
+	0x22, 0x7e, 0x0a, 0x8d, 0x88, 0xd9, 0xb3, 0x90, 0xa9, 0xbe, 0xc7, 0xd9, 0x0d, 0x97, 0x76, 0xe2,
+	0x3a, 0xac, 0x2b, 0xf1, 0x08, 0x5a, 0xb6, 0xef, 0x5d, 0xba, 0x13, 0xe6, 0x71, 0xd7, 0x9a, 0xba,
+	0x7c, 0x31, 0x60, 0x73, 0x36, 0x95, 0x4a, 0xf1, 0x41, 0x3f, 0x5b, 0x6e, 0x7f, 0x07, 0x86, 0xde,
+	0xe9, 0x89, 0xdb, 0x50, 0xb9, 0x66, 0xdc, 0x9a, 0x58, 0xdc, 0x92, 0xca, 0x9d, 0x5c, 0xb7, 0x4e,
+	0x97, 0x32, 0x7e, 0x0c, 0x60, 0x71, 0x1e, 0xba, 0x17, 0x33, 0xce, 0x22, 0xa9, 0xd2, 0x29, 0x74,
+	0xab, 0x74, 0x45, 0x23, 0xbf, 0x82, 0xa2, 0x28, 0x22, 0x6e, 0x40, 0xf5, 0xd4, 0xd0, 0xc8, 0x1b,
+	0xdd, 0x20, 0x1a, 0x7a, 0x80, 0x01, 0x4a, 0x47, 0xc3, 0x81, 0x62, 0x1c, 0xa1, 0x1c, 0xae, 0x40,
+	0xd1, 0x18, 0x6a, 0x04, 0xe5, 0x71, 0x19, 0x0a, 0xaa, 0x42, 0x51, 0x41, 0xa8, 0xde, 0x2a, 0x67,
+	0x0a, 0x2a, 0xca, 0x7f, 0xe4, 0xe1, 0x60, 0x59, 0x29, 0x8d, 0x05, 0x53, 0x7f, 0x71, 0xcd, 0x3c,
+	0x1e, 0xb7, 0xf0, 0x7b, 0x68, 0xd8, 0xab, 0xed, 0x8a, 0x7b, 0x59, 0xeb, 0x3f, 0xba, 0xb3, 0x97,
+	0x74, 0x1d, 0x8b, 0x7f, 0x84, 0x06, 0xbb, 0xbc, 0x64, 0x36, 0x77, 0xe7, 0x4c, 0xb3, 0x38, 0x4b,
+	0x3b, 0xda, 0xee, 0x25, 0x3c, 0xed, 0x65, 0x3c, 0xed, 0x99, 0x19, 0x4f, 0xe9, 0xba, 0x03, 0xee,
+	0x40, 0x4d, 0x44, 0x1b, 0x59, 0xf6, 0x47, 0xcb, 0x61, 0x71, 0x7b, 0xeb, 0x74, 0x55, 0x85, 0x0d,
+	0x28, 0xb3, 0x1b, 0x66, 0x13, 0x6f, 0x1e, 0xb7, 0xb2, 0xd9, 0x7f, 0xb1, 0x95, 0xda, 0xfa, 0x91,
+	0x7a, 0xe4, 0x86, 0xd9, 0x33, 0xee, 0xfa, 0x1e, 0xf1, 0xe6, 0x6e, 0xe8, 0x7b, 0xc2, 0x40, 0xb3,
+	0x20, 0x72, 0x0f, 0x5a, 0x77, 0x01, 0x44, 0x35, 0xb5, 0xa1, 0x7a, 0x4c, 0x68, 0x52, 0xd9, 0xf1,
+	0x87, 0xb1, 0x49, 0x4e, 0x50, 0x4e, 0xfe, 0x25, 0xb7, 0x52, 0x3c, 0xdd, 0x9b, 0xfb, 0xb6, 0x25,
+	0x5c, 0xff, 0x7b, 0xf1, 0xba, 0xb0, 0xeb, 0x4e, 0x8e, 0x98, 0xc7, 0xc2, 0x38, 0xa0, 0x32, 0x75,
+	0xd2, 0x3b, 0xb9, 0xa9, 0x96, 0x7f, 0xcb, 0x83, 0x74, 0x1b, 0x4a, 0x10, 0xd5, 0xe5, 0x8b, 0x8c,
+	0xaa, 0x8f, 0x01, 0x6c, 0x6b, 0x3a, 0x65, 0xa1, 0xca, 0x42, 0x1e, 0x27, 0x50, 0xa7, 0x2b, 0x9a,
+	0x5b, 0xfb, 0xd8, 0x75, 0x3c, 0x29, 0xbf, 0x6a, 0x17, 0x1a, 0x71, 0x55, 0x02, 0x6b, 0x31, 0xf5,
+	0xad, 0x49, 0x5a, 0xfd, 0x4c, 0x14, 0x96, 0x0b, 0xd7, 0x9b, 0xb8, 0x9e, 0x13, 0x57, 0xbe, 0x4e,
+	0x33, 0x71, 0x8d, 0xcc, 0x3b, 0x1b, 0x64, 0x7e, 0x06, 0xcd, 0xc0, 0x0a, 0x99, 0xc7, 0x4f, 0x32,
+	0x44, 0x29, 0x46, 0x6c, 0x68, 0xf1, 0x0f, 0x50, 0xe3, 0x37, 0x4b, 0x5e, 0x48, 0xe5, 0x7f, 0x65,
+	0xce, 0x2a, 0x5c, 0xfe, 0x73, 0x07, 0xd0, 0xb2, 0x24, 0x27, 0x2c, 0x8a, 0x04, 0x55, 0xbe, 0x5e,
+	0x1b, 0x47, 0x9f, 0x6f, 0x75, 0x21, 0xc5, 0xad, 0x4e, 0xa4, 0xef, 0xa0, 0xba, 0x9c, 0xa1, 0x9f,
+	0xc0, 0xde, 0x5b, 0xf0, 0x3f, 0xd4, 0x0d, 0x43, 0x91, 0xdf, 0xb8, 0x93, 0xb8, 0x68, 0x55, 0x1a,
+	0xaf, 0xf1, 0x5b, 0xd8, 0x8d, 0xd6, 0x1b, 0x17, 0x17, 0xae, 0xd6, 0xef, 0x6c, 0x73, 0x65, 0x1d,
+	0x47, 0x37, 0x1d, 0xf1, 0x2b, 0x68, 0x2e, 0x99, 0x44, 0xc4, 0xdf, 0x41, 0x2a, 0xdd, 0x33, 0x15,
+	0x63, 0x2b, 0xdd, 0x40, 0xcb, 0x7f, 0xe5, 0xef, 0x9e, 0x27, 0x75, 0xa8, 0x50, 0x72, 0xa4, 0x8f,
+	0x4d, 0x42, 0x51, 0x0e, 0x37, 0x01, 0x32, 0x89, 0x68, 0x28, 0x2f, 0xc6, 0x89, 0x6e, 0xe8, 0x26,
+	0x2a, 0xe0, 0x2a, 0xec, 0x50, 0xa2, 0x68, 0x1f, 0x50, 0x11, 0xef, 0x42, 0xcd, 0xa4, 0x8a, 0x31,
+	0x56, 0x54, 0x53, 0x1f, 0x1a, 0x68, 0x47, 0x84, 0x54, 0x87, 0x27, 0xa3, 0x01, 0x31, 0x89, 0x86,
+	0x4a, 0x02, 0x4a, 0x28, 0x1d, 0x52, 0x54, 0x16, 0x96, 0x23, 0x62, 0x9e, 0x8f, 0x4d, 0xc5, 0x24,
+	0xa8, 0x22, 0xc4, 0xd1, 0x69, 0x26, 0x56, 0x85, 0xa8, 0x91, 0x41, 0x2a, 0x02, 0x6e, 0x01, 0xd2,
+	0x8d, 0xb3, 0xe1, 0x31, 0x39, 0x57, 0x7f, 0x52, 0x74, 0x43, 0x15, 0xa3, 0xad, 0x86, 0x11, 0xd4,
+	0x53, 0xed, 0xbb, 0x53, 0x42, 0x3f, 0xa0, 0x7a, 0x92, 0xf2, 0x78, 0x34, 0x34, 0xc6, 0x04, 0x35,
+	0xc4, 0x6e, 0x89, 0xa1, 0x89, 0xf7, 0x60, 0x37, 0x5e, 0x9e, 0xdf, 0x66, 0xb3, 0x2b, 0xb2, 0x4d,
+	0x94, 0x49, 0x4e, 0x08, 0x3f, 0x82, 0x87, 0x54, 0x31, 0x8e, 0xd2, 0x78, 0xe9, 0xee, 0x0f, 0x71,
+	0x1b, 0xf6, 0xb7, 0xd4, 0xe7, 0x06, 0x79, 0x6f, 0x22, 0x8c, 0xff, 0x0f, 0x07, 0xdb, 0x36, 0x75,
+	0x30, 0x1c, 0x13, 0xb4, 0x27, 0x4e, 0x71, 0x4c, 0xc8, 0x48, 0x19, 0xe8, 0x67, 0x04, 0xb5, 0xf0,
+	0x01, 0xec, 0x91, 0xf7, 0x44, 0x3d, 0x35, 0xd7, 0x37, 0x78, 0x24, 0x7f, 0x0b, 0xf5, 0xd1, 0x8c,
+	0x8f, 0xb9, 0xc5, 0x99, 0xee, 0x5d, 0xfa, 0x18, 0x41, 0xe1, 0x23, 0x5b, 0xa4, 0xbf, 0x69, 0xb1,
+	0xc4, 0x2d, 0xd8, 0x99, 0x5b, 0xd3, 0x19, 0x4b, 0x2f, 0x6c, 0x22, 0xc8, 0x04, 0x76, 0xa9, 0xe5,
+	0x39, 0xec, 0xdd, 0x8c, 0x85, 0x8b, 0xd8, 0x5d, 0x5c, 0xc5, 0x88, 0x5b, 0x21, 0x3f, 0x5e, 0xfa,
+	0x2f, 0x65, 0xbc, 0x0f, 0x25, 0xe6, 0x4d, 0x84, 0x25, 0x19, 0x2c, 0xa9, 0x24, 0x7f, 0x01, 0x7b,
+	0x1b, 0x61, 0x0c, 0xc1, 0xab, 0x26, 0xe4, 0x75, 0x2d, 0x0d, 0x92, 0xd7, 0x35, 0xf9, 0x19, 0xb4,
+	0x36, 0x60, 0xea, 0xd4, 0x8f, 0xd8, 0x16, 0x4e, 0x81, 0x83, 0x0d, 0xdc, 0x31, 0x5b, 0x9c, 0x89,
+	0x84, 0x3f, 0xf9, 0x60, 0xbf, 0xe6, 0xb6, 0x62, 0x50, 0x16, 0x05, 0xbe, 0x17, 0x31, 0x4c, 0xa0,
+	0xf1, 0x91, 0x2d, 0x22, 0xc5, 0x9b, 0xc4, 0x31, 0x93, 0x37, 0x49, 0xad, 0xff, 0x24, 0x63, 0xfb,
+	0x3d, 0x7b, 0xd3, 0x75, 0x2f, 0x71, 0x5f, 0xaf, 0xac, 0xe8, 0xc4, 0x0f, 0x93, 0xad, 0x2b, 0x34,
+	0x13, 0xd3, 0xf3, 0x14, 0xb2, 0xf3, 0x7c, 0xf5, 0x02, 0x5a, 0x77, 0xfd, 0xd8, 0xc5, 0x5f, 0x61,
+	0x74, 0xfa, 0x7a, 0xa0, 0xab, 0xe8, 0x81, 0xa0, 0xa2, 0x3a, 0x34, 0xde, 0xe8, 0x1a, 0x31, 0x4c,
+	0x5d, 0x19, 0xa0, 0x5c, 0xff, 0xfd, 0xca, 0x40, 0x1a, 0xcf, 0x82, 0xc0, 0x0f, 0x39, 0xd6, 0xa0,
+	0x42, 0x99, 0xe3, 0x46, 0x9c, 0x85, 0x58, 0xba, 0x6f, 0x1c, 0xb5, 0xef, 0xb5, 0xc8, 0x0f, 0xba,
+	0xb9, 0xe7, 0xb9, 0xd7, 0x2a, 0xec, 0xfb, 0xa1, 0xd3, 0xbb, 0x5a, 0x04, 0x2c, 0x9c, 0xb2, 0x89,
+	0xc3, 0xc2, 0xd4, 0xe1, 0xe7, 0x2f, 0x1d, 0x97, 0x5f, 0xcd, 0x2e, 0x7a, 0xb6, 0x7f, 0x7d, 0xb8,
+	0x62, 0x3e, 0xbc, 0xb4, 0x2e, 0x42, 0xd7, 0x4e, 0x9e, 0x89, 0xd1, 0xa1, 0x78, 0x4f, 0x5e, 0x24,
+	0xaf, 0xcb, 0x6f, 0xfe, 0x1e, 0x00, 0xd1, 0xe6, 0xc0, 0x0d, 0x7c, 0x0a, 0x00, 0x00,
 }
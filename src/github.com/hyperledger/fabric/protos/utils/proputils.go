@@ -132,6 +132,12 @@ func GetProposal(propBytes []byte) (*peer.Proposal, error) {
 
 // CreateChaincodeProposal creates a proposal from given input
 func CreateChaincodeProposal(cis *peer.ChaincodeInvocationSpec, creator []byte) (*peer.Proposal, error) {
+	return CreateChaincodeProposalForChain("", cis, creator)
+}
+
+// CreateChaincodeProposalForChain creates a proposal from given input, bound for the given chain.
+// A proposal without chain ID is bound for the default chain
+func CreateChaincodeProposalForChain(chainID string, cis *peer.ChaincodeInvocationSpec, creator []byte) (*peer.Proposal, error) {
 	ccHdrExt := &peer.ChaincodeHeaderExtension{ChaincodeID: cis.ChaincodeSpec.ChaincodeID}
 	ccHdrExtBytes, err := proto.Marshal(ccHdrExt)
 	if err != nil {
@@ -156,6 +162,7 @@ func CreateChaincodeProposal(cis *peer.ChaincodeInvocationSpec, creator []byte)
 	}
 
 	hdr := &common.Header{ChainHeader: &common.ChainHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChainID:   []byte(chainID),
 		Extension: ccHdrExtBytes},
 		SignatureHeader: &common.SignatureHeader{Nonce: nonce,
 			Creator: creator}}
@@ -105,6 +105,26 @@ func TestProposal(t *testing.T) {
 	}
 }
 
+func TestProposalForChain(t *testing.T) {
+	prop, err := CreateChaincodeProposalForChain("chain2", createCIS(), []byte("creator"))
+	if err != nil {
+		t.Fatalf("Could not create chaincode proposal, err %s\n", err)
+	}
+	hdr, err := GetHeader(prop)
+	if err != nil {
+		t.Fatalf("Could not extract the header from the proposal, err %s\n", err)
+	}
+	if string(hdr.ChainHeader.ChainID) != "chain2" {
+		t.Fatalf("Expected the proposal to be bound for chain2, got [%s]\n", hdr.ChainHeader.ChainID)
+	}
+
+	// a proposal without chain ID is bound for the default chain
+	prop, _ = CreateChaincodeProposal(createCIS(), []byte("creator"))
+	if hdr, _ = GetHeader(prop); len(hdr.ChainHeader.ChainID) != 0 {
+		t.Fatalf("Expected no chain ID, got [%s]\n", hdr.ChainHeader.ChainID)
+	}
+}
+
 func TestProposalResponse(t *testing.T) {
 	events := &pb.ChaincodeEvent{
 		ChaincodeID: "ccid",